@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dayflower/boxnote2md/pkg/boxnote"
+)
+
+// imageRewriter rewrites the image sources of one note: with
+// --embed-images remote images are downloaded and inlined as data URIs;
+// otherwise, when writing a file, data URIs are saved into its assets
+// directory and linked instead.
+type imageRewriter struct {
+	ctx context.Context
+	// outputPath is empty when writing to stdout.
+	outputPath string
+	opts       options
+	// err is the first failure; the image keeps its source.
+	err error
+}
+
+func (r *imageRewriter) source(src string, node boxnote.Node) string {
+	if r.err != nil {
+		return src
+	}
+	var rewritten string
+	var err error
+	switch {
+	case r.opts.embedImages:
+		if !strings.HasPrefix(src, "http://") && !strings.HasPrefix(src, "https://") {
+			return src
+		}
+		rewritten, err = r.embed(src)
+	case r.outputPath != "" && strings.HasPrefix(src, "data:"):
+		rewritten, err = r.save(src, node)
+	default:
+		return src
+	}
+	if err != nil {
+		r.err = err
+		return src
+	}
+	return rewritten
+}
+
+// maxEmbeddedImage bounds the size of an image inlined by --embed-images.
+const maxEmbeddedImage = 32 << 20
+
+var imageClient = &http.Client{Timeout: 60 * time.Second}
+
+func (r *imageRewriter) embed(src string) (string, error) {
+	resp, data, err := sendWithRetry(r.ctx, imageClient, nil, r.opts.retries, maxEmbeddedImage+1, func() (*http.Request, error) {
+		return http.NewRequestWithContext(r.ctx, http.MethodGet, src, nil)
+	})
+	if err != nil {
+		return "", &exitError{code: exitIO, err: fmt.Errorf("failed to fetch image: %w", err)}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", &exitError{code: exitIO, err: fmt.Errorf("failed to fetch image %s: %s", src, resp.Status)}
+	}
+	if len(data) > maxEmbeddedImage {
+		return "", &exitError{code: exitIO, err: fmt.Errorf("image %s is larger than %d MiB", src, maxEmbeddedImage>>20)}
+	}
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || mediaType == "application/octet-stream" {
+		mediaType, _, _ = mime.ParseMediaType(http.DetectContentType(data))
+	}
+	return "data:" + mediaType + ";base64," + base64.StdEncoding.EncodeToString(data), nil
+}
+
+func (r *imageRewriter) save(src string, node boxnote.Node) (string, error) {
+	data, mediaType, err := decodeDataURI(src)
+	if err != nil {
+		return "", err
+	}
+	outputDir := filepath.Dir(r.outputPath)
+	dir := r.opts.assetsDir
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(outputDir, dir)
+	}
+	path := filepath.Join(dir, inputDigest(data)[:16]+assetExtension(mediaType))
+	if r.opts.store != nil {
+		if err := writeStored(path, data, r.opts); err != nil {
+			return "", err
+		}
+	} else if !exists(path) {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return "", &exitError{code: exitIO, err: fmt.Errorf("failed to create assets directory: %w", err)}
+		}
+		if err := writeFileAtomic(path, data, 0644, r.opts.fsync); err != nil {
+			return "", &exitError{code: exitIO, err: fmt.Errorf("failed to write asset: %w", err)}
+		}
+	}
+	r.opts.commit.add(path)
+	r.opts.assetManifest.add(path, mediaType, imageFileID(node), r.outputPath)
+	rel, err := filepath.Rel(outputDir, path)
+	if err != nil {
+		rel = path
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// decodeDataURI returns the payload and media type of a data: URI.
+func decodeDataURI(src string) ([]byte, string, error) {
+	header, payload, ok := strings.Cut(strings.TrimPrefix(src, "data:"), ",")
+	if !ok {
+		return nil, "", fmt.Errorf("malformed data URI")
+	}
+	params := strings.Split(header, ";")
+	mediaType := params[0]
+	if mediaType == "" {
+		mediaType = "text/plain"
+	}
+	if params[len(params)-1] == "base64" {
+		data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(payload), ""))
+		if err != nil {
+			return nil, "", fmt.Errorf("malformed data URI: %w", err)
+		}
+		return data, mediaType, nil
+	}
+	text, err := url.PathUnescape(payload)
+	if err != nil {
+		return nil, "", fmt.Errorf("malformed data URI: %w", err)
+	}
+	return []byte(text), mediaType, nil
+}
+
+var assetExtensions = map[string]string{
+	"image/png":     ".png",
+	"image/jpeg":    ".jpg",
+	"image/gif":     ".gif",
+	"image/webp":    ".webp",
+	"image/svg+xml": ".svg",
+}
+
+func assetExtension(mediaType string) string {
+	if ext, ok := assetExtensions[mediaType]; ok {
+		return ext
+	}
+	if exts, err := mime.ExtensionsByType(mediaType); err == nil && len(exts) > 0 {
+		return exts[0]
+	}
+	return ".bin"
+}
+
+// imageFileID returns the Box file ID an image node refers to, if any.
+func imageFileID(node boxnote.Node) string {
+	for _, key := range []string{"boxFileId", "fileId", "file_id"} {
+		switch value := node.Attrs[key].(type) {
+		case string:
+			if value != "" {
+				return value
+			}
+		case float64:
+			return strconv.FormatFloat(value, 'f', -1, 64)
+		}
+	}
+	return ""
+}
+
+// assetManifest is the JSON document written by --asset-manifest. It lists
+// every saved asset with the notes that reference it.
+type assetManifest struct {
+	mu     sync.Mutex
+	Assets []*manifestAsset `json:"assets"`
+	byPath map[string]*manifestAsset
+}
+
+type manifestAsset struct {
+	Path      string   `json:"path"`
+	MediaType string   `json:"media_type"`
+	BoxFileID string   `json:"box_file_id,omitempty"`
+	Notes     []string `json:"notes"`
+}
+
+func newAssetManifest() *assetManifest {
+	return &assetManifest{Assets: []*manifestAsset{}, byPath: map[string]*manifestAsset{}}
+}
+
+func (m *assetManifest) add(path, mediaType, fileID, note string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	path = filepath.ToSlash(path)
+	note = filepath.ToSlash(note)
+	asset, ok := m.byPath[path]
+	if !ok {
+		asset = &manifestAsset{Path: path, MediaType: mediaType, Notes: []string{}}
+		m.byPath[path] = asset
+		m.Assets = append(m.Assets, asset)
+	}
+	if asset.BoxFileID == "" {
+		asset.BoxFileID = fileID
+	}
+	if !containsString(asset.Notes, note) {
+		asset.Notes = append(asset.Notes, note)
+	}
+}
+
+func writeAssetManifest(path string, manifest *assetManifest) {
+	if manifest == nil {
+		return
+	}
+	data, err := marshalJSON(manifest)
+	if err != nil {
+		fatal(exitFailure, "failed to encode asset manifest", err)
+	}
+	if err := writeFileAtomic(path, data, 0644, false); err != nil {
+		fatal(exitIO, fmt.Sprintf("failed to write asset manifest %s", path), err)
+	}
+}
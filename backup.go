@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+const (
+	backupNone      = "none"
+	backupSimple    = "simple"
+	backupTimestamp = "timestamp"
+)
+
+// backupMode is a flag.Value restricted to the supported backup modes.
+type backupMode string
+
+func (m *backupMode) String() string {
+	return string(*m)
+}
+
+func (m *backupMode) Set(value string) error {
+	switch value {
+	case backupNone, backupSimple, backupTimestamp:
+		*m = backupMode(value)
+		return nil
+	default:
+		return fmt.Errorf("must be one of %s, %s, %s", backupNone, backupSimple, backupTimestamp)
+	}
+}
+
+// backupPath returns where an existing output is copied before it is
+// overwritten: name.md.bak, or name.md.20060102T150405.bak.
+func backupPath(path string, mode backupMode, now time.Time) string {
+	if mode == backupTimestamp {
+		return path + "." + now.Format("20060102T150405") + ".bak"
+	}
+	return path + ".bak"
+}
+
+// backupFile copies path aside according to mode. It is a no-op for
+// backupNone.
+func backupFile(path string, mode backupMode) error {
+	if mode == "" || mode == backupNone {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read for backup: %w", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to stat for backup: %w", err)
+	}
+	target := backupPath(path, mode, time.Now())
+	if err := writeFileAtomic(target, data, info.Mode().Perm(), false); err != nil {
+		return fmt.Errorf("failed to write backup %s: %w", target, err)
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+//go:build !darwin && !freebsd && !netbsd && !windows
+
+package main
+
+import (
+	"os"
+	"time"
+)
+
+// fileCreated reports that the creation time is unavailable; the stdlib
+// does not expose birth times on this platform.
+func fileCreated(info os.FileInfo) (time.Time, bool) {
+	return time.Time{}, false
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const boxAPIURL = "https://api.box.com/2.0"
+
+// boxClient is a minimal Box Content API client authenticated with the
+// access tokens of auth.
+type boxClient struct {
+	baseURL    string
+	auth       boxTokenSource
+	httpClient *http.Client
+	// pacer and retries are set with --rate and --retries.
+	pacer   *requestPacer
+	retries int
+}
+
+func newBoxClient(auth boxTokenSource) *boxClient {
+	return &boxClient{
+		baseURL:    boxAPIURL,
+		auth:       auth,
+		httpClient: &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+type boxFile struct {
+	ID          string         `json:"id"`
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	CreatedAt   time.Time      `json:"created_at"`
+	ModifiedAt  time.Time      `json:"modified_at"`
+	Size        int64          `json:"size"`
+	OwnedBy     boxUser        `json:"owned_by"`
+	SharedLink  *boxSharedLink `json:"shared_link"`
+}
+
+type boxUser struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Login string `json:"login"`
+}
+
+type boxSharedLink struct {
+	URL string `json:"url"`
+}
+
+const boxFileFields = "id,name,description,created_at,modified_at,size,owned_by,shared_link"
+
+// get requests path. A request Box rejects as unauthorized is retried once
+// with a renewed token, since a cached token can be revoked before it
+// expires.
+func (c *boxClient) get(ctx context.Context, path string) ([]byte, error) {
+	for renewed := false; ; renewed = true {
+		var token string
+		resp, body, err := sendWithRetry(ctx, c.httpClient, c.pacer, c.retries, 0, func() (*http.Request, error) {
+			var err error
+			if token, err = c.auth.token(ctx); err != nil {
+				return nil, err
+			}
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+path, nil)
+			if err != nil {
+				return nil, err
+			}
+			req.Header.Set("Authorization", "Bearer "+token)
+			return req, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusUnauthorized && !renewed && c.auth.expire(token) {
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("box API %s: %s", path, resp.Status)
+		}
+		return body, nil
+	}
+}
+
+func (c *boxClient) file(ctx context.Context, id string) (boxFile, error) {
+	var file boxFile
+	body, err := c.get(ctx, "/files/"+url.PathEscape(id)+"?fields="+boxFileFields)
+	if err != nil {
+		return file, err
+	}
+	if err := json.Unmarshal(body, &file); err != nil {
+		return file, fmt.Errorf("failed to parse file info: %w", err)
+	}
+	return file, nil
+}
+
+func (c *boxClient) download(ctx context.Context, id string) ([]byte, error) {
+	return c.get(ctx, "/files/"+url.PathEscape(id)+"/content")
+}
+
+func (c *boxClient) user(ctx context.Context, id string) (boxUser, error) {
+	var user boxUser
+	body, err := c.get(ctx, "/users/"+url.PathEscape(id)+"?fields=id,name,login")
+	if err != nil {
+		return user, err
+	}
+	if err := json.Unmarshal(body, &user); err != nil {
+		return user, fmt.Errorf("failed to parse user info: %w", err)
+	}
+	return user, nil
+}
+
+// boxItem is an entry of a folder listing: a file, a folder, or a web link.
+type boxItem struct {
+	Type string `json:"type"`
+	boxFile
+}
+
+// boxFolderPageSize is the largest page Box serves of a folder listing.
+const boxFolderPageSize = 1000
+
+// folderItems lists the items directly in the folder with id, following the
+// pages of the listing.
+func (c *boxClient) folderItems(ctx context.Context, id string) ([]boxItem, error) {
+	var items []boxItem
+	marker := ""
+	for {
+		query := url.Values{
+			"fields":    {"type," + boxFileFields},
+			"limit":     {fmt.Sprint(boxFolderPageSize)},
+			"usemarker": {"true"},
+		}
+		if marker != "" {
+			query.Set("marker", marker)
+		}
+		body, err := c.get(ctx, "/folders/"+url.PathEscape(id)+"/items?"+query.Encode())
+		if err != nil {
+			return nil, err
+		}
+		var page struct {
+			Entries    []boxItem `json:"entries"`
+			NextMarker string    `json:"next_marker"`
+		}
+		if err := json.Unmarshal(body, &page); err != nil {
+			return nil, fmt.Errorf("failed to parse folder items: %w", err)
+		}
+		items = append(items, page.Entries...)
+		if page.NextMarker == "" {
+			return items, nil
+		}
+		marker = page.NextMarker
+	}
+}
+
+// folderNote is a note found below a folder, with the path of its own
+// folder relative to it.
+type folderNote struct {
+	file boxFile
+	dir  string
+}
+
+// walkBoxFolder lists the notes below the folder with id, whose path
+// relative to the folder walked from is dir.
+func walkBoxFolder(ctx context.Context, client *boxClient, id, dir string) ([]folderNote, error) {
+	items, err := client.folderItems(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	var notes []folderNote
+	for _, item := range items {
+		switch {
+		case item.Type == "folder":
+			below, err := walkBoxFolder(ctx, client, item.ID, filepath.Join(dir, filepath.Base(item.Name)))
+			if err != nil {
+				return nil, err
+			}
+			notes = append(notes, below...)
+		case item.Type == "file" && strings.HasSuffix(strings.ToLower(item.Name), ".boxnote"):
+			notes = append(notes, folderNote{file: item.boxFile, dir: dir})
+		}
+	}
+	return notes, nil
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	boxAuthorizeURL = "https://account.box.com/api/oauth2/authorize"
+	boxTokenURL     = "https://api.box.com/oauth2/token"
+	boxRevokeURL    = "https://api.box.com/oauth2/revoke"
+)
+
+// defaultRedirectURI is where auth login listens for the OAuth redirect,
+// unless the app config names another redirect URI.
+const defaultRedirectURI = "http://localhost:8808/callback"
+
+// boxTokenSource supplies the access tokens of Box API requests.
+type boxTokenSource interface {
+	token(ctx context.Context) (string, error)
+	// expire discards token after Box rejected it, so that the next call
+	// to token gets a new one. It reports whether a new one can be had.
+	expire(token string) bool
+}
+
+// staticToken is a developer token, or another token given as is. It cannot
+// be renewed.
+type staticToken string
+
+func (t staticToken) token(ctx context.Context) (string, error) { return string(t), nil }
+
+func (t staticToken) expire(token string) bool { return false }
+
+// boxAppConfig is the app configuration given with --box-config: the JSON
+// file the Box Developer Console downloads for JWT apps, or one with only
+// the client credentials for OAuth apps.
+type boxAppConfig struct {
+	BoxAppSettings struct {
+		ClientID     string `json:"clientID"`
+		ClientSecret string `json:"clientSecret"`
+		AppAuth      struct {
+			PublicKeyID string `json:"publicKeyID"`
+			PrivateKey  string `json:"privateKey"`
+			Passphrase  string `json:"passphrase"`
+		} `json:"appAuth"`
+	} `json:"boxAppSettings"`
+	EnterpriseID string `json:"enterpriseID"`
+	// RedirectURI is the OAuth redirect URI registered for the app.
+	RedirectURI string `json:"redirectURI"`
+	// path is the file the config was read from.
+	path string
+}
+
+func loadBoxAppConfig(path string) (*boxAppConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config boxAppConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("malformed Box config %s: %w", path, err)
+	}
+	if config.BoxAppSettings.ClientID == "" || config.BoxAppSettings.ClientSecret == "" {
+		return nil, fmt.Errorf("Box config %s has no boxAppSettings.clientID and clientSecret", path)
+	}
+	config.path = path
+	return &config, nil
+}
+
+// usesJWT reports whether the app authenticates with JWT rather than
+// OAuth 2.0.
+func (c *boxAppConfig) usesJWT() bool {
+	return c.BoxAppSettings.AppAuth.PrivateKey != ""
+}
+
+const (
+	boxAuthToken = "token"
+	boxAuthOAuth = "oauth"
+	boxAuthJWT   = "jwt"
+)
+
+// boxAuth is how Box API requests of a run are authenticated.
+type boxAuth struct {
+	method string
+	config *boxAppConfig
+	// subject is the user or enterprise a JWT app acts as.
+	subject     string
+	subjectType string
+	// cachePath holds the tokens of OAuth and JWT apps between runs.
+	cachePath string
+}
+
+// resolveBoxAuth picks the authentication of a run: --token or
+// $BOX_ACCESS_TOKEN is a developer token; otherwise --box-config or
+// $BOX_CONFIG names an OAuth or JWT app.
+func resolveBoxAuth(opts options) (*boxAuth, error) {
+	token := opts.boxToken
+	if token == "" && opts.boxConfig == "" {
+		token = os.Getenv("BOX_ACCESS_TOKEN")
+	}
+	if token != "" {
+		return &boxAuth{method: boxAuthToken}, nil
+	}
+	path := opts.boxConfig
+	if path == "" {
+		path = os.Getenv("BOX_CONFIG")
+	}
+	if path == "" {
+		return nil, fmt.Errorf("Box credentials are required (--token or BOX_ACCESS_TOKEN for a developer token, --box-config or BOX_CONFIG for an app)")
+	}
+	config, err := loadBoxAppConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	auth := &boxAuth{method: boxAuthOAuth, config: config}
+	key := "oauth:" + config.BoxAppSettings.ClientID
+	if config.usesJWT() {
+		auth.method = boxAuthJWT
+		auth.subject, auth.subjectType = config.EnterpriseID, "enterprise"
+		if opts.boxUser != "" {
+			auth.subject, auth.subjectType = opts.boxUser, "user"
+		}
+		if auth.subject == "" {
+			return nil, fmt.Errorf("Box config %s has no enterpriseID (use --box-user to act as a user)", path)
+		}
+		key = "jwt:" + config.BoxAppSettings.ClientID + ":" + auth.subjectType + ":" + auth.subject
+	}
+	auth.cachePath = opts.tokenCache
+	if auth.cachePath == "" {
+		dir, err := os.UserCacheDir()
+		if err != nil {
+			return nil, fmt.Errorf("cannot locate the token cache (use --token-cache): %w", err)
+		}
+		sum := sha256.Sum256([]byte(key))
+		auth.cachePath = filepath.Join(dir, programName, "box-token-"+hex.EncodeToString(sum[:8])+".json")
+	}
+	return auth, nil
+}
+
+// tokenSource returns the source of the tokens of auth.
+func (a *boxAuth) tokenSource(opts options) boxTokenSource {
+	switch a.method {
+	case boxAuthOAuth:
+		return &cachedToken{path: a.cachePath, renew: a.refreshOAuth}
+	case boxAuthJWT:
+		return &cachedToken{path: a.cachePath, renew: a.requestJWT}
+	}
+	token := opts.boxToken
+	if token == "" {
+		token = os.Getenv("BOX_ACCESS_TOKEN")
+	}
+	return staticToken(token)
+}
+
+// newAuthenticatedBoxClient resolves the authentication of a run and
+// returns a client using it.
+func newAuthenticatedBoxClient(opts options) (*boxClient, error) {
+	auth, err := resolveBoxAuth(opts)
+	if err != nil {
+		return nil, err
+	}
+	client := newBoxClient(auth.tokenSource(opts))
+	client.pacer = newRequestPacer(opts.boxRate)
+	client.retries = opts.retries
+	return client, nil
+}
+
+// boxToken is an access token with what renews it, as cached between runs.
+type boxToken struct {
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// tokenExpiryMargin renews tokens this long before Box would reject them.
+const tokenExpiryMargin = time.Minute
+
+func (t *boxToken) valid(now time.Time) bool {
+	return t != nil && t.AccessToken != "" && now.Add(tokenExpiryMargin).Before(t.ExpiresAt)
+}
+
+// cachedToken keeps the token of an app in a cache file, renewing it when it
+// expires.
+type cachedToken struct {
+	mu      sync.Mutex
+	path    string
+	current *boxToken
+	loaded  bool
+	// renew gets a new token; previous is the cached one, or nil.
+	renew func(ctx context.Context, previous *boxToken) (*boxToken, error)
+}
+
+func (c *cachedToken) token(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.loaded {
+		c.current, _ = loadBoxToken(c.path)
+		c.loaded = true
+	}
+	if c.current.valid(time.Now()) {
+		return c.current.AccessToken, nil
+	}
+	token, err := c.renew(ctx, c.current)
+	if err != nil {
+		return "", err
+	}
+	if err := saveBoxToken(c.path, token); err != nil {
+		return "", err
+	}
+	c.current = token
+	return token.AccessToken, nil
+}
+
+func (c *cachedToken) expire(token string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.current != nil && c.current.AccessToken == token {
+		c.current.ExpiresAt = time.Time{}
+	}
+	return true
+}
+
+func loadBoxToken(path string) (*boxToken, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var token boxToken
+	if err := json.Unmarshal(data, &token); err != nil {
+		return nil, fmt.Errorf("malformed token cache %s: %w", path, err)
+	}
+	return &token, nil
+}
+
+func saveBoxToken(path string, token *boxToken) error {
+	data, err := marshalJSON(token)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create token cache directory: %w", err)
+	}
+	if err := writeFileAtomic(path, data, 0600, false); err != nil {
+		return fmt.Errorf("failed to write token cache: %w", err)
+	}
+	return nil
+}
+
+// refreshOAuth renews the token of an OAuth app with its refresh token. Box
+// replaces the refresh token too, so the cache must be saved every time.
+func (a *boxAuth) refreshOAuth(ctx context.Context, previous *boxToken) (*boxToken, error) {
+	if previous == nil || previous.RefreshToken == "" {
+		return nil, fmt.Errorf("not logged in to Box (run '%s auth login --box-config %s')", programName, a.config.path)
+	}
+	token, err := a.requestToken(ctx, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {previous.RefreshToken},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to refresh the Box token (run '%s auth login' again): %w", programName, err)
+	}
+	return token, nil
+}
+
+// requestJWT gets a token for a JWT app with a new signed assertion. JWT
+// tokens have no refresh token; each renewal signs another assertion.
+func (a *boxAuth) requestJWT(ctx context.Context, previous *boxToken) (*boxToken, error) {
+	settings := a.config.BoxAppSettings
+	key, err := parsePrivateKey([]byte(settings.AppAuth.PrivateKey), []byte(settings.AppAuth.Passphrase))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the private key of %s: %w", a.config.path, err)
+	}
+	assertion, err := signBoxAssertion(key, settings.AppAuth.PublicKeyID, settings.ClientID, a.subject, a.subjectType, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return a.requestToken(ctx, url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	})
+}
+
+// requestToken posts a grant with the app credentials to the token endpoint.
+func (a *boxAuth) requestToken(ctx context.Context, form url.Values) (*boxToken, error) {
+	form.Set("client_id", a.config.BoxAppSettings.ClientID)
+	form.Set("client_secret", a.config.BoxAppSettings.ClientSecret)
+	body, err := postBoxForm(ctx, boxTokenURL, form)
+	if err != nil {
+		return nil, err
+	}
+	var response struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresIn    int64  `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil || response.AccessToken == "" {
+		return nil, fmt.Errorf("malformed token response from Box")
+	}
+	return &boxToken{
+		AccessToken:  response.AccessToken,
+		RefreshToken: response.RefreshToken,
+		ExpiresAt:    time.Now().Add(time.Duration(response.ExpiresIn) * time.Second),
+	}, nil
+}
+
+var boxAuthClient = &http.Client{Timeout: 60 * time.Second}
+
+func postBoxForm(ctx context.Context, endpoint string, form url.Values) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := boxAuthClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var failure struct {
+			Error       string `json:"error"`
+			Description string `json:"error_description"`
+		}
+		if json.Unmarshal(body, &failure) == nil && failure.Error != "" {
+			return nil, fmt.Errorf("%s: %s (%s)", resp.Status, failure.Error, failure.Description)
+		}
+		return nil, fmt.Errorf("%s", resp.Status)
+	}
+	return body, nil
+}
+
+// randomString returns n random bytes as hex, for OAuth states and JWT IDs.
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
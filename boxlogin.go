@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	authLogin  = "login"
+	authLogout = "logout"
+	authStatus = "status"
+)
+
+var authActions = []string{authLogin, authLogout, authStatus}
+
+// runAuth manages the cached Box tokens of --box-config: login authorizes
+// an OAuth app (or gets a first token for a JWT app), logout revokes and
+// forgets the token, and status describes it.
+func runAuth(ctx context.Context, opts *options, args []string) int {
+	if len(args) != 1 || !containsString(authActions, args[0]) {
+		fmt.Fprintf(os.Stderr, "usage: %s auth [flags] <%s>\n", programName, strings.Join(authActions, "|"))
+		return exitUsage
+	}
+	auth, err := resolveBoxAuth(*opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	if auth.method == boxAuthToken {
+		fmt.Fprintln(os.Stderr, "a developer token is used as is; give --box-config to manage the tokens of an app")
+		return exitUsage
+	}
+	switch args[0] {
+	case authLogin:
+		err = auth.login(ctx)
+	case authLogout:
+		err = auth.logout(ctx)
+	default:
+		auth.printStatus()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitIO
+	}
+	return exitOK
+}
+
+func (a *boxAuth) login(ctx context.Context) error {
+	var token *boxToken
+	var err error
+	if a.method == boxAuthJWT {
+		token, err = a.requestJWT(ctx, nil)
+	} else {
+		token, err = a.authorizeOAuth(ctx)
+	}
+	if err != nil {
+		return fmt.Errorf("Box login failed: %w", err)
+	}
+	if err := saveBoxToken(a.cachePath, token); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "logged in; token cached in %s\n", a.cachePath)
+	return nil
+}
+
+func (a *boxAuth) logout(ctx context.Context) error {
+	token, err := loadBoxToken(a.cachePath)
+	if os.IsNotExist(err) {
+		fmt.Fprintln(os.Stderr, "not logged in")
+		return nil
+	}
+	if err == nil {
+		// Revoking the refresh token of an OAuth app revokes its access
+		// tokens too.
+		revoke := token.RefreshToken
+		if revoke == "" {
+			revoke = token.AccessToken
+		}
+		_, err = postBoxForm(ctx, boxRevokeURL, url.Values{
+			"client_id":     {a.config.BoxAppSettings.ClientID},
+			"client_secret": {a.config.BoxAppSettings.ClientSecret},
+			"token":         {revoke},
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to revoke the token: %v\n", err)
+		}
+	}
+	if err := os.Remove(a.cachePath); err != nil {
+		return fmt.Errorf("failed to remove token cache: %w", err)
+	}
+	fmt.Fprintln(os.Stderr, "logged out")
+	return nil
+}
+
+func (a *boxAuth) printStatus() {
+	fmt.Printf("method: %s\n", a.method)
+	if a.method == boxAuthJWT {
+		fmt.Printf("subject: %s %s\n", a.subjectType, a.subject)
+	}
+	fmt.Printf("cache: %s\n", a.cachePath)
+	token, err := loadBoxToken(a.cachePath)
+	switch {
+	case err != nil:
+		fmt.Println("token: none")
+	case token.valid(time.Now()):
+		fmt.Printf("token: valid until %s\n", token.ExpiresAt.Local().Format(time.RFC3339))
+	case token.RefreshToken != "" || a.method == boxAuthJWT:
+		fmt.Println("token: expired, renewed on the next request")
+	default:
+		fmt.Println("token: expired")
+	}
+}
+
+// authorizeOAuth runs the authorization code grant of an OAuth app. Box has
+// no device authorization endpoint, so the URL printed can be opened in a
+// browser on any device: the redirect is caught when it reaches this
+// machine, and otherwise the address the browser was sent to can be pasted
+// in.
+func (a *boxAuth) authorizeOAuth(ctx context.Context) (*boxToken, error) {
+	redirectURI := a.config.RedirectURI
+	if redirectURI == "" {
+		redirectURI = defaultRedirectURI
+	}
+	redirect, err := url.Parse(redirectURI)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redirectURI: %w", err)
+	}
+	state, err := randomString(16)
+	if err != nil {
+		return nil, err
+	}
+	authorize := boxAuthorizeURL + "?" + url.Values{
+		"response_type": {"code"},
+		"client_id":     {a.config.BoxAppSettings.ClientID},
+		"redirect_uri":  {redirectURI},
+		"state":         {state},
+	}.Encode()
+
+	type result struct {
+		code string
+		err  error
+	}
+	results := make(chan result, 2)
+	if redirect.Scheme == "http" && isLoopback(redirect.Hostname()) {
+		listener, err := net.Listen("tcp", redirect.Host)
+		if err == nil {
+			server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != redirect.Path {
+					http.NotFound(w, r)
+					return
+				}
+				code, err := authorizationCode(r.URL.Query(), state)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+				} else {
+					fmt.Fprintf(w, "%s is authorized; you can close this page.\n", programName)
+				}
+				select {
+				case results <- result{code, err}:
+				default:
+				}
+			})}
+			go server.Serve(listener)
+			defer server.Close()
+		}
+	}
+	go func() {
+		line, err := stdinReader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimSpace(line)
+		if u, err := url.Parse(line); err == nil && u.RawQuery != "" {
+			code, err := authorizationCode(u.Query(), state)
+			results <- result{code, err}
+			return
+		}
+		results <- result{line, nil}
+	}()
+
+	fmt.Fprintf(os.Stderr, "open this URL in a browser, on this or any other device, and allow access:\n\n  %s\n\n", authorize)
+	fmt.Fprintf(os.Stderr, "waiting for the redirect to %s;\nor paste the address the browser was sent to: ", redirectURI)
+	var r result
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case r = <-results:
+	}
+	fmt.Fprintln(os.Stderr)
+	if r.err != nil {
+		return nil, r.err
+	}
+	if r.code == "" {
+		return nil, errors.New("no authorization code")
+	}
+	return a.requestToken(ctx, url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {r.code},
+		"redirect_uri": {redirectURI},
+	})
+}
+
+// authorizationCode returns the code of the query of an OAuth redirect.
+func authorizationCode(query url.Values, state string) (string, error) {
+	if e := query.Get("error"); e != "" {
+		return "", fmt.Errorf("authorization denied: %s %s", e, query.Get("error_description"))
+	}
+	if query.Get("state") != state {
+		return "", errors.New("the redirect does not belong to this login (state mismatch)")
+	}
+	return query.Get("code"), nil
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
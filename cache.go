@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// cacheFileName is the per-directory record of the inputs that produced
+// each output, used by --skip-unchanged.
+const cacheFileName = ".boxnotes2md-cache.json"
+
+type conversionCache struct {
+	Entries map[string]cacheEntry `json:"entries"`
+}
+
+type cacheEntry struct {
+	InputSHA256 string `json:"input_sha256"`
+	// OptionsSHA256 is the optionsDigest the output was produced with.
+	OptionsSHA256 string `json:"options_sha256"`
+}
+
+func inputDigest(input []byte) string {
+	sum := sha256.Sum256(input)
+	return hex.EncodeToString(sum[:])
+}
+
+// uncachedFlags names the output flags that do not change what is written,
+// which optionsDigest leaves out.
+var uncachedFlags = map[string]bool{
+	"f": true, "backup": true, "fsync": true, "check-links": true, "check-external": true,
+	"asset-manifest": true, "manifest": true, "retries": true, "timeout": true,
+	"git-commit": true, "skip-unchanged": true, "strict": true, "validate": true, "version": true,
+}
+
+// fileFlags names the flags given a file, whose content optionsDigest
+// includes besides the path.
+var fileFlags = map[string]bool{
+	"link-map": true, "node-templates": true, "mark-styles": true, "authors-map": true,
+}
+
+// optionsDigest returns the SHA-256 of the converter version and the
+// effective values of the flags that change the output, so that
+// --skip-unchanged converts a note again when either changes.
+func optionsDigest(opts options) string {
+	fs := flag.NewFlagSet(programName, flag.ContinueOnError)
+	defineGlobalFlags(fs, &opts)
+	defineOutputFlags(fs, &opts)
+	h := sha256.New()
+	v, c, _ := buildInfo()
+	fmt.Fprintf(h, "%s %s\n", v, c)
+	fs.VisitAll(func(f *flag.Flag) {
+		if uncachedFlags[f.Name] {
+			return
+		}
+		value := f.Value.String()
+		fmt.Fprintf(h, "%s=%q\n", f.Name, value)
+		if fileFlags[f.Name] && value != "" {
+			fmt.Fprintf(h, "%s\n", fileDigest(value))
+		}
+	})
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func cachePathFor(outputPath string) string {
+	return filepath.Join(filepath.Dir(outputPath), cacheFileName)
+}
+
+func loadCache(path string) (conversionCache, error) {
+	cache := conversionCache{Entries: map[string]cacheEntry{}}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cache, nil
+	}
+	if err != nil {
+		return cache, err
+	}
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return conversionCache{Entries: map[string]cacheEntry{}}, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if cache.Entries == nil {
+		cache.Entries = map[string]cacheEntry{}
+	}
+	return cache, nil
+}
+
+// isUnchanged reports whether outputPath exists and was last produced from
+// an input with the given digest, with options of the given optionsDigest.
+func isUnchanged(outputPath, digest, options string) bool {
+	if !exists(outputPath) {
+		return false
+	}
+	cache, err := loadCache(cachePathFor(outputPath))
+	if err != nil {
+		return false
+	}
+	entry, ok := cache.Entries[filepath.Base(outputPath)]
+	return ok && entry.InputSHA256 == digest && entry.OptionsSHA256 == options
+}
+
+// cacheMu serializes updates of the cache files, which notes converted at
+// once may share.
+var cacheMu sync.Mutex
+
+func recordDigest(outputPath, digest, options string) error {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	path := cachePathFor(outputPath)
+	cache, err := loadCache(path)
+	if err != nil {
+		// A corrupt cache is rebuilt rather than blocking the run.
+		cache = conversionCache{Entries: map[string]cacheEntry{}}
+	}
+	cache.Entries[filepath.Base(outputPath)] = cacheEntry{InputSHA256: digest, OptionsSHA256: options}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(cache); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(path, buf.Bytes(), 0644, false); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	collisionError  = "error"
+	collisionNumber = "number"
+)
+
+var collisionChoices = []string{collisionError, collisionNumber}
+
+// outputCollision is an output path claimed by more than one input of a
+// batch.
+type outputCollision struct {
+	path string
+	// first and second name the inputs, in batch order.
+	first, second string
+}
+
+func (c outputCollision) Error() string {
+	return fmt.Sprintf("output %s would also be written for %s", c.path, c.first)
+}
+
+// planOutputs checks the output paths of a batch for collisions. Paths are
+// compared case-insensitively, since Note.md and note.md are the same file
+// on macOS and Windows. With collisionNumber, the later of two colliding
+// outputs is renamed with a numbered suffix (note-2.md, note-3.md, ...);
+// otherwise every collision is returned. names identifies the inputs for
+// the error messages; an empty path is an input whose output could not be
+// resolved and is left alone.
+func planOutputs(paths, names []string, mode string) ([]string, []outputCollision) {
+	planned := append([]string(nil), paths...)
+	owners := map[string]int{}
+	for i, path := range paths {
+		if _, taken := owners[collisionKey(path)]; path != "" && !taken {
+			owners[collisionKey(path)] = i
+		}
+	}
+	var collisions []outputCollision
+	for i, path := range paths {
+		if path == "" || owners[collisionKey(path)] == i {
+			continue
+		}
+		if mode != collisionNumber {
+			owner := names[owners[collisionKey(path)]]
+			collisions = append(collisions, outputCollision{path: path, first: owner, second: names[i]})
+			continue
+		}
+		ext := filepath.Ext(path)
+		stem := strings.TrimSuffix(path, ext)
+		for n := 2; ; n++ {
+			candidate := stem + "-" + strconv.Itoa(n) + ext
+			if _, taken := owners[collisionKey(candidate)]; !taken {
+				planned[i] = candidate
+				owners[collisionKey(candidate)] = i
+				break
+			}
+		}
+	}
+	return planned, collisions
+}
+
+func collisionKey(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	return strings.ToLower(filepath.Clean(path))
+}
@@ -0,0 +1,518 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// command describes a subcommand recognized as the first positional argument.
+type command struct {
+	name    string
+	summary string
+	usage   string
+	// fileExt is the extension offered when completing positional arguments.
+	fileExt string
+	// words are fixed positional values offered by shell completion.
+	words []string
+	flags func(fs *flag.FlagSet, opts *options)
+	run   func(ctx context.Context, opts *options, args []string) int
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{
+			name:    "convert",
+			summary: "convert Box Notes to Markdown (default)",
+			usage:   "[file.boxnote...]",
+			fileExt: ".boxnote",
+			flags:   defineConvertFlags,
+			run:     runConvert,
+		},
+		{
+			name:    "inspect",
+			summary: "print the node tree of Box Notes",
+			usage:   "[file.boxnote...]",
+			fileExt: ".boxnote",
+			flags:   defineInspectFlags,
+			run:     runInspect,
+		},
+		{
+			name:    "lint",
+			summary: "report content that would not convert cleanly",
+			usage:   "[file.boxnote...]",
+			fileExt: ".boxnote",
+			run:     runLint,
+		},
+		{
+			name:    "stats",
+			summary: "count the node types, marks, tables, and words of Box Notes",
+			usage:   "[file.boxnote|dir...]",
+			fileExt: ".boxnote",
+			flags:   defineStatsFlags,
+			run:     runStats,
+		},
+		{
+			name:    "coverage",
+			summary: "report every node type, attr, and mark of an export and how it converts",
+			usage:   "<dir|file.boxnote>...",
+			fileExt: ".boxnote",
+			flags:   defineCoverageFlags,
+			run:     runCoverage,
+		},
+		{
+			name:    "wc",
+			summary: "count the words, characters, and headings of each Box Note",
+			usage:   "[file.boxnote|dir...]",
+			fileExt: ".boxnote",
+			flags:   defineWordCountFlags,
+			run:     runWordCount,
+		},
+		{
+			name:    "diff",
+			summary: "compare the Markdown or node trees of two Box Notes",
+			usage:   "<old.boxnote> <new.boxnote>",
+			fileExt: ".boxnote",
+			flags:   defineDiffFlags,
+			run:     runDiff,
+		},
+		{
+			name:    "links",
+			summary: "list the links of Box Notes with their text and location",
+			usage:   "[file.boxnote|dir...]",
+			fileExt: ".boxnote",
+			flags:   defineLinksFlags,
+			run:     runLinks,
+		},
+		{
+			name:    "todos",
+			summary: "collect the check list items of Box Notes into one task list",
+			usage:   "[file.boxnote|dir...]",
+			fileExt: ".boxnote",
+			flags:   defineTodosFlags,
+			run:     runTodos,
+		},
+		{
+			name:    "export",
+			summary: "build an Obsidian vault, a Notion import, or a GitLab wiki from Box Notes",
+			usage:   "(--obsidian-vault|--notion|--gitlab-wiki) <dir> <dir|file.boxnote>...",
+			fileExt: ".boxnote",
+			flags:   defineExportFlags,
+			run:     runExport,
+		},
+		{
+			name:    "publish",
+			summary: "create or update Confluence pages from Box Notes",
+			usage:   "--confluence <url> --space <key> <dir|file.boxnote>...",
+			fileExt: ".boxnote",
+			flags:   definePublishFlags,
+			run:     runPublish,
+		},
+		{
+			name:    "watch",
+			summary: "convert Box Notes again whenever they change",
+			usage:   "<file.boxnote|dir>...",
+			fileExt: ".boxnote",
+			flags:   defineWatchFlags,
+			run:     runWatch,
+		},
+		{
+			name:    "serve",
+			summary: "run a long-lived conversion service over stdin and stdout or HTTP",
+			usage:   "--stdio | --http <addr>",
+			flags:   defineServeFlags,
+			run:     runServe,
+		},
+		{
+			name:    "filter",
+			summary: "convert notes as a Git clean filter, or for git diff as a textconv driver",
+			usage:   "(clean|smudge) [path] | textconv <file>",
+			fileExt: ".boxnote",
+			words:   filterModes,
+			flags:   defineOutputFlags,
+			run:     runFilter,
+		},
+		{
+			name:    "fetch",
+			summary: "download Box Notes by file ID and convert them",
+			usage:   "<file-id>...",
+			flags:   defineFetchFlags,
+			run:     runFetch,
+		},
+		{
+			name:    "list",
+			summary: "list the Box Notes below a Box folder with their IDs",
+			usage:   "--folder <id>",
+			flags:   defineListFlags,
+			run:     runList,
+		},
+		{
+			name:    "sync",
+			summary: "mirror the notes below a Box folder, converting only those changed since the last run",
+			usage:   "--folder <id> --out-dir <dir>",
+			flags:   defineSyncFlags,
+			run:     runSync,
+		},
+		{
+			name:    "auth",
+			summary: "log in to Box with an OAuth or JWT app and manage its cached token",
+			usage:   "<login|logout|status>",
+			words:   authActions,
+			flags:   defineBoxFlags,
+			run:     runAuth,
+		},
+		{
+			name:    "completion",
+			summary: "print a shell completion script (bash, zsh, fish)",
+			usage:   "<bash|zsh|fish>",
+			words:   completionShells,
+			run:     runCompletionCommand,
+		},
+		{
+			name:    "version",
+			summary: "print version and build information",
+			run:     runVersion,
+		},
+	}
+}
+
+// pathFlags lists the flags whose value is a file path, for shell completion.
+var pathFlags = map[string]bool{
+	"report":         true,
+	"out-dir":        true,
+	"authors-map":    true,
+	"link-map":       true,
+	"assets-dir":     true,
+	"asset-manifest": true,
+	"manifest":       true,
+	"box-config":     true,
+	"token-cache":    true,
+	"out":            true,
+	"state":          true,
+	"obsidian-vault": true,
+	"notion":         true,
+	"gitlab-wiki":    true,
+}
+
+// flagValues lists the accepted values of enumerated flags, for shell
+// completion.
+var flagValues = map[string][]string{
+	"backup":            {backupNone, backupSimple, backupTimestamp},
+	"flavor":            flavorChoices,
+	"bullet":            bulletChoices,
+	"escape":            escapingChoices,
+	"hard-break":        hardBreakChoices,
+	"heading-ids":       headingIDChoices,
+	"keep-unknown":      unknownChoices,
+	"table-mode":        tableModeChoices,
+	"headerless-tables": headerlessChoices,
+	"html":              rawHTMLChoices,
+	"lists":             listChoices,
+	"callouts":          calloutChoices,
+	"alignment":         alignmentChoices,
+	"indent":            indentChoices,
+	"tasks":             taskChoices,
+	"zwsp":              zwspChoices,
+	"emoji":             emojiChoices,
+	"front-matter":      frontMatterChoices,
+	"contributors":      contributorsChoices,
+	"split-by":          splitChoices,
+	"title-from":        titleFromChoices,
+	"title-mode":        titleModeChoices,
+	"eol":               eolChoices,
+	"on-collision":      collisionChoices,
+	"format":            todosFormatChoices,
+}
+
+func findCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return command{}, false
+}
+
+// Flag defaults are taken from opts so that global flags given before the
+// subcommand name survive the second round of parsing.
+
+func defineGlobalFlags(fs *flag.FlagSet, opts *options) {
+	fs.BoolVar(&opts.strict, "strict", opts.strict, "fail on unknown nodes, dropped marks, or malformed attrs")
+	fs.BoolVar(&opts.validate, "validate", opts.validate, "fail on notes that do not match the Box Notes schema")
+	fs.Var(&opts.locale, "locale", "format dates and numbers for people to read in the conventions of `tag`, such as ja-JP or de-DE, or auto for $LANG (default iso)")
+	fs.BoolVar(&opts.showVersion, "version", opts.showVersion, "print version and build information")
+}
+
+func defineOutputFlags(fs *flag.FlagSet, opts *options) {
+	fs.BoolVar(&opts.forceOverwrite, "f", opts.forceOverwrite, "overwrite output files without prompting")
+	fs.Var(&opts.backup, "backup", "copy existing outputs aside before overwriting: `mode` none, simple (name.md.bak), or timestamp")
+	fs.Var(choiceFlag{&opts.eol, eolChoices}, "eol", "line `ending` of outputs: lf or crlf")
+	fs.BoolVar(&opts.fsync, "fsync", opts.fsync, "flush each output to disk before reporting success")
+	fs.Var(&opts.nameTemplate, "name-template", "Go `template` for output file names (fields: .Title .Date .SourceDir .Index; funcs: slug lower upper trim)")
+	fs.BoolVar(&opts.slugify, "slugify", opts.slugify, "normalize output file names into slugs")
+	fs.BoolVar(&opts.slug.lowercase, "slug-lowercase", opts.slug.lowercase, "lowercase slugified file names")
+	fs.StringVar(&opts.slug.separator, "slug-separator", opts.slug.separator, "`separator` between words of slugified file names")
+	fs.IntVar(&opts.slug.maxLength, "slug-max-length", opts.slug.maxLength, "truncate slugified file names to `n` characters (0 for no limit)")
+	fs.Var(choiceFlag{&opts.markdown.flavor, flavorChoices}, "flavor", "Markdown `flavor`: gfm, commonmark, or pandoc")
+	fs.Var(choiceFlag{&opts.markdown.bullet, bulletChoices}, "bullet", "bullet list `marker`: -, *, or +")
+	fs.Var(choiceFlag{&opts.markdown.escaping, escapingChoices}, "escape", "escaping of Markdown characters in note text: `mode` marked, all, or none")
+	fs.Var(choiceFlag{&opts.markdown.hardBreak, hardBreakChoices}, "hard-break", "hard line break `style`: backslash, spaces, or html")
+	fs.Var(choiceFlag{&opts.markdown.headingIDs, headingIDChoices}, "heading-ids", "explicit heading ID `style`: none, attr ({#id}), or html (<a id>)")
+	fs.Var(choiceFlag{&opts.markdown.keepUnknown, unknownChoices}, "keep-unknown", "write unknown nodes as JSON in a `mode`: comment, fence, or skip")
+	fs.Var(choiceFlag{&opts.markdown.tableMode, tableModeChoices}, "table-mode", "table `mode`: pipe, html, or auto (html for tables a pipe table cannot represent)")
+	fs.Var(choiceFlag{&opts.markdown.headerless, headerlessChoices}, "headerless-tables", "tables without a header row: `mode` empty (add one), first-row, or html")
+	fs.Var(choiceFlag{&opts.markdown.lists, listChoices}, "lists", "list `style`: auto (loose when an item holds several blocks), tight, or loose")
+	fs.Var(choiceFlag{&opts.markdown.alignment, alignmentChoices}, "alignment", "centered, right-aligned, and justified paragraphs and headings: `mode` none (dropped), div (<div align=...>), or style (<div style=\"text-align: ...\">)")
+	fs.Var(choiceFlag{&opts.markdown.indent, indentChoices}, "indent", "indented paragraphs: `mode` none (dropped), quote (nested blockquotes), nbsp (&nbsp; per level), or spaces (em spaces per level)")
+	fs.Var(choiceFlag{&opts.markdown.tasks, taskChoices}, "tasks", "checklist items: `style` checkbox ([ ] and [x]) or obsidian (also the Obsidian Tasks [-] cancelled and [/] in progress markers)")
+	fs.BoolVar(&opts.markdown.doneDates, "task-done-dates", opts.markdown.doneDates, "append the Obsidian Tasks done date (✅ 2006-01-02) to checked items, or the last modification of the note when the item records none")
+	fs.Var(choiceFlag{&opts.markdown.callouts, calloutChoices}, "callouts", "call-out boxes: `style` quote (blockquotes), obsidian (> [!tip] callouts chosen by emoji), or alerts (GitHub/GitLab > [!NOTE])")
+	fs.Var(choiceFlag{&opts.markdown.rawHTML, rawHTMLChoices}, "html", "raw HTML in note text: `mode` allow, escape (show as text), or strip")
+	fs.BoolVar(&opts.markdown.htmlBlocks, "html-blocks", opts.markdown.htmlBlocks, "write HTML where Markdown has no syntax, e.g. <figure> for captioned images")
+	fs.Var(choiceFlag{&opts.markdown.zwsp, zwspChoices}, "zwsp", "formatted text starting or ending with Japanese punctuation: `mode` char (padded with U+200B), entity (&#8203; outside the delimiters), or html (<strong>, <em>, and <del> tags)")
+	fs.Var(choiceFlag{&opts.markdown.emoji, emojiChoices}, "emoji", "emoji in text: `form` keep (as written), unicode (also :shortcodes: as emoji), or shortcode (emoji as :shortcodes: for GitHub or Slack)")
+	fs.Var(&opts.markdown.shift, "shift-headings", "move the headings of notes `n` levels down (up when negative), or with auto, one level down when a title H1 is added")
+	fs.Var(&opts.markdown.nodes, "node-templates", "JSON `file` mapping node types to Markdown templates they are rendered with, such as {\"poll\": \"> {{inline}}\"}")
+	fs.Var(&opts.markdown.marks, "mark-styles", "JSON `file` mapping nonstandard mark types to the prefix and suffix or HTML element they are written with, such as {\"highlight\": {\"html\": \"mark\"}}")
+	fs.Var(&opts.markdown.toc, "toc", "insert a table of contents linking to the headings after the title; --toc=n includes the headings of levels 1 to n (default 3)")
+	fs.BoolVar(&opts.markdown.joinCJK, "join-cjk-lines", opts.markdown.joinCJK, "join the lines of paragraphs broken by newlines: without a space between CJK characters, with one elsewhere")
+	fs.BoolVar(&opts.markdown.ideographic, "ideographic-space-entities", opts.markdown.ideographic, "write ideographic spaces (U+3000) as &#x3000;, so that tools trimming whitespace keep the indentation of Japanese text")
+	fs.BoolVar(&opts.markdown.keepEmpty, "keep-empty-paragraphs", opts.markdown.keepEmpty, "keep empty paragraphs used as spacing, written as &nbsp; lines")
+	fs.Var(choiceFlag{&opts.titleFrom, titleFromChoices}, "title-from", "document title `source`: filename (injected as H1), first-heading (the note's own first heading), or front-matter-only (filename, front matter only)")
+	fs.Var(choiceFlag{&opts.titleMode, titleModeChoices}, "title-mode", "how the title is injected: `mode` h1, front-matter, or none")
+	fs.StringVar(&opts.title, "title", opts.title, "`title` of a note read from stdin")
+	fs.Var(choiceFlag{&opts.frontMatter, frontMatterChoices}, "front-matter", "prepend a front matter block: `format` none or yaml")
+	fs.Var(&opts.frontMatterFields, "front-matter-fields", "comma-separated front matter `fields`")
+	fs.Var(&opts.date, "date", "front matter `date` (YYYY-MM-DD or RFC 3339) instead of the file's creation time")
+	fs.Var(choiceFlag{&opts.contributors, contributorsChoices}, "contributors", "list the note's authors: `where` none, front-matter, or appendix")
+	fs.BoolVar(&opts.footer, "footer", opts.footer, "append a footer naming the source note, its Box link, the conversion date, and the converter version")
+	fs.Var(&opts.footerTemplate, "footer-template", "Go `template` of the footer, implying --footer (fields: .Title .Source .BoxID .BoxURL .Date .Generator; funcs: slug lower upper trim)")
+	fs.StringVar(&opts.authorsMap, "authors-map", opts.authorsMap, "JSON `file` mapping Box user IDs to contributor names")
+	fs.StringVar(&opts.section, "section", opts.section, "convert only the section under the top-level heading with `text`, down to the next heading of its level")
+	fs.StringVar(&opts.sectionFrom, "from", opts.sectionFrom, "convert only from the top-level heading with `text` on")
+	fs.StringVar(&opts.sectionTo, "to", opts.sectionTo, "convert only up to, not including, the top-level heading with `text`")
+	fs.StringVar(&opts.merge, "merge", opts.merge, "convert all inputs into the one `file` (- for stdout), each note under a heading with its title")
+	fs.Var(choiceFlag{&opts.splitBy, splitChoices}, "split-by", "write each section under a heading of `level` none, h1, h2, or h3 to a file of its own, in a folder named after the output, which links to them")
+	fs.BoolVar(&opts.stripHashtags, "strip-hashtags", opts.stripHashtags, "remove #tags and labels from the body (they are still listed as front matter tags)")
+	fs.BoolVar(&opts.sidecar, "sidecar", opts.sidecar, "also write name.md"+sidecarSuffix+" with the note's raw attrs, author IDs, and dropped node types")
+	fs.Var(opts.linkMap, "link-map", "JSON `file` mapping old URLs (or prefixes ending in /) to new ones")
+	fs.BoolVar(&opts.checkLinks, "check-links", opts.checkLinks, "after converting, report links that point at missing files or at Box")
+	fs.BoolVar(&opts.checkExternal, "check-external", opts.checkExternal, "with --check-links, also request every http(s) link")
+	fs.StringVar(&opts.assetsDir, "assets-dir", opts.assetsDir, "save images embedded as data URIs into `dir`, relative to each output unless absolute")
+	fs.StringVar(&opts.assetManifestPath, "asset-manifest", opts.assetManifestPath, "write a JSON `file` listing saved assets and the notes that reference them")
+	fs.StringVar(&opts.manifestPath, "manifest", opts.manifestPath, "read and update a JSON `file` mapping each converted note to its output")
+	fs.BoolVar(&opts.embedImages, "embed-images", opts.embedImages, "download remote images and inline them as data URIs")
+	fs.IntVar(&opts.retries, "retries", opts.retries, "retry failed downloads and Box API requests up to `n` times, on connection errors, 429, and 5xx")
+	fs.DurationVar(&opts.timeout, "timeout", opts.timeout, "give up on a note after `duration` (0 for no limit)")
+	fs.Var(choiceFlag{&opts.onCollision, collisionChoices}, "on-collision", "when inputs would write the same output: `mode` error (convert nothing) or number (add -2, -3, ...)")
+	fs.BoolVar(&opts.marker, "marker", opts.marker, "embed the source hash, a hash of the output flags, and the converter version in outputs as an HTML comment, and skip outputs whose comment still matches")
+	fs.BoolVar(&opts.gitCommit, "git-commit", opts.gitCommit, "after converting, stage the written files and commit them in their git repository with a summary of the run")
+	fs.BoolVar(&opts.skipUnchanged, "skip-unchanged", opts.skipUnchanged, "skip inputs whose output was produced from identical content (cached in "+cacheFileName+")")
+}
+
+func defineConvertFlags(fs *flag.FlagSet, opts *options) {
+	defineOutputFlags(fs, opts)
+	fs.StringVar(&opts.reportPath, "report", opts.reportPath, "write a JSON conversion report to `path`")
+	fs.BoolVar(&opts.recursive, "r", opts.recursive, "convert the .boxnote files below directory arguments")
+	fs.StringVar(&opts.outDir, "out-dir", opts.outDir, "write outputs into `dir` or s3://bucket/prefix, mirroring the layout below directory arguments")
+	fs.BoolVar(&opts.stream, "stream", opts.stream, "render each note block by block as it is decoded, bounding memory for huge notes")
+	fs.BoolVar(&opts.interactive, "interactive", opts.interactive, "pick the notes to convert from the given directories")
+	fs.IntVar(&opts.jobs, "j", opts.jobs, "convert `n` notes at once (0 for one per CPU)")
+	fs.Var(byteSizeFlag{&opts.maxMemory}, "max-memory", "hold back -j workers to keep the estimated memory of the notes being converted under `size` (e.g. 512M); also the garbage collector's soft limit")
+	fs.BoolVar(&opts.reverse, "reverse", opts.reverse, "turn Markdown files (.md below directories with -r) back into .boxnote files")
+}
+
+func defineExportFlags(fs *flag.FlagSet, opts *options) {
+	defineOutputFlags(fs, opts)
+	fs.StringVar(&opts.obsidianVault, "obsidian-vault", opts.obsidianVault, "build an Obsidian vault in `dir`: folders mirrored, images in attachments/, wikilinks, and callouts")
+	fs.StringVar(&opts.notionDir, "notion", opts.notionDir, "write a folder for Notion's Markdown & CSV import into `dir`: a page per folder and tables as CSV databases")
+	fs.StringVar(&opts.gitlabWiki, "gitlab-wiki", opts.gitlabWiki, "write the pages of a GitLab wiki repository into `dir`: hyphenated page paths, alerts, and a _sidebar page")
+	fs.StringVar(&opts.reportPath, "report", opts.reportPath, "write a JSON conversion report to `path`")
+}
+
+func definePublishFlags(fs *flag.FlagSet, opts *options) {
+	fs.StringVar(&opts.confluenceURL, "confluence", opts.confluenceURL, "publish to the Confluence site at `url` (e.g. https://example.atlassian.net/wiki)")
+	fs.StringVar(&opts.confluenceSpace, "space", opts.confluenceSpace, "`key` of the space the pages are published in")
+	fs.StringVar(&opts.confluenceParent, "parent", opts.confluenceParent, "create new pages below the page with `id`")
+	fs.StringVar(&opts.confluenceUser, "confluence-user", opts.confluenceUser, "account `email` for an API token (default $CONFLUENCE_USER; without it the token is a personal access token)")
+	fs.StringVar(&opts.confluenceToken, "confluence-token", opts.confluenceToken, "API `token` (default $CONFLUENCE_TOKEN)")
+	fs.BoolVar(&opts.publishDryRun, "dry-run", opts.publishDryRun, "print the storage format of each page instead of publishing")
+	fs.Var(opts.linkMap, "link-map", "JSON `file` mapping old URLs (or prefixes ending in /) to new ones")
+	fs.DurationVar(&opts.timeout, "timeout", opts.timeout, "give up on a note after `duration` (0 for no limit)")
+}
+
+func defineInspectFlags(fs *flag.FlagSet, opts *options) {
+	fs.IntVar(&opts.inspectText, "max-text", opts.inspectText, "truncate text and attribute values to `n` characters (0 for no limit)")
+	fs.BoolVar(&opts.inspectPaths, "paths", opts.inspectPaths, "start each line with the node's path, as used in warnings")
+}
+
+func defineStatsFlags(fs *flag.FlagSet, opts *options) {
+	fs.BoolVar(&opts.recursive, "r", opts.recursive, "count the .boxnote files below directory arguments")
+	fs.BoolVar(&opts.statsJSON, "json", opts.statsJSON, "print the counts as JSON")
+}
+
+func defineCoverageFlags(fs *flag.FlagSet, opts *options) {
+	fs.BoolVar(&opts.coverageJSON, "json", opts.coverageJSON, "print the entries as a JSON array")
+}
+
+func defineWordCountFlags(fs *flag.FlagSet, opts *options) {
+	fs.BoolVar(&opts.recursive, "r", opts.recursive, "count the .boxnote files below directory arguments")
+	fs.BoolVar(&opts.wcJSON, "json", opts.wcJSON, "print the counts as a JSON array")
+}
+
+func defineDiffFlags(fs *flag.FlagSet, opts *options) {
+	fs.BoolVar(&opts.diffNodes, "nodes", opts.diffNodes, "compare the node trees, as printed by inspect, instead of the Markdown")
+	fs.IntVar(&opts.diffContext, "U", opts.diffContext, "show `n` lines of context around each change")
+}
+
+func defineLinksFlags(fs *flag.FlagSet, opts *options) {
+	fs.BoolVar(&opts.recursive, "r", opts.recursive, "list the links of the .boxnote files below directory arguments")
+	fs.BoolVar(&opts.linksJSON, "json", opts.linksJSON, "print the links as a JSON array")
+}
+
+func defineTodosFlags(fs *flag.FlagSet, opts *options) {
+	fs.BoolVar(&opts.recursive, "r", opts.recursive, "collect the items of the .boxnote files below directory arguments")
+	fs.Var(choiceFlag{&opts.todosFormat, todosFormatChoices}, "format", "output `format`: markdown or csv")
+	fs.BoolVar(&opts.todosOpen, "open", opts.todosOpen, "list only the items not checked yet")
+}
+
+func defineWatchFlags(fs *flag.FlagSet, opts *options) {
+	fs.DurationVar(&opts.watchInterval, "interval", opts.watchInterval, "polling `interval` for changes")
+}
+
+// defineBoxFlags defines the flags of the commands that call the Box API.
+func defineBoxFlags(fs *flag.FlagSet, opts *options) {
+	fs.StringVar(&opts.boxToken, "token", opts.boxToken, "Box developer `token` (default $BOX_ACCESS_TOKEN)")
+	fs.StringVar(&opts.boxConfig, "box-config", opts.boxConfig, "JSON `file` with the settings of a Box OAuth or JWT app (default $BOX_CONFIG)")
+	fs.StringVar(&opts.boxUser, "box-user", opts.boxUser, "with a JWT app, act as the user with `id` instead of the service account")
+	fs.StringVar(&opts.tokenCache, "token-cache", opts.tokenCache, "cache the tokens of the app in `file` (default: in the user cache directory)")
+	fs.Float64Var(&opts.boxRate, "rate", opts.boxRate, "send at most `n` Box API requests a second (0 for no limit)")
+}
+
+func defineFetchFlags(fs *flag.FlagSet, opts *options) {
+	defineOutputFlags(fs, opts)
+	defineBoxFlags(fs, opts)
+	fs.StringVar(&opts.outDir, "out-dir", opts.outDir, "write converted notes into `dir` or s3://bucket/prefix (default: current directory)")
+}
+
+func defineListFlags(fs *flag.FlagSet, opts *options) {
+	defineBoxFlags(fs, opts)
+	fs.StringVar(&opts.syncFolder, "folder", opts.syncFolder, "Box folder `id` to list, with its subfolders (0 for the root)")
+	fs.BoolVar(&opts.listJSON, "json", opts.listJSON, "print the notes as a JSON array")
+}
+
+func defineSyncFlags(fs *flag.FlagSet, opts *options) {
+	defineOutputFlags(fs, opts)
+	defineBoxFlags(fs, opts)
+	fs.StringVar(&opts.syncFolder, "folder", opts.syncFolder, "Box folder `id` to mirror, with its subfolders (0 for the root)")
+	fs.StringVar(&opts.outDir, "out-dir", opts.outDir, "mirror the folder into `dir` (default: current directory)")
+	fs.StringVar(&opts.outDir, "out", opts.outDir, "same as --out-dir")
+	fs.StringVar(&opts.manifestPath, "state", opts.manifestPath, "keep the sync state in `file`, a --manifest (default: "+syncStateName+" in --out-dir)")
+	fs.BoolVar(&opts.syncDelete, "delete", opts.syncDelete, "remove the outputs of notes deleted, renamed, or moved in Box")
+	fs.DurationVar(&opts.syncInterval, "interval", opts.syncInterval, "sync again every `interval` until interrupted (0 to sync once)")
+}
+
+func defineServeFlags(fs *flag.FlagSet, opts *options) {
+	defineOutputFlags(fs, opts)
+	fs.BoolVar(&opts.serveStdio, "stdio", opts.serveStdio, "answer JSON-RPC requests, one per line, on stdin and stdout")
+	fs.StringVar(&opts.serveHTTP, "http", opts.serveHTTP, "serve POST /convert, /healthz, and /readyz on `addr`, such as :8080")
+	fs.Int64Var(&opts.serveMaxBody, "max-body", opts.serveMaxBody, "with --http, reject requests larger than `bytes`")
+	fs.IntVar(&opts.serveMaxConcurrent, "max-concurrent", opts.serveMaxConcurrent, "with --http, convert at most `n` requests at once (0 for no limit)")
+}
+
+func newFlagSet(cmd command, opts *options) *flag.FlagSet {
+	fs := flag.NewFlagSet(programName+" "+cmd.name, flag.ExitOnError)
+	defineGlobalFlags(fs, opts)
+	if cmd.flags != nil {
+		cmd.flags(fs, opts)
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s %s [flags] %s\n\n%s.\n\nFlags:\n", programName, cmd.name, cmd.usage, cmd.summary)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// runCLI parses global flags, dispatches to a subcommand, and returns the
+// exit status. Without a subcommand name, arguments are handled by convert.
+func runCLI(args []string) int {
+	opts := defaultOptions()
+	convert, _ := findCommand("convert")
+
+	top := flag.NewFlagSet(programName, flag.ExitOnError)
+	defineGlobalFlags(top, &opts)
+	convert.flags(top, &opts)
+	top.Usage = func() { writeUsage(top) }
+	top.Parse(args)
+	args = top.Args()
+	given := func(f *flag.Flag) { opts.givenFlags[f.Name] = true }
+	top.Visit(given)
+
+	cmd := convert
+	if len(args) > 0 {
+		if found, ok := findCommand(args[0]); ok {
+			cmd = found
+			fs := newFlagSet(cmd, &opts)
+			fs.Parse(args[1:])
+			args = fs.Args()
+			fs.Visit(given)
+		}
+	}
+
+	if opts.showVersion {
+		return runVersion(context.Background(), &opts, nil)
+	}
+	return cmd.run(context.Background(), &opts, args)
+}
+
+func writeUsage(top *flag.FlagSet) {
+	w := top.Output()
+	fmt.Fprintf(w, "Usage:\n  %s [flags] [file.boxnote...]\n  %s <command> [flags] [args...]\n\nCommands:\n", programName, programName)
+	width := 0
+	for _, cmd := range commands {
+		if len(cmd.name) > width {
+			width = len(cmd.name)
+		}
+	}
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-*s  %s\n", width, cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(w, "\nFlags:\n")
+	top.PrintDefaults()
+	fmt.Fprintf(w, "\nRun '%s <command> -h' for command-specific flags.\n", programName)
+}
+
+func runVersion(ctx context.Context, opts *options, args []string) int {
+	writeVersion(os.Stdout)
+	return exitOK
+}
+
+func runCompletionCommand(ctx context.Context, opts *options, args []string) int {
+	if err := runCompletion(os.Stdout, args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	return exitOK
+}
+
+func commandNames() []string {
+	names := make([]string, 0, len(commands))
+	for _, cmd := range commands {
+		names = append(names, cmd.name)
+	}
+	return names
+}
+
+func otherCommandNames(name string) string {
+	var names []string
+	for _, cmd := range commands {
+		if cmd.name != name {
+			names = append(names, cmd.name)
+		}
+	}
+	return strings.Join(names, " ")
+}
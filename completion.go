@@ -0,0 +1,320 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+const programName = "boxnotes2md"
+
+var completionShells = []string{"bash", "zsh", "fish"}
+
+func runCompletion(w io.Writer, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: %s completion <%s>", programName, strings.Join(completionShells, "|"))
+	}
+	switch args[0] {
+	case "bash":
+		writeBashCompletion(w)
+	case "zsh":
+		writeZshCompletion(w)
+	case "fish":
+		writeFishCompletion(w)
+	default:
+		return fmt.Errorf("unsupported shell %q (expected one of %s)", args[0], strings.Join(completionShells, ", "))
+	}
+	return nil
+}
+
+type completionFlag struct {
+	name      string
+	usage     string
+	takesArg  bool
+	takesPath bool
+	values    []string
+}
+
+// spelling returns the flag as users usually type it: -x for single-letter
+// flags and --name otherwise. The flag package accepts either form.
+func (f completionFlag) spelling() string {
+	if len(f.name) == 1 {
+		return "-" + f.name
+	}
+	return "--" + f.name
+}
+
+// completionFlags returns the flags accepted by cmd, including global flags.
+func completionFlags(cmd command) []completionFlag {
+	opts := defaultOptions()
+	fs := newFlagSet(cmd, &opts)
+
+	var flags []completionFlag
+	fs.VisitAll(func(f *flag.Flag) {
+		_, usage := flag.UnquoteUsage(f)
+		takesArg := true
+		if bf, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && bf.IsBoolFlag() {
+			takesArg = false
+		}
+		flags = append(flags, completionFlag{
+			name:      f.Name,
+			usage:     usage,
+			takesArg:  takesArg,
+			takesPath: pathFlags[f.Name],
+			values:    flagValues[f.Name],
+		})
+	})
+	sort.Slice(flags, func(i, j int) bool { return flags[i].name < flags[j].name })
+	return flags
+}
+
+func flagSpellings(flags []completionFlag) string {
+	spellings := make([]string, 0, len(flags))
+	for _, f := range flags {
+		spellings = append(spellings, f.spelling())
+	}
+	return strings.Join(spellings, " ")
+}
+
+func writeBashCompletion(w io.Writer) {
+	var pathArgs, valueArgs []string
+	var enumArgs []completionFlag
+	seen := map[string]bool{}
+	for _, cmd := range commands {
+		for _, f := range completionFlags(cmd) {
+			if !f.takesArg || seen[f.name] {
+				continue
+			}
+			seen[f.name] = true
+			forms := "-" + f.name + "|--" + f.name
+			if len(f.values) > 0 {
+				enumArgs = append(enumArgs, f)
+				continue
+			}
+			if f.takesPath {
+				pathArgs = append(pathArgs, forms)
+			} else {
+				valueArgs = append(valueArgs, forms)
+			}
+		}
+	}
+	sort.Strings(pathArgs)
+	sort.Strings(valueArgs)
+
+	fmt.Fprintf(w, "# bash completion for %s\n", programName)
+	fmt.Fprintf(w, "_%s() {\n", programName)
+	fmt.Fprintln(w, `    local cur prev cmd flags i`)
+	fmt.Fprintln(w, `    cur="${COMP_WORDS[COMP_CWORD]}"`)
+	fmt.Fprintln(w, `    prev="${COMP_WORDS[COMP_CWORD-1]}"`)
+	fmt.Fprintln(w, `    cmd=""`)
+	fmt.Fprintln(w, `    for ((i = 1; i < COMP_CWORD; i++)); do`)
+	fmt.Fprintln(w, `        case "${COMP_WORDS[i]}" in`)
+	fmt.Fprintf(w, "            %s)\n", strings.Join(commandNames(), "|"))
+	fmt.Fprintln(w, `                cmd="${COMP_WORDS[i]}"`)
+	fmt.Fprintln(w, `                break`)
+	fmt.Fprintln(w, `                ;;`)
+	fmt.Fprintln(w, `        esac`)
+	fmt.Fprintln(w, `    done`)
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, `    case "$prev" in`)
+	sort.Slice(enumArgs, func(i, j int) bool { return enumArgs[i].name < enumArgs[j].name })
+	for _, f := range enumArgs {
+		fmt.Fprintf(w, "        -%s|--%s)\n", f.name, f.name)
+		fmt.Fprintf(w, "            COMPREPLY=( $(compgen -W %q -- \"$cur\") )\n", strings.Join(f.values, " "))
+		fmt.Fprintln(w, `            return`)
+		fmt.Fprintln(w, `            ;;`)
+	}
+	if len(pathArgs) > 0 {
+		fmt.Fprintf(w, "        %s)\n", strings.Join(pathArgs, "|"))
+		fmt.Fprintln(w, `            COMPREPLY=( $(compgen -f -- "$cur") )`)
+		fmt.Fprintln(w, `            return`)
+		fmt.Fprintln(w, `            ;;`)
+	}
+	if len(valueArgs) > 0 {
+		fmt.Fprintf(w, "        %s)\n", strings.Join(valueArgs, "|"))
+		fmt.Fprintln(w, `            COMPREPLY=()`)
+		fmt.Fprintln(w, `            return`)
+		fmt.Fprintln(w, `            ;;`)
+	}
+	fmt.Fprintln(w, `    esac`)
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, `    if [[ "$cur" == -* ]]; then`)
+	fmt.Fprintln(w, `        case "$cmd" in`)
+	for _, cmd := range commands {
+		label := cmd.name
+		if cmd.name == "convert" {
+			label = `""|convert`
+		}
+		fmt.Fprintf(w, "            %s) flags=%q ;;\n", label, flagSpellings(completionFlags(cmd)))
+	}
+	fmt.Fprintln(w, `        esac`)
+	fmt.Fprintln(w, `        COMPREPLY=( $(compgen -W "$flags" -- "$cur") )`)
+	fmt.Fprintln(w, `        return`)
+	fmt.Fprintln(w, `    fi`)
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, `    case "$cmd" in`)
+	for _, cmd := range commands {
+		label := cmd.name
+		if cmd.name == "convert" {
+			label = `""|convert`
+		}
+		switch {
+		case cmd.fileExt != "":
+			fmt.Fprintf(w, "        %s)\n", label)
+			fmt.Fprintf(w, "            COMPREPLY=( $(compgen -f -X '!*%s' -- \"$cur\") $(compgen -d -- \"$cur\") )\n", cmd.fileExt)
+			fmt.Fprintln(w, `            ;;`)
+		case len(cmd.words) > 0:
+			fmt.Fprintf(w, "        %s)\n", label)
+			fmt.Fprintf(w, "            COMPREPLY=( $(compgen -W %q -- \"$cur\") )\n", strings.Join(cmd.words, " "))
+			fmt.Fprintln(w, `            ;;`)
+		}
+	}
+	fmt.Fprintln(w, `    esac`)
+	fmt.Fprintln(w, `    if [[ -z "$cmd" ]]; then`)
+	fmt.Fprintf(w, "        COMPREPLY+=( $(compgen -W %q -- \"$cur\") )\n", strings.Join(commandNames(), " "))
+	fmt.Fprintln(w, `    fi`)
+	fmt.Fprintln(w, `}`)
+	fmt.Fprintf(w, "complete -o filenames -F _%s %s\n", programName, programName)
+}
+
+func zshArgumentSpecs(cmd command) []string {
+	var specs []string
+	for _, f := range completionFlags(cmd) {
+		spec := f.spelling() + "[" + zshEscapeBrackets(f.usage) + "]"
+		if f.takesArg {
+			action := " "
+			switch {
+			case len(f.values) > 0:
+				action = "(" + strings.Join(f.values, " ") + ")"
+			case f.takesPath:
+				action = "_files"
+			}
+			spec += ":" + f.name + ":" + action
+		}
+		specs = append(specs, zshQuote(spec))
+	}
+	switch {
+	case cmd.name == "convert":
+		specs = append(specs, zshQuote("*:boxnote file:_"+programName+"_default_args"))
+	case cmd.fileExt != "":
+		specs = append(specs, zshQuote("*:file:_files -g '*"+cmd.fileExt+"(-.)'"))
+	case len(cmd.words) > 0:
+		specs = append(specs, zshQuote("1:"+cmd.name+":("+strings.Join(cmd.words, " ")+")"))
+	}
+	return specs
+}
+
+func writeZshCompletion(w io.Writer) {
+	fmt.Fprintf(w, "#compdef %s\n\n", programName)
+	fmt.Fprintf(w, "_%s_default_args() {\n", programName)
+	fmt.Fprintln(w, `  if [[ -z $cmd ]]; then`)
+	fmt.Fprintln(w, `    local -a commands`)
+	fmt.Fprintln(w, `    commands=(`)
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "      %s\n", zshQuote(cmd.name+":"+cmd.summary))
+	}
+	fmt.Fprintln(w, `    )`)
+	fmt.Fprintln(w, `    _describe -t commands 'command' commands`)
+	fmt.Fprintln(w, `  fi`)
+	fmt.Fprintln(w, `  _files -g '*.boxnote(-.)'`)
+	fmt.Fprintln(w, `}`)
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "_%s() {\n", programName)
+	fmt.Fprintln(w, `  local cmd word`)
+	fmt.Fprintln(w, `  for word in ${words[2,CURRENT-1]}; do`)
+	fmt.Fprintln(w, `    case $word in`)
+	fmt.Fprintf(w, "      (%s) cmd=$word; break ;;\n", strings.Join(commandNames(), "|"))
+	fmt.Fprintln(w, `    esac`)
+	fmt.Fprintln(w, `  done`)
+	fmt.Fprintln(w, `  case $cmd in`)
+	for _, cmd := range commands {
+		label := cmd.name
+		if cmd.name == "convert" {
+			label = "|convert"
+		}
+		fmt.Fprintf(w, "    (%s)\n", label)
+		fmt.Fprintln(w, `      _arguments -s \`)
+		specs := zshArgumentSpecs(cmd)
+		for i, spec := range specs {
+			if i == len(specs)-1 {
+				fmt.Fprintf(w, "        %s\n", spec)
+			} else {
+				fmt.Fprintf(w, "        %s \\\n", spec)
+			}
+		}
+		fmt.Fprintln(w, `      ;;`)
+	}
+	fmt.Fprintln(w, `  esac`)
+	fmt.Fprintln(w, `}`)
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "_%s \"$@\"\n", programName)
+}
+
+// fishCondition limits a completion to cmd. The convert flags also apply when
+// no subcommand is given.
+func fishCondition(cmd command) string {
+	if cmd.name == "convert" {
+		return "not __fish_seen_subcommand_from " + otherCommandNames(cmd.name)
+	}
+	return "__fish_seen_subcommand_from " + cmd.name
+}
+
+func writeFishCompletion(w io.Writer) {
+	fmt.Fprintf(w, "# fish completion for %s\n", programName)
+	fmt.Fprintf(w, "complete -c %s -f\n", programName)
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "complete -c %s -n '__fish_use_subcommand' -a %s -d %s\n", programName, cmd.name, fishQuote(cmd.summary))
+	}
+
+	global := flag.NewFlagSet(programName, flag.ContinueOnError)
+	globalOpts := defaultOptions()
+	defineGlobalFlags(global, &globalOpts)
+	for _, cmd := range commands {
+		condition := fishCondition(cmd)
+		for _, f := range completionFlags(cmd) {
+			isGlobal := global.Lookup(f.name) != nil
+			if isGlobal && cmd.name != "convert" {
+				continue
+			}
+			option := "-l " + f.name
+			if len(f.name) == 1 {
+				option = "-s " + f.name
+			}
+			extra := ""
+			if f.takesArg {
+				extra = " -x"
+				switch {
+				case len(f.values) > 0:
+					extra = " -x -a " + fishQuote(strings.Join(f.values, " "))
+				case f.takesPath:
+					extra = " -r -F"
+				}
+			}
+			scope := " -n " + fishQuote(condition)
+			if isGlobal {
+				scope = ""
+			}
+			fmt.Fprintf(w, "complete -c %s%s %s%s -d %s\n", programName, scope, option, extra, fishQuote(f.usage))
+		}
+		switch {
+		case cmd.fileExt != "":
+			fmt.Fprintf(w, "complete -c %s -n %s -a '(__fish_complete_suffix %s)'\n", programName, fishQuote(condition), cmd.fileExt)
+		case len(cmd.words) > 0:
+			fmt.Fprintf(w, "complete -c %s -n %s -a %s\n", programName, fishQuote(condition), fishQuote(strings.Join(cmd.words, " ")))
+		}
+	}
+}
+
+func zshQuote(text string) string {
+	return "'" + strings.ReplaceAll(text, "'", `'\''`) + "'"
+}
+
+func zshEscapeBrackets(text string) string {
+	return strings.NewReplacer("[", `\[`, "]", `\]`).Replace(text)
+}
+
+func fishQuote(text string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(text) + "'"
+}
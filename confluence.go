@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dayflower/boxnote2md/pkg/boxnote"
+)
+
+// confluenceClient is a minimal client of the Confluence REST API. With a
+// user it authenticates with an API token as Confluence Cloud expects, and
+// otherwise with the token as a personal access token, as Confluence Server
+// and Data Center do.
+type confluenceClient struct {
+	// baseURL is the URL of the site, including the /wiki context path of
+	// Confluence Cloud.
+	baseURL    string
+	user       string
+	token      string
+	httpClient *http.Client
+}
+
+func newConfluenceClient(baseURL, user, token string) *confluenceClient {
+	return &confluenceClient{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		user:       user,
+		token:      token,
+		httpClient: &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+// confluencePage is the part of a content object the publish command uses.
+type confluencePage struct {
+	ID      string `json:"id"`
+	Title   string `json:"title"`
+	Version struct {
+		Number int `json:"number"`
+	} `json:"version"`
+}
+
+func (c *confluenceClient) do(ctx context.Context, method, path, contentType string, body io.Reader) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if c.user != "" {
+		req.SetBasicAuth(c.user, c.token)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	req.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	// Attachment uploads are refused without it, as a CSRF protection.
+	req.Header.Set("X-Atlassian-Token", "no-check")
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("confluence API %s %s: %s", method, path, resp.Status)
+	}
+	return data, nil
+}
+
+func (c *confluenceClient) sendJSON(ctx context.Context, method, path string, payload interface{}) (confluencePage, error) {
+	var page confluencePage
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return page, err
+	}
+	data, err := c.do(ctx, method, path, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return page, err
+	}
+	if err := json.Unmarshal(data, &page); err != nil {
+		return page, fmt.Errorf("failed to parse page: %w", err)
+	}
+	return page, nil
+}
+
+// findPage looks up the page titled title in space.
+func (c *confluenceClient) findPage(ctx context.Context, space, title string) (confluencePage, bool, error) {
+	query := url.Values{"spaceKey": {space}, "title": {title}, "type": {"page"}, "expand": {"version"}}
+	data, err := c.do(ctx, http.MethodGet, "/rest/api/content?"+query.Encode(), "", nil)
+	if err != nil {
+		return confluencePage{}, false, err
+	}
+	var result struct {
+		Results []confluencePage `json:"results"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return confluencePage{}, false, fmt.Errorf("failed to parse search results: %w", err)
+	}
+	if len(result.Results) == 0 {
+		return confluencePage{}, false, nil
+	}
+	return result.Results[0], true, nil
+}
+
+func storageBody(value string) map[string]interface{} {
+	return map[string]interface{}{"storage": map[string]string{"value": value, "representation": "storage"}}
+}
+
+// createPage creates a page in space, below the page with parentID unless
+// it is empty.
+func (c *confluenceClient) createPage(ctx context.Context, space, parentID, title, body string) (confluencePage, error) {
+	payload := map[string]interface{}{
+		"type":  "page",
+		"title": title,
+		"space": map[string]string{"key": space},
+		"body":  storageBody(body),
+	}
+	if parentID != "" {
+		payload["ancestors"] = []map[string]string{{"id": parentID}}
+	}
+	return c.sendJSON(ctx, http.MethodPost, "/rest/api/content", payload)
+}
+
+// updatePage replaces the body of page with a new version.
+func (c *confluenceClient) updatePage(ctx context.Context, space string, page confluencePage, body string) (confluencePage, error) {
+	payload := map[string]interface{}{
+		"id":      page.ID,
+		"type":    "page",
+		"title":   page.Title,
+		"space":   map[string]string{"key": space},
+		"body":    storageBody(body),
+		"version": map[string]int{"number": page.Version.Number + 1},
+	}
+	return c.sendJSON(ctx, http.MethodPut, "/rest/api/content/"+url.PathEscape(page.ID), payload)
+}
+
+// uploadAttachment creates the attachment of the page with pageID, or adds
+// a version to the attachment of the same name.
+func (c *confluenceClient) uploadAttachment(ctx context.Context, pageID string, attachment storageAttachment) error {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename=%q`, attachment.name))
+	header.Set("Content-Type", attachment.mediaType)
+	part, err := w.CreatePart(header)
+	if err != nil {
+		return err
+	}
+	part.Write(attachment.data)
+	w.WriteField("minorEdit", "true")
+	if err := w.Close(); err != nil {
+		return err
+	}
+	_, err = c.do(ctx, http.MethodPut, "/rest/api/content/"+url.PathEscape(pageID)+"/child/attachment", w.FormDataContentType(), &body)
+	return err
+}
+
+// publishedNote is an input of the publish command with the title of its
+// page.
+type publishedNote struct {
+	input inputFile
+	title string
+}
+
+// runPublish converts each note to Confluence storage format and creates or
+// updates the page of the same title in the target space.
+func runPublish(ctx context.Context, opts *options, args []string) int {
+	if len(args) == 0 || opts.confluenceURL == "" || opts.confluenceSpace == "" {
+		fmt.Fprintf(os.Stderr, "usage: %s publish --confluence <url> --space <key> [flags] <dir|file.boxnote>...\n", programName)
+		return exitUsage
+	}
+	user, token := opts.confluenceUser, opts.confluenceToken
+	if user == "" {
+		user = os.Getenv("CONFLUENCE_USER")
+	}
+	if token == "" {
+		token = os.Getenv("CONFLUENCE_TOKEN")
+	}
+	if token == "" && !opts.publishDryRun {
+		fmt.Fprintln(os.Stderr, "a Confluence API token is required (--confluence-token or CONFLUENCE_TOKEN)")
+		return exitUsage
+	}
+	client := newConfluenceClient(opts.confluenceURL, user, token)
+
+	// Titles are settled first so that links between the notes can point
+	// at their pages. Confluence titles are unique within a space.
+	var notes []publishedNote
+	titles := map[string]string{}
+	owners := map[string]string{}
+	exitCode := exitOK
+	fail := func(source string, err error) {
+		reportError(source, err)
+		if exitCode == exitOK {
+			exitCode = exitFailure
+			if opts.strict {
+				exitCode = exitCodeFor(err)
+			}
+		}
+	}
+	for _, input := range collectInputs(args, true) {
+		title := titleFromPath(input.Path)
+		if owner, ok := owners[title]; ok {
+			fail(input.Path, fmt.Errorf("page title %q is already taken by %s", title, owner))
+			continue
+		}
+		owners[title] = input.Path
+		if abs, err := filepath.Abs(input.Path); err == nil {
+			titles[abs] = title
+		}
+		notes = append(notes, publishedNote{input: input, title: title})
+	}
+	for _, note := range notes {
+		if err := publishNote(ctx, client, note, titles, *opts); err != nil {
+			fail(note.input.Path, err)
+			continue
+		}
+		if !opts.publishDryRun {
+			reportOK(note.input.Path)
+		}
+	}
+	return exitCode
+}
+
+func publishNote(ctx context.Context, client *confluenceClient, note publishedNote, titles map[string]string, opts options) error {
+	input, err := os.ReadFile(note.input.Path)
+	if err != nil {
+		return &exitError{code: exitIO, err: fmt.Errorf("failed to read: %w", err)}
+	}
+	doc := &boxnote.Document{}
+	if len(strings.TrimSpace(string(input))) > 0 {
+		if doc, err = boxnote.Parse(input); err != nil {
+			return &exitError{code: exitParse, err: err}
+		}
+	}
+	if opts.validate {
+		if errs := doc.Validate(); len(errs) > 0 {
+			return &exitError{code: exitParse, err: schemaViolations(errs)}
+		}
+	}
+	r := &storageRenderer{
+		rewrite:   opts.linkMap.rewrite,
+		pageTitle: noteTitles(note.input.Path, titles),
+	}
+	body, err := r.storageFormat(doc)
+	if err != nil {
+		return err
+	}
+	if opts.publishDryRun {
+		_, err := fmt.Fprintf(os.Stdout, "<!-- %s -->\n%s\n", note.title, body)
+		return err
+	}
+
+	ctx, cancel := withTimeout(ctx, opts.timeout)
+	defer cancel()
+	page, found, err := client.findPage(ctx, opts.confluenceSpace, note.title)
+	if err != nil {
+		return &exitError{code: exitIO, err: err}
+	}
+	if found {
+		page, err = client.updatePage(ctx, opts.confluenceSpace, page, body)
+	} else {
+		page, err = client.createPage(ctx, opts.confluenceSpace, opts.confluenceParent, note.title, body)
+	}
+	if err != nil {
+		return &exitError{code: exitIO, err: err}
+	}
+	for _, attachment := range r.attachments {
+		if err := client.uploadAttachment(ctx, page.ID, attachment); err != nil {
+			return &exitError{code: exitIO, err: err}
+		}
+	}
+	return nil
+}
+
+// noteTitles resolves relative links to .boxnote files from the note at
+// source to the titles of their pages.
+func noteTitles(source string, titles map[string]string) func(string) (string, bool) {
+	return func(href string) (string, bool) {
+		for _, p := range noteLinkPaths(href, ".boxnote") {
+			if abs, err := filepath.Abs(filepath.Join(filepath.Dir(source), p)); err == nil {
+				if title, ok := titles[abs]; ok {
+					return title, true
+				}
+			}
+		}
+		return "", false
+	}
+}
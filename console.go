@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/dayflower/boxnote2md/pkg/boxnote"
+)
+
+const (
+	ansiReset  = "\x1b[0m"
+	ansiRed    = "\x1b[31m"
+	ansiGreen  = "\x1b[32m"
+	ansiYellow = "\x1b[33m"
+	ansiDim    = "\x1b[2m"
+)
+
+// labelWidth aligns the message column of every diagnostic line.
+const labelWidth = len("WARNING")
+
+var stderrColor = colorEnabled(os.Stderr)
+
+// colorEnabled reports whether ANSI colors should be written to f. Colors
+// are disabled by NO_COLOR, TERM=dumb, and when f is not a terminal.
+func colorEnabled(f *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+func colorize(text, color string) string {
+	if !stderrColor || color == "" {
+		return text
+	}
+	return color + text + ansiReset
+}
+
+func writeDiagnostic(w io.Writer, label, color, message string) {
+	padding := labelWidth - len(label)
+	if padding < 0 {
+		padding = 0
+	}
+	fmt.Fprintf(w, "%s%*s %s\n", colorize(label, color), padding, "", message)
+}
+
+func reportOK(source string) {
+	writeDiagnostic(os.Stderr, "OK", ansiGreen, source)
+}
+
+func reportSkipped(source string) {
+	writeDiagnostic(os.Stderr, "SKIP", ansiDim, source+" (unchanged)")
+}
+
+func reportRemoved(source string) {
+	writeDiagnostic(os.Stderr, "REMOVED", ansiYellow, source)
+}
+
+func reportError(source string, err error) {
+	writeDiagnostic(os.Stderr, "ERROR", ansiRed, fmt.Sprintf("%s: %v", source, err))
+}
+
+func reportBrokenLink(source, href, reason string) {
+	writeDiagnostic(os.Stderr, "BROKEN", ansiRed, fmt.Sprintf("%s: %s (%s)", source, href, reason))
+}
+
+// printUnknown reports the node and mark types that were not recognized,
+// once per type, so that lossy conversions do not go unnoticed without
+// --strict.
+func printUnknown(source string, warnings []boxnote.Warning) {
+	for _, unknown := range boxnote.SummarizeUnknown(warnings) {
+		what := "node"
+		if unknown.Kind == boxnote.WarningUnknownMark {
+			what = "mark"
+		}
+		message := fmt.Sprintf("%s: unknown %s type %q (%d occurrence(s), first at %s)", source, what, unknown.Type, unknown.Count, unknown.FirstPath)
+		writeDiagnostic(os.Stderr, "WARNING", ansiYellow, message)
+	}
+}
+
+// printSanitized summarizes the text cleaned of control characters or
+// invalid UTF-8, which is reported in full by --strict and --report.
+func printSanitized(source string, warnings []boxnote.Warning) {
+	count, first := 0, ""
+	for _, warning := range warnings {
+		if warning.Kind == boxnote.WarningSanitized {
+			if count == 0 {
+				first = warning.Path
+			}
+			count++
+		}
+	}
+	if count > 0 {
+		message := fmt.Sprintf("%s: cleaned control characters or invalid UTF-8 (%d warning(s), first at %s)", source, count, first)
+		writeDiagnostic(os.Stderr, "WARNING", ansiYellow, message)
+	}
+}
+
+func printWarnings(source string, warnings []boxnote.Warning) {
+	for _, warning := range warnings {
+		message := fmt.Sprintf("%s: %s %s", source, colorize(warning.Path+":", ansiDim), warning.Message)
+		writeDiagnostic(os.Stderr, "WARNING", ansiYellow, message)
+		if warning.Excerpt != "" {
+			fmt.Fprintf(os.Stderr, "%*s %s\n", labelWidth, "", colorize(fmt.Sprintf("near %q", warning.Excerpt), ansiDim))
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/dayflower/boxnote2md/pkg/boxnote"
+)
+
+const (
+	contributorsNone        = "none"
+	contributorsFrontMatter = "front-matter"
+	contributorsAppendix    = "appendix"
+)
+
+var contributorsChoices = []string{contributorsNone, contributorsFrontMatter, contributorsAppendix}
+
+// authorDirectory resolves the user IDs of author_id marks to names, from
+// a mapping file and, when fetching, the Box API. It is safe for
+// concurrent use.
+type authorDirectory struct {
+	mu     sync.Mutex
+	names  map[string]string
+	client *boxClient
+}
+
+// loadAuthorDirectory reads path, a JSON object mapping user IDs to names.
+// An empty path yields an empty directory.
+func loadAuthorDirectory(path string, client *boxClient) (*authorDirectory, error) {
+	dir := &authorDirectory{names: map[string]string{}, client: client}
+	if path == "" {
+		return dir, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read authors map: %w", err)
+	}
+	if err := json.Unmarshal(data, &dir.names); err != nil {
+		return nil, fmt.Errorf("failed to parse authors map %s: %w", path, err)
+	}
+	return dir, nil
+}
+
+// prepareAuthors sets up opts.authors when contributors are requested.
+func prepareAuthors(opts *options, client *boxClient) error {
+	if opts.contributors == contributorsNone {
+		return nil
+	}
+	dir, err := loadAuthorDirectory(opts.authorsMap, client)
+	if err != nil {
+		return err
+	}
+	opts.authors = dir
+	return nil
+}
+
+// resolve returns the name for id, or id itself when it cannot be resolved.
+// Names found through the Box API are remembered for later notes.
+func (d *authorDirectory) resolve(ctx context.Context, id string) string {
+	if d == nil {
+		return id
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if name, ok := d.names[id]; ok {
+		return name
+	}
+	// Without a client there is nothing to remember: serve would otherwise
+	// keep every ID a request sends.
+	if d.client == nil {
+		return id
+	}
+	name := id
+	if user, err := d.client.user(ctx, id); err == nil && user.Name != "" {
+		name = user.Name
+	}
+	d.names[id] = name
+	return name
+}
+
+// contributorNames lists the resolved authors of doc.
+func contributorNames(ctx context.Context, doc *boxnote.Document, opts options) []string {
+	var names []string
+	for _, id := range doc.AuthorIDs() {
+		names = append(names, opts.authors.resolve(ctx, id))
+	}
+	return names
+}
+
+// appendContributors adds a Contributors section listing names to output.
+func appendContributors(output string, names []string) string {
+	if len(names) == 0 {
+		return output
+	}
+	var b strings.Builder
+	b.WriteString(output)
+	if output != "" {
+		b.WriteString("\n\n")
+	}
+	b.WriteString("## Contributors\n")
+	for _, name := range names {
+		b.WriteString("\n- " + name)
+	}
+	return b.String()
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/dayflower/boxnote2md/pkg/boxnote"
+)
+
+// coverageEntry is one node type, attr, or mark type found by the coverage
+// command, with how the converter supports it.
+type coverageEntry struct {
+	// Kind is "node", "attr", "mark", or "mark attr".
+	Kind string `json:"kind"`
+	// Type is the node or mark type, "type.attr" for attrs, and
+	// "mark on type" for marks of nodes other than text.
+	Type    string          `json:"type"`
+	Support boxnote.Support `json:"support"`
+	Count   int             `json:"count"`
+	Notes   int             `json:"notes"`
+	// First locates the first occurrence as file:path.
+	First string `json:"first"`
+	// seen is the last note counted in Notes.
+	seen string
+}
+
+var coverageKinds = []string{"node", "attr", "mark", "mark attr"}
+
+var supportOrder = map[boxnote.Support]int{
+	boxnote.SupportDropped: 0,
+	boxnote.SupportPartial: 1,
+	boxnote.SupportFull:    2,
+}
+
+// coverage collects the entries of a corpus.
+type coverage struct {
+	notes   int
+	entries map[[2]string]*coverageEntry
+}
+
+func (c *coverage) record(kind, typ string, support boxnote.Support, source, path string) {
+	key := [2]string{kind, typ}
+	entry, ok := c.entries[key]
+	if !ok {
+		entry = &coverageEntry{Kind: kind, Type: typ, Support: support, First: source + ":" + path}
+		c.entries[key] = entry
+	}
+	entry.Count++
+	if entry.seen != source {
+		entry.seen = source
+		entry.Notes++
+	}
+}
+
+func (c *coverage) add(source string, doc *boxnote.Document) {
+	c.notes++
+	boxnote.Walk(doc, boxnote.Visitor{
+		Enter: func(node *boxnote.Node, path []int) boxnote.Action {
+			at := boxnote.FormatPath(path)
+			c.record("node", node.Type, boxnote.NodeSupport(node.Type), source, at)
+			for _, attr := range sortedKeys(node.Attrs) {
+				c.record("attr", node.Type+"."+attr, boxnote.AttrSupport(node.Type, attr), source, at)
+			}
+			for _, mark := range node.Marks {
+				if node.Type != "text" {
+					c.record("mark", mark.Type+" on "+node.Type, boxnote.BlockMarkSupport(node.Type, mark.Type), source, at)
+					continue
+				}
+				c.record("mark", mark.Type, boxnote.MarkSupport(mark.Type), source, at)
+				for _, attr := range sortedKeys(mark.Attrs) {
+					c.record("mark attr", mark.Type+"."+attr, boxnote.MarkAttrSupport(mark.Type, attr), source, at)
+				}
+			}
+			return boxnote.Continue
+		},
+	})
+}
+
+// sorted returns the entries from the most to the least at risk: dropped
+// before partial before full, then by kind and count.
+func (c *coverage) sorted() []coverageEntry {
+	kindOrder := map[string]int{}
+	for i, kind := range coverageKinds {
+		kindOrder[kind] = i
+	}
+	entries := make([]coverageEntry, 0, len(c.entries))
+	for _, entry := range c.entries {
+		entries = append(entries, *entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		switch {
+		case a.Support != b.Support:
+			return supportOrder[a.Support] < supportOrder[b.Support]
+		case a.Kind != b.Kind:
+			return kindOrder[a.Kind] < kindOrder[b.Kind]
+		case a.Count != b.Count:
+			return a.Count > b.Count
+		}
+		return a.Type < b.Type
+	})
+	return entries
+}
+
+func sortedKeys(attrs map[string]interface{}) []string {
+	keys := make([]string, 0, len(attrs))
+	for key := range attrs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// runCoverage scans the notes below the given directories and reports
+// every node type, attr, and mark found, with how far it is converted.
+func runCoverage(ctx context.Context, opts *options, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, "usage: %s coverage [flags] <dir|file.boxnote>...\n", programName)
+		return exitUsage
+	}
+	c := &coverage{entries: map[[2]string]*coverageEntry{}}
+	exitCode := exitOK
+	for _, input := range collectInputs(args, true) {
+		code := exitOK
+		data, err := os.ReadFile(input.Path)
+		switch {
+		case err != nil:
+			reportError(input.Path, fmt.Errorf("failed to read: %w", err))
+			code = exitIO
+		case len(strings.TrimSpace(string(data))) == 0:
+			c.notes++
+		default:
+			doc, err := boxnote.Parse(data)
+			if err != nil {
+				reportError(input.Path, err)
+				code = exitParse
+				break
+			}
+			c.add(input.Path, doc)
+		}
+		if exitCode == exitOK {
+			exitCode = code
+		}
+	}
+	entries := c.sorted()
+	if opts.coverageJSON {
+		data, err := marshalJSON(entries)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to encode coverage: %v\n", err)
+			return exitFailure
+		}
+		os.Stdout.Write(data)
+		return exitCode
+	}
+	writeCoverage(os.Stdout, c.notes, entries)
+	return exitCode
+}
+
+func writeCoverage(w io.Writer, notes int, entries []coverageEntry) {
+	rows := [][]string{{"SUPPORT", "KIND", "TYPE", "COUNT", "NOTES", "FIRST"}}
+	totals := map[boxnote.Support]int{}
+	for _, entry := range entries {
+		rows = append(rows, []string{string(entry.Support), entry.Kind, entry.Type, fmt.Sprint(entry.Count), fmt.Sprint(entry.Notes), entry.First})
+		totals[entry.Support]++
+	}
+	widths := make([]int, len(rows[0])-1)
+	for _, row := range rows {
+		for i := range widths {
+			if len(row[i]) > widths[i] {
+				widths[i] = len(row[i])
+			}
+		}
+	}
+	for _, row := range rows {
+		var b strings.Builder
+		for i, cell := range row[:len(widths)] {
+			fmt.Fprintf(&b, "%-*s  ", widths[i], cell)
+		}
+		b.WriteString(row[len(widths)])
+		fmt.Fprintln(w, b.String())
+	}
+	fmt.Fprintf(w, "\n%d note(s), %d type(s): %d full, %d partial, %d dropped\n",
+		notes, len(entries), totals[boxnote.SupportFull], totals[boxnote.SupportPartial], totals[boxnote.SupportDropped])
+}
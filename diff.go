@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/dayflower/boxnote2md/pkg/boxnote"
+)
+
+// runDiff converts two notes and prints a unified diff of their Markdown,
+// or with --nodes of their node trees. As with diff(1), the exit status is
+// exitOK when they match and exitFailure when they differ.
+func runDiff(ctx context.Context, opts *options, args []string) int {
+	if len(args) != 2 {
+		fmt.Fprintf(os.Stderr, "usage: %s diff [flags] <old.boxnote> <new.boxnote>\n", programName)
+		return exitUsage
+	}
+	if opts.diffContext < 0 {
+		fmt.Fprintln(os.Stderr, "diff context must not be negative")
+		return exitUsage
+	}
+	var sides [2][]string
+	for i, inputPath := range args {
+		lines, code := diffSide(ctx, inputPath, *opts)
+		if code != exitOK {
+			return code
+		}
+		sides[i] = lines
+	}
+	ops := diffLines(sides[0], sides[1])
+	if !hasChanges(ops) {
+		return exitOK
+	}
+	writeUnifiedDiff(os.Stdout, args[0], args[1], ops, opts.diffContext)
+	return exitFailure
+}
+
+// diffSide returns the lines to compare for one note: its Markdown, or its
+// untruncated node tree.
+func diffSide(ctx context.Context, inputPath string, opts options) ([]string, int) {
+	input, err := os.ReadFile(inputPath)
+	if err != nil {
+		reportError(inputPath, fmt.Errorf("failed to read: %w", err))
+		return nil, exitIO
+	}
+	if len(strings.TrimSpace(string(input))) == 0 {
+		return nil, exitOK
+	}
+	doc, err := boxnote.Parse(input)
+	if err != nil {
+		reportError(inputPath, err)
+		return nil, exitParse
+	}
+	if opts.diffNodes {
+		var buf bytes.Buffer
+		opts.inspectText, opts.inspectPaths = 0, false
+		writeNodeTree(&buf, doc, opts)
+		return splitLines(buf.String()), exitOK
+	}
+	output, _, err := doc.MarkdownContext(ctx)
+	if err != nil {
+		reportError(inputPath, err)
+		return nil, exitParse
+	}
+	return splitLines(finishOutput(output, eolLF)), exitOK
+}
+
+func splitLines(text string) []string {
+	text = strings.TrimSuffix(text, "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+// diffLine is a line of a diff: kept (' '), removed ('-'), or added ('+').
+type diffLine struct {
+	kind byte
+	text string
+}
+
+// maxDiffEdits bounds the edit distance diffLines searches for, and with
+// it the memory of the search. Inputs further apart are diffed as the
+// removal of one and the addition of the other.
+const maxDiffEdits = 2000
+
+// diffLines computes a shortest edit script from a to b with Myers'
+// algorithm, after setting aside the lines they start and end with alike.
+func diffLines(a, b []string) []diffLine {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	var ops []diffLine
+	for _, line := range a[:prefix] {
+		ops = append(ops, diffLine{' ', line})
+	}
+	ops = append(ops, myersDiff(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, diffLine{' ', line})
+	}
+	return ops
+}
+
+func myersDiff(a, b []string) []diffLine {
+	n, m := len(a), len(b)
+	offset := n + m + 1
+	v := make([]int, 2*offset+1)
+	// trace holds, for each edit count d, the furthest x reached on the
+	// diagonals -d..d before step d.
+	var trace [][]int
+	for d := 0; d <= n+m && d <= maxDiffEdits; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || k != d && v[offset+k-1] < v[offset+k+1] {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrackDiff(a, b, trace)
+			}
+		}
+	}
+	ops := make([]diffLine, 0, n+m)
+	for _, line := range a {
+		ops = append(ops, diffLine{'-', line})
+	}
+	for _, line := range b {
+		ops = append(ops, diffLine{'+', line})
+	}
+	return ops
+}
+
+// backtrackDiff follows the snapshots of myersDiff from the end of both
+// inputs back to their start.
+func backtrackDiff(a, b []string, trace [][]int) []diffLine {
+	var ops []diffLine
+	x, y := len(a), len(b)
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || k != d && v[d+k-1] < v[d+k+1] {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := 0
+		if d > 0 {
+			prevX = v[d+prevK]
+		}
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			ops = append(ops, diffLine{' ', a[x]})
+		}
+		if d == 0 {
+			break
+		}
+		if x == prevX {
+			y--
+			ops = append(ops, diffLine{'+', b[y]})
+		} else {
+			x--
+			ops = append(ops, diffLine{'-', a[x]})
+		}
+	}
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+func hasChanges(ops []diffLine) bool {
+	for _, op := range ops {
+		if op.kind != ' ' {
+			return true
+		}
+	}
+	return false
+}
+
+// writeUnifiedDiff prints ops as a unified diff, with context unchanged
+// lines around each change. Changes closer than twice the context share a
+// hunk.
+func writeUnifiedDiff(w io.Writer, oldName, newName string, ops []diffLine, context int) {
+	// oldPos and newPos are the line indexes each op starts at.
+	oldPos := make([]int, len(ops)+1)
+	newPos := make([]int, len(ops)+1)
+	for i, op := range ops {
+		oldPos[i+1], newPos[i+1] = oldPos[i], newPos[i]
+		if op.kind != '+' {
+			oldPos[i+1]++
+		}
+		if op.kind != '-' {
+			newPos[i+1]++
+		}
+	}
+	fmt.Fprintf(w, "--- %s\n+++ %s\n", oldName, newName)
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+		last := i
+		for j := i + 1; j < len(ops); j++ {
+			if ops[j].kind != ' ' {
+				last = j
+			} else if j-last > 2*context {
+				break
+			}
+		}
+		end := last + context + 1
+		if end > len(ops) {
+			end = len(ops)
+		}
+		fmt.Fprintf(w, "@@ -%s +%s @@\n", hunkRange(oldPos[start], oldPos[end]), hunkRange(newPos[start], newPos[end]))
+		for _, op := range ops[start:end] {
+			fmt.Fprintf(w, "%c%s\n", op.kind, op.text)
+		}
+		i = end
+	}
+}
+
+// hunkRange formats the lines [start, end) of one side of a hunk. An empty
+// range names the line before it, as diff(1) does.
+func hunkRange(start, end int) string {
+	switch end - start {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, end-start)
+}
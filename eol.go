@@ -0,0 +1,25 @@
+package main
+
+import "strings"
+
+const (
+	eolLF   = "lf"
+	eolCRLF = "crlf"
+)
+
+var eolChoices = []string{eolLF, eolCRLF}
+
+// finishOutput ends a non-empty output with exactly one newline and writes
+// its line endings in the --eol style.
+func finishOutput(output, eol string) string {
+	output = strings.ReplaceAll(output, "\r\n", "\n")
+	output = strings.TrimRight(output, "\n")
+	if output == "" {
+		return ""
+	}
+	output += "\n"
+	if eol == eolCRLF {
+		output = strings.ReplaceAll(output, "\n", "\r\n")
+	}
+	return output
+}
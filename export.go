@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/dayflower/boxnote2md/pkg/boxnote"
+)
+
+// Formats of the export command.
+const (
+	exportObsidian = "obsidian"
+	exportNotion   = "notion"
+	exportGitLab   = "gitlab"
+)
+
+// exportTree records where the notes of an export are written, so that links
+// between them can follow the notes into the tree.
+type exportTree struct {
+	format string
+	dir    string
+	// notes maps the absolute paths of the inputs, and of their outputs, to
+	// the outputs.
+	notes map[string]string
+}
+
+// runExport converts the notes below the given directories into a tree
+// that a note-taking app opens or imports as is.
+func runExport(ctx context.Context, opts *options, args []string) int {
+	var format, dir string
+	targets := 0
+	for _, target := range [][2]string{
+		{exportObsidian, opts.obsidianVault},
+		{exportNotion, opts.notionDir},
+		{exportGitLab, opts.gitlabWiki},
+	} {
+		if target[1] != "" {
+			format, dir = target[0], target[1]
+			targets++
+		}
+	}
+	if len(args) == 0 || targets != 1 {
+		fmt.Fprintf(os.Stderr, "usage: %s export (--obsidian-vault|--notion|--gitlab-wiki) <dir> [flags] <dir|file.boxnote>...\n", programName)
+		return exitUsage
+	}
+	if opts.stream {
+		fmt.Fprintln(os.Stderr, "--stream cannot be combined with export")
+		return exitUsage
+	}
+	if opts.splitBy != splitNone {
+		fmt.Fprintln(os.Stderr, "--split-by cannot be combined with export")
+		return exitUsage
+	}
+	if err := prepareAuthors(opts, nil); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitIO
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to resolve %s: %v\n", dir, err)
+		return exitIO
+	}
+	opts.outDir = dir
+	opts.export = &exportTree{format: format, dir: dir, notes: map[string]string{}}
+	var report *conversionReport
+	if opts.reportPath != "" {
+		report = &conversionReport{}
+	}
+	inputs := collectInputs(args, true)
+	opts.commit = newMigrationCommit(*opts)
+	switch format {
+	case exportObsidian:
+		applyObsidianDefaults(opts, dir)
+		if err := writeVaultConfig(dir, *opts); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitIO
+		}
+	case exportGitLab:
+		applyGitLabDefaults(opts, dir)
+	}
+	exitCode := convertInputs(ctx, opts, inputs, report)
+	code := exitOK
+	switch format {
+	case exportNotion:
+		code = writeNotionIndexes(opts)
+	case exportGitLab:
+		code = writeGitLabSidebar(opts)
+	}
+	if exitCode == exitOK {
+		exitCode = code
+	}
+	return commitOutputs(opts, exitCode)
+}
+
+// safePath adjusts a planned output path to the names the format accepts.
+func (t *exportTree) safePath(outputPath string) string {
+	switch t.format {
+	case exportObsidian:
+		return obsidianSafePath(t.dir, outputPath)
+	case exportGitLab:
+		return gitLabSafePath(t.dir, outputPath)
+	}
+	return outputPath
+}
+
+// add records the planned output of each input.
+func (t *exportTree) add(inputs []inputFile, planned []string) {
+	if t == nil {
+		return
+	}
+	for i, input := range inputs {
+		if planned[i] == "" {
+			continue
+		}
+		for _, p := range []string{input.Path, planned[i]} {
+			if abs, err := filepath.Abs(p); err == nil {
+				t.notes[abs] = planned[i]
+			}
+		}
+	}
+}
+
+// noteLinkPaths returns the paths of the note files that a relative href
+// may link to, with one of exts. A # that is part of a file name, as in an
+// unencoded link to "Plan #1.boxnote", is tried as such before the
+// fragment.
+func noteLinkPaths(href string, exts ...string) []string {
+	u, err := url.Parse(href)
+	if err != nil || u.Scheme != "" || u.Host != "" {
+		return nil
+	}
+	var candidates []string
+	if u.Fragment != "" {
+		if p, err := url.PathUnescape(href); err == nil {
+			candidates = append(candidates, p)
+		}
+	}
+	var paths []string
+	for _, p := range append(candidates, u.Path) {
+		if containsString(exts, path.Ext(p)) {
+			paths = append(paths, filepath.FromSlash(p))
+		}
+	}
+	return paths
+}
+
+// resolve returns the output of the note of the export that href links to.
+// A relative link to a .boxnote or .md file, as written in the note or
+// produced by --link-map, resolves against the linking note's source, its
+// output, and the export root.
+func (t *exportTree) resolve(meta *noteMeta, href string) (string, bool) {
+	bases := []string{filepath.Dir(meta.source), filepath.Dir(meta.outputPath), t.dir}
+	for _, p := range noteLinkPaths(href, ".boxnote", ".md") {
+		for _, base := range bases {
+			abs, err := filepath.Abs(filepath.Join(base, p))
+			if err != nil {
+				continue
+			}
+			if output, ok := t.notes[abs]; ok {
+				return output, true
+			}
+		}
+	}
+	return "", false
+}
+
+// prepare adapts the document of the note written to meta.outputPath
+// before it is rendered.
+func (t *exportTree) prepare(doc *boxnote.Document, meta *noteMeta, opts options) error {
+	if t.format == exportNotion {
+		return splitNotionTables(doc, meta.outputPath, opts)
+	}
+	return nil
+}
+
+// noteOptions adjusts the conversion of the note written to
+// meta.outputPath: the format's assets directory, links between the notes
+// of the export, and the options only the format uses.
+func (t *exportTree) noteOptions(meta *noteMeta, opts *options, rewrite func(string) string) (func(string) string, []boxnote.ConvertOption) {
+	switch t.format {
+	case exportNotion:
+		if !opts.givenFlags["assets-dir"] {
+			opts.assetsDir = notionPageDir(meta.outputPath)
+		}
+		return notionLinks(t, meta, rewrite), nil
+	case exportGitLab:
+		return gitLabLinks(t, meta, rewrite), nil
+	}
+	return rewrite, []boxnote.ConvertOption{boxnote.WithWikiLinks(func(href string) (string, bool) {
+		output, ok := t.resolve(meta, href)
+		if !ok {
+			return "", false
+		}
+		return vaultPageName(t.dir, output), true
+	})}
+}
+
+// writeGeneratedPage writes a page the export adds to the converted notes,
+// such as an index, asking before overwriting as for the notes.
+func writeGeneratedPage(path, content string, opts options) error {
+	if err := prepareOverwrite(path, opts); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(path, []byte(finishOutput(content, opts.eol)), 0644, opts.fsync); err != nil {
+		return &exitError{code: exitIO, err: fmt.Errorf("failed to write: %w", err)}
+	}
+	opts.commit.add(path)
+	return nil
+}
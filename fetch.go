@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// runFetch downloads each Box Note by file ID and converts it into
+// opts.outDir, named after the note.
+func runFetch(ctx context.Context, opts *options, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, "usage: %s fetch [flags] <file-id>...\n", programName)
+		return exitUsage
+	}
+	client, err := newAuthenticatedBoxClient(*opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	if err := openStore(opts); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	if err := prepareAuthors(opts, client); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitIO
+	}
+
+	opts.commit = newMigrationCommit(*opts)
+	if opts.assetManifestPath != "" {
+		opts.assetManifest = newAssetManifest()
+	}
+	if opts.checkLinks {
+		opts.linkCheck = newLinkChecker(opts.checkExternal)
+	}
+	// Look up every note first so that links between them can be rewritten
+	// to the outputs.
+	type fetched struct {
+		id         string
+		file       boxFile
+		outputPath string
+	}
+	var notes []fetched
+	opts.noteLinks = newNoteLinks()
+	if err := prepareManifest(opts); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to read manifest: %v\n", err)
+		return exitIO
+	}
+	exitCode := exitOK
+	fail := func(id string, err error) {
+		reportError(id, err)
+		if exitCode == exitOK {
+			exitCode = exitFailure
+			if opts.strict {
+				exitCode = exitCodeFor(err)
+			}
+		}
+	}
+	for i, id := range args {
+		file, outputPath, err := fetchInfo(ctx, client, id, i+1, *opts)
+		if err != nil {
+			fail(id, err)
+			continue
+		}
+		notes = append(notes, fetched{id: id, file: file, outputPath: outputPath})
+	}
+	paths := make([]string, len(notes))
+	names := make([]string, len(notes))
+	for i, note := range notes {
+		paths[i], names[i] = note.outputPath, note.id
+	}
+	planned, collisions := planOutputs(paths, names, opts.onCollision)
+	for _, collision := range collisions {
+		reportError(collision.second, collision)
+	}
+	if len(collisions) > 0 {
+		fmt.Fprintf(os.Stderr, "%d output collision(s); use --on-collision %s\n", len(collisions), collisionNumber)
+		return exitFailure
+	}
+	for i := range notes {
+		notes[i].outputPath = planned[i]
+		opts.noteLinks.add(notes[i].file, planned[i])
+	}
+	for _, note := range notes {
+		result, err := fetchNote(ctx, client, note.file, note.outputPath, *opts)
+		if err != nil {
+			fail(note.id, err)
+			continue
+		}
+		if result.Skipped {
+			reportSkipped(note.id)
+			continue
+		}
+		reportOK(note.id)
+	}
+	writeAssetManifest(opts.assetManifestPath, opts.assetManifest)
+	writeManifest(opts.manifestPath, opts.manifest)
+	return commitOutputs(opts, checkLinks(ctx, opts, exitCode))
+}
+
+// fetchInfo looks up the note with id and resolves its output path.
+func fetchInfo(ctx context.Context, client *boxClient, id string, index int, opts options) (boxFile, string, error) {
+	infoCtx, cancel := withTimeout(ctx, opts.timeout)
+	defer cancel()
+	file, err := client.file(infoCtx, id)
+	if err != nil {
+		return file, "", &exitError{code: exitIO, err: err}
+	}
+	name := filepath.Base(file.Name)
+	target := filepath.Join(opts.outDir, name)
+	outputPath, err := resolveOutputPath(target, newNameFields(target, file.ModifiedAt, index), opts)
+	if err != nil {
+		return file, "", err
+	}
+	return file, outputPath, nil
+}
+
+func fetchNote(ctx context.Context, client *boxClient, file boxFile, outputPath string, opts options) (fileResult, error) {
+	downloadCtx, cancel := withTimeout(ctx, opts.timeout)
+	defer cancel()
+	input, err := client.download(downloadCtx, file.ID)
+	if err != nil {
+		return fileResult{}, &exitError{code: exitIO, err: err}
+	}
+	return convertToFile(ctx, input, boxNoteMeta(file), outputPath, opts)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/dayflower/boxnote2md/pkg/boxnote"
+)
+
+// Modes of the filter command, named after the Git attributes that run
+// them.
+const (
+	filterClean    = "clean"
+	filterSmudge   = "smudge"
+	filterTextconv = "textconv"
+)
+
+var filterModes = []string{filterClean, filterSmudge, filterTextconv}
+
+// runFilter converts a note for Git: clean turns the Box Note on stdin into
+// the Markdown that is committed, smudge checks content out unchanged, and
+// textconv prints the Markdown of the file named for git diff and log.
+func runFilter(ctx context.Context, opts *options, args []string) int {
+	if len(args) == 0 || len(args) > 2 || !containsString(filterModes, args[0]) || (args[0] == filterTextconv && len(args) != 2) {
+		fmt.Fprintf(os.Stderr, "usage: %s filter (clean|smudge) [path] | textconv <file>\n", programName)
+		return exitUsage
+	}
+	mode, path := args[0], ""
+	if len(args) == 2 {
+		path = args[1]
+	}
+	if path != "" && opts.title == "" {
+		opts.title = titleFromPath(path)
+	}
+	if err := prepareAuthors(opts, nil); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitIO
+	}
+
+	var input []byte
+	var err error
+	switch mode {
+	case filterSmudge:
+		if _, err := io.Copy(os.Stdout, stdinReader); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to copy stdin: %v\n", err)
+			return exitIO
+		}
+		return exitOK
+	case filterClean:
+		input, err = io.ReadAll(stdinReader)
+	default:
+		input, err = os.ReadFile(path)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to read: %v\n", err)
+		return exitIO
+	}
+	source := path
+	if source == "" {
+		source = stdinName
+	}
+	output, err := filterNote(ctx, input, source, *opts)
+	if err != nil {
+		reportError(source, err)
+		return exitCodeFor(err)
+	}
+	if _, err := io.WriteString(os.Stdout, output); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write stdout: %v\n", err)
+		return exitIO
+	}
+	return exitOK
+}
+
+// filterNote returns the Markdown of input. Content that is not a JSON
+// object, such as Markdown a checkout left in place of the note, is
+// returned as is: Git expects running a clean filter twice to change
+// nothing. The object may follow a byte order mark or be UTF-16, as for
+// the other commands.
+func filterNote(ctx context.Context, input []byte, source string, opts options) (string, error) {
+	decoded, err := boxnote.DecodeText(input)
+	if err != nil {
+		return string(input), nil
+	}
+	trimmed := bytes.TrimSpace(decoded)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return string(input), nil
+	}
+	output, warnings, err := convertDocument(ctx, input, opts)
+	if err != nil {
+		return "", err
+	}
+	printUnknown(source, warnings)
+	printSanitized(source, warnings)
+	return output, nil
+}
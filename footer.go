@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// defaultFooter is the --footer template used without --footer-template.
+const defaultFooter = `---
+
+Converted{{with .Source}} from {{if $.BoxURL}}[{{.}}]({{$.BoxURL}}){{else}}{{.}}{{end}}{{end}}` +
+	`{{with .BoxID}} (Box file {{.}}){{end}} on {{.Date}} by {{.Generator}}.`
+
+// boxNoteURL is where a note fetched from Box is opened, when it has no
+// shared link.
+const boxNoteURL = "https://app.box.com/notes/"
+
+// footerFields are the values available to --footer-template.
+type footerFields struct {
+	// Title is the title of the note, empty for stdin without --title.
+	Title string
+	// Source is the file name of the input, or the note name when fetched.
+	Source string
+	// BoxID is the Box file ID of a fetched note.
+	BoxID string
+	// BoxURL is the shared link of a fetched note, or else its Box URL.
+	BoxURL string
+	// Date is the date of the conversion, as --locale writes it.
+	Date string
+	// Generator is the program name and version.
+	Generator string
+}
+
+func newFooterFields(meta noteMeta, opts options, now time.Time) footerFields {
+	v, _, _ := buildInfo()
+	fields := footerFields{
+		Title:     meta.title,
+		BoxID:     meta.boxID,
+		BoxURL:    meta.sharedLink,
+		Date:      now.Format(opts.locale.dateLayout()),
+		Generator: programName + " " + v,
+	}
+	if meta.source != "" {
+		fields.Source = filepath.Base(meta.source)
+	}
+	if fields.BoxURL == "" && meta.boxID != "" {
+		fields.BoxURL = boxNoteURL + meta.boxID
+	}
+	return fields
+}
+
+// footerTemplate is a flag.Value holding a parsed --footer-template.
+type footerTemplate struct {
+	text string
+	tmpl *template.Template
+}
+
+func (t *footerTemplate) String() string {
+	return t.text
+}
+
+func (t *footerTemplate) Set(value string) error {
+	tmpl, err := template.New("footer").Funcs(nameTemplateFuncs).Option("missingkey=error").Parse(value)
+	if err != nil {
+		return err
+	}
+	// Unknown fields are only found by executing the template.
+	if err := tmpl.Execute(io.Discard, footerFields{}); err != nil {
+		return err
+	}
+	t.text = value
+	t.tmpl = tmpl
+	return nil
+}
+
+var defaultFooterTemplate = template.Must(template.New("footer").Parse(defaultFooter))
+
+// renderFooter returns the footer of the note described by meta, or "" when
+// no footer is asked for. --footer-template implies --footer.
+func renderFooter(meta noteMeta, opts options) (string, error) {
+	tmpl := opts.footerTemplate.tmpl
+	if tmpl == nil {
+		if !opts.footer {
+			return "", nil
+		}
+		tmpl = defaultFooterTemplate
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, newFooterFields(meta, opts, time.Now())); err != nil {
+		return "", fmt.Errorf("failed to apply footer template: %w", err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// appendFooter appends the footer of the note described by meta to output.
+func appendFooter(output string, meta noteMeta, opts options) (string, error) {
+	footer, err := renderFooter(meta, opts)
+	if err != nil || footer == "" {
+		return output, err
+	}
+	if output == "" {
+		return footer, nil
+	}
+	return output + "\n\n" + footer, nil
+}
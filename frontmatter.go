@@ -0,0 +1,294 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	frontMatterNone = "none"
+	frontMatterYAML = "yaml"
+)
+
+var frontMatterChoices = []string{frontMatterNone, frontMatterYAML}
+
+// frontMatterFieldNames lists the fields --front-matter-fields accepts, in
+// the order they are written.
+var frontMatterFieldNames = []string{
+	"title", "aliases", "date", "lastmod", "description", "owner", "contributors", "tags", "words", "reading_time",
+	"shared_link", "box_id", "source", "converted", "generator",
+}
+
+// defaultFrontMatterFields are the fields written without
+// --front-matter-fields: all but aliases and the text counts.
+var defaultFrontMatterFields = []string{
+	"title", "date", "lastmod", "description", "owner", "contributors", "tags", "shared_link", "box_id",
+	"source", "converted", "generator",
+}
+
+// fieldList is a flag.Value holding a comma-separated subset of
+// frontMatterFieldNames.
+type fieldList []string
+
+func (l *fieldList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *fieldList) Set(value string) error {
+	var fields []string
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if !containsString(frontMatterFieldNames, field) {
+			return fmt.Errorf("unknown field %q (valid: %s)", field, strings.Join(frontMatterFieldNames, ", "))
+		}
+		fields = append(fields, field)
+	}
+	*l = fields
+	return nil
+}
+
+func (l fieldList) has(field string) bool {
+	return containsString(l, field)
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// dateValue is a flag.Value accepting YYYY-MM-DD or RFC 3339 timestamps.
+type dateValue struct {
+	time time.Time
+}
+
+func (d *dateValue) String() string {
+	if d.time.IsZero() {
+		return ""
+	}
+	return d.time.Format(time.RFC3339)
+}
+
+func (d *dateValue) Set(value string) error {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			d.time = t
+			return nil
+		}
+	}
+	return fmt.Errorf("want YYYY-MM-DD or an RFC 3339 timestamp")
+}
+
+// metaField is one key of a front matter block. value is a string, int,
+// time.Time, or []string.
+type metaField struct {
+	key   string
+	value interface{}
+}
+
+// frontMatter is an ordered set of front matter fields.
+type frontMatter []metaField
+
+// set adds key, or replaces its value if it is already present. Empty
+// values are left out.
+func (m *frontMatter) set(key string, value interface{}) {
+	switch v := value.(type) {
+	case string:
+		if v == "" {
+			return
+		}
+	case time.Time:
+		if v.IsZero() {
+			return
+		}
+	case []string:
+		if len(v) == 0 {
+			return
+		}
+	}
+	for i := range *m {
+		if (*m)[i].key == key {
+			(*m)[i].value = value
+			return
+		}
+	}
+	*m = append(*m, metaField{key: key, value: value})
+}
+
+// yaml renders the block between --- fences, followed by a blank line.
+func (m frontMatter) yaml() string {
+	var b strings.Builder
+	b.WriteString("---\n")
+	for _, field := range m {
+		switch v := field.value.(type) {
+		case time.Time:
+			fmt.Fprintf(&b, "%s: %s\n", field.key, v.Format(time.RFC3339))
+		case int:
+			fmt.Fprintf(&b, "%s: %d\n", field.key, v)
+		case []string:
+			fmt.Fprintf(&b, "%s:\n", field.key)
+			for _, item := range v {
+				fmt.Fprintf(&b, "  - %s\n", yamlString(item))
+			}
+		default:
+			fmt.Fprintf(&b, "%s: %s\n", field.key, yamlString(fmt.Sprint(v)))
+		}
+	}
+	b.WriteString("---\n\n")
+	return b.String()
+}
+
+// yamlString quotes s as a double-quoted scalar; JSON string syntax is
+// valid YAML.
+func yamlString(s string) string {
+	quoted, _ := json.Marshal(s)
+	return string(quoted)
+}
+
+// noteMeta describes the note being converted, for front matter.
+type noteMeta struct {
+	// title is empty for stdin unless given with --title.
+	title string
+	// titleMode is how the title is injected: titleModeH1,
+	// titleModeFrontMatter, or titleModeNone.
+	titleMode string
+	// source is the input path, or the note name when fetched.
+	source string
+	// created and modified are zero when unknown.
+	created  time.Time
+	modified time.Time
+	// The remaining fields are only known for notes fetched from Box.
+	description string
+	owner       string
+	sharedLink  string
+	boxID       string
+	// contributors is set with --contributors front-matter.
+	contributors []string
+	// tags are the note's hashtags and labels.
+	tags []string
+	// count is set when the words or reading_time field is written.
+	count *textCount
+	// outputPath is where the Markdown goes; empty for stdout.
+	outputPath string
+	// sidecar is collected with --sidecar.
+	sidecar *sidecar
+}
+
+// boxNoteMeta describes a note fetched from Box.
+func boxNoteMeta(file boxFile) noteMeta {
+	name := filepath.Base(file.Name)
+	meta := noteMeta{
+		title:       titleFromPath(name),
+		source:      name,
+		created:     file.CreatedAt,
+		modified:    file.ModifiedAt,
+		description: file.Description,
+		owner:       file.OwnedBy.Name,
+		boxID:       file.ID,
+	}
+	if file.OwnedBy.Login != "" {
+		meta.owner = strings.TrimSpace(meta.owner + " <" + file.OwnedBy.Login + ">")
+	}
+	if file.SharedLink != nil {
+		meta.sharedLink = file.SharedLink.URL
+	}
+	return meta
+}
+
+// fileNoteMeta describes the note read from path.
+func fileNoteMeta(path string, info os.FileInfo) noteMeta {
+	meta := noteMeta{title: titleFromPath(path), source: path, modified: info.ModTime()}
+	if created, ok := fileCreated(info); ok {
+		meta.created = created
+	}
+	return meta
+}
+
+// buildFrontMatter collects the fields selected by --front-matter-fields.
+func buildFrontMatter(meta noteMeta, opts options, now time.Time) frontMatter {
+	var m frontMatter
+	fields := opts.frontMatterFields
+	if fields.has("title") && meta.titleMode != titleModeNone {
+		m.set("title", meta.title)
+	}
+	if fields.has("aliases") && meta.title != "" {
+		m.set("aliases", []string{meta.title})
+	}
+	if fields.has("date") {
+		switch {
+		case !opts.date.time.IsZero():
+			m.set("date", opts.date.time)
+		case !meta.created.IsZero():
+			m.set("date", meta.created.Truncate(time.Second))
+		default:
+			m.set("date", meta.modified.Truncate(time.Second))
+		}
+	}
+	if fields.has("lastmod") {
+		m.set("lastmod", meta.modified.Truncate(time.Second))
+	}
+	if fields.has("description") {
+		m.set("description", meta.description)
+	}
+	if fields.has("owner") {
+		m.set("owner", meta.owner)
+	}
+	if fields.has("contributors") {
+		m.set("contributors", meta.contributors)
+	}
+	if fields.has("tags") {
+		m.set("tags", meta.tags)
+	}
+	if meta.count != nil && fields.has("words") {
+		m.set("words", meta.count.Words)
+	}
+	if meta.count != nil && fields.has("reading_time") {
+		m.set("reading_time", meta.count.Minutes)
+	}
+	if fields.has("shared_link") {
+		m.set("shared_link", meta.sharedLink)
+	}
+	if fields.has("box_id") {
+		m.set("box_id", meta.boxID)
+	}
+	if fields.has("source") && meta.source != "" {
+		m.set("source", filepath.Base(meta.source))
+	}
+	if fields.has("converted") {
+		m.set("converted", now.UTC().Truncate(time.Second))
+	}
+	if fields.has("generator") {
+		v, _, _ := buildInfo()
+		m.set("generator", programName+" "+v)
+	}
+	return m
+}
+
+// prependFrontMatter adds the front matter block requested by opts to
+// output.
+func prependFrontMatter(output string, meta noteMeta, opts options) string {
+	var m frontMatter
+	switch {
+	case opts.frontMatter == frontMatterYAML:
+		m = buildFrontMatter(meta, opts, time.Now())
+	case meta.titleMode == titleModeFrontMatter:
+		// The title has nowhere else to go.
+		m.set("title", meta.title)
+	default:
+		return output
+	}
+	if len(m) == 0 {
+		return output
+	}
+	return m.yaml() + output
+}
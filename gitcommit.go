@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// migrationCommit records the files a run writes for --git-commit, and the
+// source of each converted note, so that they can be committed together.
+type migrationCommit struct {
+	mu    sync.Mutex
+	files []string
+	// sources maps the outputs of notes to their sources and the SHA-256 of
+	// the converted content.
+	sources map[string][2]string
+}
+
+func newMigrationCommit(opts options) *migrationCommit {
+	if !opts.gitCommit {
+		return nil
+	}
+	return &migrationCommit{sources: map[string][2]string{}}
+}
+
+// add records a written file.
+func (c *migrationCommit) add(path string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !containsString(c.files, path) {
+		c.files = append(c.files, path)
+	}
+}
+
+// addOutput records the output of the note read from source. An empty
+// digest, as from --stream, is computed from the source file.
+func (c *migrationCommit) addOutput(path, source, digest string) {
+	if c == nil {
+		return
+	}
+	if digest == "" {
+		digest = fileDigest(source)
+	}
+	c.add(path)
+	c.mu.Lock()
+	c.sources[path] = [2]string{source, digest}
+	c.mu.Unlock()
+}
+
+// fileDigest returns the SHA-256 of the file at path, or "" if it cannot be
+// read.
+func fileDigest(path string) string {
+	file, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// commitOutputs commits the files recorded during the run, if --git-commit
+// is given, and returns exitCode, or the failure of git if the run was
+// otherwise successful.
+func commitOutputs(opts *options, exitCode int) int {
+	if opts.commit == nil {
+		return exitCode
+	}
+	if err := opts.commit.commit(); err != nil {
+		fmt.Fprintf(os.Stderr, "--git-commit: %v\n", err)
+		if exitCode == exitOK {
+			return exitFailure
+		}
+	}
+	return exitCode
+}
+
+// changedFile is a file of the commit with its status from git: "A" for
+// added, "D" for removed, and "M" for updated.
+type changedFile struct {
+	status string
+	path   string
+	// abs is the path as recorded.
+	abs string
+}
+
+// commit stages the recorded files in the repository that holds them and
+// commits those that changed. Other changes in the index are left staged.
+func (c *migrationCommit) commit() error {
+	if len(c.files) == 0 {
+		fmt.Fprintln(os.Stderr, "nothing to commit")
+		return nil
+	}
+	dir := filepath.Dir(c.files[0])
+	top, err := git(dir, nil, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return err
+	}
+	root := realPath(strings.TrimSpace(top))
+	byPath := map[string]string{}
+	var pathspecs bytes.Buffer
+	for _, file := range c.files {
+		rel, err := filepath.Rel(root, realPath(file))
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("%s is outside the repository at %s", file, root)
+		}
+		rel = filepath.ToSlash(rel)
+		byPath[rel] = file
+		pathspecs.WriteString(rel + "\x00")
+	}
+	if _, err := git(root, bytes.NewReader(pathspecs.Bytes()), "add", "--pathspec-from-file=-", "--pathspec-file-nul"); err != nil {
+		return err
+	}
+	status, err := git(root, nil, "diff", "--cached", "--name-status", "--no-renames", "-z")
+	if err != nil {
+		return err
+	}
+	var changed []changedFile
+	fields := strings.Split(strings.TrimSuffix(status, "\x00"), "\x00")
+	for i := 0; i+1 < len(fields); i += 2 {
+		if abs, ok := byPath[fields[i+1]]; ok {
+			changed = append(changed, changedFile{status: fields[i], path: fields[i+1], abs: abs})
+		}
+	}
+	if len(changed) == 0 {
+		fmt.Fprintln(os.Stderr, "nothing to commit: the outputs are unchanged")
+		return nil
+	}
+
+	message, err := os.CreateTemp("", programName+"-commit-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(message.Name())
+	_, err = message.WriteString(c.message(changed))
+	if closeErr := message.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	pathspecs.Reset()
+	for _, file := range changed {
+		pathspecs.WriteString(file.path + "\x00")
+	}
+	if _, err := git(root, bytes.NewReader(pathspecs.Bytes()), "commit", "-q", "-F", message.Name(), "--pathspec-from-file=-", "--pathspec-file-nul"); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "committed %d file(s)\n", len(changed))
+	return nil
+}
+
+// message summarizes changed: the number of notes converted and of files
+// added and updated, then each note with its source and source hash, then
+// the other files, such as assets.
+func (c *migrationCommit) message(changed []changedFile) string {
+	sort.Slice(changed, func(i, j int) bool { return changed[i].path < changed[j].path })
+	var added, updated, removed int
+	var notes, others []string
+	for _, file := range changed {
+		status := file.status
+		switch status {
+		case "A":
+			added++
+		case "D":
+			removed++
+		default:
+			status = "M"
+			updated++
+		}
+		source, ok := c.sources[file.abs]
+		if !ok {
+			others = append(others, status+" "+file.path)
+			continue
+		}
+		line := fmt.Sprintf("%s %s <- %s", status, file.path, source[0])
+		if source[1] != "" {
+			line += " (sha256:" + source[1] + ")"
+		}
+		notes = append(notes, line)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Convert %d Box Note(s): %d file(s) added, %d updated", len(c.sources), added, updated)
+	if removed > 0 {
+		fmt.Fprintf(&b, ", %d removed", removed)
+	}
+	b.WriteString("\n\n")
+	for _, line := range notes {
+		b.WriteString(line + "\n")
+	}
+	if len(others) > 0 {
+		if len(notes) > 0 {
+			b.WriteString("\n")
+		}
+		for _, line := range others {
+			b.WriteString(line + "\n")
+		}
+	}
+	v, _, _ := buildInfo()
+	fmt.Fprintf(&b, "\nConverted by %s %s\n", programName, v)
+	return b.String()
+}
+
+// git runs git in dir and returns its output. The failure includes what git
+// printed.
+func git(dir string, stdin io.Reader, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"--literal-pathspecs"}, args...)...)
+	cmd.Dir = dir
+	cmd.Stdin = stdin
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return stdout.String(), nil
+}
+
+// realPath resolves the symlinks in path, as git does for the top level of
+// the repository, so that the two can be compared.
+func realPath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		return resolved
+	}
+	return abs
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dayflower/boxnote2md/pkg/boxnote"
+)
+
+// gitLabUploads is the wiki folder images are saved into, where GitLab keeps
+// the files uploaded to a wiki.
+const gitLabUploads = "uploads"
+
+// gitLabSidebar is the page GitLab shows as the wiki's navigation in place
+// of its page list.
+const gitLabSidebar = "_sidebar.md"
+
+// applyGitLabDefaults turns on the settings the wiki at dir wants, unless
+// given on the command line: the original title in front matter (GitLab
+// titles a page after its path), alerts, and a shared uploads folder.
+func applyGitLabDefaults(opts *options, dir string) {
+	if !opts.givenFlags["title-mode"] {
+		opts.titleMode = titleModeFrontMatter
+	}
+	if !opts.givenFlags["callouts"] {
+		opts.markdown.callouts = string(boxnote.CalloutsAlerts)
+	}
+	if !opts.givenFlags["assets-dir"] {
+		opts.assetsDir = gitLabUploads
+	}
+	if !filepath.IsAbs(opts.assetsDir) {
+		opts.assetsDir = filepath.Join(dir, opts.assetsDir)
+	}
+}
+
+// gitLabSafePath writes the names below the wiki directory as GitLab page
+// slugs, with hyphens for spaces.
+func gitLabSafePath(dir, outputPath string) string {
+	rel, err := filepath.Rel(dir, outputPath)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return outputPath
+	}
+	return filepath.Join(dir, strings.ReplaceAll(rel, " ", "-"))
+}
+
+// gitLabPageLink is the link to the page written to outputPath: its path
+// from the wiki root, without the extension and URL-encoded, which GitLab
+// resolves the same from every page.
+func gitLabPageLink(dir, outputPath string) string {
+	rel, err := filepath.Rel(dir, outputPath)
+	if err != nil {
+		rel = filepath.Base(outputPath)
+	}
+	segments := strings.Split(strings.TrimSuffix(filepath.ToSlash(rel), ".md"), "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+// gitLabLinks returns the link rewriting for the note described by meta:
+// links to another note of the export, after rewrite, point at its page.
+func gitLabLinks(t *exportTree, meta *noteMeta, rewrite func(string) string) func(string) string {
+	return func(href string) string {
+		if rewrite != nil {
+			if href = rewrite(href); href == "" {
+				return ""
+			}
+		}
+		if output, ok := t.resolve(meta, href); ok {
+			return gitLabPageLink(t.dir, output)
+		}
+		return href
+	}
+}
+
+// gitLabTitle is the title GitLab derives from a page slug.
+func gitLabTitle(slug string) string {
+	return strings.ReplaceAll(strings.TrimSuffix(slug, ".md"), "-", " ")
+}
+
+// writeGitLabSidebar writes _sidebar.md with a nested list of the pages
+// written, by folder, unless a note is converted to that page itself.
+func writeGitLabSidebar(opts *options) int {
+	t := opts.export
+	page := filepath.Join(t.dir, gitLabSidebar)
+	var rels []string
+	for _, output := range opts.plannedOutputs {
+		if output == page {
+			return exitOK
+		}
+		if output == "" || !exists(output) {
+			continue
+		}
+		if rel, err := filepath.Rel(t.dir, output); err == nil && !containsString(rels, filepath.ToSlash(rel)) {
+			rels = append(rels, filepath.ToSlash(rel))
+		}
+	}
+	sort.Strings(rels)
+	var b strings.Builder
+	var open []string
+	for _, rel := range rels {
+		folders := strings.Split(rel, "/")
+		name := folders[len(folders)-1]
+		folders = folders[:len(folders)-1]
+		common := 0
+		for common < len(open) && common < len(folders) && open[common] == folders[common] {
+			common++
+		}
+		for i := common; i < len(folders); i++ {
+			fmt.Fprintf(&b, "%s- %s\n", strings.Repeat("  ", i), gitLabTitle(folders[i]))
+		}
+		open = folders
+		output := filepath.Join(t.dir, filepath.FromSlash(rel))
+		fmt.Fprintf(&b, "%s- [%s](%s)\n", strings.Repeat("  ", len(folders)), gitLabTitle(name), gitLabPageLink(t.dir, output))
+	}
+	if err := writeGeneratedPage(page, b.String(), *opts); err != nil {
+		reportError(page, err)
+		return exitCodeFor(err)
+	}
+	reportOK(page)
+	return exitOK
+}
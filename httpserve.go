@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/dayflower/boxnote2md/pkg/boxnote"
+)
+
+// httpServer is the conversion service of serve --http.
+type httpServer struct {
+	opts options
+	// slots bounds the conversions running at once; nil for no limit.
+	slots    chan struct{}
+	stopping atomic.Bool
+}
+
+// uploadResult is the conversion of one uploaded file when several are
+// converted at once.
+type uploadResult struct {
+	Name     string            `json:"name"`
+	Markdown string            `json:"markdown,omitempty"`
+	Warnings []boxnote.Warning `json:"warnings"`
+	Error    string            `json:"error,omitempty"`
+}
+
+// serveHTTP runs the conversion service on addr until it is interrupted,
+// then lets the requests in progress finish.
+func serveHTTP(ctx context.Context, addr string, opts options) error {
+	s := &httpServer{opts: opts}
+	if opts.serveMaxConcurrent > 0 {
+		s.slots = make(chan struct{}, opts.serveMaxConcurrent)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/convert", s.handleConvert)
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok\n")
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if s.stopping.Load() {
+			http.Error(w, "shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, "ok\n")
+	})
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           logRequests(mux),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	errc := make(chan error, 1)
+	go func() { errc <- server.ListenAndServe() }()
+	fmt.Fprintf(os.Stderr, "listening on %s\n", addr)
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	s.stopping.Store(true)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	return server.Shutdown(shutdownCtx)
+}
+
+// statusWriter remembers the status of a response for the access log.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started := time.Now()
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+		fmt.Fprintf(os.Stderr, "%s %s %d %s\n", r.Method, r.URL.Path, sw.status, time.Since(started).Round(time.Millisecond))
+	})
+}
+
+// handleConvert converts the Box Note posted as the request body, or each
+// file of a multipart upload. Query parameters set the options a stdio
+// request sets in "options". A single note is answered with its Markdown,
+// or with its conversion as JSON when the client names JSON first in Accept;
+// several uploaded files are answered with a JSON array.
+func (s *httpServer) handleConvert(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		httpError(w, http.StatusMethodNotAllowed, "use POST", nil)
+		return
+	}
+	opts := s.opts
+	query := map[string]interface{}{}
+	for name, values := range r.URL.Query() {
+		if len(values) == 1 {
+			query[name] = values[0]
+			continue
+		}
+		list := make([]interface{}, len(values))
+		for i, value := range values {
+			list[i] = value
+		}
+		query[name] = list
+	}
+	if err := applyRequestOptions(&opts, query); err != nil {
+		httpError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, opts.serveMaxBody)
+	uploads, err := readUploads(r)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			httpError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("request body is larger than %d bytes", tooLarge.Limit), nil)
+			return
+		}
+		httpError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	if len(uploads) == 0 {
+		httpError(w, http.StatusBadRequest, "no note in the request", nil)
+		return
+	}
+
+	if s.slots != nil {
+		select {
+		case s.slots <- struct{}{}:
+			defer func() { <-s.slots }()
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if len(uploads) > 1 {
+		results := make([]uploadResult, len(uploads))
+		for i, upload := range uploads {
+			markdown, warnings, err := convertUpload(r.Context(), upload, opts)
+			results[i] = uploadResult{Name: upload.name, Markdown: markdown, Warnings: warnings}
+			if err != nil {
+				results[i].Error = err.Error()
+			}
+		}
+		writeJSONResponse(w, http.StatusOK, results)
+		return
+	}
+	markdown, warnings, err := convertUpload(r.Context(), uploads[0], opts)
+	if err != nil {
+		httpError(w, http.StatusUnprocessableEntity, err.Error(), map[string]interface{}{
+			"exit_code": exitCodeFor(err),
+			"warnings":  warnings,
+		})
+		return
+	}
+	if prefersJSON(r) {
+		writeJSONResponse(w, http.StatusOK, convertResult{Markdown: markdown, Warnings: warnings})
+		return
+	}
+	w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+	w.Header().Set("X-Conversion-Warnings", strconv.Itoa(len(warnings)))
+	io.WriteString(w, markdown)
+}
+
+// upload is a note of a request, with the name of its file if uploaded.
+type upload struct {
+	name string
+	data []byte
+}
+
+func readUploads(r *http.Request) ([]upload, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		if len(data) == 0 {
+			return nil, nil
+		}
+		return []upload{{data: data}}, nil
+	}
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	var uploads []upload
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return uploads, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if part.FileName() == "" {
+			continue
+		}
+		data, err := io.ReadAll(part)
+		if err != nil {
+			return nil, err
+		}
+		uploads = append(uploads, upload{name: part.FileName(), data: data})
+	}
+}
+
+// convertUpload converts one note of a request. An uploaded file is titled
+// after its name unless the request sets a title.
+func convertUpload(ctx context.Context, u upload, opts options) (string, []boxnote.Warning, error) {
+	if opts.title == "" && u.name != "" {
+		opts.title = titleFromPath(u.name)
+	}
+	markdown, warnings, err := convertDocument(ctx, u.data, opts)
+	if warnings == nil {
+		warnings = []boxnote.Warning{}
+	}
+	return markdown, warnings, err
+}
+
+// prefersJSON reports whether the client prefers JSON, by naming it
+// first in Accept.
+func prefersJSON(r *http.Request) bool {
+	first, _, _ := strings.Cut(r.Header.Get("Accept"), ",")
+	mediaType, _, _ := mime.ParseMediaType(first)
+	return mediaType == "application/json"
+}
+
+func writeJSONResponse(w http.ResponseWriter, status int, v interface{}) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
+
+// httpError answers with a JSON error object, with the fields of data
+// added.
+func httpError(w http.ResponseWriter, status int, message string, data map[string]interface{}) {
+	body := map[string]interface{}{"error": message}
+	for key, value := range data {
+		body[key] = value
+	}
+	writeJSONResponse(w, status, body)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// inputFile is a note to convert. Root is the directory argument it was
+// found under, or empty when the file was named directly.
+type inputFile struct {
+	Path string
+	Root string
+}
+
+// collectInputs returns the inputs named by args. With recursive,
+// directories are expanded into the .boxnote files below them; otherwise
+// every argument is taken as a file.
+func collectInputs(args []string, recursive bool) []inputFile {
+	return collectFiles(args, recursive, ".boxnote")
+}
+
+// collectFiles is collectInputs for the files with extension ext.
+func collectFiles(args []string, recursive bool, ext string) []inputFile {
+	var inputs []inputFile
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if !recursive || err != nil || !info.IsDir() {
+			inputs = append(inputs, inputFile{Path: arg})
+			continue
+		}
+		filepath.WalkDir(arg, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if !entry.IsDir() && strings.HasSuffix(path, ext) {
+				inputs = append(inputs, inputFile{Path: path, Root: arg})
+			}
+			return nil
+		})
+	}
+	return inputs
+}
+
+// placeInput returns where input would sit if it lived in outDir: directly
+// inside it for named files, or at the same relative path below it for
+// files found under a directory argument. Without outDir the input stays
+// where it is.
+func placeInput(input inputFile, outDir string) string {
+	if outDir == "" {
+		return input.Path
+	}
+	if input.Root != "" {
+		if rel, err := filepath.Rel(input.Root, input.Path); err == nil {
+			return filepath.Join(outDir, rel)
+		}
+	}
+	return filepath.Join(outDir, filepath.Base(input.Path))
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/dayflower/boxnote2md/pkg/boxnote"
+)
+
+func runInspect(ctx context.Context, opts *options, args []string) int {
+	if len(args) == 0 {
+		input, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to read stdin: %v\n", err)
+			return exitIO
+		}
+		note, err := boxnote.Parse(input)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitParse
+		}
+		writeNodeTree(os.Stdout, note, *opts)
+		return exitOK
+	}
+
+	exitCode := exitOK
+	for i, inputPath := range args {
+		input, err := os.ReadFile(inputPath)
+		if err != nil {
+			reportError(inputPath, fmt.Errorf("failed to read: %w", err))
+			if exitCode == exitOK {
+				exitCode = exitIO
+			}
+			continue
+		}
+		note, err := boxnote.Parse(input)
+		if err != nil {
+			reportError(inputPath, err)
+			if exitCode == exitOK {
+				exitCode = exitParse
+			}
+			continue
+		}
+		if len(args) > 1 {
+			if i > 0 {
+				fmt.Fprintln(os.Stdout)
+			}
+			fmt.Fprintf(os.Stdout, "%s:\n", inputPath)
+		}
+		writeNodeTree(os.Stdout, note, *opts)
+	}
+	return exitCode
+}
+
+// writeNodeTree prints one line per node, indented by depth, with its
+// attrs, marks, and text. Text and attr values longer than opts.inspectText
+// runes are truncated; with opts.inspectPaths, each line starts with the
+// node's path.
+func writeNodeTree(w io.Writer, doc *boxnote.Document, opts options) {
+	var lines, paths []string
+	width := 0
+	boxnote.Walk(doc, boxnote.Visitor{
+		Enter: func(node *boxnote.Node, path []int) boxnote.Action {
+			lines = append(lines, formatNodeLine(*node, len(path), opts.inspectText))
+			if opts.inspectPaths {
+				formatted := boxnote.FormatPath(path)
+				paths = append(paths, formatted)
+				if len(formatted) > width {
+					width = len(formatted)
+				}
+			}
+			return boxnote.Continue
+		},
+	})
+	for i, line := range lines {
+		if opts.inspectPaths {
+			line = fmt.Sprintf("%-*s  %s", width, paths[i], line)
+		}
+		fmt.Fprintln(w, line)
+	}
+}
+
+func formatNodeLine(node boxnote.Node, depth, maxText int) string {
+	line := strings.Repeat("  ", depth) + node.Type
+	if attrs := formatAttrs(node.Attrs, maxText); attrs != "" {
+		line += " " + attrs
+	}
+	if len(node.Marks) > 0 {
+		var marks []string
+		for _, mark := range node.Marks {
+			marks = append(marks, mark.Type+formatAttrs(mark.Attrs, maxText))
+		}
+		line += " [" + strings.Join(marks, ", ") + "]"
+	}
+	if node.Type == "text" {
+		line += " " + fmt.Sprintf("%q", truncateText(node.Text, maxText))
+	}
+	return line
+}
+
+// truncateText shortens text to max runes, marking the cut with an
+// ellipsis and the length of the whole. A max of 0 means no limit.
+func truncateText(text string, max int) string {
+	runes := []rune(text)
+	if max <= 0 || len(runes) <= max {
+		return text
+	}
+	return fmt.Sprintf("%s… (%d chars)", string(runes[:max]), len(runes))
+}
+
+func formatAttrs(attrs map[string]interface{}, maxText int) string {
+	if len(attrs) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(attrs))
+	for key := range attrs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		value := attrs[key]
+		if text, ok := value.(string); ok {
+			// Attrs such as data URI image sources can be huge.
+			value = truncateText(text, maxText)
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			encoded = []byte(fmt.Sprint(value))
+		}
+		parts = append(parts, key+"="+string(encoded))
+	}
+	return "{" + strings.Join(parts, " ") + "}"
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const previewLines = 20
+
+// runInteractive lists the .boxnote files found under args and lets the
+// user select which ones to convert.
+func runInteractive(ctx context.Context, opts *options, args []string) int {
+	if len(args) == 0 {
+		args = []string{"."}
+	}
+	inputs := collectInputs(args, true)
+	if len(inputs) == 0 {
+		fmt.Fprintln(os.Stderr, "no .boxnote files found")
+		return exitFailure
+	}
+
+	selected := make([]bool, len(inputs))
+	for {
+		writePickerList(os.Stderr, inputs, selected)
+		fmt.Fprint(os.Stderr, "> ")
+		line, err := stdinReader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			fmt.Fprintf(os.Stderr, "failed to read input: %v\n", err)
+			return exitIO
+		}
+		if err == io.EOF && strings.TrimSpace(line) == "" {
+			fmt.Fprintln(os.Stderr)
+			return exitOK
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "q", "quit":
+			return exitOK
+		case "a", "all":
+			setAll(selected, true)
+		case "n", "none":
+			setAll(selected, false)
+		case "p", "preview":
+			if len(fields) != 2 {
+				fmt.Fprintln(os.Stderr, "usage: p <number>")
+				continue
+			}
+			index, err := strconv.Atoi(fields[1])
+			if err != nil || index < 1 || index > len(inputs) {
+				fmt.Fprintf(os.Stderr, "no such entry: %s\n", fields[1])
+				continue
+			}
+			writePreview(ctx, os.Stderr, inputs[index-1].Path)
+		case "c", "convert":
+			return convertSelected(ctx, opts, inputs, selected)
+		default:
+			indexes, err := parseSelection(strings.Join(fields, ","), len(inputs))
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				continue
+			}
+			for _, index := range indexes {
+				selected[index] = !selected[index]
+			}
+		}
+	}
+}
+
+func writePickerList(w io.Writer, inputs []inputFile, selected []bool) {
+	fmt.Fprintln(w)
+	width := len(strconv.Itoa(len(inputs)))
+	for i, input := range inputs {
+		mark := " "
+		if selected[i] {
+			mark = "x"
+		}
+		fmt.Fprintf(w, "%*d [%s] %s\n", width, i+1, mark, input.Path)
+	}
+	fmt.Fprintln(w, "toggle: <n>[,<n>|<n>-<m>]  a: all  n: none  p <n>: preview  c: convert  q: quit")
+}
+
+func setAll(selected []bool, value bool) {
+	for i := range selected {
+		selected[i] = value
+	}
+}
+
+// parseSelection parses 1-based entries such as "1,3-5" into 0-based indexes.
+func parseSelection(text string, count int) ([]int, error) {
+	var indexes []int
+	for _, part := range strings.Split(text, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		first, last := part, part
+		if i := strings.Index(part, "-"); i > 0 {
+			first, last = part[:i], part[i+1:]
+		}
+		from, err1 := strconv.Atoi(first)
+		to, err2 := strconv.Atoi(last)
+		if err1 != nil || err2 != nil || from < 1 || to > count || from > to {
+			return nil, fmt.Errorf("invalid selection: %s", part)
+		}
+		for i := from; i <= to; i++ {
+			indexes = append(indexes, i-1)
+		}
+	}
+	return indexes, nil
+}
+
+func writePreview(ctx context.Context, w io.Writer, path string) {
+	input, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(w, "failed to read %s: %v\n", path, err)
+		return
+	}
+	if len(strings.TrimSpace(string(input))) == 0 {
+		fmt.Fprintf(w, "--- %s (empty)\n", path)
+		return
+	}
+	output, _, err := renderBoxNote(ctx, input)
+	if err != nil {
+		fmt.Fprintf(w, "failed to render %s: %v\n", path, err)
+		return
+	}
+	lines := strings.Split(output, "\n")
+	fmt.Fprintf(w, "--- %s\n", path)
+	for i, line := range lines {
+		if i == previewLines {
+			fmt.Fprintf(w, "... (%d more lines)\n", len(lines)-previewLines)
+			break
+		}
+		fmt.Fprintln(w, line)
+	}
+	fmt.Fprintln(w, "---")
+}
+
+func convertSelected(ctx context.Context, opts *options, inputs []inputFile, selected []bool) int {
+	var chosen []inputFile
+	for i, input := range inputs {
+		if selected[i] {
+			chosen = append(chosen, input)
+		}
+	}
+	if len(chosen) == 0 {
+		fmt.Fprintln(os.Stderr, "nothing selected")
+		return exitOK
+	}
+	var report *conversionReport
+	if opts.reportPath != "" {
+		report = &conversionReport{}
+	}
+	return convertInputs(ctx, opts, chosen, report)
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// parsedSizeFactor estimates the memory a note takes while it is converted,
+// as a multiple of its file size: the parsed tree alone is about five times
+// the JSON, and the input and output buffers add to it.
+const parsedSizeFactor = 8
+
+// maxPooledBuffer keeps the buffers of unusually large notes out of
+// inputBuffers, so that one huge note does not pin its memory for the rest
+// of the batch.
+const maxPooledBuffer = 16 << 20
+
+// inputBuffers recycles the buffers that notes are read into, so that a
+// batch does not grow a fresh one to the size of every note.
+var inputBuffers = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+
+// readInput reads the file at path into buf, which must not be reused
+// before the returned bytes are.
+func readInput(path string, buf *bytes.Buffer) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	buf.Reset()
+	if info, err := f.Stat(); err == nil {
+		buf.Grow(int(info.Size()) + bytes.MinRead)
+	}
+	if _, err := buf.ReadFrom(f); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func putInputBuffer(buf *bytes.Buffer) {
+	if buf.Cap() <= maxPooledBuffer {
+		inputBuffers.Put(buf)
+	}
+}
+
+// memoryBudget bounds the estimated memory of the notes converted at once
+// for --max-memory. A note larger than the whole budget waits for the
+// others to finish and then runs alone.
+type memoryBudget struct {
+	mu    sync.Mutex
+	freed *sync.Cond
+	limit int64
+	used  int64
+}
+
+func newMemoryBudget(limit int64) *memoryBudget {
+	if limit <= 0 {
+		return nil
+	}
+	b := &memoryBudget{limit: limit}
+	b.freed = sync.NewCond(&b.mu)
+	return b
+}
+
+// acquire waits until cost fits in the budget and takes it. It returns the
+// cost taken, to be given back to release.
+func (b *memoryBudget) acquire(cost int64) int64 {
+	if b == nil {
+		return 0
+	}
+	if cost > b.limit {
+		cost = b.limit
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for b.used > 0 && b.used+cost > b.limit {
+		b.freed.Wait()
+	}
+	b.used += cost
+	return cost
+}
+
+func (b *memoryBudget) release(cost int64) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	b.used -= cost
+	b.mu.Unlock()
+	b.freed.Broadcast()
+}
+
+// noteCost estimates the memory converting input takes. A streamed note
+// holds one block at a time, so it is charged its size only.
+func noteCost(input inputFile, opts options) int64 {
+	info, err := os.Stat(input.Path)
+	if err != nil {
+		return 0
+	}
+	if opts.stream {
+		return info.Size()
+	}
+	return info.Size() * parsedSizeFactor
+}
+
+// jobCount returns the number of notes -j converts at once: 0 for one per
+// CPU.
+func jobCount(opts options) int {
+	if opts.jobs == 0 {
+		return runtime.NumCPU()
+	}
+	return opts.jobs
+}
+
+// forEachInput calls convert for every input, on -j workers at once. The
+// workers take the inputs in order, each waiting for its note to fit in
+// --max-memory first.
+func forEachInput(inputs []inputFile, opts options, convert func(i int)) {
+	jobs := jobCount(opts)
+	if jobs > len(inputs) {
+		jobs = len(inputs)
+	}
+	if jobs <= 1 {
+		for i := range inputs {
+			convert(i)
+		}
+		return
+	}
+	budget := newMemoryBudget(opts.maxMemory)
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				cost := budget.acquire(noteCost(inputs[i], opts))
+				convert(i)
+				budget.release(cost)
+			}
+		}()
+	}
+	for i := range inputs {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+}
+
+// byteSizeFlag is a flag.Value for a size in bytes, written as a number
+// with an optional unit: K, M, G, or T (powers of 1024), optionally
+// followed by B or iB.
+type byteSizeFlag struct {
+	value *int64
+}
+
+func (f byteSizeFlag) String() string {
+	if f.value == nil || *f.value == 0 {
+		return ""
+	}
+	return strconv.FormatInt(*f.value, 10)
+}
+
+func (f byteSizeFlag) Set(value string) error {
+	size, err := parseByteSize(value)
+	if err != nil {
+		return err
+	}
+	*f.value = size
+	return nil
+}
+
+func parseByteSize(value string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(value))
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "B"), "I")
+	shift := 0
+	if s != "" {
+		if i := strings.IndexByte("KMGT", s[len(s)-1]); i >= 0 {
+			shift = 10 * (i + 1)
+			s = strings.TrimSpace(s[:len(s)-1])
+		}
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q (want e.g. 512M or 2G)", value)
+	}
+	return int64(n * float64(int64(1)<<shift)), nil
+}
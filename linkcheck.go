@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dayflower/boxnote2md/pkg/boxnote"
+)
+
+// linkChecker collects the links and images written to each output so that
+// --check-links can verify them once the whole batch is converted. Links may
+// be collected from several conversions at once.
+type linkChecker struct {
+	mu       sync.Mutex
+	external bool
+	// outputs lists the outputs in conversion order.
+	outputs []string
+	links   map[string][]string
+	// checked caches the result of external URL checks.
+	checked map[string]string
+}
+
+func newLinkChecker(external bool) *linkChecker {
+	return &linkChecker{external: external, links: map[string][]string{}, checked: map[string]string{}}
+}
+
+func (c *linkChecker) addOutput(outputPath string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.addOutputLocked(outputPath)
+}
+
+func (c *linkChecker) addOutputLocked(outputPath string) {
+	if _, ok := c.links[outputPath]; !ok {
+		c.outputs = append(c.outputs, outputPath)
+		c.links[outputPath] = []string{}
+	}
+}
+
+func (c *linkChecker) record(outputPath, href string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.addOutputLocked(outputPath)
+	if !containsString(c.links[outputPath], href) {
+		c.links[outputPath] = append(c.links[outputPath], href)
+	}
+}
+
+// collect wraps rewrite, which may be nil, to record the resulting hrefs of
+// the note converted to outputPath.
+func (c *linkChecker) collect(outputPath string, rewrite func(string) string) func(string) string {
+	return func(href string) string {
+		if rewrite != nil {
+			href = rewrite(href)
+		}
+		if href != "" {
+			c.record(outputPath, href)
+		}
+		return href
+	}
+}
+
+// check reports every broken link and returns how many there were.
+func (c *linkChecker) check(ctx context.Context) int {
+	broken := 0
+	for _, output := range c.outputs {
+		for _, href := range c.links[output] {
+			if reason := c.problem(ctx, output, href); reason != "" {
+				reportBrokenLink(output, href, reason)
+				broken++
+			}
+		}
+	}
+	return broken
+}
+
+// problem returns why href in output is broken, or "" when it is fine.
+// Links to headings are checked during conversion.
+func (c *linkChecker) problem(ctx context.Context, output, href string) string {
+	if strings.HasPrefix(href, "#") || strings.HasPrefix(href, "data:") {
+		return ""
+	}
+	if _, _, ok := parseBoxURL(href); ok {
+		return "links to Box"
+	}
+	u, err := url.Parse(href)
+	if err != nil {
+		return "malformed URL"
+	}
+	switch u.Scheme {
+	case "http", "https":
+		if !c.external {
+			return ""
+		}
+		return c.checkExternal(ctx, href)
+	case "":
+		if u.Path == "" {
+			return ""
+		}
+		target := filepath.Join(filepath.Dir(output), filepath.FromSlash(u.Path))
+		if strings.HasPrefix(u.Path, "/") {
+			target = filepath.FromSlash(u.Path)
+		}
+		if _, ok := c.links[filepath.Clean(target)]; ok || exists(target) {
+			return ""
+		}
+		return "no such file"
+	}
+	return ""
+}
+
+var linkCheckClient = &http.Client{Timeout: 30 * time.Second}
+
+func (c *linkChecker) checkExternal(ctx context.Context, href string) string {
+	if reason, ok := c.checked[href]; ok {
+		return reason
+	}
+	reason := ""
+	status, err := requestStatus(ctx, http.MethodHead, href)
+	if err == nil && (status == http.StatusMethodNotAllowed || status == http.StatusNotImplemented) {
+		status, err = requestStatus(ctx, http.MethodGet, href)
+	}
+	switch {
+	case err != nil:
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		reason = err.Error()
+	case status >= 400:
+		reason = fmt.Sprintf("HTTP %d", status)
+	}
+	c.checked[href] = reason
+	return reason
+}
+
+func requestStatus(ctx context.Context, method, href string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, href, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := linkCheckClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+// checkLinks runs the --check-links pass over a finished batch and turns
+// broken links into a failure exit code.
+func checkLinks(ctx context.Context, opts *options, exitCode int) int {
+	if opts.linkCheck == nil {
+		return exitCode
+	}
+	if broken := opts.linkCheck.check(ctx); broken > 0 {
+		fmt.Fprintf(os.Stderr, "%d broken link(s)\n", broken)
+		if exitCode == exitOK {
+			return exitFailure
+		}
+	}
+	return exitCode
+}
+
+// collectImages wraps source like collect does for links.
+func (c *linkChecker) collectImages(outputPath string, source func(string, boxnote.Node) string) func(string, boxnote.Node) string {
+	return func(src string, node boxnote.Node) string {
+		src = source(src, node)
+		if src != "" {
+			c.record(outputPath, src)
+		}
+		return src
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/dayflower/boxnote2md/pkg/boxnote"
+)
+
+// noteLink is a link found in a note by the links command.
+type noteLink struct {
+	File string `json:"file"`
+	// Path locates the first text node of the link.
+	Path string `json:"path"`
+	Href string `json:"href"`
+	Text string `json:"text"`
+}
+
+func runLinks(ctx context.Context, opts *options, args []string) int {
+	var links []noteLink
+	exitCode := exitOK
+	if len(args) == 0 {
+		input, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to read stdin: %v\n", err)
+			return exitIO
+		}
+		links, exitCode = appendNoteLinks(links, stdinName, input)
+	}
+	for _, input := range collectInputs(args, opts.recursive) {
+		code := exitOK
+		data, err := os.ReadFile(input.Path)
+		if err != nil {
+			reportError(input.Path, fmt.Errorf("failed to read: %w", err))
+			code = exitIO
+		} else {
+			links, code = appendNoteLinks(links, input.Path, data)
+		}
+		if exitCode == exitOK {
+			exitCode = code
+		}
+	}
+	if opts.linksJSON {
+		if links == nil {
+			links = []noteLink{}
+		}
+		data, err := marshalJSON(links)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to encode links: %v\n", err)
+			return exitFailure
+		}
+		os.Stdout.Write(data)
+		return exitCode
+	}
+	for _, link := range links {
+		fmt.Fprintf(os.Stdout, "%s:%s\t%s\t%q\n", link.File, link.Path, link.Href, link.Text)
+	}
+	return exitCode
+}
+
+// appendNoteLinks appends the links of the note read from source.
+func appendNoteLinks(links []noteLink, source string, input []byte) ([]noteLink, int) {
+	if len(strings.TrimSpace(string(input))) == 0 {
+		return links, exitOK
+	}
+	doc, err := boxnote.Parse(input)
+	if err != nil {
+		reportError(source, err)
+		return links, exitParse
+	}
+	for _, link := range collectLinks(doc) {
+		link.File = source
+		links = append(links, link)
+	}
+	return links, exitOK
+}
+
+// collectLinks returns the links of doc in document order. Adjacent text
+// nodes linking to the same href, as formatting splits a link into, are one
+// link.
+func collectLinks(doc *boxnote.Document) []noteLink {
+	var links []noteLink
+	boxnote.Walk(doc, boxnote.Visitor{
+		Enter: func(node *boxnote.Node, path []int) boxnote.Action {
+			open := false
+			for i, child := range node.Content {
+				href, ok := linkHref(child)
+				if !ok {
+					open = false
+					continue
+				}
+				if open && links[len(links)-1].Href == href {
+					links[len(links)-1].Text += child.Text
+					continue
+				}
+				childPath := append(append([]int(nil), path...), i)
+				links = append(links, noteLink{Path: boxnote.FormatPath(childPath), Href: href, Text: child.Text})
+				open = true
+			}
+			return boxnote.Continue
+		},
+	})
+	return links
+}
+
+// linkHref returns the href of a text node's link mark.
+func linkHref(node boxnote.Node) (string, bool) {
+	if node.Type != "text" {
+		return "", false
+	}
+	for _, mark := range node.Marks {
+		if mark.Type == "link" {
+			href, _ := mark.Attrs["href"].(string)
+			return href, href != ""
+		}
+	}
+	return "", false
+}
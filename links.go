@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// noteLinks maps the Box URLs of the notes in one batch to the outputs they
+// are converted to, so that links between them can point at the Markdown.
+type noteLinks struct {
+	byID     map[string]string
+	byShared map[string]string
+}
+
+func newNoteLinks() *noteLinks {
+	return &noteLinks{byID: map[string]string{}, byShared: map[string]string{}}
+}
+
+func (l *noteLinks) add(file boxFile, outputPath string) {
+	l.byID[file.ID] = outputPath
+	if file.SharedLink != nil {
+		if kind, key, ok := parseBoxURL(file.SharedLink.URL); ok && kind == "s" {
+			l.byShared[key] = outputPath
+		}
+	}
+}
+
+// target returns the output of the note that href links to.
+func (l *noteLinks) target(href string) (string, bool) {
+	if l == nil {
+		return "", false
+	}
+	kind, key, ok := parseBoxURL(href)
+	if !ok {
+		return "", false
+	}
+	var path string
+	if kind == "s" {
+		path, ok = l.byShared[key]
+	} else {
+		path, ok = l.byID[key]
+	}
+	return path, ok
+}
+
+// parseBoxURL recognizes Box file URLs (https://app.box.com/notes/<id>,
+// .../file/<id>) and shared links (https://app.box.com/s/<hash>).
+func parseBoxURL(href string) (kind, key string, ok bool) {
+	u, err := url.Parse(href)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") {
+		return "", "", false
+	}
+	host := strings.ToLower(u.Hostname())
+	if host != "box.com" && !strings.HasSuffix(host, ".box.com") {
+		return "", "", false
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) != 2 || parts[1] == "" {
+		return "", "", false
+	}
+	switch parts[0] {
+	case "notes", "file":
+		return "file", parts[1], true
+	case "s":
+		return "s", parts[1], true
+	}
+	return "", "", false
+}
+
+// relativeLink returns the link from the output at fromPath to target.
+func relativeLink(fromPath, target string) string {
+	rel, err := relativePath(filepath.Dir(fromPath), target)
+	if err != nil {
+		rel = target
+	}
+	replacer := strings.NewReplacer(" ", "%20", "(", "%28", ")", "%29", "%", "%25", "#", "%23", "?", "%3F")
+	return replacer.Replace(filepath.ToSlash(rel))
+}
+
+// sameNoteFragment returns the fragment of a Box URL that links to a heading
+// of the note with boxID itself. The library resolves the resulting #fragment
+// to the converted heading.
+func sameNoteFragment(href, boxID string) (string, bool) {
+	if boxID == "" {
+		return "", false
+	}
+	kind, key, ok := parseBoxURL(href)
+	if !ok || kind != "file" || key != boxID {
+		return "", false
+	}
+	u, _ := url.Parse(href)
+	return u.Fragment, u.Fragment != ""
+}
+
+// linkMap is a flag.Value that loads the JSON object given with --link-map.
+// Each key is a URL or, when it ends with "/", a URL prefix.
+type linkMap struct {
+	path  string
+	rules map[string]string
+}
+
+func (m *linkMap) String() string {
+	return m.path
+}
+
+func (m *linkMap) Set(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	rules := map[string]string{}
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	m.path = path
+	m.rules = rules
+	return nil
+}
+
+// rewrite applies the exact match for href, or else the longest matching
+// prefix rule.
+func (m *linkMap) rewrite(href string) string {
+	if replacement, ok := m.rules[href]; ok {
+		return replacement
+	}
+	best := ""
+	for prefix := range m.rules {
+		if strings.HasSuffix(prefix, "/") && strings.HasPrefix(href, prefix) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+	if best == "" {
+		return href
+	}
+	return m.rules[best] + strings.TrimPrefix(href, best)
+}
+
+// linkRewrite returns the href rewriting for one note, or nil when there is
+// nothing to rewrite. Links to notes in the same batch win over --link-map.
+func linkRewrite(meta *noteMeta, opts options) func(string) string {
+	notes := opts.noteLinks != nil && meta.outputPath != ""
+	if !notes && meta.boxID == "" && len(opts.linkMap.rules) == 0 {
+		return nil
+	}
+	return func(href string) string {
+		if fragment, ok := sameNoteFragment(href, meta.boxID); ok {
+			return "#" + fragment
+		}
+		if notes {
+			if target, ok := opts.noteLinks.target(href); ok {
+				return relativeLink(meta.outputPath, target)
+			}
+		}
+		return opts.linkMap.rewrite(href)
+	}
+}
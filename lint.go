@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/dayflower/boxnote2md/pkg/boxnote"
+)
+
+// runLint validates and converts inputs without writing output and reports
+// every schema violation and warning.
+// Exit status follows the --strict classes: warnings are always failures.
+func runLint(ctx context.Context, opts *options, args []string) int {
+	if len(args) == 0 {
+		input, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to read stdin: %v\n", err)
+			return exitIO
+		}
+		return lintInput(ctx, stdinName, input)
+	}
+
+	exitCode := exitOK
+	for _, inputPath := range args {
+		code := exitOK
+		input, err := os.ReadFile(inputPath)
+		if err != nil {
+			reportError(inputPath, fmt.Errorf("failed to read: %w", err))
+			code = exitIO
+		} else {
+			code = lintInput(ctx, inputPath, input)
+		}
+		if exitCode == exitOK {
+			exitCode = code
+		}
+	}
+	return exitCode
+}
+
+func lintInput(ctx context.Context, source string, input []byte) int {
+	if len(strings.TrimSpace(string(input))) == 0 {
+		reportOK(source)
+		return exitOK
+	}
+	doc, err := boxnote.Parse(input)
+	if err != nil {
+		reportError(source, err)
+		return exitParse
+	}
+	if errs := doc.Validate(); len(errs) > 0 {
+		for _, err := range errs {
+			reportError(source, err)
+		}
+		return exitParse
+	}
+	output, warnings, err := doc.MarkdownContext(ctx)
+	if err != nil {
+		reportError(source, err)
+		return exitParse
+	}
+	issues := lintMarkdown(output)
+	if len(warnings) > 0 || len(issues) > 0 {
+		printWarnings(source, warnings)
+		printMarkdownIssues(source, issues)
+		return exitWarnings
+	}
+	reportOK(source)
+	return exitOK
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// listedNote is a note found by list, as printed with --json.
+type listedNote struct {
+	ID       string    `json:"id"`
+	Path     string    `json:"path"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+	Owner    string    `json:"owner"`
+}
+
+// runList prints the notes below a Box folder, so that their IDs can be
+// picked for fetch.
+func runList(ctx context.Context, opts *options, args []string) int {
+	if opts.syncFolder == "" || len(args) > 0 {
+		fmt.Fprintf(os.Stderr, "usage: %s list [flags] --folder <id>\n", programName)
+		return exitUsage
+	}
+	client, err := newAuthenticatedBoxClient(*opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	listCtx, cancel := withTimeout(ctx, opts.timeout)
+	defer cancel()
+	notes, err := walkBoxFolder(listCtx, client, opts.syncFolder, "")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to list folder %s: %v\n", opts.syncFolder, err)
+		return exitIO
+	}
+	listed := make([]listedNote, 0, len(notes))
+	for _, note := range notes {
+		owner := note.file.OwnedBy.Name
+		if owner == "" {
+			owner = note.file.OwnedBy.Login
+		}
+		listed = append(listed, listedNote{
+			ID:       note.file.ID,
+			Path:     filepath.ToSlash(filepath.Join(note.dir, note.file.Name)),
+			Size:     note.file.Size,
+			Modified: note.file.ModifiedAt,
+			Owner:    owner,
+		})
+	}
+	if opts.listJSON {
+		data, err := marshalJSON(listed)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to encode notes: %v\n", err)
+			return exitFailure
+		}
+		os.Stdout.Write(data)
+		return exitOK
+	}
+	writeListedNotes(os.Stdout, listed, opts.locale)
+	return exitOK
+}
+
+// writeListedNotes prints a table of notes, with the path last since it is
+// the widest column.
+func writeListedNotes(w io.Writer, notes []listedNote, loc locale) {
+	rows := [][]string{{"ID", "SIZE", "MODIFIED", "OWNER", "PATH"}}
+	for _, n := range notes {
+		modified := ""
+		if !n.Modified.IsZero() {
+			modified = loc.formatDateTime(n.Modified.Local())
+		}
+		rows = append(rows, []string{n.ID, loc.formatNumber(n.Size), modified, n.Owner, n.Path})
+	}
+	widths := make([]int, 4)
+	for _, row := range rows {
+		for i := range widths {
+			if n := displayWidth(row[i]); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+	for _, row := range rows {
+		line := fmt.Sprintf("%-*s  %*s  %-*s  %s  %s", widths[0], row[0], widths[1], row[1], widths[2], row[2], padDisplay(row[3], widths[3]), row[4])
+		fmt.Fprintln(w, strings.TrimRight(line, " "))
+	}
+}
+
+// displayWidth approximates the terminal columns of s: East Asian wide and
+// fullwidth characters take two.
+func displayWidth(s string) int {
+	n := 0
+	for _, r := range s {
+		n++
+		if isWideRune(r) {
+			n++
+		}
+	}
+	return n
+}
+
+func isWideRune(r rune) bool {
+	switch {
+	case r >= 0x1100 && r <= 0x115F, // Hangul Jamo
+		r >= 0x2E80 && r <= 0x303E, // CJK radicals, symbols, and punctuation
+		r >= 0x3041 && r <= 0x33FF, // kana, Bopomofo, and CJK compatibility
+		r >= 0x3400 && r <= 0x4DBF, // CJK extension A
+		r >= 0x4E00 && r <= 0x9FFF, // CJK unified ideographs
+		r >= 0xA000 && r <= 0xA4CF, // Yi
+		r >= 0xAC00 && r <= 0xD7A3, // Hangul syllables
+		r >= 0xF900 && r <= 0xFAFF, // CJK compatibility ideographs
+		r >= 0xFE30 && r <= 0xFE4F, // CJK compatibility forms
+		r >= 0xFF00 && r <= 0xFF60, // fullwidth forms
+		r >= 0xFFE0 && r <= 0xFFE6,
+		r >= 0x1F300 && r <= 0x1F64F, // emoji
+		r >= 0x1F900 && r <= 0x1F9FF,
+		r >= 0x20000 && r <= 0x3FFFD: // CJK extensions B and later
+		return true
+	}
+	return false
+}
+
+// padDisplay pads s with spaces to width columns.
+func padDisplay(s string, width int) string {
+	if n := displayWidth(s); n < width {
+		return s + strings.Repeat(" ", width-n)
+	}
+	return s
+}
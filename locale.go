@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// locale holds the conventions that --locale formats dates and numbers in
+// for people to read: in list, stats, and wc tables and in dates the
+// converter writes into notes. Output that programs read, such as front
+// matter, JSON, CSV, and file names, keeps ISO 8601 dates and plain
+// numbers.
+type locale struct {
+	name string
+	// date and dateTime are time layouts.
+	date     string
+	dateTime string
+	// group separates the thousands of numbers.
+	group string
+}
+
+// isoLocale is used without --locale.
+var isoLocale = locale{date: "2006-01-02", dateTime: "2006-01-02 15:04"}
+
+var locales = map[string]locale{
+	"en-US": {date: "01/02/2006", dateTime: "01/02/2006 3:04 PM", group: ","},
+	"en-GB": {date: "02/01/2006", dateTime: "02/01/2006 15:04", group: ","},
+	"ja-JP": {date: "2006/01/02", dateTime: "2006/01/02 15:04", group: ","},
+	"zh-CN": {date: "2006/1/2", dateTime: "2006/1/2 15:04", group: ","},
+	"zh-TW": {date: "2006/1/2", dateTime: "2006/1/2 15:04", group: ","},
+	"ko-KR": {date: "2006. 1. 2.", dateTime: "2006. 1. 2. 15:04", group: ","},
+	"de-DE": {date: "02.01.2006", dateTime: "02.01.2006 15:04", group: "."},
+	"fr-FR": {date: "02/01/2006", dateTime: "02/01/2006 15:04", group: "\u202f"},
+	"es-ES": {date: "02/01/2006", dateTime: "02/01/2006 15:04", group: "."},
+	"it-IT": {date: "02/01/2006", dateTime: "02/01/2006 15:04", group: "."},
+	"nl-NL": {date: "02-01-2006", dateTime: "02-01-2006 15:04", group: "."},
+	"pt-BR": {date: "02/01/2006", dateTime: "02/01/2006 15:04", group: "."},
+}
+
+// localeLanguages maps a language without a region to its locale.
+var localeLanguages = map[string]string{
+	"en": "en-US", "ja": "ja-JP", "zh": "zh-CN", "ko": "ko-KR", "de": "de-DE",
+	"fr": "fr-FR", "es": "es-ES", "it": "it-IT", "nl": "nl-NL", "pt": "pt-BR",
+}
+
+// parseLocale looks up a locale by a tag such as ja-JP, ja_JP.UTF-8, or ja.
+// "auto" takes it from $LC_ALL, $LC_TIME, or $LANG, and C, POSIX, and an
+// unknown environment locale give the ISO formats.
+func parseLocale(tag string) (locale, error) {
+	auto := tag == "auto"
+	if auto {
+		tag = ""
+		for _, key := range []string{"LC_ALL", "LC_TIME", "LANG"} {
+			if tag = os.Getenv(key); tag != "" {
+				break
+			}
+		}
+	}
+	if i := strings.IndexAny(tag, ".@"); i >= 0 {
+		tag = tag[:i]
+	}
+	tag = strings.ReplaceAll(tag, "_", "-")
+	if tag == "" || tag == "C" || tag == "POSIX" || strings.EqualFold(tag, "iso") {
+		return isoLocale, nil
+	}
+	language, region, _ := strings.Cut(tag, "-")
+	name := strings.ToLower(language)
+	if region != "" {
+		name += "-" + strings.ToUpper(region)
+	}
+	l, ok := locales[name]
+	if !ok {
+		name, ok = localeLanguages[strings.ToLower(language)]
+		l = locales[name]
+	}
+	if !ok {
+		if auto {
+			return isoLocale, nil
+		}
+		return isoLocale, fmt.Errorf("unknown locale %q (known: iso, auto, %s)", tag, strings.Join(localeNames(), ", "))
+	}
+	l.name = name
+	return l, nil
+}
+
+func localeNames() []string {
+	names := make([]string, 0, len(locales))
+	for name := range locales {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// String and Set make a locale a flag.Value.
+func (l *locale) String() string {
+	if l == nil || l.name == "" {
+		return "iso"
+	}
+	return l.name
+}
+
+func (l *locale) Set(value string) error {
+	parsed, err := parseLocale(value)
+	if err != nil {
+		return err
+	}
+	*l = parsed
+	return nil
+}
+
+func (l locale) dateLayout() string {
+	if l.date == "" {
+		return isoLocale.date
+	}
+	return l.date
+}
+
+func (l locale) formatDateTime(t time.Time) string {
+	layout := l.dateTime
+	if layout == "" {
+		layout = isoLocale.dateTime
+	}
+	return t.Format(layout)
+}
+
+// formatNumber writes n with the thousands separated by the group
+// separator of the locale.
+func (l locale) formatNumber(n int64) string {
+	digits := strconv.FormatInt(n, 10)
+	if l.group == "" {
+		return digits
+	}
+	sign := ""
+	if n < 0 {
+		sign, digits = "-", digits[1:]
+	}
+	var b strings.Builder
+	for i, d := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b.WriteString(l.group)
+		}
+		b.WriteRune(d)
+	}
+	return sign + b.String()
+}
@@ -2,734 +2,761 @@ package main
 
 import (
 	"bufio"
-	"encoding/json"
-	"flag"
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
-	"sort"
+	"runtime/debug"
 	"strings"
-	"unicode"
+	"sync"
+	"time"
+
+	"github.com/dayflower/boxnote2md/pkg/boxnote"
 )
 
-type BoxNote struct {
-	Doc Node `json:"doc"`
-}
+const (
+	exitOK       = 0
+	exitFailure  = 1
+	exitUsage    = 2
+	exitIO       = 3
+	exitParse    = 4
+	exitWarnings = 5
+)
 
-type Node struct {
-	Type    string                 `json:"type"`
-	Attrs   map[string]interface{} `json:"attrs"`
-	Content []Node                 `json:"content"`
-	Text    string                 `json:"text"`
-	Marks   []Mark                 `json:"marks"`
+// exitError attaches an exit status class to a per-file failure.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+func exitCodeFor(err error) int {
+	var exitErr *exitError
+	if errors.As(err, &exitErr) {
+		return exitErr.code
+	}
+	return exitFailure
+}
+
+type options struct {
+	forceOverwrite    bool
+	strict            bool
+	validate          bool
+	reportPath        string
+	showVersion       bool
+	locale            locale
+	watchInterval     time.Duration
+	boxToken          string
+	outDir            string
+	interactive       bool
+	backup            backupMode
+	fsync             bool
+	skipUnchanged     bool
+	nameTemplate      nameTemplate
+	recursive         bool
+	slugify           bool
+	slug              slugOptions
+	markdown          markdownStyle
+	timeout           time.Duration
+	frontMatter       string
+	frontMatterFields fieldList
+	date              dateValue
+	contributors      string
+	footer            bool
+	footerTemplate    footerTemplate
+	authorsMap        string
+	authors           *authorDirectory
+	titleFrom         string
+	titleMode         string
+	title             string
+	stripHashtags     bool
+	section           string
+	sectionFrom       string
+	sectionTo         string
+	splitBy           string
+	merge             string
+	sidecar           bool
+	marker            bool
+	eol               string
+	stream            bool
+	onCollision       string
+	inspectText       int
+	inspectPaths      bool
+	statsJSON         bool
+	wcJSON            bool
+	coverageJSON      bool
+	diffNodes         bool
+	diffContext       int
+	linksJSON         bool
+	listJSON          bool
+	todosFormat       string
+	todosOpen         bool
+	// givenFlags names the flags set on the command line, so that a command
+	// can tell them from defaults.
+	givenFlags map[string]bool
+	// plannedOutputs holds the collision-free output path of each input of
+	// a batch, by position.
+	plannedOutputs    []string
+	assetsDir         string
+	embedImages       bool
+	assetManifestPath string
+	assetManifest     *assetManifest
+	// noteLinks is set by fetch to rewrite links between fetched notes,
+	// and by --manifest to those converted earlier.
+	noteLinks *noteLinks
+	// export is set by the export command.
+	export        *exportTree
+	obsidianVault string
+	notionDir     string
+	gitlabWiki    string
+	// Settings of publish --confluence.
+	confluenceURL    string
+	confluenceSpace  string
+	confluenceParent string
+	confluenceUser   string
+	confluenceToken  string
+	publishDryRun    bool
+	// Settings of serve.
+	serveStdio         bool
+	serveHTTP          string
+	serveMaxBody       int64
+	serveMaxConcurrent int
+	linkMap            *linkMap
+	checkLinks         bool
+	checkExternal      bool
+	linkCheck          *linkChecker
+	gitCommit          bool
+	// commit records the files written for --git-commit.
+	commit *migrationCommit
+	// store is set when outDir names object storage.
+	store     outputStore
+	reverse   bool
+	jobs      int
+	maxMemory int64
+	// manifest maps the converted notes to their outputs for --manifest.
+	manifestPath string
+	manifest     *conversionManifest
+	// Box authentication besides boxToken.
+	boxConfig  string
+	boxUser    string
+	tokenCache string
+	// retries bounds the retries of Box API requests and image downloads;
+	// boxRate paces the Box API requests.
+	retries int
+	boxRate float64
+	// Settings of sync.
+	syncFolder   string
+	syncDelete   bool
+	syncInterval time.Duration
+}
+
+func defaultOptions() options {
+	return options{
+		watchInterval:     time.Second,
+		backup:            backupNone,
+		slug:              defaultSlugOptions,
+		splitBy:           splitNone,
+		markdown:          defaultMarkdownStyle,
+		frontMatter:       frontMatterNone,
+		frontMatterFields: fieldList(defaultFrontMatterFields),
+		contributors:      contributorsNone,
+		titleFrom:         titleFromFilename,
+		titleMode:         titleModeH1,
+		eol:               eolLF,
+		onCollision:       collisionError,
+		inspectText:       60,
+		diffContext:       3,
+		todosFormat:       todosMarkdown,
+		assetsDir:         "assets",
+		serveMaxBody:      32 << 20,
+		jobs:              1,
+		retries:           5,
+		linkMap:           &linkMap{},
+		givenFlags:        map[string]bool{},
+	}
+}
+
+// fileResult collects per-input details for progress and report output.
+type fileResult struct {
+	OutputPath  string
+	Warnings    []boxnote.Warning
+	InputBytes  int
+	OutputBytes int
+	Skipped     bool
 }
 
-type Mark struct {
-	Type  string                 `json:"type"`
-	Attrs map[string]interface{} `json:"attrs"`
+func main() {
+	os.Exit(runCLI(os.Args[1:]))
 }
 
-type RenderContext struct {
-	Indent int
-}
+func runConvert(ctx context.Context, opts *options, args []string) int {
+	if flag := streamConflict(*opts); flag != "" {
+		fmt.Fprintf(os.Stderr, "--stream cannot be combined with %s\n", flag)
+		return exitUsage
+	}
+	if err := openStore(opts); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	if opts.reverse {
+		return runReverse(opts, args)
+	}
+	if opts.jobs < 0 {
+		fmt.Fprintln(os.Stderr, "-j must not be negative")
+		return exitUsage
+	}
+	if opts.maxMemory > 0 {
+		debug.SetMemoryLimit(opts.maxMemory)
+	}
+	if err := prepareAuthors(opts, nil); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitIO
+	}
+	opts.commit = newMigrationCommit(*opts)
+	if opts.merge != "" {
+		return commitOutputs(opts, runMerge(ctx, opts, args))
+	}
+	if opts.interactive {
+		return commitOutputs(opts, runInteractive(ctx, opts, args))
+	}
 
-func main() {
-	forceOverwrite := flag.Bool("f", false, "overwrite output files without prompting")
-	flag.Parse()
-	args := flag.Args()
+	var report *conversionReport
+	if opts.reportPath != "" {
+		report = &conversionReport{}
+	}
 
 	if len(args) == 0 {
-		input, err := io.ReadAll(os.Stdin)
+		started := time.Now()
+		result, err := processStdin(ctx, *opts)
+		report.add(stdinName, result, err, time.Since(started))
+		writeReport(opts.reportPath, report)
 		if err != nil {
-			fatal("failed to read stdin", err)
-		}
-		if len(strings.TrimSpace(string(input))) == 0 {
-			return
-		}
-		output, err := renderBoxNote(input)
-		if err != nil {
-			fatal(err.Error(), nil)
+			reportError(stdinName, err)
+			if opts.strict {
+				return exitCodeFor(err)
+			}
+			return exitFailure
 		}
-		fmt.Fprint(os.Stdout, output)
-		return
+		return exitOK
 	}
 
-	hadError := false
-	for _, inputPath := range args {
-		if err := processFile(inputPath, *forceOverwrite); err != nil {
-			fmt.Fprintf(os.Stderr, "ERROR: %s: %v\n", inputPath, err)
-			hadError = true
-			continue
+	return commitOutputs(opts, convertInputs(ctx, opts, collectInputs(args, opts.recursive), report))
+}
+
+// planInputOutputs resolves the output paths of inputs up front and
+// handles the collisions among them with the --on-collision mode.
+func planInputOutputs(opts *options, inputs []inputFile) int {
+	paths := make([]string, len(inputs))
+	names := make([]string, len(inputs))
+	for i, input := range inputs {
+		// Inputs whose output cannot be resolved fail when they are processed.
+		paths[i], _, _ = inputOutputPath(input, i+1, *opts)
+		names[i] = input.Path
+		if opts.export != nil && paths[i] != "" {
+			paths[i] = opts.export.safePath(paths[i])
 		}
-		fmt.Fprintf(os.Stderr, "OK: %s\n", inputPath)
 	}
-	if hadError {
-		os.Exit(1)
+	planned, collisions := planOutputs(paths, names, opts.onCollision)
+	for _, collision := range collisions {
+		reportError(collision.second, collision)
+	}
+	if len(collisions) > 0 {
+		fmt.Fprintf(os.Stderr, "%d output collision(s); rename the inputs or use --on-collision %s\n", len(collisions), collisionNumber)
+		return exitFailure
+	}
+	opts.plannedOutputs = planned
+	opts.export.add(inputs, planned)
+	return exitOK
+}
+
+func convertInputs(ctx context.Context, opts *options, inputs []inputFile, report *conversionReport) int {
+	if opts.assetManifestPath != "" {
+		opts.assetManifest = newAssetManifest()
+	}
+	if opts.checkLinks {
+		opts.linkCheck = newLinkChecker(opts.checkExternal)
+	}
+	if err := prepareManifest(opts); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to read manifest: %v\n", err)
+		return exitIO
+	}
+	if code := planInputOutputs(opts, inputs); code != exitOK {
+		return code
+	}
+	type outcome struct {
+		result  fileResult
+		err     error
+		elapsed time.Duration
+	}
+	outcomes := make([]outcome, len(inputs))
+	forEachInput(inputs, *opts, func(i int) {
+		inputPath := inputs[i].Path
+		started := time.Now()
+		result, err := processFile(ctx, inputs[i], i+1, *opts)
+		outcomes[i] = outcome{result, err, time.Since(started)}
+		switch {
+		case err != nil:
+			reportError(inputPath, err)
+		case result.Skipped:
+			reportSkipped(inputPath)
+		default:
+			reportOK(inputPath)
+		}
+	})
+	exitCode := exitOK
+	for i, o := range outcomes {
+		report.add(inputs[i].Path, o.result, o.err, o.elapsed)
+		if o.err != nil && exitCode == exitOK {
+			exitCode = exitFailure
+			if opts.strict {
+				exitCode = exitCodeFor(o.err)
+			}
+		}
 	}
+	writeReport(opts.reportPath, report)
+	writeAssetManifest(opts.assetManifestPath, opts.assetManifest)
+	writeManifest(opts.manifestPath, opts.manifest)
+	return checkLinks(ctx, opts, exitCode)
 }
 
-func fatal(message string, err error) {
+func fatal(code int, message string, err error) {
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%s: %v\n", message, err)
 	} else {
 		fmt.Fprintf(os.Stderr, "%s\n", message)
 	}
-	os.Exit(1)
+	os.Exit(code)
 }
 
-func renderBoxNote(input []byte) (string, error) {
-	var note BoxNote
-	if err := json.Unmarshal(input, &note); err != nil {
-		return "", fmt.Errorf("failed to parse JSON")
-	}
-	if note.Doc.Type == "" {
-		return "", fmt.Errorf("missing doc node")
-	}
-	return renderNode(note.Doc, RenderContext{}), nil
-}
-
-func processFile(inputPath string, forceOverwrite bool) error {
-	input, err := os.ReadFile(inputPath)
-	if err != nil {
-		return fmt.Errorf("failed to read: %w", err)
-	}
-
-	outputPath := outputPathFor(inputPath)
-	if exists(outputPath) && !forceOverwrite {
-		confirmed, err := confirmOverwrite(outputPath)
-		if err != nil {
-			return err
-		}
-		if !confirmed {
-			return fmt.Errorf("overwrite declined")
-		}
-	}
-
-	if len(strings.TrimSpace(string(input))) == 0 {
-		return os.WriteFile(outputPath, []byte(""), 0644)
-	}
-
-	output, err := renderBoxNote(input)
+// renderBoxNote converts a Box Note and returns the warnings collected while
+// rendering.
+func renderBoxNote(ctx context.Context, input []byte, opts ...boxnote.ConvertOption) (string, []boxnote.Warning, error) {
+	doc, err := boxnote.Parse(input)
 	if err != nil {
-		return err
+		return "", nil, err
 	}
-
-	title := titleFromPath(inputPath)
-	if title != "" {
-		output = "# " + title + "\n\n" + output
-	}
-
-	if err := os.WriteFile(outputPath, []byte(output), 0644); err != nil {
-		return fmt.Errorf("failed to write: %w", err)
-	}
-	return nil
+	return doc.MarkdownContext(ctx, opts...)
 }
 
-func exists(path string) bool {
-	_, err := os.Stat(path)
-	return err == nil
-}
+// schemaViolations is the error for a note that fails --validate.
+type schemaViolations []*boxnote.SchemaError
 
-func confirmOverwrite(path string) (bool, error) {
-	fmt.Fprintf(os.Stderr, "overwrite %s? [y/N]: ", path)
-	reader := bufio.NewReader(os.Stdin)
-	line, err := reader.ReadString('\n')
-	if err != nil && err != io.EOF {
-		return false, fmt.Errorf("failed to read overwrite confirmation: %w", err)
+func (v schemaViolations) Error() string {
+	messages := make([]string, len(v))
+	for i, err := range v {
+		messages[i] = err.Error()
 	}
-	answer := strings.TrimSpace(strings.ToLower(line))
-	return answer == "y" || answer == "yes", nil
-}
-
-func outputPathFor(inputPath string) string {
-	return strings.TrimSuffix(inputPath, ".boxnote") + ".md"
-}
-
-func titleFromPath(inputPath string) string {
-	base := filepath.Base(inputPath)
-	return strings.TrimSuffix(base, ".boxnote")
+	return fmt.Sprintf("%d schema violation(s): %s", len(v), strings.Join(messages, "; "))
 }
 
-func renderNode(node Node, ctx RenderContext) string {
-	switch node.Type {
-	case "doc":
-		return renderBlocks(node.Content, ctx)
+// renderFailure classifies an error returned by renderBoxNote.
+func renderFailure(err error) error {
+	var exitErr *exitError
+	switch {
+	case errors.As(err, &exitErr):
+		return err
+	case errors.Is(err, context.DeadlineExceeded):
+		return fmt.Errorf("conversion timed out")
+	case errors.Is(err, context.Canceled):
+		return fmt.Errorf("conversion canceled")
 	default:
-		return renderBlocks(node.Content, ctx)
+		return &exitError{code: exitParse, err: err}
 	}
 }
 
-func renderBlocks(nodes []Node, ctx RenderContext) string {
-	var blocks []string
-	for _, node := range nodes {
-		block, keep := renderBlock(node, ctx)
-		if !keep {
-			continue
-		}
-		blocks = append(blocks, block)
+// withTimeout bounds ctx by timeout when it is positive.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
 	}
-	return strings.Join(blocks, "\n\n")
+	return context.WithTimeout(ctx, timeout)
 }
 
-func renderBlock(node Node, ctx RenderContext) (string, bool) {
-	switch node.Type {
-	case "heading":
-		level := clampInt(getIntAttr(node.Attrs, "level"), 1, 6)
-		text := renderInline(node.Content)
-		return fmt.Sprintf("%s %s", strings.Repeat("#", level), text), true
-	case "paragraph":
-		if len(node.Content) == 0 {
-			return "", true
-		}
-		return renderInline(node.Content), true
-	case "hard_break":
-		return "\\\n", true
-	case "bullet_list":
-		return renderList(node, ctx, "- "), true
-	case "ordered_list":
-		return renderList(node, ctx, "1. "), true
-	case "list_item":
-		lines := renderListItem(node, ctx, "- ")
-		return strings.Join(lines, "\n"), true
-	case "check_list":
-		return renderCheckList(node, ctx), true
-	case "check_list_item":
-		prefix := "- [ ] "
-		if getBoolAttr(node.Attrs, "checked") {
-			prefix = "- [x] "
-		}
-		lines := renderListItem(node, ctx, prefix)
-		return strings.Join(lines, "\n"), true
-	case "horizontal_rule":
-		return "---", true
-	case "blockquote":
-		return renderBlockquote(node.Content, ctx), true
-	case "call_out_box":
-		return renderBlockquote(node.Content, ctx), true
-	case "table":
-		return renderTable(node, ctx), true
-	default:
-		if len(node.Content) == 0 {
-			return "", false
-		}
-		return renderBlocks(node.Content, ctx), true
+// renderNote converts input with the CLI settings and completes meta with
+// what is learned from the document, such as its contributors.
+func renderNote(ctx context.Context, input []byte, meta *noteMeta, opts options) (string, []boxnote.Warning, error) {
+	doc, err := parseNote(input, opts)
+	if err != nil {
+		return "", nil, err
 	}
+	return renderDocument(ctx, doc, meta, opts)
 }
 
-func renderInline(nodes []Node) string {
-	var b strings.Builder
-	for _, node := range nodes {
-		switch node.Type {
-		case "text":
-			b.WriteString(applyMarks(node.Text, node.Marks))
-		case "hard_break":
-			b.WriteString("\\\n")
-		default:
-			if len(node.Content) > 0 {
-				b.WriteString(renderInline(node.Content))
-			}
-		}
+// parseNote parses input, validated with --validate, and cut down to the
+// part chosen with --section, or --from and --to.
+func parseNote(input []byte, opts options) (*boxnote.Document, error) {
+	doc, err := boxnote.Parse(input)
+	if err != nil {
+		return nil, err
 	}
-	return b.String()
-}
-
-func renderList(node Node, ctx RenderContext, prefix string) string {
-	var lines []string
-	hasItem := false
-	for _, item := range node.Content {
-		switch item.Type {
-		case "list_item":
-			lines = append(lines, renderListItem(item, ctx, prefix)...)
-			hasItem = true
-		case "bullet_list":
-			if hasItem {
-				nested := renderList(item, RenderContext{Indent: ctx.Indent + 2}, "- ")
-				if nested != "" {
-					lines = append(lines, strings.Split(nested, "\n")...)
-				}
-			}
-		case "ordered_list":
-			if hasItem {
-				nested := renderList(item, RenderContext{Indent: ctx.Indent + 2}, "1. ")
-				if nested != "" {
-					lines = append(lines, strings.Split(nested, "\n")...)
-				}
-			}
-		case "check_list":
-			if hasItem {
-				nested := renderCheckList(item, RenderContext{Indent: ctx.Indent + 2})
-				if nested != "" {
-					lines = append(lines, strings.Split(nested, "\n")...)
-				}
-			}
+	if opts.validate {
+		if errs := doc.Validate(); len(errs) > 0 {
+			return nil, schemaViolations(errs)
 		}
 	}
-	return strings.Join(lines, "\n")
-}
-
-func renderCheckList(node Node, ctx RenderContext) string {
-	var lines []string
-	hasItem := false
-	for _, item := range node.Content {
-		switch item.Type {
-		case "check_list_item":
-			prefix := "- [ ] "
-			if getBoolAttr(item.Attrs, "checked") {
-				prefix = "- [x] "
-			}
-			lines = append(lines, renderListItem(item, ctx, prefix)...)
-			hasItem = true
-		case "bullet_list":
-			if hasItem {
-				nested := renderList(item, RenderContext{Indent: ctx.Indent + 2}, "- ")
-				if nested != "" {
-					lines = append(lines, strings.Split(nested, "\n")...)
-				}
-			}
-		case "ordered_list":
-			if hasItem {
-				nested := renderList(item, RenderContext{Indent: ctx.Indent + 2}, "1. ")
-				if nested != "" {
-					lines = append(lines, strings.Split(nested, "\n")...)
-				}
-			}
-		case "check_list":
-			if hasItem {
-				nested := renderCheckList(item, RenderContext{Indent: ctx.Indent + 2})
-				if nested != "" {
-					lines = append(lines, strings.Split(nested, "\n")...)
-				}
-			}
-		}
+	if err := selectSection(doc, opts); err != nil {
+		return nil, err
 	}
-	return strings.Join(lines, "\n")
+	return doc, nil
 }
 
-func renderListItem(node Node, ctx RenderContext, prefix string) []string {
-	indent := ctx.Indent
-	prefixLine := strings.Repeat(" ", indent) + prefix
-	children := node.Content
-	if len(children) == 0 {
-		return []string{prefixLine}
-	}
-
-	var lines []string
-	first := children[0]
-	if first.Type == "paragraph" {
-		text := renderInline(first.Content)
-		text = indentMultiline(text, len(prefixLine))
-		lines = append(lines, prefixLine+text)
-		children = children[1:]
-	} else {
-		lines = append(lines, prefixLine)
+// renderDocument is renderNote for a parsed note.
+func renderDocument(ctx context.Context, doc *boxnote.Document, meta *noteMeta, opts options) (string, []boxnote.Warning, error) {
+	if opts.sidecar {
+		meta.sidecar = newSidecar(doc)
 	}
-
-	for _, child := range children {
-		block, keep := renderBlock(child, RenderContext{Indent: indent + 2})
-		if !keep {
-			continue
-		}
-		if block == "" {
-			lines = append(lines, strings.Repeat(" ", indent+2))
-			continue
-		}
-		lines = append(lines, indentAllLines(block, indent+2))
+	meta.tags = doc.Hashtags()
+	if opts.frontMatterFields.has("words") || opts.frontMatterFields.has("reading_time") {
+		count := countText(doc)
+		meta.count = &count
 	}
-
-	return lines
-}
-
-func renderBlockquote(nodes []Node, ctx RenderContext) string {
-	content := renderBlocks(nodes, ctx)
-	if content == "" {
-		return ">"
+	if opts.stripHashtags {
+		doc.StripHashtags()
 	}
-	return prefixLines(content, "> ")
-}
-
-func renderTable(node Node, ctx RenderContext) string {
-	var rows [][]string
-	for _, row := range node.Content {
-		if row.Type != "table_row" {
-			continue
+	if opts.export != nil && meta.outputPath != "" {
+		if err := opts.export.prepare(doc, meta, opts); err != nil {
+			return "", nil, err
 		}
-		rows = append(rows, renderTableRow(row, ctx))
 	}
-	if len(rows) == 0 {
-		return ""
-	}
-
-	colCount := 0
-	for _, row := range rows {
-		if len(row) > colCount {
-			colCount = len(row)
+	meta.titleMode = opts.titleMode
+	switch opts.titleFrom {
+	case titleFromFirstHeading:
+		// The note's own heading stands in for the injected one.
+		if title, ok := doc.FirstHeading(); ok && title != "" {
+			meta.title = title
+			if meta.titleMode == titleModeH1 {
+				meta.titleMode = titleModeFrontMatter
+			}
 		}
+	case titleFromFrontMatterOnly:
+		meta.titleMode = titleModeFrontMatter
 	}
-	if colCount == 0 {
-		return ""
+	convertOpts, images := noteOptions(ctx, meta, opts)
+	output, warnings, err := doc.MarkdownContext(ctx, convertOpts...)
+	if err != nil {
+		return "", warnings, err
 	}
-
-	header := normalizeRow(rows[0], colCount)
-	lines := []string{formatTableRow(header), formatTableSeparator(colCount)}
-	for _, row := range rows[1:] {
-		lines = append(lines, formatTableRow(normalizeRow(row, colCount)))
+	if images.err != nil {
+		return "", warnings, images.err
 	}
-
-	return strings.Join(lines, "\n")
-}
-
-func renderTableRow(row Node, ctx RenderContext) []string {
-	var cells []string
-	for _, cell := range row.Content {
-		switch cell.Type {
-		case "table_header", "table_cell":
-			cells = append(cells, renderTableCell(cell, ctx))
-		}
+	if meta.sidecar != nil {
+		meta.sidecar.addDropped(warnings)
 	}
-	return cells
-}
-
-func renderTableCell(cell Node, ctx RenderContext) string {
-	text := renderCellContent(cell.Content, ctx)
-	text = strings.ReplaceAll(text, "\n", "<br>")
-	text = escapeTableCell(text)
-	return text
+	switch opts.contributors {
+	case contributorsFrontMatter:
+		meta.contributors = contributorNames(ctx, doc, opts)
+	case contributorsAppendix:
+		output = appendContributors(output, contributorNames(ctx, doc, opts))
+	}
+	output, err = appendFooter(output, *meta, opts)
+	return output, warnings, err
 }
 
-func renderCellContent(nodes []Node, ctx RenderContext) string {
-	var parts []string
-	for _, node := range nodes {
-		switch node.Type {
-		case "paragraph":
-			if len(node.Content) > 0 {
-				parts = append(parts, renderInline(node.Content))
-			}
-		case "text":
-			parts = append(parts, applyMarks(node.Text, node.Marks))
-		default:
-			if len(node.Content) > 0 {
-				parts = append(parts, renderCellContent(node.Content, ctx))
-			}
-		}
+// selectSection cuts doc down to the part chosen with --section, or --from
+// and --to.
+func selectSection(doc *boxnote.Document, opts options) error {
+	var err error
+	switch {
+	case opts.section != "" && (opts.sectionFrom != "" || opts.sectionTo != ""):
+		return &exitError{code: exitUsage, err: errors.New("--section cannot be combined with --from or --to")}
+	case opts.section != "":
+		err = doc.SelectSection(opts.section)
+	case opts.sectionFrom != "" || opts.sectionTo != "":
+		err = doc.SelectRange(opts.sectionFrom, opts.sectionTo)
 	}
-	return strings.Join(parts, "<br>")
+	if err != nil {
+		return &exitError{code: exitFailure, err: err}
+	}
+	return nil
 }
 
-func applyMarks(text string, marks []Mark) string {
-	filtered := filterMarks(marks)
-	if len(filtered) == 0 {
-		return text
+// noteOptions returns the conversion options for the note described by
+// meta, whose titleMode is settled. Image failures are recorded in the
+// returned imageRewriter.
+func noteOptions(ctx context.Context, meta *noteMeta, opts options) ([]boxnote.ConvertOption, *imageRewriter) {
+	heading := ""
+	if meta.titleMode == titleModeH1 {
+		heading = meta.title
 	}
-
-	hasStrong := hasMarkType(filtered, "strong")
-	hasEm := hasMarkType(filtered, "em")
-	hasStrike := hasMarkType(filtered, "strikethrough")
-	hasCode := hasMarkType(filtered, "code")
-	hasLink := hasMarkType(filtered, "link")
-	emDelimiter := "*"
-	if hasStrong && hasEm {
-		emDelimiter = "_"
+	convertOpts := convertOptions(opts, heading)
+	if opts.markdown.doneDates {
+		// Items are checked no later than the last change of the note.
+		convertOpts = append(convertOpts, boxnote.WithDoneDates(meta.modified))
 	}
-	if !hasCode {
-		text = escapeForMarkdown(text, emDelimiter, hasStrong, hasStrike)
+	rewrite := linkRewrite(meta, opts)
+	if opts.export != nil && meta.outputPath != "" {
+		var exportOpts []boxnote.ConvertOption
+		rewrite, exportOpts = opts.export.noteOptions(meta, &opts, rewrite)
+		convertOpts = append(convertOpts, exportOpts...)
 	}
-	if (hasStrong || hasEm || hasStrike || hasCode) && !hasLink {
-		text = padWithZeroWidthSpace(text)
+	images := &imageRewriter{ctx: ctx, outputPath: meta.outputPath, opts: opts}
+	imageSource := images.source
+	if opts.linkCheck != nil && meta.outputPath != "" {
+		opts.linkCheck.addOutput(meta.outputPath)
+		imageSource = opts.linkCheck.collectImages(meta.outputPath, imageSource)
+		rewrite = opts.linkCheck.collect(meta.outputPath, rewrite)
 	}
-
-	sort.SliceStable(filtered, func(i, j int) bool {
-		return markOrder(filtered[i].Type) < markOrder(filtered[j].Type)
-	})
-
-	for i := len(filtered) - 1; i >= 0; i-- {
-		mark := filtered[i]
-		switch mark.Type {
-		case "link":
-			href, ok := getStringAttr(mark.Attrs, "href")
-			if !ok || href == "" {
-				continue
-			}
-			text = fmt.Sprintf("[%s](%s)", escapeLinkText(text), href)
-		case "strong":
-			text = "**" + text + "**"
-		case "em":
-			text = emDelimiter + text + emDelimiter
-		case "underline":
-			text = "<u>" + text + "</u>"
-		case "strikethrough":
-			text = "~~" + text + "~~"
-		case "code":
-			text = wrapInlineCode(text)
-		}
+	convertOpts = append(convertOpts, boxnote.WithImageSource(imageSource))
+	if rewrite != nil {
+		convertOpts = append(convertOpts, boxnote.WithLinkRewrite(rewrite))
 	}
-	return text
+	return convertOpts, images
 }
 
-func filterMarks(marks []Mark) []Mark {
-	var filtered []Mark
-	for _, mark := range marks {
-		switch mark.Type {
-		case "author_id", "font_size", "font_color", "highlight":
-			continue
-		default:
-			filtered = append(filtered, mark)
-		}
+func processStdin(ctx context.Context, opts options) (fileResult, error) {
+	if opts.stream {
+		return streamStdin(ctx, opts)
 	}
-	return filtered
-}
-
-func markOrder(markType string) int {
-	switch markType {
-	case "link":
-		return 0
-	case "strong":
-		return 1
-	case "em":
-		return 2
-	case "underline":
-		return 3
-	case "strikethrough":
-		return 4
-	case "code":
-		return 5
-	default:
-		return 100
+	var result fileResult
+	input, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return result, &exitError{code: exitIO, err: fmt.Errorf("failed to read stdin: %w", err)}
 	}
-}
-
-func wrapInlineCode(text string) string {
-	if !strings.Contains(text, "`") {
-		return "`" + text + "`"
+	result.InputBytes = len(input)
+	if len(strings.TrimSpace(string(input))) == 0 {
+		return result, nil
 	}
-	max := maxConsecutiveBackticks(text)
-	fence := strings.Repeat("`", max+1)
-	return fence + text + fence
-}
 
-func hasMarkType(marks []Mark, markType string) bool {
-	for _, mark := range marks {
-		if mark.Type == markType {
-			return true
-		}
+	ctx, cancel := withTimeout(ctx, opts.timeout)
+	defer cancel()
+	if opts.splitBy != splitNone {
+		return result, &exitError{code: exitUsage, err: errors.New("--split-by writes files; give the note as a file, not on stdin")}
 	}
-	return false
-}
-
-func maxConsecutiveBackticks(text string) int {
-	max := 0
-	current := 0
-	for _, r := range text {
-		if r == '`' {
-			current++
-			if current > max {
-				max = current
-			}
-		} else {
-			current = 0
-		}
+	meta := noteMeta{title: opts.title}
+	output, warnings, err := renderNote(ctx, input, &meta, opts)
+	result.Warnings = warnings
+	if err != nil {
+		return result, renderFailure(err)
 	}
-	return max
-}
+	if opts.strict && len(warnings) > 0 {
+		printWarnings(stdinName, warnings)
+		return result, &exitError{code: exitWarnings, err: fmt.Errorf("%d conversion warning(s)", len(warnings))}
+	}
+	printUnknown(stdinName, warnings)
+	printSanitized(stdinName, warnings)
 
-func getIntAttr(attrs map[string]interface{}, key string) int {
-	if attrs == nil {
-		return 0
-	}
-	value, ok := attrs[key]
-	if !ok {
-		return 0
-	}
-	switch v := value.(type) {
-	case float64:
-		return int(v)
-	case int:
-		return v
-	case json.Number:
-		intValue, err := v.Int64()
-		if err == nil {
-			return int(intValue)
-		}
+	output = finishOutput(prependFrontMatter(output, meta, opts), opts.eol)
+	if _, err := fmt.Fprint(os.Stdout, output); err != nil {
+		return result, &exitError{code: exitIO, err: fmt.Errorf("failed to write stdout: %w", err)}
 	}
-	return 0
+	result.OutputBytes = len(output)
+	return result, nil
 }
 
-func getBoolAttr(attrs map[string]interface{}, key string) bool {
-	if attrs == nil {
-		return false
+// processFile converts file, the index-th input of the run, into its
+// output file.
+func processFile(ctx context.Context, file inputFile, index int, opts options) (fileResult, error) {
+	inputPath := file.Path
+	outputPath, info, err := inputOutputPath(file, index, opts)
+	if err != nil {
+		return fileResult{}, err
 	}
-	value, ok := attrs[key]
-	if !ok {
-		return false
+	if index <= len(opts.plannedOutputs) && opts.plannedOutputs[index-1] != "" {
+		outputPath = opts.plannedOutputs[index-1]
 	}
-	boolValue, ok := value.(bool)
-	return ok && boolValue
-}
-
-func getStringAttr(attrs map[string]interface{}, key string) (string, bool) {
-	if attrs == nil {
-		return "", false
+	if opts.stream {
+		return streamToFile(ctx, inputPath, fileNoteMeta(inputPath, info), outputPath, opts)
 	}
-	value, ok := attrs[key]
-	if !ok {
-		return "", false
+	buf := inputBuffers.Get().(*bytes.Buffer)
+	defer putInputBuffer(buf)
+	input, err := readInput(inputPath, buf)
+	if err != nil {
+		return fileResult{}, &exitError{code: exitIO, err: fmt.Errorf("failed to read: %w", err)}
 	}
-	stringValue, ok := value.(string)
-	return stringValue, ok
+	return convertToFile(ctx, input, fileNoteMeta(inputPath, info), outputPath, opts)
 }
 
-func clampInt(value, minValue, maxValue int) int {
-	if value < minValue {
-		return minValue
+// inputOutputPath resolves the output path of file, the index-th input of
+// the run.
+func inputOutputPath(file inputFile, index int, opts options) (string, os.FileInfo, error) {
+	inputPath := file.Path
+	if info, err := os.Stat(inputPath); err == nil && info.IsDir() {
+		return "", nil, fmt.Errorf("is a directory (use -r to convert the notes below it)")
 	}
-	if value > maxValue {
-		return maxValue
+	info, err := os.Stat(inputPath)
+	if err != nil {
+		return "", nil, &exitError{code: exitIO, err: fmt.Errorf("failed to stat: %w", err)}
 	}
-	return value
+	outputPath, err := resolveOutputPath(placeInput(file, opts.outDir), newNameFields(inputPath, info.ModTime(), index), opts)
+	if err != nil {
+		return "", nil, err
+	}
+	return outputPath, info, nil
 }
 
-func indentMultiline(text string, indent int) string {
-	lines := strings.Split(text, "\n")
-	if len(lines) == 0 {
-		return text
+// convertToFile renders input and writes it to outputPath. meta names the
+// note for diagnostics, the H1 title, and front matter.
+func convertToFile(ctx context.Context, input []byte, meta noteMeta, outputPath string, opts options) (fileResult, error) {
+	sourcePath := meta.source
+	result := fileResult{InputBytes: len(input), OutputPath: outputPath}
+	digest := inputDigest(input)
+	if opts.skipUnchanged && isUnchanged(outputPath, digest, optionsDigest(opts)) {
+		result.Skipped = true
+		opts.manifest.record(meta, digest, outputPath, opts)
+		return result, nil
 	}
-	for i := 1; i < len(lines); i++ {
-		lines[i] = strings.Repeat(" ", indent) + lines[i]
+	if opts.marker && markerMatches(outputPath, digest, optionsDigest(opts)) {
+		result.Skipped = true
+		opts.manifest.record(meta, digest, outputPath, opts)
+		return result, nil
 	}
-	return strings.Join(lines, "\n")
-}
 
-func indentAllLines(text string, indent int) string {
-	if text == "" {
-		return ""
+	if err := prepareOverwrite(outputPath, opts); err != nil {
+		return result, err
 	}
-	lines := strings.Split(text, "\n")
-	prefix := strings.Repeat(" ", indent)
-	for i, line := range lines {
-		if line == "" {
-			lines[i] = prefix
-			continue
+
+	if len(strings.TrimSpace(string(input))) == 0 {
+		if err := writeOutput(outputPath, "", digest, opts); err != nil {
+			return result, err
 		}
-		lines[i] = prefix + line
+		opts.commit.addOutput(outputPath, sourcePath, digest)
+		opts.manifest.record(meta, digest, outputPath, opts)
+		return result, nil
+	}
+
+	ctx, cancel := withTimeout(ctx, opts.timeout)
+	defer cancel()
+	meta.outputPath = outputPath
+	var output string
+	var parts []splitPart
+	var warnings []boxnote.Warning
+	var err error
+	if opts.splitBy != splitNone {
+		output, parts, warnings, err = renderSplit(ctx, input, &meta, opts)
+	} else {
+		output, warnings, err = renderNote(ctx, input, &meta, opts)
 	}
-	return strings.Join(lines, "\n")
-}
+	result.Warnings = warnings
+	if err != nil {
+		return result, renderFailure(err)
+	}
+	if opts.strict && len(warnings) > 0 {
+		printWarnings(sourcePath, warnings)
+		return result, &exitError{code: exitWarnings, err: fmt.Errorf("%d conversion warning(s)", len(warnings))}
+	}
+	printUnknown(sourcePath, warnings)
+	printSanitized(sourcePath, warnings)
 
-func prefixLines(text, prefix string) string {
-	lines := strings.Split(text, "\n")
-	for i, line := range lines {
-		if line == "" {
-			lines[i] = strings.TrimRight(prefix, " ")
-			continue
+	output = prependFrontMatter(output, meta, opts)
+	if opts.marker {
+		output = insertMarker(output, digest, optionsDigest(opts))
+	}
+	output = finishOutput(output, opts.eol)
+	if err := writeSplitParts(parts, sourcePath, digest, opts); err != nil {
+		return result, err
+	}
+	if err := writeOutput(outputPath, output, digest, opts); err != nil {
+		return result, err
+	}
+	opts.commit.addOutput(outputPath, sourcePath, digest)
+	opts.manifest.record(meta, digest, outputPath, opts)
+	if meta.sidecar != nil {
+		meta.sidecar.Source = filepath.Base(sourcePath)
+		meta.sidecar.SourceSHA256 = digest
+		if err := writeSidecar(outputPath, meta.sidecar, opts); err != nil {
+			return result, err
 		}
-		lines[i] = prefix + line
 	}
-	return strings.Join(lines, "\n")
+	result.OutputBytes = len(output)
+	return result, nil
 }
 
-func escapeTableCell(text string) string {
-	return strings.ReplaceAll(text, "|", "\\|")
-}
-
-func escapeLinkText(text string) string {
-	replacer := strings.NewReplacer(
-		"\\", "\\\\",
-		"[", "\\[",
-		"]", "\\]",
-		"(", "\\(",
-		")", "\\)",
-	)
-	return replacer.Replace(text)
-}
-
-func escapeForMarkdown(text, emDelimiter string, hasStrong, hasStrike bool) string {
-	text = strings.ReplaceAll(text, "\\", "\\\\")
-	if emDelimiter == "*" || hasStrong {
-		text = strings.ReplaceAll(text, "*", "\\*")
+// prepareOverwrite confirms overwriting an existing output, unless -f is
+// given, and backs it up. Outputs in a store replace earlier versions
+// without asking.
+func prepareOverwrite(outputPath string, opts options) error {
+	if opts.store != nil || !exists(outputPath) {
+		return nil
 	}
-	if emDelimiter == "_" {
-		text = strings.ReplaceAll(text, "_", "\\_")
+	if !opts.forceOverwrite {
+		confirmed, err := confirmOverwrite(outputPath)
+		if err != nil {
+			return &exitError{code: exitIO, err: err}
+		}
+		if !confirmed {
+			return fmt.Errorf("overwrite declined")
+		}
 	}
-	if hasStrike {
-		text = strings.ReplaceAll(text, "~", "\\~")
+	if err := backupFile(outputPath, opts.backup); err != nil {
+		return &exitError{code: exitIO, err: err}
 	}
-	return text
+	return nil
 }
 
-func padWithZeroWidthSpace(text string) string {
-	if text == "" {
-		return text
+func writeOutput(outputPath, output, digest string, opts options) error {
+	if opts.store != nil {
+		return writeStored(outputPath, []byte(output), opts)
 	}
-	zwsp := "\u200B"
-	if !strings.HasPrefix(text, zwsp) {
-		if r, ok := firstRune(text); ok && !unicode.IsSpace(r) && isYakumono(r) {
-			text = zwsp + text
-		}
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return &exitError{code: exitIO, err: fmt.Errorf("failed to create output directory: %w", err)}
+	}
+	if err := writeFileAtomic(outputPath, []byte(output), 0644, opts.fsync); err != nil {
+		return &exitError{code: exitIO, err: fmt.Errorf("failed to write: %w", err)}
 	}
-	if !strings.HasSuffix(text, zwsp) {
-		if r, ok := lastRune(text); ok && !unicode.IsSpace(r) && isYakumono(r) {
-			text = text + zwsp
+	if opts.skipUnchanged {
+		if err := recordDigest(outputPath, digest, optionsDigest(opts)); err != nil {
+			return &exitError{code: exitIO, err: err}
 		}
+		opts.commit.add(cachePathFor(outputPath))
 	}
-	return text
+	return nil
 }
 
-func isYakumono(r rune) bool {
-	switch r {
-	case '、', '。', '，', '．', '｡', '､', '･', '・',
-		'：', '；', '！', '？', '!', '?',
-		'「', '」', '『', '』', '（', '）', '［', '］', '【', '】',
-		'〈', '〉', '《', '》', '“', '”', '‘', '’',
-		'…', '‥', '〜', '～', 'ー', '—', '―', '‐', '‑', 'ｰ':
-		return true
-	default:
-		return false
-	}
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
 }
 
-func firstRune(text string) (rune, bool) {
-	for _, r := range text {
-		return r, true
-	}
-	return 0, false
-}
+// stdinReader is shared by every interactive prompt so that buffered input
+// is not lost between prompts.
+var stdinReader = bufio.NewReader(os.Stdin)
 
-func lastRune(text string) (rune, bool) {
-	var last rune
-	found := false
-	for _, r := range text {
-		last = r
-		found = true
-	}
-	return last, found
-}
+// promptMu keeps the prompts of notes converted at once from interleaving.
+var promptMu sync.Mutex
 
-func normalizeRow(row []string, colCount int) []string {
-	if len(row) == colCount {
-		return row
-	}
-	if len(row) > colCount {
-		return row[:colCount]
+func confirmOverwrite(path string) (bool, error) {
+	promptMu.Lock()
+	defer promptMu.Unlock()
+	fmt.Fprintf(os.Stderr, "overwrite %s? [y/N]: ", path)
+	line, err := stdinReader.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, fmt.Errorf("failed to read overwrite confirmation: %w", err)
 	}
-	normalized := make([]string, colCount)
-	copy(normalized, row)
-	return normalized
+	answer := strings.TrimSpace(strings.ToLower(line))
+	return answer == "y" || answer == "yes", nil
 }
 
-func formatTableRow(row []string) string {
-	for i, cell := range row {
-		row[i] = strings.TrimSpace(cell)
-	}
-	return "| " + strings.Join(row, " | ") + " |"
+func outputPathFor(inputPath string) string {
+	return strings.TrimSuffix(inputPath, ".boxnote") + ".md"
 }
 
-func formatTableSeparator(colCount int) string {
-	if colCount <= 0 {
-		return ""
-	}
-	parts := make([]string, colCount)
-	for i := range parts {
-		parts[i] = "---"
-	}
-	return "| " + strings.Join(parts, " | ") + " |"
+const (
+	titleFromFilename        = "filename"
+	titleFromFirstHeading    = "first-heading"
+	titleFromFrontMatterOnly = "front-matter-only"
+)
+
+var titleFromChoices = []string{titleFromFilename, titleFromFirstHeading, titleFromFrontMatterOnly}
+
+const (
+	titleModeH1          = "h1"
+	titleModeFrontMatter = "front-matter"
+	titleModeNone        = "none"
+)
+
+var titleModeChoices = []string{titleModeH1, titleModeFrontMatter, titleModeNone}
+
+func titleFromPath(inputPath string) string {
+	base := filepath.Base(inputPath)
+	return strings.TrimSuffix(base, ".boxnote")
 }
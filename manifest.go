@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// conversionManifest is the JSON document written by --manifest. It maps
+// every note converted into the tree to its output, so that later runs can
+// find the notes without scanning the outputs again. Entries from an
+// existing manifest are kept unless their note is converted again.
+type conversionManifest struct {
+	mu        sync.Mutex
+	Generator string          `json:"generator"`
+	Notes     []*manifestNote `json:"notes"`
+	// dir is the directory of the manifest; paths in it are relative to
+	// dir.
+	dir   string
+	byKey map[string]*manifestNote
+}
+
+type manifestNote struct {
+	// Source is the input file, empty for notes fetched from Box.
+	Source     string `json:"source,omitempty"`
+	Name       string `json:"name,omitempty"`
+	BoxFileID  string `json:"box_file_id,omitempty"`
+	SharedLink string `json:"shared_link,omitempty"`
+	SHA256     string `json:"sha256,omitempty"`
+	Modified   string `json:"modified,omitempty"`
+	Output     string `json:"output"`
+}
+
+// key identifies the note of an entry across runs: its Box file ID, or its
+// input file.
+func (n *manifestNote) key() string {
+	if n.BoxFileID != "" {
+		return "box:" + n.BoxFileID
+	}
+	return "file:" + n.Source
+}
+
+// loadManifest reads the manifest at path; a missing file is an empty
+// manifest.
+func loadManifest(path string) (*conversionManifest, error) {
+	v, _, _ := buildInfo()
+	m := &conversionManifest{
+		Generator: programName + " " + v,
+		Notes:     []*manifestNote{},
+		dir:       filepath.Dir(path),
+		byKey:     map[string]*manifestNote{},
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var previous struct {
+		Notes []*manifestNote `json:"notes"`
+	}
+	if err := json.Unmarshal(data, &previous); err != nil {
+		return nil, fmt.Errorf("malformed manifest %s: %w", path, err)
+	}
+	for _, note := range previous.Notes {
+		if note == nil || note.Output == "" {
+			continue
+		}
+		if _, ok := m.byKey[note.key()]; ok {
+			continue
+		}
+		m.byKey[note.key()] = note
+		m.Notes = append(m.Notes, note)
+	}
+	return m, nil
+}
+
+// prepareManifest loads --manifest into opts, and adds the outputs of the
+// notes it knows to opts.noteLinks, so that links to notes converted by
+// earlier runs are rewritten too.
+func prepareManifest(opts *options) error {
+	if opts.manifestPath == "" {
+		return nil
+	}
+	m, err := loadManifest(opts.manifestPath)
+	if err != nil {
+		return err
+	}
+	opts.manifest = m
+	for _, note := range m.Notes {
+		if note.BoxFileID == "" {
+			continue
+		}
+		if opts.noteLinks == nil {
+			opts.noteLinks = newNoteLinks()
+		}
+		file := boxFile{ID: note.BoxFileID}
+		if note.SharedLink != "" {
+			file.SharedLink = &boxSharedLink{URL: note.SharedLink}
+		}
+		opts.noteLinks.add(file, m.path(note.Output))
+	}
+	return nil
+}
+
+// path resolves a path recorded in the manifest.
+func (m *conversionManifest) path(rel string) string {
+	if filepath.IsAbs(rel) || isStoreLocation(rel) {
+		return rel
+	}
+	return filepath.Join(m.dir, filepath.FromSlash(rel))
+}
+
+// rel returns path as recorded in the manifest.
+func (m *conversionManifest) rel(path string) string {
+	if isStoreLocation(path) {
+		return path
+	}
+	if rel, err := relativePath(m.dir, path); err == nil {
+		path = rel
+	}
+	return filepath.ToSlash(path)
+}
+
+// record adds the note described by meta, converted to outputPath. digest
+// is the SHA-256 of the input; it is computed from the input file when
+// empty.
+func (m *conversionManifest) record(meta noteMeta, digest, outputPath string, opts options) {
+	if m == nil {
+		return
+	}
+	note := &manifestNote{BoxFileID: meta.boxID, SharedLink: meta.sharedLink, SHA256: digest}
+	if meta.boxID == "" {
+		note.Source = m.rel(meta.source)
+		if digest == "" {
+			note.SHA256 = fileDigest(meta.source)
+		}
+	} else {
+		note.Name = meta.source
+	}
+	if !meta.modified.IsZero() {
+		note.Modified = meta.modified.UTC().Format(time.RFC3339)
+	}
+	if opts.store != nil {
+		if name, err := storeKey(opts.outDir, outputPath); err == nil {
+			outputPath = opts.store.location(name)
+		}
+	}
+	note.Output = m.rel(outputPath)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if previous, ok := m.byKey[note.key()]; ok {
+		*previous = *note
+		return
+	}
+	m.byKey[note.key()] = note
+	m.Notes = append(m.Notes, note)
+}
+
+// boxNote returns the entry of the note with the Box file ID id, or nil.
+func (m *conversionManifest) boxNote(id string) *manifestNote {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.byKey["box:"+id]
+}
+
+// remove drops the entry of a note that no longer exists.
+func (m *conversionManifest) remove(note *manifestNote) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.byKey, note.key())
+	for i, n := range m.Notes {
+		if n == note {
+			m.Notes = append(m.Notes[:i], m.Notes[i+1:]...)
+			break
+		}
+	}
+}
+
+func writeManifest(path string, manifest *conversionManifest) {
+	if manifest == nil {
+		return
+	}
+	manifest.mu.Lock()
+	defer manifest.mu.Unlock()
+	sort.SliceStable(manifest.Notes, func(i, j int) bool {
+		return manifest.Notes[i].Output < manifest.Notes[j].Output
+	})
+	data, err := marshalJSON(manifest)
+	if err != nil {
+		fatal(exitFailure, "failed to encode manifest", err)
+	}
+	if err := writeFileAtomic(path, data, 0644, false); err != nil {
+		fatal(exitIO, fmt.Sprintf("failed to write manifest %s", path), err)
+	}
+}
+
+// isStoreLocation reports whether path is the URL of an object in a store.
+func isStoreLocation(path string) bool {
+	for scheme := range storeSchemes {
+		if strings.HasPrefix(path, scheme+"://") {
+			return true
+		}
+	}
+	return false
+}
+
+// relativePath is filepath.Rel that also relates an absolute path to a
+// relative one, through the working directory.
+func relativePath(base, target string) (string, error) {
+	if filepath.IsAbs(base) != filepath.IsAbs(target) {
+		var err error
+		if base, err = filepath.Abs(base); err != nil {
+			return "", err
+		}
+		if target, err = filepath.Abs(target); err != nil {
+			return "", err
+		}
+	}
+	return filepath.Rel(base, target)
+}
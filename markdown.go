@@ -0,0 +1,269 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/dayflower/boxnote2md/pkg/boxnote"
+)
+
+// markdownStyle holds the Markdown output settings given on the command line.
+type markdownStyle struct {
+	flavor      string
+	bullet      string
+	escaping    string
+	hardBreak   string
+	headingIDs  string
+	keepUnknown string
+	tableMode   string
+	headerless  string
+	htmlBlocks  bool
+	keepEmpty   bool
+	rawHTML     string
+	lists       string
+	callouts    string
+	alignment   string
+	indent      string
+	tasks       string
+	doneDates   bool
+	joinCJK     bool
+	zwsp        string
+	emoji       string
+	ideographic bool
+	toc         tocDepth
+	shift       headingShift
+	nodes       nodeTemplateFile
+	marks       markStyleFile
+}
+
+var defaultMarkdownStyle = markdownStyle{
+	flavor:      string(boxnote.FlavorGFM),
+	bullet:      "-",
+	escaping:    string(boxnote.EscapeMarked),
+	hardBreak:   string(boxnote.HardBreakBackslash),
+	headingIDs:  string(boxnote.HeadingIDsNone),
+	keepUnknown: string(boxnote.UnknownNodesSkip),
+	tableMode:   string(boxnote.TableModePipe),
+	headerless:  string(boxnote.HeaderlessTableEmpty),
+	rawHTML:     string(boxnote.RawHTMLAllow),
+	lists:       string(boxnote.ListAuto),
+	callouts:    string(boxnote.CalloutsQuote),
+	alignment:   string(boxnote.AlignmentNone),
+	indent:      string(boxnote.IndentNone),
+	tasks:       string(boxnote.TasksCheckbox),
+	zwsp:        string(boxnote.ZeroWidthSpaceChar),
+	emoji:       string(boxnote.EmojiKeep),
+}
+
+var (
+	flavorChoices     = []string{string(boxnote.FlavorGFM), string(boxnote.FlavorCommonMark), string(boxnote.FlavorPandoc)}
+	bulletChoices     = []string{"-", "*", "+"}
+	escapingChoices   = []string{string(boxnote.EscapeMarked), string(boxnote.EscapeAll), string(boxnote.EscapeNone)}
+	hardBreakChoices  = []string{string(boxnote.HardBreakBackslash), string(boxnote.HardBreakSpaces), string(boxnote.HardBreakHTML)}
+	headingIDChoices  = []string{string(boxnote.HeadingIDsNone), string(boxnote.HeadingIDsAttr), string(boxnote.HeadingIDsHTML)}
+	unknownChoices    = []string{string(boxnote.UnknownNodesComment), string(boxnote.UnknownNodesFence), string(boxnote.UnknownNodesSkip)}
+	tableModeChoices  = []string{string(boxnote.TableModePipe), string(boxnote.TableModeHTML), string(boxnote.TableModeAuto)}
+	headerlessChoices = []string{string(boxnote.HeaderlessTableEmpty), string(boxnote.HeaderlessTableFirstRow), string(boxnote.HeaderlessTableHTML)}
+	rawHTMLChoices    = []string{string(boxnote.RawHTMLAllow), string(boxnote.RawHTMLEscape), string(boxnote.RawHTMLStrip)}
+	listChoices       = []string{string(boxnote.ListAuto), string(boxnote.ListTight), string(boxnote.ListLoose)}
+	calloutChoices    = []string{string(boxnote.CalloutsQuote), string(boxnote.CalloutsObsidian), string(boxnote.CalloutsAlerts)}
+	alignmentChoices  = []string{string(boxnote.AlignmentNone), string(boxnote.AlignmentDiv), string(boxnote.AlignmentStyle)}
+	indentChoices     = []string{string(boxnote.IndentNone), string(boxnote.IndentQuote), string(boxnote.IndentNBSP), string(boxnote.IndentSpaces)}
+	taskChoices       = []string{string(boxnote.TasksCheckbox), string(boxnote.TasksObsidian)}
+	zwspChoices       = []string{string(boxnote.ZeroWidthSpaceChar), string(boxnote.ZeroWidthSpaceEntity), string(boxnote.ZeroWidthSpaceHTML)}
+	emojiChoices      = []string{string(boxnote.EmojiKeep), string(boxnote.EmojiUnicode), string(boxnote.EmojiShortcode)}
+)
+
+// choiceFlag is a flag.Value restricted to a fixed set of strings.
+type choiceFlag struct {
+	value   *string
+	choices []string
+}
+
+func (f choiceFlag) String() string {
+	if f.value == nil {
+		return ""
+	}
+	return *f.value
+}
+
+func (f choiceFlag) Set(value string) error {
+	for _, choice := range f.choices {
+		if value == choice {
+			*f.value = value
+			return nil
+		}
+	}
+	return fmt.Errorf("must be one of %s", strings.Join(f.choices, ", "))
+}
+
+// defaultTOCDepth is the depth of a --toc given without one.
+const defaultTOCDepth = 3
+
+// tocDepth is the flag.Value of --toc: a boolean flag that also takes a
+// depth, as --toc=2. Zero leaves the table of contents out.
+type tocDepth int
+
+func (d *tocDepth) String() string {
+	if d == nil || *d == 0 {
+		return "0"
+	}
+	return strconv.Itoa(int(*d))
+}
+
+func (d *tocDepth) Set(value string) error {
+	switch value {
+	case "true":
+		*d = defaultTOCDepth
+		return nil
+	case "false":
+		*d = 0
+		return nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 || n > 6 {
+		return fmt.Errorf("must be a heading depth from 0 to 6")
+	}
+	*d = tocDepth(n)
+	return nil
+}
+
+func (d *tocDepth) IsBoolFlag() bool { return true }
+
+// headingShiftAuto is the --shift-headings value that demotes the headings
+// only when a title H1 is added.
+const headingShiftAuto = "auto"
+
+// headingShift is the flag.Value of --shift-headings: a number of levels,
+// or auto.
+type headingShift struct {
+	levels int
+	auto   bool
+}
+
+func (s *headingShift) String() string {
+	if s == nil {
+		return "0"
+	}
+	if s.auto {
+		return headingShiftAuto
+	}
+	return strconv.Itoa(s.levels)
+}
+
+func (s *headingShift) Set(value string) error {
+	if value == headingShiftAuto {
+		*s = headingShift{auto: true}
+		return nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < -5 || n > 5 {
+		return fmt.Errorf("must be a number of levels from -5 to 5, or %s", headingShiftAuto)
+	}
+	*s = headingShift{levels: n}
+	return nil
+}
+
+func (s headingShift) option() boxnote.ConvertOption {
+	if s.auto {
+		return boxnote.WithShiftHeadingsAuto()
+	}
+	return boxnote.WithShiftHeadings(s.levels)
+}
+
+// nodeTemplateFile is the flag.Value of --node-templates: a JSON object
+// mapping node types to the templates they are rendered with.
+type nodeTemplateFile struct {
+	path      string
+	templates map[string]string
+}
+
+func (f *nodeTemplateFile) String() string {
+	return f.path
+}
+
+func (f *nodeTemplateFile) Set(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	templates := map[string]string{}
+	if err := json.Unmarshal(data, &templates); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	for nodeType, template := range templates {
+		if err := boxnote.ValidateNodeTemplate(template); err != nil {
+			return fmt.Errorf("%s: %s: %w", path, nodeType, err)
+		}
+	}
+	f.path = path
+	f.templates = templates
+	return nil
+}
+
+// markStyleFile is the flag.Value of --mark-styles: a JSON object mapping
+// mark types to the boxnote.MarkStyle they are written with.
+type markStyleFile struct {
+	path   string
+	styles map[string]boxnote.MarkStyle
+}
+
+func (f *markStyleFile) String() string {
+	return f.path
+}
+
+func (f *markStyleFile) Set(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	styles := map[string]boxnote.MarkStyle{}
+	if err := json.Unmarshal(data, &styles); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	for markType, style := range styles {
+		if err := boxnote.ValidateMarkStyle(markType, style); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	f.path = path
+	f.styles = styles
+	return nil
+}
+
+// convertOptions translates the CLI settings into library options. A
+// non-empty title is rendered as the leading H1.
+func convertOptions(opts options, title string) []boxnote.ConvertOption {
+	style := opts.markdown
+	return []boxnote.ConvertOption{
+		boxnote.WithFlavor(boxnote.Flavor(style.flavor)),
+		boxnote.WithBullet([]rune(style.bullet)[0]),
+		boxnote.WithEscaping(boxnote.Escaping(style.escaping)),
+		boxnote.WithHardBreak(boxnote.HardBreak(style.hardBreak)),
+		boxnote.WithHeadingIDs(boxnote.HeadingIDs(style.headingIDs)),
+		boxnote.WithUnknownNodes(boxnote.UnknownNodes(style.keepUnknown)),
+		boxnote.WithTableMode(boxnote.TableMode(style.tableMode)),
+		boxnote.WithHeaderlessTables(boxnote.HeaderlessTable(style.headerless)),
+		boxnote.WithHTMLBlocks(style.htmlBlocks),
+		boxnote.WithEmptyParagraphs(style.keepEmpty),
+		boxnote.WithRawHTML(boxnote.RawHTML(style.rawHTML)),
+		boxnote.WithListStyle(boxnote.ListStyle(style.lists)),
+		boxnote.WithCallouts(boxnote.Callouts(style.callouts)),
+		boxnote.WithAlignment(boxnote.Alignment(style.alignment)),
+		boxnote.WithIndent(boxnote.Indent(style.indent)),
+		boxnote.WithTasks(boxnote.Tasks(style.tasks)),
+		boxnote.WithJoinCJKLines(style.joinCJK),
+		boxnote.WithZeroWidthSpace(boxnote.ZeroWidthSpace(style.zwsp)),
+		boxnote.WithEmoji(boxnote.Emoji(style.emoji)),
+		boxnote.WithIdeographicSpaceEntities(style.ideographic),
+		boxnote.WithDateLayout(opts.locale.dateLayout()),
+		boxnote.WithTableOfContents(int(style.toc)),
+		style.shift.option(),
+		boxnote.WithNodeTemplates(style.nodes.templates),
+		boxnote.WithMarkStyles(style.marks.styles),
+		boxnote.WithTitle(title),
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// markerPrefix starts the HTML comment that --marker embeds in outputs to
+// record what produced them.
+const markerPrefix = "<!-- " + programName + " "
+
+// markerLines bounds how far into an output the marker is looked for; it
+// follows the front matter, if any.
+const markerLines = 64
+
+// formatMarker returns the marker of an input with digest, converted with
+// options of the given optionsDigest.
+func formatMarker(digest, options string) string {
+	v, _, _ := buildInfo()
+	return fmt.Sprintf("%ssource-sha256=%s options-sha256=%s version=%s -->", markerPrefix, digest, options, v)
+}
+
+// insertMarker places the marker at the top of output, after the front
+// matter block when there is one so that it stays first in the file.
+func insertMarker(output, digest, options string) string {
+	marker := formatMarker(digest, options) + "\n\n"
+	if strings.HasPrefix(output, "---\n") {
+		if end := strings.Index(output[4:], "\n---\n\n"); end >= 0 {
+			split := 4 + end + len("\n---\n\n")
+			return output[:split] + marker + output[split:]
+		}
+	}
+	return marker + output
+}
+
+// markerMatches reports whether the output at path carries the marker for
+// an input with digest, converted by this version with the same options.
+func markerMatches(path, digest, options string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	want := formatMarker(digest, options)
+	scanner := bufio.NewScanner(file)
+	for i := 0; i < markerLines && scanner.Scan(); i++ {
+		line := scanner.Text()
+		if strings.HasPrefix(line, markerPrefix) {
+			return line == want
+		}
+	}
+	return false
+}
@@ -0,0 +1,432 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// markdownIssue is a construct in converted Markdown that a CommonMark or
+// GFM parser reads differently than the converter meant.
+type markdownIssue struct {
+	// line is 1-based.
+	line    int
+	message string
+}
+
+var (
+	listMarkerPattern   = regexp.MustCompile(`^([-*+]|[0-9]{1,9}[.)])( |$)`)
+	delimiterRowPattern = regexp.MustCompile(`^\|?(\s*:?-+:?\s*\|)*\s*:?-+:?\s*\|?$`)
+	thematicPattern     = regexp.MustCompile(`^(-[ \t]*){3,}$|^(\*[ \t]*){3,}$|^(_[ \t]*){3,}$`)
+	setextPattern       = regexp.MustCompile(`^(=+|-+)[ \t]*$`)
+	inlineTagPattern    = regexp.MustCompile(`^<[A-Za-z/!][^<>\n]*>`)
+)
+
+// listItem is an open list item: the column of its marker and of its
+// content, which nested blocks must be indented to.
+type listItem struct {
+	marker, content int
+}
+
+// markdownLinter re-reads converted Markdown line by line, following the
+// block structure a CommonMark parser would build, and records where it
+// departs from the structure the converter wrote: table rows that do not
+// match their header, list items and continuation lines indented off the
+// columns of their list, emphasis and code spans left open, and text that
+// would turn into a heading or a code block.
+type markdownLinter struct {
+	issues []markdownIssue
+	// fence is the fence that opened the current code block.
+	fence   string
+	comment bool
+	items   []listItem
+	// quote is the blockquote depth of the previous line.
+	quote int
+	// blockStart is set after a blank line, where indentation starts a new
+	// block rather than continuing a paragraph.
+	blockStart bool
+	// tableCells is the column count of the current table, 0 outside one
+	// and -1 in one that is already reported broken.
+	tableCells int
+	para       []string
+	paraLine   int
+}
+
+func lintMarkdown(markdown string) []markdownIssue {
+	l := &markdownLinter{blockStart: true}
+	lines := strings.Split(strings.TrimSuffix(markdown, "\n"), "\n")
+	for i, line := range lines {
+		next := ""
+		if i+1 < len(lines) {
+			next = lines[i+1]
+		}
+		l.line(i+1, line, next)
+	}
+	l.flush()
+	if l.fence != "" {
+		l.report(len(lines), fmt.Sprintf("code fence %s is never closed", l.fence))
+	}
+	return l.issues
+}
+
+func (l *markdownLinter) report(line int, message string) {
+	l.issues = append(l.issues, markdownIssue{line: line, message: message})
+}
+
+func (l *markdownLinter) line(n int, line, next string) {
+	depth, rest := stripQuotes(line)
+	if depth != l.quote && l.fence == "" {
+		l.flush()
+		l.items, l.tableCells, l.blockStart = nil, 0, true
+	}
+	l.quote = depth
+	indent, text := splitIndent(rest)
+
+	switch {
+	case l.fence != "":
+		if isFenceClose(text, l.fence) {
+			l.fence = ""
+		}
+		return
+	case l.comment:
+		l.comment = !strings.Contains(text, "-->")
+		return
+	case text == "":
+		l.flush()
+		l.tableCells, l.blockStart = 0, true
+		return
+	}
+
+	if marker := listMarkerPattern.FindString(text); marker != "" && !thematicPattern.MatchString(text) {
+		l.listItem(n, indent, marker)
+		l.flush()
+		l.blockStart = false
+		l.inline(n, strings.TrimPrefix(strings.TrimPrefix(text[len(marker):], "[ ] "), "[x] "))
+		return
+	}
+	if l.continuation(n, indent) {
+		return
+	}
+
+	switch {
+	case strings.HasPrefix(text, "```") || strings.HasPrefix(text, "~~~"):
+		l.flush()
+		l.fence = text[:len(text)-len(strings.TrimLeft(text, text[:1]))]
+	case strings.HasPrefix(text, "<!--"):
+		l.flush()
+		l.comment = !strings.Contains(text[len("<!--"):], "-->")
+	case strings.HasPrefix(text, "|"):
+		l.flush()
+		l.tableRow(n, text, next)
+		l.blockStart = false
+		return
+	case strings.HasPrefix(text, "#"):
+		l.flush()
+		l.inline(n, strings.TrimLeft(text, "#"))
+	case len(l.para) > 0 && setextPattern.MatchString(text):
+		l.report(n, fmt.Sprintf("%q under a paragraph turns the line above into a heading", text))
+		l.flush()
+	case thematicPattern.MatchString(text):
+		l.flush()
+	case strings.HasPrefix(text, "<"):
+		// HTML blocks are passed through as they are.
+		l.flush()
+	default:
+		if len(l.para) == 0 {
+			l.paraLine = n
+		}
+		l.para = append(l.para, text)
+	}
+	l.tableCells = 0
+	l.blockStart = false
+}
+
+// listItem opens a list item, reporting an item indented less than the
+// content of the item above it but more than its marker: the item was
+// meant to be nested, but is read as a sibling.
+func (l *markdownLinter) listItem(n, indent int, marker string) {
+	var parent *listItem
+	for len(l.items) > 0 && indent < l.items[len(l.items)-1].content {
+		if top := l.items[len(l.items)-1]; top.marker < indent && parent == nil {
+			parent = &top
+		}
+		l.items = l.items[:len(l.items)-1]
+	}
+	switch {
+	case parent != nil:
+		l.report(n, fmt.Sprintf("list item indented %d space(s) is not nested under the item above, which needs %d", indent, parent.content))
+	case len(l.items) == 0 && l.blockStart && indent >= 4:
+		l.report(n, fmt.Sprintf("line indented %d space(s) renders as a code block", indent))
+	}
+	content := indent + len(marker)
+	if !strings.HasSuffix(marker, " ") {
+		content++
+	}
+	l.items = append(l.items, listItem{marker: indent, content: content})
+	l.tableCells = 0
+}
+
+// continuation checks a line that is not a list item against the open
+// items and whether its indentation starts a code block. It reports whether
+// the line has been dealt with.
+func (l *markdownLinter) continuation(n, indent int) bool {
+	if !l.blockStart {
+		// A lazy continuation line belongs to the paragraph above.
+		return false
+	}
+	expected := 0
+	for len(l.items) > 0 && indent < l.items[len(l.items)-1].content {
+		expected = l.items[len(l.items)-1].content
+		l.items = l.items[:len(l.items)-1]
+	}
+	base := 0
+	if len(l.items) > 0 {
+		base = l.items[len(l.items)-1].content
+	}
+	switch {
+	case indent >= base+4:
+		l.report(n, fmt.Sprintf("line indented %d space(s) renders as a code block", indent))
+	case len(l.items) == 0 && indent > 0:
+		l.report(n, fmt.Sprintf("line indented %d space(s) ends the list, expected %d", indent, expected))
+	default:
+		return false
+	}
+	l.blockStart = false
+	return true
+}
+
+// tableRow checks that a row has as many cells as its table's header, and
+// that a header is followed by a matching delimiter row.
+func (l *markdownLinter) tableRow(n int, text, next string) {
+	cells := countCells(text)
+	if l.tableCells != 0 {
+		if l.tableCells > 0 && cells != l.tableCells {
+			l.report(n, fmt.Sprintf("table row has %d cell(s), the header has %d", cells, l.tableCells))
+		}
+		return
+	}
+	_, next = stripQuotes(next)
+	_, next = splitIndent(next)
+	if !delimiterRowPattern.MatchString(next) {
+		if !delimiterRowPattern.MatchString(text) {
+			l.report(n, "table row without a header delimiter row below it renders as text")
+		}
+		return
+	}
+	l.tableCells = cells
+	if delimiters := countCells(next); delimiters != cells {
+		l.report(n+1, fmt.Sprintf("delimiter row has %d cell(s), the header has %d; the table renders as text", delimiters, cells))
+		l.tableCells = -1
+	}
+}
+
+// countCells counts the cells of a pipe table row. As in GFM, an escaped
+// pipe does not split cells, even within a code span.
+func countCells(row string) int {
+	row = strings.TrimSpace(row)
+	cells, escaped := 1, false
+	for i, c := range row {
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == '|' && i > 0 && i < len(row)-1:
+			cells++
+		}
+	}
+	return cells
+}
+
+func (l *markdownLinter) flush() {
+	if len(l.para) > 0 {
+		l.inline(l.paraLine, strings.Join(l.para, "\n"))
+		l.para = nil
+	}
+}
+
+// delimiterRun is a run of *, _, or ~ that may open or close emphasis.
+type delimiterRun struct {
+	char            byte
+	length          int
+	line            int
+	canOpen, closes bool
+}
+
+// inline checks the code spans and emphasis of a block's text, which
+// starts on line n.
+func (l *markdownLinter) inline(n int, text string) {
+	var runs []delimiterRun
+	line := n
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == '\\' && i+1 < len(text) && text[i+1] != '\n':
+			i += 2
+		case c == '`':
+			length := runLength(text, i)
+			end := findBackticks(text[i+length:], length)
+			if end < 0 {
+				l.report(line, fmt.Sprintf("unclosed code span (%s)", text[i:i+length]))
+				i += length
+				continue
+			}
+			skipped := text[i : i+length+end+length]
+			line += strings.Count(skipped, "\n")
+			i += len(skipped)
+		case c == '<':
+			tag := inlineTagPattern.FindString(text[i:])
+			if tag == "" {
+				tag = "<"
+			}
+			i += len(tag)
+		case c == ']' && strings.HasPrefix(text[i:], "]("):
+			// The destination of a link is not inline text.
+			end := strings.IndexByte(text[i:], ')')
+			if end < 0 {
+				end = 1
+			}
+			line += strings.Count(text[i:i+end], "\n")
+			i += end
+		case c == '*' || c == '_' || c == '~':
+			length := runLength(text, i)
+			before, _ := utf8.DecodeLastRuneInString(text[:i])
+			after, _ := utf8.DecodeRuneInString(text[i+length:])
+			if i == 0 {
+				before = ' '
+			}
+			if i+length == len(text) {
+				after = ' '
+			}
+			left := !unicode.IsSpace(after) && (!unicode.IsPunct(after) && !unicode.IsSymbol(after) || unicode.IsSpace(before) || unicode.IsPunct(before) || unicode.IsSymbol(before))
+			right := !unicode.IsSpace(before) && (!unicode.IsPunct(before) && !unicode.IsSymbol(before) || unicode.IsSpace(after) || unicode.IsPunct(after) || unicode.IsSymbol(after))
+			run := delimiterRun{char: c, length: length, line: line, canOpen: left, closes: right}
+			if c == '_' {
+				run.canOpen = left && (!right || unicode.IsPunct(before))
+				run.closes = right && (!left || unicode.IsPunct(after))
+			}
+			if c != '~' || length <= 2 {
+				runs = append(runs, run)
+			}
+			i += length
+		default:
+			i++
+		}
+	}
+	for _, open := range matchDelimiters(runs) {
+		what := "emphasis"
+		if open.char == '~' {
+			what = "strikethrough"
+		}
+		l.report(open.line, fmt.Sprintf("unclosed %s (%s)", what, strings.Repeat(string(open.char), open.length)))
+	}
+}
+
+// matchDelimiters pairs closing runs with the nearest opener of the same
+// character, as a CommonMark parser does, and returns the openers left.
+func matchDelimiters(runs []delimiterRun) []delimiterRun {
+	var openers []delimiterRun
+	for _, run := range runs {
+		for run.closes && run.length > 0 {
+			j := len(openers) - 1
+			for j >= 0 && openers[j].char != run.char {
+				j--
+			}
+			if j < 0 {
+				break
+			}
+			used := openers[j].length
+			if run.length < used {
+				used = run.length
+			}
+			if run.char == '~' && openers[j].length != run.length {
+				break
+			}
+			openers[j].length -= used
+			run.length -= used
+			// Openers between the pair are left unmatched inside it.
+			openers = openers[:j+1]
+			if openers[j].length == 0 {
+				openers = openers[:j]
+			}
+		}
+		if run.canOpen && run.length > 0 {
+			openers = append(openers, run)
+		}
+	}
+	return openers
+}
+
+func runLength(text string, i int) int {
+	n := 1
+	for i+n < len(text) && text[i+n] == text[i] {
+		n++
+	}
+	return n
+}
+
+// findBackticks returns the offset of the next run of exactly length
+// backticks in text, or -1.
+func findBackticks(text string, length int) int {
+	for i := 0; i < len(text); {
+		if text[i] != '`' {
+			i++
+			continue
+		}
+		n := runLength(text, i)
+		if n == length {
+			return i
+		}
+		i += n
+	}
+	return -1
+}
+
+// stripQuotes removes the blockquote markers of a line and returns its
+// quote depth.
+func stripQuotes(line string) (int, string) {
+	depth := 0
+	for {
+		indent, text := splitIndent(line)
+		if indent > 3 || !strings.HasPrefix(text, ">") {
+			return depth, line
+		}
+		depth++
+		line = strings.TrimPrefix(text[1:], " ")
+	}
+}
+
+// splitIndent returns the indentation width of a line, with tabs advancing
+// to the next multiple of 4, and the text after it.
+func splitIndent(line string) (int, string) {
+	width := 0
+	for i, c := range line {
+		switch c {
+		case ' ':
+			width++
+		case '\t':
+			width += 4 - width%4
+		default:
+			return width, line[i:]
+		}
+	}
+	return width, ""
+}
+
+func isFenceClose(text, fence string) bool {
+	text = strings.TrimRight(text, " \t")
+	return strings.HasPrefix(text, fence) && strings.Trim(text, fence[:1]) == ""
+}
+
+func printMarkdownIssues(source string, issues []markdownIssue) {
+	for _, issue := range issues {
+		message := fmt.Sprintf("%s: %s %s", source, colorize(fmt.Sprintf("output line %d:", issue.line), ansiDim), issue.message)
+		writeDiagnostic(os.Stderr, "WARNING", ansiYellow, message)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dayflower/boxnote2md/pkg/boxnote"
+)
+
+// runMerge converts the notes named by args into the single document
+// --merge names, or writes it to stdout for -. Each note becomes a section
+// headed by its title, one level below the title of the document when that
+// is written as an H1, so that --toc lists the notes.
+func runMerge(ctx context.Context, opts *options, args []string) int {
+	switch {
+	case len(args) == 0:
+		fmt.Fprintf(os.Stderr, "usage: %s --merge <file.md|-> [flags] <file.boxnote|dir>...\n", programName)
+		return exitUsage
+	case opts.splitBy != splitNone:
+		fmt.Fprintln(os.Stderr, "--merge cannot be combined with --split-by")
+		return exitUsage
+	}
+	if opts.assetManifestPath != "" {
+		opts.assetManifest = newAssetManifest()
+	}
+	if opts.checkLinks {
+		opts.linkCheck = newLinkChecker(opts.checkExternal)
+	}
+
+	meta := noteMeta{title: opts.title, source: opts.merge}
+	if opts.merge != "-" {
+		meta.outputPath = opts.merge
+		if meta.title == "" {
+			meta.title = strings.TrimSuffix(filepath.Base(opts.merge), filepath.Ext(opts.merge))
+		}
+	}
+	level := 1
+	if meta.title != "" && opts.titleMode == titleModeH1 && opts.titleFrom != titleFromFrontMatterOnly {
+		level = 2
+	}
+	// The title of the document is never the heading of its first note.
+	opts.titleFrom = titleFromFilename
+
+	exitCode := exitOK
+	fail := func(source string, err error) {
+		reportError(source, err)
+		if exitCode == exitOK {
+			exitCode = exitFailure
+			if opts.strict {
+				exitCode = exitCodeFor(err)
+			}
+		}
+	}
+	type note struct {
+		path  string
+		input []byte
+	}
+	var notes []note
+	var all bytes.Buffer
+	for _, input := range collectInputs(args, opts.recursive) {
+		info, err := os.Stat(input.Path)
+		if err == nil && info.IsDir() {
+			err = fmt.Errorf("is a directory (use -r to merge the notes below it)")
+		}
+		var data []byte
+		if err == nil {
+			data, err = os.ReadFile(input.Path)
+		}
+		if err != nil {
+			fail(input.Path, &exitError{code: exitIO, err: err})
+			continue
+		}
+		if info.ModTime().After(meta.modified) {
+			meta.modified = info.ModTime()
+		}
+		notes = append(notes, note{input.Path, data})
+		all.Write(data)
+	}
+	digest := inputDigest(all.Bytes())
+	if meta.outputPath != "" && opts.skipUnchanged && isUnchanged(meta.outputPath, digest, optionsDigest(*opts)) {
+		reportSkipped(opts.merge)
+		return exitCode
+	}
+
+	var sections []boxnote.Section
+	for _, n := range notes {
+		doc := &boxnote.Document{}
+		if len(strings.TrimSpace(string(n.input))) > 0 {
+			var err error
+			if doc, err = parseNote(n.input, *opts); err != nil {
+				fail(n.path, renderFailure(err))
+				continue
+			}
+		}
+		sections = append(sections, boxnote.Section{Title: titleFromPath(n.path), Level: level, Document: doc})
+	}
+
+	// --timeout is given to each note.
+	ctx, cancel := withTimeout(ctx, time.Duration(len(notes))*opts.timeout)
+	defer cancel()
+	output, warnings, err := renderDocument(ctx, boxnote.Merge(sections), &meta, *opts)
+	if err != nil {
+		fail(opts.merge, renderFailure(err))
+		return exitCode
+	}
+	if opts.strict && len(warnings) > 0 {
+		printWarnings(opts.merge, warnings)
+		fail(opts.merge, &exitError{code: exitWarnings, err: fmt.Errorf("%d conversion warning(s)", len(warnings))})
+		return exitCode
+	}
+	printUnknown(opts.merge, warnings)
+	printSanitized(opts.merge, warnings)
+	output = finishOutput(prependFrontMatter(output, meta, *opts), opts.eol)
+
+	if meta.outputPath == "" {
+		if _, err := fmt.Fprint(os.Stdout, output); err != nil {
+			fail(opts.merge, &exitError{code: exitIO, err: fmt.Errorf("failed to write stdout: %w", err)})
+		}
+		return exitCode
+	}
+	if err := prepareOverwrite(meta.outputPath, *opts); err != nil {
+		fail(opts.merge, err)
+		return exitCode
+	}
+	if err := writeOutput(meta.outputPath, output, digest, *opts); err != nil {
+		fail(opts.merge, err)
+		return exitCode
+	}
+	opts.commit.addOutput(meta.outputPath, "", digest)
+	reportOK(opts.merge)
+	writeAssetManifest(opts.assetManifestPath, opts.assetManifest)
+	return checkLinks(ctx, opts, exitCode)
+}
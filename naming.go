@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+)
+
+// nameFields are the values available to --name-template.
+type nameFields struct {
+	// Title is the note name without the .boxnote extension.
+	Title string
+	// Date is the input's modification date as YYYY-MM-DD.
+	Date string
+	// SourceDir is the directory containing the input.
+	SourceDir string
+	// Index is the 1-based position of the input in this run.
+	Index int
+}
+
+func newNameFields(inputPath string, modTime time.Time, index int) nameFields {
+	return nameFields{
+		Title:     titleFromPath(inputPath),
+		Date:      modTime.Format("2006-01-02"),
+		SourceDir: filepath.Dir(inputPath),
+		Index:     index,
+	}
+}
+
+var nameTemplateFuncs = template.FuncMap{
+	"slug":  slug,
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"trim":  strings.TrimSpace,
+}
+
+// nameTemplate is a flag.Value holding a parsed --name-template.
+type nameTemplate struct {
+	text string
+	tmpl *template.Template
+}
+
+func (t *nameTemplate) String() string {
+	return t.text
+}
+
+func (t *nameTemplate) Set(value string) error {
+	tmpl, err := template.New("name").Funcs(nameTemplateFuncs).Option("missingkey=error").Parse(value)
+	if err != nil {
+		return err
+	}
+	t.text = value
+	t.tmpl = tmpl
+	return nil
+}
+
+// resolveOutputPath returns the output path for inputPath. Without a name
+// template the output sits next to the input with a .md extension; a
+// template result is relative to the input's directory unless absolute.
+func resolveOutputPath(inputPath string, fields nameFields, opts options) (string, error) {
+	path := outputPathFor(inputPath)
+	if opts.nameTemplate.tmpl != nil {
+		var buf bytes.Buffer
+		if err := opts.nameTemplate.tmpl.Execute(&buf, fields); err != nil {
+			return "", fmt.Errorf("failed to apply name template: %w", err)
+		}
+		name := strings.TrimSpace(buf.String())
+		if name == "" {
+			return "", fmt.Errorf("name template produced an empty file name")
+		}
+		path = name
+		if !filepath.IsAbs(name) {
+			path = filepath.Join(filepath.Dir(inputPath), name)
+		}
+	}
+	if opts.slugify {
+		path = slugifyPath(path, opts.slug)
+	}
+	return filepath.Clean(path), nil
+}
+
+// slugifyPath slugifies the file name of path, keeping its directory and
+// extension.
+func slugifyPath(path string, opts slugOptions) string {
+	dir, base := filepath.Split(path)
+	ext := filepath.Ext(base)
+	stem := slugify(strings.TrimSuffix(base, ext), opts)
+	if stem == "" {
+		stem = "untitled"
+	}
+	return filepath.Join(dir, stem+ext)
+}
+
+// slugOptions configures slugify.
+type slugOptions struct {
+	lowercase bool
+	separator string
+	// maxLength limits the slug to this many runes; 0 means unlimited.
+	maxLength int
+}
+
+var defaultSlugOptions = slugOptions{lowercase: true, separator: "-"}
+
+// slug is the template function form of slugify with the default options.
+func slug(text string) string {
+	return slugify(text, defaultSlugOptions)
+}
+
+// slugify transliterates common Latin letters to ASCII, folds full-width
+// ASCII to half-width, and joins the remaining letter and digit runs with
+// the separator. Letters of other scripts, such as CJK, are kept; everything
+// else, including CJK punctuation, separates words.
+func slugify(text string, opts slugOptions) string {
+	var words []string
+	var word strings.Builder
+	flush := func() {
+		if word.Len() > 0 {
+			words = append(words, word.String())
+			word.Reset()
+		}
+	}
+	for _, r := range text {
+		r = foldWidth(r)
+		if opts.lowercase {
+			r = unicode.ToLower(r)
+		}
+		if ascii, ok := transliterate(r); ok {
+			word.WriteString(ascii)
+			continue
+		}
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r) {
+			word.WriteRune(r)
+			continue
+		}
+		flush()
+	}
+	flush()
+
+	result := strings.Join(words, opts.separator)
+	if opts.maxLength > 0 {
+		runes := []rune(result)
+		if len(runes) > opts.maxLength {
+			result = strings.TrimRight(string(runes[:opts.maxLength]), opts.separator)
+		}
+	}
+	return result
+}
+
+// foldWidth maps full-width ASCII variants and the ideographic space to
+// their half-width forms.
+func foldWidth(r rune) rune {
+	switch {
+	case r >= 0xFF01 && r <= 0xFF5E:
+		return r - 0xFEE0
+	case r == 0x3000:
+		return ' '
+	default:
+		return r
+	}
+}
+
+var transliterations = map[rune]string{
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a", 'ā': "a", 'ă': "a", 'ą': "a",
+	'ç': "c", 'ć': "c", 'č': "c",
+	'ď': "d", 'đ': "d", 'ð': "d",
+	'è': "e", 'é': "e", 'ê': "e", 'ë': "e", 'ē': "e", 'ė': "e", 'ę': "e", 'ě': "e",
+	'ğ': "g",
+	'ì': "i", 'í': "i", 'î': "i", 'ï': "i", 'ī': "i", 'ı': "i",
+	'ł': "l", 'ľ': "l",
+	'ñ': "n", 'ń': "n", 'ň': "n",
+	'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "o", 'ø': "o", 'ō': "o", 'ő': "o",
+	'ř': "r",
+	'ś': "s", 'š': "s", 'ş': "s",
+	'ť': "t", 'ţ': "t",
+	'ù': "u", 'ú': "u", 'û': "u", 'ü': "u", 'ū': "u", 'ů': "u", 'ű': "u",
+	'ý': "y", 'ÿ': "y",
+	'ź': "z", 'ż': "z", 'ž': "z",
+	'ß': "ss", 'æ': "ae", 'œ': "oe", 'þ': "th",
+}
+
+// transliterate returns the ASCII spelling of a Latin letter with
+// diacritics, preserving upper case.
+func transliterate(r rune) (string, bool) {
+	if ascii, ok := transliterations[r]; ok {
+		return ascii, true
+	}
+	lower := unicode.ToLower(r)
+	if lower == r {
+		return "", false
+	}
+	ascii, ok := transliterations[lower]
+	if !ok {
+		return "", false
+	}
+	return strings.ToUpper(ascii[:1]) + ascii[1:], true
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dayflower/boxnote2md/pkg/boxnote"
+)
+
+// Notion's Markdown & CSV importer takes the layout of Notion's own export:
+// a page is a .md file, its child pages and databases sit in the folder of
+// the same name beside it, and a database is a .csv file linked from its
+// page.
+
+// notionPageDir is the folder of the page written to outputPath, relative
+// to the page's directory.
+func notionPageDir(outputPath string) string {
+	return strings.TrimSuffix(filepath.Base(outputPath), ".md")
+}
+
+// notionLinks returns the link rewriting for the note described by meta:
+// links to another note of the export, after rewrite, point at its page
+// relative to this one, the way the importer turns them into page links.
+func notionLinks(t *exportTree, meta *noteMeta, rewrite func(string) string) func(string) string {
+	return func(href string) string {
+		if rewrite != nil {
+			if href = rewrite(href); href == "" {
+				return ""
+			}
+		}
+		if output, ok := t.resolve(meta, href); ok {
+			return relativeLink(meta.outputPath, output)
+		}
+		return href
+	}
+}
+
+// splitNotionTables writes each table of doc into the page folder of
+// outputPath as "Table N.csv", which the importer turns into a database,
+// and replaces the table with a link to it.
+func splitNotionTables(doc *boxnote.Document, outputPath string, opts options) error {
+	dir := filepath.Join(filepath.Dir(outputPath), notionPageDir(outputPath))
+	n := 0
+	var err error
+	boxnote.Walk(doc, boxnote.Visitor{
+		Enter: func(node *boxnote.Node, path []int) boxnote.Action {
+			if node.Type != "table" || err != nil {
+				return boxnote.Continue
+			}
+			n++
+			name := fmt.Sprintf("Table %d", n)
+			csvPath := filepath.Join(dir, name+".csv")
+			if err = writeTableCSV(csvPath, *node, opts); err != nil {
+				return boxnote.SkipChildren
+			}
+			*node = boxnote.Node{Type: "paragraph", Content: []boxnote.Node{{
+				Type:  "text",
+				Text:  name,
+				Marks: []boxnote.Mark{{Type: "link", Attrs: map[string]interface{}{"href": relativeLink(outputPath, csvPath)}}},
+			}}}
+			return boxnote.SkipChildren
+		},
+	})
+	return err
+}
+
+// writeTableCSV writes the plain text of table's cells as CSV rows. A cell
+// spanning several columns is followed by empty cells, so that the columns
+// stay aligned with the header.
+func writeTableCSV(path string, table boxnote.Node, opts options) error {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	for _, row := range table.Content {
+		var record []string
+		for _, cell := range row.Content {
+			var blocks []string
+			for _, block := range cell.Content {
+				blocks = append(blocks, strings.TrimSpace(boxnote.PlainText(block)))
+			}
+			record = append(record, strings.Join(blocks, "\n"))
+			if span, ok := cell.Attrs["colspan"].(float64); ok {
+				for i := 1; i < int(span); i++ {
+					record = append(record, "")
+				}
+			}
+		}
+		w.Write(record)
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("failed to encode table: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return &exitError{code: exitIO, err: fmt.Errorf("failed to create page folder: %w", err)}
+	}
+	if err := writeFileAtomic(path, buf.Bytes(), 0644, opts.fsync); err != nil {
+		return &exitError{code: exitIO, err: fmt.Errorf("failed to write table: %w", err)}
+	}
+	opts.commit.add(path)
+	return nil
+}
+
+// writeNotionIndexes gives every folder of the export that has no page of
+// its own one listing its child pages, so that the importer nests them
+// under it.
+func writeNotionIndexes(opts *options) int {
+	t := opts.export
+	pages := map[string]bool{}
+	children := map[string][]string{}
+	for _, output := range opts.plannedOutputs {
+		if output == "" || !exists(output) || pages[output] {
+			continue
+		}
+		pages[output] = true
+		children[filepath.Dir(output)] = append(children[filepath.Dir(output)], output)
+	}
+	// Folders become pages from the deepest up, so that each index is
+	// listed by the one above it.
+	var dirs []string
+	for dir := range children {
+		for ; dir != t.dir && strings.HasPrefix(dir, t.dir+string(filepath.Separator)); dir = filepath.Dir(dir) {
+			if !containsString(dirs, dir) {
+				dirs = append(dirs, dir)
+			}
+		}
+	}
+	sort.Slice(dirs, func(i, j int) bool { return dirs[i] > dirs[j] })
+	for _, dir := range dirs {
+		page := dir + ".md"
+		if !pages[page] {
+			pages[page] = true
+			children[filepath.Dir(dir)] = append(children[filepath.Dir(dir)], page)
+		}
+	}
+
+	exitCode := exitOK
+	for _, dir := range dirs {
+		page := dir + ".md"
+		if containsString(opts.plannedOutputs, page) {
+			continue
+		}
+		if err := writeNotionIndex(page, children[dir], *opts); err != nil {
+			reportError(page, err)
+			if exitCode == exitOK {
+				exitCode = exitCodeFor(err)
+			}
+			continue
+		}
+		reportOK(page)
+	}
+	return exitCode
+}
+
+func writeNotionIndex(page string, children []string, opts options) error {
+	sort.Strings(children)
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", filepath.Base(strings.TrimSuffix(page, ".md")))
+	for _, child := range children {
+		fmt.Fprintf(&b, "- [%s](%s)\n", strings.TrimSuffix(filepath.Base(child), ".md"), relativeLink(page, child))
+	}
+	return writeGeneratedPage(page, b.String(), opts)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"mime"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// outputStore receives the outputs of a run whose --out-dir names object
+// storage rather than a local directory. Output paths are planned below
+// the --out-dir value as if it were a directory, and passed to the store
+// relative to it, with slashes.
+type outputStore interface {
+	// put writes data as the file name, replacing any earlier version.
+	put(name string, data []byte) error
+	// location names the file name in the store for messages, as a URL.
+	location(name string) string
+}
+
+// storeSchemes maps the URL schemes --out-dir accepts to their backends.
+var storeSchemes = map[string]func(u *url.URL) (outputStore, error){
+	"s3": newS3Store,
+}
+
+// openStore sets opts.store from an --out-dir that is a URL with one of the
+// storeSchemes. Other values are local directories and leave it nil.
+func openStore(opts *options) error {
+	i := strings.Index(opts.outDir, "://")
+	if i < 0 {
+		return nil
+	}
+	u, err := url.Parse(opts.outDir)
+	if err != nil {
+		return fmt.Errorf("invalid --out-dir: %w", err)
+	}
+	open, ok := storeSchemes[u.Scheme]
+	if !ok {
+		return fmt.Errorf("unsupported --out-dir scheme %q", opts.outDir[:i])
+	}
+	if flag := storeConflict(*opts); flag != "" {
+		return fmt.Errorf("%s needs a local --out-dir", flag)
+	}
+	store, err := open(u)
+	if err != nil {
+		return err
+	}
+	opts.store = store
+	return nil
+}
+
+// storeConflict returns the first flag given that reads or renames outputs
+// on disk, which a store does not allow.
+func storeConflict(opts options) string {
+	switch {
+	case opts.stream:
+		return "--stream"
+	case opts.skipUnchanged:
+		return "--skip-unchanged"
+	case opts.marker:
+		return "--marker"
+	case opts.backup != backupNone:
+		return "--backup"
+	case opts.checkLinks:
+		return "--check-links"
+	case opts.gitCommit:
+		return "--git-commit"
+	}
+	return ""
+}
+
+// storeKey returns the name below root of path, which was planned by
+// joining root with it.
+func storeKey(root, path string) (string, error) {
+	rel, err := filepath.Rel(filepath.Clean(root), path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside %s", path, root)
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// storeContentType returns the media type objects are stored with.
+func storeContentType(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".md":
+		return "text/markdown; charset=utf-8"
+	case ".json":
+		return "application/json"
+	}
+	if t := mime.TypeByExtension(filepath.Ext(path)); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+// writeStored writes the output planned at path to opts.store.
+func writeStored(path string, data []byte, opts options) error {
+	name, err := storeKey(opts.outDir, path)
+	if err != nil {
+		return &exitError{code: exitIO, err: err}
+	}
+	if err := opts.store.put(name, data); err != nil {
+		return &exitError{code: exitIO, err: fmt.Errorf("failed to write %s: %w", opts.store.location(name), err)}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dayflower/boxnote2md/pkg/boxnote"
+)
+
+// obsidianAttachments is the vault folder images are saved into, unless
+// --assets-dir names another.
+const obsidianAttachments = "attachments"
+
+// applyObsidianDefaults turns on the settings the vault at dir wants,
+// unless given on the command line: YAML front matter with the original
+// title as an alias, no H1 title (Obsidian shows the file name), callouts,
+// and a shared attachments folder.
+func applyObsidianDefaults(opts *options, dir string) {
+	if !opts.givenFlags["front-matter"] {
+		opts.frontMatter = frontMatterYAML
+	}
+	if !opts.givenFlags["front-matter-fields"] {
+		opts.frontMatterFields = fieldList{"aliases", "date", "lastmod", "description", "owner", "contributors", "tags", "source"}
+	}
+	if !opts.givenFlags["title-mode"] {
+		opts.titleMode = titleModeNone
+	}
+	if !opts.givenFlags["callouts"] {
+		opts.markdown.callouts = string(boxnote.CalloutsObsidian)
+	}
+	if !opts.givenFlags["tasks"] {
+		opts.markdown.tasks = string(boxnote.TasksObsidian)
+	}
+	if !opts.givenFlags["assets-dir"] {
+		opts.assetsDir = obsidianAttachments
+	}
+	if !filepath.IsAbs(opts.assetsDir) {
+		opts.assetsDir = filepath.Join(dir, opts.assetsDir)
+	}
+}
+
+// writeVaultConfig points Obsidian's attachment folder at opts.assetsDir
+// when the vault at dir has no settings yet.
+func writeVaultConfig(dir string, opts options) error {
+	configDir := filepath.Join(dir, ".obsidian")
+	if exists(configDir) {
+		return nil
+	}
+	rel, err := filepath.Rel(dir, opts.assetsDir)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return nil
+	}
+	data, err := marshalJSON(map[string]string{"attachmentFolderPath": filepath.ToSlash(rel)})
+	if err != nil {
+		return fmt.Errorf("failed to encode vault settings: %w", err)
+	}
+	if err := os.MkdirAll(configDir, 0755); err != nil {
+		return fmt.Errorf("failed to create vault settings: %w", err)
+	}
+	path := filepath.Join(configDir, "app.json")
+	if err := writeFileAtomic(path, data, 0644, false); err != nil {
+		return fmt.Errorf("failed to write vault settings: %w", err)
+	}
+	opts.commit.add(path)
+	return nil
+}
+
+// obsidianUnsafe lists the characters Obsidian does not allow in file names
+// or that break wikilinks to them.
+const obsidianUnsafe = `[]#^|\:*?"<>`
+
+// obsidianSafePath replaces the characters Obsidian rejects in the names
+// below the vault directory.
+func obsidianSafePath(dir, outputPath string) string {
+	rel, err := filepath.Rel(dir, outputPath)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return outputPath
+	}
+	parts := strings.Split(rel, string(filepath.Separator))
+	for i, part := range parts {
+		parts[i] = strings.Map(func(r rune) rune {
+			if strings.ContainsRune(obsidianUnsafe, r) {
+				return '-'
+			}
+			return r
+		}, part)
+	}
+	return filepath.Join(dir, filepath.Join(parts...))
+}
+
+// vaultPageName is the wikilink target of the output at outputPath: its
+// path in the vault without the extension. Heading fragments are dropped,
+// since wikilinks name headings by their text.
+func vaultPageName(dir, outputPath string) string {
+	rel, err := filepath.Rel(dir, outputPath)
+	if err != nil {
+		rel = filepath.Base(outputPath)
+	}
+	return strings.TrimSuffix(filepath.ToSlash(rel), ".md")
+}
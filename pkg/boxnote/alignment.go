@@ -0,0 +1,79 @@
+package boxnote
+
+import "strings"
+
+// Alignment selects how the alignment of paragraphs and headings is kept.
+// Markdown has no syntax for it, so it is kept by wrapping the block in an
+// HTML element; Markdown inside it is still rendered, since the block is
+// set off by blank lines.
+type Alignment string
+
+const (
+	// AlignmentNone drops the alignment (the default).
+	AlignmentNone Alignment = "none"
+	// AlignmentDiv wraps aligned blocks in <div align="center">, which
+	// GitHub and GitLab keep when they sanitize HTML.
+	AlignmentDiv Alignment = "div"
+	// AlignmentStyle wraps aligned blocks in <div style="text-align:
+	// center">, for renderers that keep style attributes.
+	AlignmentStyle Alignment = "style"
+)
+
+// WithAlignment selects how center, right, and justify alignment is kept.
+func WithAlignment(mode Alignment) ConvertOption {
+	return func(c *config) {
+		c.alignment = mode
+	}
+}
+
+// alignments lists the alignments that are kept. Left is the default of
+// every block.
+var alignments = []string{"center", "right", "justify"}
+
+// blockAlignment returns the alignment of a paragraph or heading: the
+// attribute of its alignment mark, as Box Notes writes it, or an alignment
+// attr. Left and unset alignments are "".
+func blockAlignment(node Node, ctx renderContext) string {
+	var value interface{}
+	for _, mark := range node.Marks {
+		if mark.Type == "alignment" {
+			value = mark.Attrs["alignment"]
+		}
+	}
+	if value == nil {
+		for _, key := range []string{"alignment", "textAlign", "align"} {
+			if v, ok := node.Attrs[key]; ok {
+				value = v
+				break
+			}
+		}
+	}
+	if value == nil {
+		return ""
+	}
+	align, _ := value.(string)
+	align = strings.ToLower(align)
+	switch {
+	case containsType(alignments, align):
+		return align
+	case align != "left" && align != "start" && align != "":
+		ctx.warn(WarningInvalidAttr, "unknown alignment %v", value)
+	}
+	return ""
+}
+
+// alignBlock wraps the rendered block of node for its alignment.
+func alignBlock(block string, node Node, ctx renderContext) string {
+	if ctx.cfg.alignment != AlignmentDiv && ctx.cfg.alignment != AlignmentStyle || block == "" {
+		return block
+	}
+	align := blockAlignment(node, ctx)
+	if align == "" {
+		return block
+	}
+	open := `<div align="` + align + `">`
+	if ctx.cfg.alignment == AlignmentStyle {
+		open = `<div style="text-align: ` + align + `">`
+	}
+	return open + "\n\n" + block + "\n\n</div>"
+}
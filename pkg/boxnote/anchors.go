@@ -0,0 +1,136 @@
+package boxnote
+
+import (
+	"html"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// headingAnchors maps the headings of a document to the fragments that
+// GitHub-style renderers generate for them, so that in-note links can
+// target the converted headings.
+type headingAnchors struct {
+	// byKey maps heading id attrs and slugs to the final fragment.
+	byKey map[string]string
+	// byPath maps the formatted path of each heading to its fragment.
+	byPath map[string]string
+	seen   map[string]int
+	// partial is set while streaming, when the headings after the current
+	// block are not known yet.
+	partial bool
+}
+
+// newHeadingAnchors collects the anchors of every heading in doc, after the
+// title heading added by WithTitle, if any. With WithHeadingIDs, a heading
+// that carries an ID is anchored at that ID instead of its slug.
+func newHeadingAnchors(doc *Document, cfg *config) *headingAnchors {
+	a := &headingAnchors{byKey: map[string]string{}, byPath: map[string]string{}, seen: map[string]int{}}
+	if cfg.title != "" {
+		a.add(cfg.title, "", false)
+	}
+	if doc != nil {
+		a.collect(&doc.Doc, nil, cfg)
+	}
+	return a
+}
+
+// collect adds the anchors of the headings at or below node, which is at
+// path in the document.
+func (a *headingAnchors) collect(node *Node, path []int, cfg *config) {
+	explicit := cfg.headingIDs == HeadingIDsAttr || cfg.headingIDs == HeadingIDsHTML
+	walkNode(node, path, Visitor{
+		Enter: func(node *Node, path []int) Action {
+			if node.Type != "heading" {
+				return Continue
+			}
+			a.byPath[formatNodePath(path)] = a.add(PlainText(*node), headingID(*node), explicit)
+			return SkipChildren
+		},
+	})
+}
+
+func (a *headingAnchors) add(text, id string, explicit bool) string {
+	slug := headingSlug(text)
+	if n, ok := a.seen[slug]; ok {
+		a.seen[slug] = n + 1
+		slug += "-" + strconv.Itoa(n)
+	} else {
+		a.seen[slug] = 1
+	}
+	anchor := slug
+	if explicit && id != "" {
+		anchor = id
+	}
+	a.byKey[slug] = anchor
+	if id != "" {
+		a.byKey[id] = anchor
+	}
+	return anchor
+}
+
+// headingID returns the stable ID a heading carries in the note: its id
+// attr, or the guid Box Notes assigns.
+func headingID(node Node) string {
+	for _, key := range []string{"id", "guid"} {
+		if id, _ := getStringAttr(node.Attrs, key); id != "" {
+			return id
+		}
+	}
+	return ""
+}
+
+// resolve returns the fragment of the heading that fragment refers to, by
+// its id attr or by its text.
+func (a *headingAnchors) resolve(fragment string) (string, bool) {
+	if unescaped, err := url.PathUnescape(fragment); err == nil {
+		fragment = unescaped
+	}
+	if anchor, ok := a.byKey[fragment]; ok {
+		return anchor, true
+	}
+	slug := headingSlug(fragment)
+	if anchor, ok := a.byKey[slug]; ok {
+		return anchor, true
+	}
+	if a.partial {
+		// The heading may come later; assume it gets the plain slug.
+		return slug, slug != ""
+	}
+	return "", false
+}
+
+// headingSlug lowercases text, drops punctuation, and joins words with
+// hyphens, as GitHub does for heading anchors.
+func headingSlug(text string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(strings.TrimSpace(text)) {
+		switch {
+		case r == ' ':
+			b.WriteRune('-')
+		case r == '-' || r == '_' || unicode.IsLetter(r) || unicode.IsNumber(r) || unicode.Is(unicode.M, r):
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// withHeadingID adds the explicit ID selected by WithHeadingIDs to the
+// rendered text of a heading.
+func withHeadingID(text string, ctx renderContext) string {
+	if ctx.cfg.headingIDs != HeadingIDsAttr && ctx.cfg.headingIDs != HeadingIDsHTML {
+		return text
+	}
+	if ctx.anchors == nil {
+		return text
+	}
+	id := ctx.anchors.byPath[formatNodePath(ctx.path)]
+	if id == "" {
+		return text
+	}
+	if ctx.cfg.headingIDs == HeadingIDsHTML {
+		return `<a id="` + html.EscapeString(id) + `"></a>` + text
+	}
+	return text + " {#" + id + "}"
+}
@@ -0,0 +1,59 @@
+package boxnote
+
+import "encoding/json"
+
+func getIntAttr(attrs map[string]interface{}, key string) int {
+	if attrs == nil {
+		return 0
+	}
+	value, ok := attrs[key]
+	if !ok {
+		return 0
+	}
+	switch v := value.(type) {
+	case float64:
+		return int(v)
+	case int:
+		return v
+	case json.Number:
+		intValue, err := v.Int64()
+		if err == nil {
+			return int(intValue)
+		}
+	}
+	return 0
+}
+
+func getBoolAttr(attrs map[string]interface{}, key string) bool {
+	if attrs == nil {
+		return false
+	}
+	value, ok := attrs[key]
+	if !ok {
+		return false
+	}
+	boolValue, ok := value.(bool)
+	return ok && boolValue
+}
+
+func getStringAttr(attrs map[string]interface{}, key string) (string, bool) {
+	if attrs == nil {
+		return "", false
+	}
+	value, ok := attrs[key]
+	if !ok {
+		return "", false
+	}
+	stringValue, ok := value.(string)
+	return stringValue, ok
+}
+
+func clampInt(value, minValue, maxValue int) int {
+	if value < minValue {
+		return minValue
+	}
+	if value > maxValue {
+		return maxValue
+	}
+	return value
+}
@@ -0,0 +1,39 @@
+package boxnote
+
+import "strconv"
+
+// AuthorIDs returns the distinct Box user IDs found in author_id marks, in
+// order of first appearance.
+func (d *Document) AuthorIDs() []string {
+	var ids []string
+	seen := map[string]bool{}
+	Walk(d, Visitor{
+		Enter: func(node *Node, path []int) Action {
+			for _, mark := range node.Marks {
+				if mark.Type != "author_id" {
+					continue
+				}
+				id := authorID(mark.Attrs["authorId"])
+				if id == "" || seen[id] {
+					continue
+				}
+				seen[id] = true
+				ids = append(ids, id)
+			}
+			return Continue
+		},
+	})
+	return ids
+}
+
+// authorID accepts IDs stored as strings or as JSON numbers.
+func authorID(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return ""
+	}
+}
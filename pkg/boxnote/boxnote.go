@@ -0,0 +1,238 @@
+// Package boxnote converts Box Notes JSON documents into GitHub Flavored
+// Markdown.
+//
+// A Box Note stores a ProseMirror document under its "doc" key. Parse decodes
+// it into a Document, and Markdown renders that tree; Convert does both.
+package boxnote
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Document is a parsed Box Note. The ProseMirror tree is under Doc.
+type Document struct {
+	Doc Node `json:"doc"`
+	// invalidUTF8 counts the invalid bytes in the parsed input, which the
+	// decoder has replaced with U+FFFD.
+	invalidUTF8 int
+}
+
+// Node is a ProseMirror node such as a paragraph, list, or text run.
+type Node struct {
+	Type    string                 `json:"type"`
+	Attrs   map[string]interface{} `json:"attrs"`
+	Content []Node                 `json:"content"`
+	Text    string                 `json:"text"`
+	Marks   []Mark                 `json:"marks"`
+}
+
+// Mark is inline formatting applied to a text node.
+type Mark struct {
+	Type  string                 `json:"type"`
+	Attrs map[string]interface{} `json:"attrs"`
+}
+
+// Parse decodes a Box Notes JSON document. Malformed JSON is reported as a
+// *ParseError and JSON without a doc node as a *SchemaError. A byte order
+// mark is skipped and UTF-16 input is transcoded first.
+func Parse(input []byte) (*Document, error) {
+	input, err := decodeInput(input)
+	if err != nil {
+		return nil, &ParseError{Err: err}
+	}
+	var doc Document
+	if err := json.Unmarshal(input, &doc); err != nil {
+		return nil, newParseError(input, err)
+	}
+	if doc.Doc.Type == "" {
+		return nil, &SchemaError{Message: "missing doc node"}
+	}
+	doc.invalidUTF8 = countInvalidUTF8(input)
+	if path, ok := exceedsDepth(&doc.Doc, MaxDepth); ok {
+		// The full path would be hundreds of levels long; name the block.
+		return nil, depthError(FormatPath(path[:1]))
+	}
+	return &doc, nil
+}
+
+// MaxDepth bounds how deeply nodes may nest in a parsed document, so that
+// pathological input cannot exhaust the stack of the recursive renderers.
+// Real notes stay far below it.
+const MaxDepth = 256
+
+func depthError(path string) *SchemaError {
+	return &SchemaError{Path: path, Message: fmt.Sprintf("nodes nested deeper than %d levels", MaxDepth)}
+}
+
+// exceedsDepth returns the path of the first node nested more than limit
+// levels below root. It walks the tree with an explicit stack.
+func exceedsDepth(root *Node, limit int) ([]int, bool) {
+	type frame struct {
+		node *Node
+		path []int
+	}
+	stack := []frame{{node: root}}
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if len(top.path) > limit {
+			return top.path, true
+		}
+		for i := len(top.node.Content) - 1; i >= 0; i-- {
+			path := append(append([]int(nil), top.path...), i)
+			stack = append(stack, frame{node: &top.node.Content[i], path: path})
+		}
+	}
+	return nil, false
+}
+
+// Convert renders a Box Notes JSON document as Markdown. Input that is empty
+// or only whitespace converts to an empty string.
+func Convert(input []byte, opts ...ConvertOption) (string, error) {
+	return ConvertContext(context.Background(), input, opts...)
+}
+
+// ConvertContext is like Convert but stops with ctx.Err() once ctx is done.
+func ConvertContext(ctx context.Context, input []byte, opts ...ConvertOption) (string, error) {
+	if len(strings.TrimSpace(string(input))) == 0 {
+		return "", nil
+	}
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	doc, err := Parse(input)
+	if err != nil {
+		return "", err
+	}
+	output, _, err := doc.MarkdownContext(ctx, opts...)
+	return output, err
+}
+
+// Markdown renders the document and returns the warnings collected for
+// content that could not be converted faithfully.
+func (d *Document) Markdown(opts ...ConvertOption) (string, []Warning) {
+	output, warnings, _ := d.MarkdownContext(context.Background(), opts...)
+	return output, warnings
+}
+
+// MarkdownContext is like Markdown but stops with ctx.Err() once ctx is
+// done. Cancellation is checked between blocks.
+func (d *Document) MarkdownContext(ctx context.Context, opts ...ConvertOption) (string, []Warning, error) {
+	b := outputBuffers.Get().(*bytes.Buffer)
+	defer putOutputBuffer(b)
+	b.Reset()
+	warnings, err := render(ctx, b, d, newConfig(opts))
+	if err != nil {
+		return "", warnings, err
+	}
+	return b.String(), warnings, nil
+}
+
+// outputBuffers recycles the buffers Markdown is rendered into, so that
+// converting many notes does not grow a new one for each.
+var outputBuffers = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+
+// maxPooledOutput keeps the buffers of very large outputs out of the pool.
+const maxPooledOutput = 16 << 20
+
+func putOutputBuffer(b *bytes.Buffer) {
+	if b.Cap() <= maxPooledOutput {
+		outputBuffers.Put(b)
+	}
+}
+
+// Render writes doc to w as Markdown. Top-level blocks are written as soon
+// as they are rendered, so the whole document is never held in memory. The
+// first error reported by w is returned as a *RenderError.
+func Render(w io.Writer, doc Document, opts ...ConvertOption) error {
+	return RenderContext(context.Background(), w, doc, opts...)
+}
+
+// RenderContext is like Render but stops with ctx.Err() once ctx is done.
+// Blocks already written to w are not retracted.
+func RenderContext(ctx context.Context, w io.Writer, doc Document, opts ...ConvertOption) error {
+	_, err := render(ctx, w, &doc, newConfig(opts))
+	return err
+}
+
+func render(parent context.Context, w io.Writer, doc *Document, cfg *config) ([]Warning, error) {
+	diag := &diagnostics{root: doc.Doc}
+	out := &errWriter{w: w}
+	if doc.invalidUTF8 > 0 {
+		ctx := renderContext{diag: diag}
+		ctx.warn(WarningSanitized, "replaced %d invalid UTF-8 byte(s) with U+FFFD", doc.invalidUTF8)
+	}
+	if cfg.title != "" {
+		out.writeString("# " + safeHeadingText(cfg.title, cfg) + "\n\n")
+	}
+	ctx := renderContext{
+		diag:    diag,
+		cfg:     cfg,
+		parent:  parent,
+		anchors: newHeadingAnchors(doc, cfg),
+	}
+	if cfg.tocDepth > 0 {
+		if toc := renderTableOfContents(doc, ctx.anchors, cfg); toc != "" {
+			out.writeString(toc + "\n\n")
+		}
+	}
+	renderBlocksTo(out, doc.Doc.Content, ctx)
+	if out.err == nil {
+		// Nested blocks stop early on cancellation without reporting it.
+		out.err = parent.Err()
+	}
+	return diag.warnings, out.err
+}
+
+// errWriter remembers the first write error and drops later writes. path
+// is the block being written, for the RenderError.
+type errWriter struct {
+	w    io.Writer
+	path []int
+	err  error
+}
+
+func (e *errWriter) writeString(s string) {
+	if e.err != nil {
+		return
+	}
+	if _, err := io.WriteString(e.w, s); err != nil {
+		e.err = &RenderError{Path: formatNodePath(e.path), Err: err}
+	}
+}
+
+// FirstHeading returns the plain text of the first top-level heading.
+func (d *Document) FirstHeading() (string, bool) {
+	for _, node := range d.Doc.Content {
+		if node.Type == "heading" {
+			return PlainText(node), true
+		}
+	}
+	return "", false
+}
+
+// PlainText returns the text below node without formatting, with hard
+// breaks as spaces and surrounding whitespace trimmed.
+func PlainText(node Node) string {
+	var b strings.Builder
+	var collect func(Node)
+	collect = func(n Node) {
+		switch n.Type {
+		case "text":
+			b.WriteString(n.Text)
+		case "hard_break":
+			b.WriteString(" ")
+		}
+		for _, child := range n.Content {
+			collect(child)
+		}
+	}
+	collect(node)
+	return strings.TrimSpace(b.String())
+}
@@ -0,0 +1,87 @@
+package boxnote
+
+import "strings"
+
+// Callouts selects how call_out_box nodes are written.
+type Callouts string
+
+const (
+	// CalloutsQuote writes them as plain blockquotes (the default).
+	CalloutsQuote Callouts = "quote"
+	// CalloutsObsidian writes Obsidian callouts, > [!type], with the type
+	// chosen by the box's emoji.
+	CalloutsObsidian Callouts = "obsidian"
+	// CalloutsAlerts writes the alerts of GitHub and GitLab, > [!NOTE], of
+	// the five types they know.
+	CalloutsAlerts Callouts = "alerts"
+)
+
+// WithCallouts selects how call-out boxes are written.
+func WithCallouts(style Callouts) ConvertOption {
+	return func(c *config) {
+		c.callouts = style
+	}
+}
+
+// calloutTypes maps the emoji of a call-out box to the Obsidian callout type
+// closest in meaning. Other emoji give a note callout.
+var calloutTypes = map[string]string{
+	"💡": "tip",
+	"✨": "tip",
+	"ℹ": "info",
+	"📌": "info",
+	"⚠": "warning",
+	"🚧": "warning",
+	"❗": "important",
+	"‼": "important",
+	"🚨": "danger",
+	"🔥": "danger",
+	"⛔": "danger",
+	"❓": "question",
+	"🤔": "question",
+	"✅": "success",
+	"✔": "success",
+	"❌": "failure",
+	"🐛": "bug",
+	"📋": "abstract",
+	"💬": "quote",
+	"📝": "note",
+}
+
+// alertTypes maps callout types to the closest alert type.
+var alertTypes = map[string]string{
+	"tip":       "TIP",
+	"success":   "TIP",
+	"important": "IMPORTANT",
+	"warning":   "WARNING",
+	"danger":    "CAUTION",
+	"failure":   "CAUTION",
+	"bug":       "CAUTION",
+}
+
+func renderCallout(node Node, ctx renderContext) string {
+	header := "[!" + CalloutType(node) + "]"
+	if ctx.cfg.callouts == CalloutsAlerts {
+		alert, ok := alertTypes[CalloutType(node)]
+		if !ok {
+			alert = "NOTE"
+		}
+		header = "[!" + alert + "]"
+	}
+	content := renderBlocks(node.Content, ctx)
+	if content == "" {
+		return quoteLines(header)
+	}
+	return quoteLines(header + "\n" + content)
+}
+
+// CalloutType returns the Obsidian callout type, such as "tip" or
+// "warning", that the emoji attr of a call-out box stands for, ignoring
+// emoji variation selectors. Other emoji give "note".
+func CalloutType(node Node) string {
+	emoji, _ := getStringAttr(node.Attrs, "emoji")
+	if calloutType, ok := calloutTypes[strings.TrimSuffix(emoji, "\ufe0f")]; ok {
+		return calloutType
+	}
+	return "note"
+}
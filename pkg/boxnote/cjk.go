@@ -0,0 +1,95 @@
+package boxnote
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// WithJoinCJKLines joins the lines that newlines in note text break
+// paragraphs into. Markdown renderers turn such a soft break into a space,
+// which shows as a gap in Chinese and Japanese text: a newline between two
+// CJK characters is removed, and one between other text becomes a space.
+func WithJoinCJKLines(join bool) ConvertOption {
+	return func(c *config) {
+		c.joinCJKLines = join
+	}
+}
+
+const (
+	ideographicSpace       = "\u3000"
+	ideographicSpaceEntity = "&#x3000;"
+)
+
+// WithIdeographicSpaceEntities writes the ideographic spaces (U+3000) of
+// note text, outside code, as &#x3000;. Japanese text is indented with
+// them, and editors and tools that trim Unicode whitespace would take them
+// off the start of a line or table cell; the converter itself keeps them.
+func WithIdeographicSpaceEntities(entities bool) ConvertOption {
+	return func(c *config) {
+		c.ideographicSpaceEntities = entities
+	}
+}
+
+// isCJK reports whether r is written without spaces between words: Han
+// characters, kana, and full-width forms and punctuation. Hangul is written
+// with spaces and is not.
+func isCJK(r rune) bool {
+	switch {
+	case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Bopomofo):
+		return true
+	case r >= 0x3000 && r <= 0x303f: // CJK symbols and punctuation
+		return true
+	case r >= 0xff00 && r <= 0xff60, r >= 0xffe0 && r <= 0xffe6: // full-width forms
+		return true
+	}
+	return false
+}
+
+// joinLines joins the lines of text for WithJoinCJKLines. before and after
+// are the characters around text in its paragraph, or 0 at the start or end
+// of one; the spaces around each newline go with it.
+func joinLines(text string, before, after rune) string {
+	if !strings.Contains(text, "\n") {
+		return text
+	}
+	var b strings.Builder
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if i > 0 {
+			line = strings.TrimLeft(line, " \t")
+		}
+		if i < len(lines)-1 {
+			line = strings.TrimRight(line, " \t")
+		}
+		if i > 0 {
+			prev, next := before, after
+			if s := b.String(); s != "" {
+				prev, _ = utf8.DecodeLastRuneInString(s)
+			}
+			if line != "" {
+				next, _ = utf8.DecodeRuneInString(line)
+			} else if i < len(lines)-1 {
+				// An empty line in between: the next line decides.
+				next = firstLineRune(lines[i+1:], after)
+			}
+			if prev != 0 && next != 0 && !(isCJK(prev) && isCJK(next)) && !strings.HasSuffix(b.String(), " ") {
+				b.WriteByte(' ')
+			}
+		}
+		b.WriteString(line)
+	}
+	return b.String()
+}
+
+// firstLineRune returns the first character of lines, ignoring leading
+// spaces, or after when they are all blank.
+func firstLineRune(lines []string, after rune) rune {
+	for _, line := range lines {
+		if line = strings.TrimLeft(line, " \t"); line != "" {
+			r, _ := utf8.DecodeRuneInString(line)
+			return r
+		}
+	}
+	return after
+}
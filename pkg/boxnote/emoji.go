@@ -0,0 +1,161 @@
+package boxnote
+
+import (
+	_ "embed"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Emoji selects how emoji in note text are written. Box stores them as
+// Unicode, while some targets, such as GitHub and Slack, prefer the
+// :shortcode: form.
+type Emoji string
+
+const (
+	// EmojiKeep writes the text as it is (the default).
+	EmojiKeep Emoji = "keep"
+	// EmojiUnicode also writes the :shortcodes: typed into notes as emoji.
+	EmojiUnicode Emoji = "unicode"
+	// EmojiShortcode writes emoji as :shortcodes:. Emoji without one, with
+	// a skin tone, or joined by U+200D are kept.
+	EmojiShortcode Emoji = "shortcode"
+)
+
+// WithEmoji selects how emoji in text are written. Code spans are left
+// alone.
+func WithEmoji(mode Emoji) ConvertOption {
+	return func(c *config) {
+		c.emoji = mode
+	}
+}
+
+//go:embed emoji.txt
+var emojiData string
+
+const (
+	zeroWidthJoiner     = '\u200D'
+	variationSelector16 = '\uFE0F'
+)
+
+var emojiTable struct {
+	once        sync.Once
+	byShortcode map[string]string
+	byEmoji     map[string]string
+	// starts holds the first rune of every emoji, and maxLen the length of
+	// the longest in bytes.
+	starts map[rune]bool
+	maxLen int
+}
+
+func loadEmojiTable() {
+	emojiTable.byShortcode = map[string]string{}
+	emojiTable.byEmoji = map[string]string{}
+	emojiTable.starts = map[rune]bool{}
+	add := func(emoji, shortcode string) {
+		if _, ok := emojiTable.byEmoji[emoji]; ok {
+			return
+		}
+		emojiTable.byEmoji[emoji] = shortcode
+		r, _ := utf8.DecodeRuneInString(emoji)
+		emojiTable.starts[r] = true
+		emojiTable.maxLen = maxInt(emojiTable.maxLen, len(emoji))
+	}
+	for _, line := range strings.Split(emojiData, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		var b strings.Builder
+		for _, hex := range strings.Split(fields[0], "-") {
+			cp, err := strconv.ParseUint(hex, 16, 32)
+			if err != nil {
+				panic("boxnote: bad emoji table line " + strconv.Quote(line))
+			}
+			b.WriteRune(rune(cp))
+		}
+		emoji := b.String()
+		for _, shortcode := range fields[1:] {
+			emojiTable.byShortcode[shortcode] = emoji
+		}
+		add(emoji, fields[1])
+		// Pictographs are also written without the presentation selector;
+		// symbols such as © and ↩ are emoji only with it.
+		if r, _ := utf8.DecodeRuneInString(emoji); r >= 0x1F000 {
+			add(strings.ReplaceAll(emoji, string(variationSelector16), ""), fields[1])
+		}
+	}
+}
+
+// fromShortcodes replaces the known :shortcodes: of text with their emoji.
+func fromShortcodes(text string) string {
+	if !strings.Contains(text, ":") {
+		return text
+	}
+	emojiTable.once.Do(loadEmojiTable)
+	var b strings.Builder
+	for {
+		start := strings.IndexByte(text, ':')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(text[start+1:], ':')
+		if end < 0 {
+			break
+		}
+		end += start + 1
+		if emoji, ok := emojiTable.byShortcode[text[start+1:end]]; ok {
+			b.WriteString(text[:start])
+			b.WriteString(emoji)
+			text = text[end+1:]
+			continue
+		}
+		// The closing colon may open the next shortcode.
+		b.WriteString(text[:end])
+		text = text[end:]
+	}
+	b.WriteString(text)
+	return b.String()
+}
+
+// toShortcodes replaces the emoji of text that have a shortcode with it.
+func toShortcodes(text string) string {
+	emojiTable.once.Do(loadEmojiTable)
+	var b strings.Builder
+	joined := false
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if emojiTable.starts[r] && !joined {
+			if n := matchEmoji(text[i:]); n > 0 {
+				end := i + n
+				if next, size := utf8.DecodeRuneInString(text[end:]); next == variationSelector16 {
+					end += size
+				}
+				// Skin tones and joined sequences have no shortcode of their own.
+				if next, _ := utf8.DecodeRuneInString(text[end:]); next == zeroWidthJoiner || next >= 0x1F3FB && next <= 0x1F3FF {
+					b.WriteString(text[i:end])
+				} else {
+					b.WriteString(":" + emojiTable.byEmoji[text[i:i+n]] + ":")
+				}
+				i = end
+				continue
+			}
+		}
+		joined = r == zeroWidthJoiner
+		b.WriteString(text[i : i+size])
+		i += size
+	}
+	return b.String()
+}
+
+// matchEmoji returns the length of the longest emoji of the table that
+// text starts with, or 0.
+func matchEmoji(text string) int {
+	for n := clampInt(len(text), 0, emojiTable.maxLen); n > 0; n-- {
+		if _, ok := emojiTable.byEmoji[text[:n]]; ok {
+			return n
+		}
+	}
+	return 0
+}
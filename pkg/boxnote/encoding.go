@@ -0,0 +1,61 @@
+package boxnote
+
+import (
+	"bytes"
+	"errors"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// decodeInput returns input as UTF-8 without a byte order mark. UTF-16
+// input, as written by some Windows tools, is transcoded: it is recognized
+// by its BOM or, without one, by the zero bytes around the opening brace.
+func decodeInput(input []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(input, utf8BOM):
+		return input[len(utf8BOM):], nil
+	case bytes.HasPrefix(input, []byte{0xFF, 0xFE}):
+		return decodeUTF16(input[2:], false)
+	case bytes.HasPrefix(input, []byte{0xFE, 0xFF}):
+		return decodeUTF16(input[2:], true)
+	case len(input) >= 2 && input[0] != 0 && input[1] == 0:
+		return decodeUTF16(input, false)
+	case len(input) >= 2 && input[0] == 0 && input[1] != 0:
+		return decodeUTF16(input, true)
+	}
+	return input, nil
+}
+
+// DecodeText returns input as Parse reads it: as UTF-8 without a byte order
+// mark, transcoded first when it is UTF-16.
+func DecodeText(input []byte) ([]byte, error) {
+	return decodeInput(input)
+}
+
+// isUTF16 reports whether input starting with head is decoded as UTF-16.
+func isUTF16(head []byte) bool {
+	return bytes.HasPrefix(head, []byte{0xFF, 0xFE}) || bytes.HasPrefix(head, []byte{0xFE, 0xFF}) ||
+		len(head) >= 2 && (head[0] == 0) != (head[1] == 0)
+}
+
+func decodeUTF16(input []byte, bigEndian bool) ([]byte, error) {
+	if len(input)%2 != 0 {
+		return nil, errors.New("truncated UTF-16 input")
+	}
+	units := make([]uint16, len(input)/2)
+	for i := range units {
+		if bigEndian {
+			units[i] = uint16(input[2*i])<<8 | uint16(input[2*i+1])
+		} else {
+			units[i] = uint16(input[2*i+1])<<8 | uint16(input[2*i])
+		}
+	}
+	runes := utf16.Decode(units)
+	out := make([]byte, 0, len(runes))
+	for _, r := range runes {
+		out = utf8.AppendRune(out, r)
+	}
+	return bytes.TrimPrefix(out, utf8BOM), nil
+}
@@ -0,0 +1,150 @@
+package boxnote
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseError reports input that is not valid Box Notes JSON. Path locates
+// the value being read when decoding failed, e.g. doc.content[12].attrs.level.
+type ParseError struct {
+	Path string
+	// Offset is the byte offset in the input at which decoding failed.
+	Offset int64
+	Err    error
+}
+
+func (e *ParseError) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("failed to parse JSON: %v", e.Err)
+	}
+	return fmt.Sprintf("failed to parse JSON at %s: %v", e.Path, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// SchemaError reports JSON that decodes but does not have the shape of a
+// Box Note. Path is empty when the problem concerns the whole document.
+type SchemaError struct {
+	Path    string
+	Message string
+}
+
+func (e *SchemaError) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return fmt.Sprintf("%s at %s", e.Message, e.Path)
+}
+
+// RenderError reports a failure while writing rendered output. Path names
+// the block that was being written.
+type RenderError struct {
+	Path string
+	Err  error
+}
+
+func (e *RenderError) Error() string {
+	return fmt.Sprintf("failed to write output at %s: %v", e.Path, e.Err)
+}
+
+func (e *RenderError) Unwrap() error {
+	return e.Err
+}
+
+func newParseError(input []byte, err error) *ParseError {
+	var offset int64
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		offset = syntaxErr.Offset
+	case errors.As(err, &typeErr):
+		offset = typeErr.Offset
+		err = fmt.Errorf("cannot use JSON %s as %s", typeErr.Value, typeErr.Type)
+	default:
+		offset = int64(len(input))
+	}
+	return &ParseError{Path: jsonPathAt(input, offset), Offset: offset, Err: err}
+}
+
+type jsonFrame struct {
+	array     bool
+	index     int
+	key       string
+	expectKey bool
+}
+
+// elidedPathFrames is how many levels jsonPathAt keeps at each end of a path
+// deeper than MaxDepth.
+const elidedPathFrames = 5
+
+// jsonPathAt returns the path of the value being read at offset, replaying
+// the input token by token up to that point. The middle of a path deeper
+// than MaxDepth is elided.
+func jsonPathAt(input []byte, offset int64) string {
+	dec := json.NewDecoder(bytes.NewReader(input))
+	var stack []*jsonFrame
+	for dec.InputOffset() < offset {
+		tok, err := dec.Token()
+		if err != nil {
+			break
+		}
+		var top *jsonFrame
+		if len(stack) > 0 {
+			top = stack[len(stack)-1]
+		}
+		if top != nil && !top.array && top.expectKey {
+			if key, ok := tok.(string); ok {
+				top.key = key
+				top.expectKey = false
+				continue
+			}
+		}
+		if delim, ok := tok.(json.Delim); ok && (delim == '}' || delim == ']') {
+			stack = stack[:len(stack)-1]
+			if len(stack) > 0 && !stack[len(stack)-1].array {
+				stack[len(stack)-1].expectKey = true
+			}
+			continue
+		}
+		if top != nil && top.array {
+			top.index++
+		}
+		if delim, ok := tok.(json.Delim); ok {
+			stack = append(stack, &jsonFrame{array: delim == '[', index: -1, expectKey: delim == '{'})
+			continue
+		}
+		if top != nil && !top.array {
+			top.expectKey = true
+		}
+	}
+
+	var b strings.Builder
+	for i, frame := range stack {
+		// Input nested past MaxDepth, which json rejects at about 10,000
+		// levels, would give a path of tens of kilobytes.
+		if len(stack) > MaxDepth && i >= elidedPathFrames && i < len(stack)-elidedPathFrames {
+			if i == elidedPathFrames {
+				b.WriteString("…")
+			}
+			continue
+		}
+		switch {
+		case frame.array && frame.index >= 0:
+			b.WriteString("[" + strconv.Itoa(frame.index) + "]")
+		case !frame.array && frame.key != "":
+			if b.Len() > 0 {
+				b.WriteString(".")
+			}
+			b.WriteString(frame.key)
+		}
+	}
+	return b.String()
+}
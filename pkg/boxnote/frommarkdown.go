@@ -0,0 +1,660 @@
+package boxnote
+
+import (
+	"bytes"
+	"encoding/json"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// FromMarkdown parses GFM Markdown into a Box Notes document. It reads
+// what the converter writes: headings, paragraphs, bullet, ordered, and
+// task lists, block quotes, callouts and alerts (as call-out boxes),
+// tables, horizontal rules, images, and the strong, em, underline,
+// strikethrough, code, and link marks. Code blocks become paragraphs of
+// code-marked lines. Front matter and HTML comments are skipped; other
+// HTML is kept as text.
+func FromMarkdown(markdown []byte) *Document {
+	text := strings.ReplaceAll(string(markdown), "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = expandTabs(line)
+	}
+	lines = skipFrontMatter(lines)
+	return &Document{Doc: Node{Type: "doc", Content: parseBlocks(lines)}}
+}
+
+// expandTabs replaces the tabs of a line's indentation with spaces up to
+// the next multiple of 4, so that indentation can be counted in columns.
+func expandTabs(line string) string {
+	var b strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\t':
+			b.WriteString(strings.Repeat(" ", 4-b.Len()%4))
+		case ' ':
+			b.WriteByte(' ')
+		default:
+			b.WriteString(line[i:])
+			return b.String()
+		}
+	}
+	return b.String()
+}
+
+func skipFrontMatter(lines []string) []string {
+	if len(lines) == 0 || strings.TrimRight(lines[0], " ") != "---" {
+		return lines
+	}
+	for i := 1; i < len(lines); i++ {
+		if line := strings.TrimRight(lines[i], " "); line == "---" || line == "..." {
+			return lines[i+1:]
+		}
+	}
+	return lines
+}
+
+func indentOf(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+func isBlank(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
+
+// dedent removes up to n columns of indentation from line.
+func dedent(line string, n int) string {
+	if indent := indentOf(line); indent < n {
+		n = indent
+	}
+	return line[n:]
+}
+
+func parseBlocks(lines []string) []Node {
+	var nodes []Node
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		switch {
+		case isBlank(line):
+			// Beyond the blank line between blocks, each pair of blank lines
+			// is an empty paragraph, as the converter writes them.
+			start := i
+			for i < len(lines) && isBlank(lines[i]) {
+				i++
+			}
+			if len(nodes) > 0 && i < len(lines) {
+				for n := (i - start - 1) / 2; n > 0; n-- {
+					nodes = append(nodes, Node{Type: "paragraph"})
+				}
+			}
+		case indentOf(line) >= 4:
+			var code []string
+			for ; i < len(lines) && (isBlank(lines[i]) || indentOf(lines[i]) >= 4); i++ {
+				code = append(code, dedent(lines[i], 4))
+			}
+			for len(code) > 0 && isBlank(code[len(code)-1]) {
+				code = code[:len(code)-1]
+			}
+			nodes = append(nodes, codeParagraph(code))
+		case isFenceStart(line):
+			var code []string
+			code, i = parseFence(lines, i)
+			nodes = append(nodes, codeParagraph(code))
+		case strings.HasPrefix(strings.TrimLeft(line, " "), "<!--"):
+			for ; i < len(lines); i++ {
+				if strings.Contains(lines[i], "-->") {
+					i++
+					break
+				}
+			}
+		case isThematicBreak(line):
+			nodes = append(nodes, Node{Type: "horizontal_rule"})
+			i++
+		default:
+			if level, text, id, ok := parseATXHeading(line); ok {
+				node := heading(level, text)
+				if id != "" {
+					node.Attrs["id"] = id
+				}
+				nodes = append(nodes, node)
+				i++
+				break
+			}
+			if isBlockQuote(line) {
+				var quoted []string
+				for ; i < len(lines) && isBlockQuote(lines[i]); i++ {
+					quoted = append(quoted, stripQuote(lines[i]))
+				}
+				nodes = append(nodes, blockQuote(quoted))
+				break
+			}
+			if i+1 < len(lines) && isTableStart(line, lines[i+1]) {
+				var table Node
+				table, i = parseTable(lines, i)
+				nodes = append(nodes, table)
+				break
+			}
+			if _, ok := parseListMarker(line); ok {
+				var list []Node
+				list, i = parseList(lines, i)
+				nodes = append(nodes, list...)
+				break
+			}
+			var node Node
+			node, i = parseParagraph(lines, i)
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// interrupts reports whether line starts a block that ends a paragraph.
+func interrupts(line string) bool {
+	if _, _, _, ok := parseATXHeading(line); ok {
+		return true
+	}
+	if marker, ok := parseListMarker(line); ok && marker.rest != "" {
+		return true
+	}
+	return isFenceStart(line) || isThematicBreak(line) || isBlockQuote(line) ||
+		strings.HasPrefix(strings.TrimLeft(line, " "), "<!--")
+}
+
+func parseParagraph(lines []string, i int) (Node, int) {
+	var text []string
+	for ; i < len(lines) && !isBlank(lines[i]); i++ {
+		if len(text) > 0 {
+			if level := setextLevel(lines[i]); level > 0 {
+				return heading(level, strings.Join(text, "\n")), i + 1
+			}
+			if interrupts(lines[i]) {
+				break
+			}
+		}
+		text = append(text, strings.TrimLeft(lines[i], " "))
+	}
+	joined := strings.TrimRight(strings.Join(text, "\n"), " ")
+	if joined == "&nbsp;" || joined == " " {
+		// An empty paragraph kept for spacing.
+		return Node{Type: "paragraph"}, i
+	}
+	content := parseInline(joined)
+	if len(content) == 1 && content[0].Type == "image" {
+		return content[0], i
+	}
+	return Node{Type: "paragraph", Content: content}, i
+}
+
+func setextLevel(line string) int {
+	if indentOf(line) > 3 {
+		return 0
+	}
+	trimmed := strings.TrimSpace(line)
+	switch {
+	case trimmed == "":
+		return 0
+	case strings.Trim(trimmed, "=") == "":
+		return 1
+	case strings.Trim(trimmed, "-") == "":
+		return 2
+	}
+	return 0
+}
+
+func heading(level int, text string) Node {
+	return Node{
+		Type:    "heading",
+		Attrs:   map[string]interface{}{"level": float64(level)},
+		Content: parseInline(text),
+	}
+}
+
+// parseATXHeading parses "## text ##", with the explicit ID written by
+// --heading-ids as {#id} or <a id>.
+func parseATXHeading(line string) (level int, text, id string, ok bool) {
+	if indentOf(line) > 3 {
+		return 0, "", "", false
+	}
+	trimmed := strings.TrimLeft(line, " ")
+	level = len(trimmed) - len(strings.TrimLeft(trimmed, "#"))
+	if level < 1 || level > 6 {
+		return 0, "", "", false
+	}
+	rest := trimmed[level:]
+	if rest != "" && rest[0] != ' ' {
+		return 0, "", "", false
+	}
+	rest = strings.TrimSpace(rest)
+	if closing := strings.TrimRight(rest, "#"); closing == "" || strings.HasSuffix(closing, " ") {
+		rest = strings.TrimSpace(closing)
+	}
+	if strings.HasSuffix(rest, "}") {
+		if start := strings.LastIndex(rest, " {#"); start >= 0 {
+			rest, id = rest[:start], rest[start+len(" {#"):len(rest)-1]
+		}
+	}
+	if m := headingAnchorPattern.FindStringSubmatch(rest); m != nil {
+		rest, id = strings.TrimSpace(rest[len(m[0]):]), html.UnescapeString(m[1])
+	}
+	return level, rest, id, true
+}
+
+var headingAnchorPattern = regexp.MustCompile(`^<a id="([^"]*)"></a>`)
+
+func isThematicBreak(line string) bool {
+	if indentOf(line) > 3 {
+		return false
+	}
+	trimmed := strings.TrimSpace(line)
+	if trimmed == "" {
+		return false
+	}
+	c := trimmed[0]
+	if c != '-' && c != '*' && c != '_' {
+		return false
+	}
+	count := 0
+	for i := 0; i < len(trimmed); i++ {
+		switch trimmed[i] {
+		case c:
+			count++
+		case ' ':
+		default:
+			return false
+		}
+	}
+	return count >= 3
+}
+
+func isFenceStart(line string) bool {
+	if indentOf(line) > 3 {
+		return false
+	}
+	trimmed := strings.TrimLeft(line, " ")
+	return strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~")
+}
+
+// parseFence returns the lines of the fenced code block starting at line
+// i, and the line after it. An unclosed fence runs to the end.
+func parseFence(lines []string, i int) ([]string, int) {
+	indent := indentOf(lines[i])
+	opening := strings.TrimLeft(lines[i], " ")
+	fence := opening[:len(opening)-len(strings.TrimLeft(opening, opening[:1]))]
+	var code []string
+	for i++; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if indentOf(lines[i]) <= 3 && strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+			return code, i + 1
+		}
+		code = append(code, dedent(lines[i], indent))
+	}
+	return code, i
+}
+
+// codeParagraph keeps the lines of a code block as code-marked text
+// separated by hard breaks, since Box Notes have no code blocks.
+func codeParagraph(code []string) Node {
+	paragraph := Node{Type: "paragraph"}
+	for i, line := range code {
+		if i > 0 {
+			paragraph.Content = append(paragraph.Content, Node{Type: "hard_break"})
+		}
+		if line != "" {
+			paragraph.Content = append(paragraph.Content, Node{Type: "text", Text: line, Marks: []Mark{{Type: "code"}}})
+		}
+	}
+	return paragraph
+}
+
+func isBlockQuote(line string) bool {
+	return indentOf(line) <= 3 && strings.HasPrefix(strings.TrimLeft(line, " "), ">")
+}
+
+func stripQuote(line string) string {
+	line = strings.TrimLeft(line, " ")[1:]
+	return strings.TrimPrefix(line, " ")
+}
+
+// calloutEmoji maps Obsidian callout types and GitHub alert types to the
+// emoji of a call-out box, which CalloutType maps back.
+var calloutEmoji = map[string]string{
+	"tip":       "💡",
+	"info":      "ℹ️",
+	"warning":   "⚠️",
+	"important": "❗",
+	"danger":    "🚨",
+	"caution":   "🚨",
+	"question":  "❓",
+	"success":   "✅",
+	"failure":   "❌",
+	"bug":       "🐛",
+	"abstract":  "📋",
+	"quote":     "💬",
+	"note":      "📝",
+}
+
+// blockQuote returns a blockquote, or a call-out box for a quote that
+// starts with a "[!type]" callout or alert header.
+func blockQuote(lines []string) Node {
+	if len(lines) > 0 {
+		header := strings.TrimSpace(lines[0])
+		if strings.HasPrefix(header, "[!") {
+			if end := strings.Index(header, "]"); end > 2 {
+				calloutType := strings.ToLower(header[2:end])
+				emoji, ok := calloutEmoji[calloutType]
+				if !ok {
+					emoji = calloutEmoji["note"]
+				}
+				content := parseBlocks(lines[1:])
+				title := strings.TrimSpace(strings.TrimLeft(header[end+1:], "+-"))
+				if title != "" {
+					titled := Node{Type: "paragraph", Content: parseInline(title)}
+					for i := range titled.Content {
+						titled.Content[i].Marks = append(titled.Content[i].Marks, Mark{Type: "strong"})
+					}
+					content = append([]Node{titled}, content...)
+				}
+				return Node{Type: "call_out_box", Attrs: map[string]interface{}{"emoji": emoji}, Content: content}
+			}
+		}
+	}
+	return Node{Type: "blockquote", Content: parseBlocks(lines)}
+}
+
+// splitTableRow splits a pipe table row into its cells. Escaped pipes are
+// kept in the cells.
+func splitTableRow(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	if strings.HasSuffix(line, "|") && !strings.HasSuffix(line, `\|`) {
+		line = line[:len(line)-1]
+	}
+	var cells []string
+	var cell strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && i+1 < len(line) && line[i+1] == '|':
+			cell.WriteByte('|')
+			i++
+		case line[i] == '|':
+			cells = append(cells, trimMarkdownSpace(cell.String()))
+			cell.Reset()
+		default:
+			cell.WriteByte(line[i])
+		}
+	}
+	return append(cells, trimMarkdownSpace(cell.String()))
+}
+
+func isDelimiterRow(line string) bool {
+	if !strings.Contains(line, "-") {
+		return false
+	}
+	for _, cell := range splitTableRow(line) {
+		cell = strings.TrimSuffix(strings.TrimPrefix(cell, ":"), ":")
+		if cell == "" || strings.Trim(cell, "-") != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func isTableStart(line, next string) bool {
+	return strings.Contains(line, "|") && isDelimiterRow(next) &&
+		len(splitTableRow(line)) == len(splitTableRow(next))
+}
+
+func parseTable(lines []string, i int) (Node, int) {
+	columns := len(splitTableRow(lines[i]))
+	table := Node{Type: "table", Content: []Node{tableRow(splitTableRow(lines[i]), columns, "table_header")}}
+	for i += 2; i < len(lines) && !isBlank(lines[i]) && !interrupts(lines[i]); i++ {
+		table.Content = append(table.Content, tableRow(splitTableRow(lines[i]), columns, "table_cell"))
+	}
+	return table, i
+}
+
+var cellBreakPattern = regexp.MustCompile(`<br\s*/?>`)
+
+func tableRow(cells []string, columns int, cellType string) Node {
+	row := Node{Type: "table_row"}
+	for i := 0; i < columns; i++ {
+		// The paragraphs of a cell are joined by <br> in a row.
+		var paragraphs []Node
+		if i < len(cells) {
+			for _, text := range cellBreakPattern.Split(cells[i], -1) {
+				paragraphs = append(paragraphs, Node{Type: "paragraph", Content: parseInline(text)})
+			}
+		} else {
+			paragraphs = []Node{{Type: "paragraph"}}
+		}
+		row.Content = append(row.Content, Node{
+			Type:    cellType,
+			Attrs:   map[string]interface{}{"colspan": float64(1), "rowspan": float64(1)},
+			Content: paragraphs,
+		})
+	}
+	return row
+}
+
+// listMarker is the start of a list item.
+type listMarker struct {
+	indent  int
+	ordered bool
+	// delimiter is the bullet character, or the . or ) after the number.
+	delimiter byte
+	start     int
+	// contentIndent is the column the item's content starts at.
+	contentIndent int
+	rest          string
+}
+
+func parseListMarker(line string) (listMarker, bool) {
+	indent := indentOf(line)
+	if indent > 3 {
+		return listMarker{}, false
+	}
+	trimmed := line[indent:]
+	m := listMarker{indent: indent}
+	width := 0
+	switch {
+	case trimmed == "":
+		return m, false
+	case strings.IndexByte("-*+", trimmed[0]) >= 0:
+		m.delimiter = trimmed[0]
+		width = 1
+	default:
+		digits := len(trimmed) - len(strings.TrimLeftFunc(trimmed, unicode.IsDigit))
+		if digits == 0 || digits > 9 || digits >= len(trimmed) || (trimmed[digits] != '.' && trimmed[digits] != ')') {
+			return m, false
+		}
+		m.ordered = true
+		m.delimiter = trimmed[digits]
+		m.start, _ = strconv.Atoi(trimmed[:digits])
+		width = digits + 1
+	}
+	after := trimmed[width:]
+	if after != "" && after[0] != ' ' {
+		return listMarker{}, false
+	}
+	spaces := indentOf(after)
+	if spaces > 4 || after == strings.Repeat(" ", spaces) {
+		// Content indented as code, or no content, starts one space after
+		// the marker.
+		spaces = 1
+	}
+	m.contentIndent = indent + width + spaces
+	m.rest = strings.TrimLeft(after, " ")
+	return m, true
+}
+
+// listItem is an item with its lines, dedented to its content.
+type listItem struct {
+	marker listMarker
+	lines  []string
+}
+
+// parseList parses the list starting at line i. It returns the list nodes,
+// several when task items and other items alternate, and the line after
+// the list.
+func parseList(lines []string, i int) ([]Node, int) {
+	first, _ := parseListMarker(lines[i])
+	var items []listItem
+	for i < len(lines) {
+		marker, ok := parseListMarker(lines[i])
+		if !ok || marker.ordered != first.ordered || marker.delimiter != first.delimiter {
+			break
+		}
+		item := listItem{marker: marker, lines: []string{marker.rest}}
+		// Lines indented past the marker belong to the item, as long as its
+		// content: the converter nests every list by two spaces.
+		childIndent := marker.contentIndent
+		if childIndent > marker.indent+2 {
+			childIndent = marker.indent + 2
+		}
+		i++
+		blank := false
+		for ; i < len(lines); i++ {
+			line := lines[i]
+			switch {
+			case isBlank(line):
+				blank = true
+				item.lines = append(item.lines, "")
+				continue
+			case indentOf(line) >= childIndent:
+				item.lines = append(item.lines, line[childIndent:])
+				blank = false
+				continue
+			case !blank && !interrupts(line) && !isThematicBreak(line):
+				if _, isItem := parseListMarker(line); !isItem {
+					// A lazy continuation of the item's paragraph.
+					item.lines = append(item.lines, strings.TrimLeft(line, " "))
+					continue
+				}
+			}
+			break
+		}
+		items = append(items, item)
+		if i < len(lines) && !isBlank(lines[i]) {
+			if _, ok := parseListMarker(lines[i]); !ok {
+				break
+			}
+		}
+	}
+	// The blank lines after the list belong to no item.
+	for isBlank(lines[i-1]) {
+		i--
+	}
+	return listNodes(items, first), i
+}
+
+func listNodes(items []listItem, first listMarker) []Node {
+	var lists []Node
+	for _, item := range items {
+		taskAttrs, task := taskMarker(item.lines[0])
+		if task {
+			item.lines[0] = strings.TrimLeft(item.lines[0][3:], " ")
+		}
+		listType, itemType := "bullet_list", "list_item"
+		switch {
+		case task:
+			listType, itemType = "check_list", "check_list_item"
+		case first.ordered:
+			listType = "ordered_list"
+		}
+		if len(lists) == 0 || lists[len(lists)-1].Type != listType {
+			list := Node{Type: listType}
+			if listType == "ordered_list" {
+				list.Attrs = map[string]interface{}{"order": float64(item.marker.start)}
+			}
+			lists = append(lists, list)
+		}
+		list := &lists[len(lists)-1]
+
+		// Box keeps a sub-list in the list, after the item it belongs to.
+		var content, sublists []Node
+		for _, block := range parseBlocks(item.lines) {
+			if block.Type == "bullet_list" || block.Type == "ordered_list" || block.Type == "check_list" {
+				sublists = append(sublists, block)
+				continue
+			}
+			content = append(content, block)
+		}
+		if len(content) == 0 {
+			content = []Node{{Type: "paragraph"}}
+		}
+		node := Node{Type: itemType, Content: content}
+		if task {
+			node.Attrs = taskAttrs
+		}
+		list.Content = append(list.Content, node)
+		list.Content = append(list.Content, sublists...)
+	}
+	return lists
+}
+
+// taskMarker returns the attrs of the checklist item a task list marker
+// makes. The cancelled, [-], and in progress, [/], markers of the Obsidian
+// Tasks plugin are kept as its state.
+func taskMarker(line string) (map[string]interface{}, bool) {
+	if len(line) < 3 || line[0] != '[' || line[2] != ']' || (len(line) > 3 && line[3] != ' ') {
+		return nil, false
+	}
+	switch line[1] {
+	case ' ':
+		return map[string]interface{}{"checked": false}, true
+	case 'x', 'X':
+		return map[string]interface{}{"checked": true}, true
+	case '-':
+		return map[string]interface{}{"checked": false, "state": "cancelled"}, true
+	case '/':
+		return map[string]interface{}{"checked": false, "state": "in_progress"}, true
+	}
+	return nil, false
+}
+
+// encodedNode and encodedMark are the JSON written for a node and a mark,
+// without the fields they do not use.
+type encodedNode struct {
+	Type    string                 `json:"type"`
+	Attrs   map[string]interface{} `json:"attrs,omitempty"`
+	Content []encodedNode          `json:"content,omitempty"`
+	Text    string                 `json:"text,omitempty"`
+	Marks   []encodedMark          `json:"marks,omitempty"`
+}
+
+type encodedMark struct {
+	Type  string                 `json:"type"`
+	Attrs map[string]interface{} `json:"attrs,omitempty"`
+}
+
+func encodeNode(node Node) encodedNode {
+	encoded := encodedNode{Type: node.Type, Attrs: node.Attrs, Text: node.Text}
+	for _, child := range node.Content {
+		encoded.Content = append(encoded.Content, encodeNode(child))
+	}
+	for _, mark := range node.Marks {
+		encoded.Marks = append(encoded.Marks, encodedMark(mark))
+	}
+	return encoded
+}
+
+// Encode returns d as a Box Notes file in the new format, which Parse
+// reads back.
+func (d *Document) Encode() ([]byte, error) {
+	file := struct {
+		Version       int         `json:"version"`
+		SchemaVersion int         `json:"schema_version"`
+		Doc           encodedNode `json:"doc"`
+	}{Version: 1, SchemaVersion: 1, Doc: encodeNode(d.Doc)}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(file); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
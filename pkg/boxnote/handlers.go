@@ -0,0 +1,87 @@
+package boxnote
+
+import "sync"
+
+// BlockHandler renders a block-level node as Markdown. Returning false
+// drops the node, as for empty unknown nodes.
+type BlockHandler func(node Node, r *Renderer) (string, bool)
+
+// InlineHandler renders a node found among inline content, such as within a
+// paragraph or a table cell.
+type InlineHandler func(node Node, r *Renderer) string
+
+var handlers = struct {
+	sync.RWMutex
+	block  map[string]BlockHandler
+	inline map[string]InlineHandler
+}{
+	block:  map[string]BlockHandler{},
+	inline: map[string]InlineHandler{},
+}
+
+// RegisterBlockHandler makes nodes of nodeType render through fn when they
+// appear as blocks. It takes precedence over the built-in rendering, so it
+// can also replace how a standard node type is converted. A nil fn removes
+// the handler.
+func RegisterBlockHandler(nodeType string, fn BlockHandler) {
+	handlers.Lock()
+	defer handlers.Unlock()
+	if fn == nil {
+		delete(handlers.block, nodeType)
+		return
+	}
+	handlers.block[nodeType] = fn
+}
+
+// RegisterInlineHandler makes nodes of nodeType render through fn when they
+// appear among inline content. A nil fn removes the handler.
+func RegisterInlineHandler(nodeType string, fn InlineHandler) {
+	handlers.Lock()
+	defer handlers.Unlock()
+	if fn == nil {
+		delete(handlers.inline, nodeType)
+		return
+	}
+	handlers.inline[nodeType] = fn
+}
+
+func blockHandler(nodeType string) (BlockHandler, bool) {
+	handlers.RLock()
+	defer handlers.RUnlock()
+	fn, ok := handlers.block[nodeType]
+	return fn, ok
+}
+
+func inlineHandler(nodeType string) (InlineHandler, bool) {
+	handlers.RLock()
+	defer handlers.RUnlock()
+	fn, ok := handlers.inline[nodeType]
+	return fn, ok
+}
+
+// Renderer gives handlers access to the conversion in progress: rendering a
+// node's children with the current settings and reporting warnings.
+type Renderer struct {
+	ctx renderContext
+}
+
+// Blocks renders the children of the handled node as blocks separated by
+// blank lines.
+func (r *Renderer) Blocks(nodes []Node) string {
+	return renderBlocks(nodes, r.ctx)
+}
+
+// Inline renders the children of the handled node as inline content.
+func (r *Renderer) Inline(nodes []Node) string {
+	return renderInline(nodes, r.ctx)
+}
+
+// Warn records a warning of kind for the handled node.
+func (r *Renderer) Warn(kind, format string, args ...interface{}) {
+	r.ctx.warn(kind, format, args...)
+}
+
+// Path returns the location of the handled node, as in Warning.Path.
+func (r *Renderer) Path() string {
+	return formatNodePath(r.ctx.path)
+}
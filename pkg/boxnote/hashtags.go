@@ -0,0 +1,128 @@
+package boxnote
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// hashtagPattern matches #tag tokens that start a word, so URL fragments and
+// names such as C# are not taken for tags.
+var hashtagPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_&#/])(#[\p{L}\p{N}_][\p{L}\p{N}_\-]*)`)
+
+// Hashtags returns the distinct tags of the document, without the leading
+// #, in order of first appearance. Tags come from #tag tokens in text that
+// is not formatted as code, and from label nodes. Tokens made only of digits
+// and punctuation, such as #1, are not tags.
+func (d *Document) Hashtags() []string {
+	var tags []string
+	seen := map[string]bool{}
+	add := func(tag string) {
+		if tag == "" || seen[tag] {
+			return
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	Walk(d, Visitor{
+		Enter: func(node *Node, path []int) Action {
+			switch {
+			case isLabelNode(*node):
+				add(labelName(*node))
+				return SkipChildren
+			case node.Type == "text" && !hasMarkType(node.Marks, "code"):
+				for _, span := range hashtagSpans(node.Text) {
+					add(node.Text[span[0]+1 : span[1]])
+				}
+			}
+			return Continue
+		},
+	})
+	return tags
+}
+
+// StripHashtags removes the tags reported by Hashtags from the document:
+// #tag tokens are cut from the text, label nodes are dropped, and paragraphs
+// left without text are removed.
+func (d *Document) StripHashtags() {
+	Walk(d, Visitor{
+		Enter: func(node *Node, path []int) Action {
+			switch {
+			case isLabelNode(*node):
+				return Remove
+			case node.Type == "text" && !hasMarkType(node.Marks, "code"):
+				node.Text = stripHashtags(node.Text)
+			}
+			return Continue
+		},
+	})
+	Walk(d, Visitor{
+		Enter: func(node *Node, path []int) Action {
+			if node.Type == "paragraph" && len(node.Content) > 0 && onlyBlankText(node.Content) {
+				return Remove
+			}
+			return Continue
+		},
+	})
+}
+
+func isLabelNode(node Node) bool {
+	return node.Type == "label" || node.Type == "tag"
+}
+
+// labelName returns the name of a label node, from its name or text attr
+// or its text content.
+func labelName(node Node) string {
+	for _, key := range []string{"name", "text"} {
+		if name, ok := getStringAttr(node.Attrs, key); ok && name != "" {
+			return strings.TrimPrefix(strings.TrimSpace(name), "#")
+		}
+	}
+	return strings.TrimPrefix(PlainText(node), "#")
+}
+
+// hashtagSpans returns the byte ranges of the #tag tokens in text.
+func hashtagSpans(text string) [][2]int {
+	var spans [][2]int
+	for _, match := range hashtagPattern.FindAllStringSubmatchIndex(text, -1) {
+		start, end := match[2], match[3]
+		if !strings.ContainsFunc(text[start:end], unicode.IsLetter) {
+			continue
+		}
+		spans = append(spans, [2]int{start, end})
+	}
+	return spans
+}
+
+// stripHashtags cuts the #tag tokens from text, along with one of the
+// spaces left on either side.
+func stripHashtags(text string) string {
+	spans := hashtagSpans(text)
+	if len(spans) == 0 {
+		return text
+	}
+	var b strings.Builder
+	last := 0
+	for _, span := range spans {
+		start, end := span[0], span[1]
+		if end < len(text) && text[end] == ' ' && (start == 0 || text[start-1] == ' ') {
+			end++
+		}
+		b.WriteString(text[last:start])
+		last = end
+	}
+	b.WriteString(text[last:])
+	if spans[len(spans)-1][1] == len(text) {
+		return strings.TrimRight(b.String(), " ")
+	}
+	return b.String()
+}
+
+func onlyBlankText(nodes []Node) bool {
+	for _, node := range nodes {
+		if node.Type != "text" || strings.TrimSpace(node.Text) != "" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,34 @@
+package boxnote
+
+// WithShiftHeadings moves every heading of the note n levels down, or up
+// when n is negative, within H1 to H6. A note that starts with its own H1
+// can then sit below the title added by WithTitle.
+func WithShiftHeadings(n int) ConvertOption {
+	return func(c *config) {
+		c.headingShift = n
+		c.headingShiftAuto = false
+	}
+}
+
+// WithShiftHeadingsAuto demotes the headings of the note by one level when
+// WithTitle adds a title, so that the title is the only H1, and leaves
+// them alone otherwise.
+func WithShiftHeadingsAuto() ConvertOption {
+	return func(c *config) {
+		c.headingShift = 0
+		c.headingShiftAuto = true
+	}
+}
+
+// headingLevel returns the level a heading of the note at level is written
+// at.
+func (c *config) headingLevel(level int) int {
+	shift := c.headingShift
+	if c.headingShiftAuto {
+		shift = 0
+		if c.title != "" {
+			shift = 1
+		}
+	}
+	return clampInt(level+shift, 1, 6)
+}
@@ -0,0 +1,88 @@
+package boxnote
+
+import (
+	"html"
+	"strings"
+)
+
+// WithImageSource passes the source of every image through fn before it is
+// rendered, e.g. to save data URIs as files and link to them instead. An
+// empty result drops the image.
+func WithImageSource(fn func(src string, node Node) string) ConvertOption {
+	return func(c *config) {
+		c.imageSource = fn
+	}
+}
+
+// renderImage renders an image node as an inline image. Its alt text is
+// the alt attr, or the caption when there is none.
+func renderImage(node Node, ctx renderContext) (string, bool) {
+	src, ok := imageSource(node, ctx)
+	if !ok {
+		return "", false
+	}
+	return "![" + escapeLinkText(imageAlt(node)) + "](" + escapeLinkDestination(src) + ")", true
+}
+
+// renderImageBlock renders a block-level image followed by its caption as an
+// italic line, or as a <figure> with WithHTMLBlocks.
+func renderImageBlock(node Node, ctx renderContext) (string, bool) {
+	caption := captionAttr(node)
+	if caption == "" {
+		return renderImage(node, ctx)
+	}
+	src, ok := imageSource(node, ctx)
+	if !ok {
+		return "", false
+	}
+	if ctx.cfg.htmlBlocks {
+		return "<figure>\n" +
+			"<img src=\"" + html.EscapeString(src) + "\" alt=\"" + html.EscapeString(imageAlt(node)) + "\">\n" +
+			"<figcaption>" + html.EscapeString(caption) + "</figcaption>\n" +
+			"</figure>", true
+	}
+	image := "![" + escapeLinkText(imageAlt(node)) + "](" + escapeLinkDestination(src) + ")"
+	return image + "\n" + applyMarks(caption, []Mark{{Type: "em"}}, ctx), true
+}
+
+// imageSource returns the src of an image, passed through WithImageSource.
+func imageSource(node Node, ctx renderContext) (string, bool) {
+	src, _ := getStringAttr(node.Attrs, "src")
+	if src == "" {
+		ctx.warn(WarningInvalidAttr, "image without src dropped")
+		return "", false
+	}
+	if ctx.cfg.imageSource != nil {
+		src = ctx.cfg.imageSource(src, node)
+	}
+	return src, src != ""
+}
+
+func imageAlt(node Node) string {
+	if alt, _ := getStringAttr(node.Attrs, "alt"); alt != "" {
+		return alt
+	}
+	return captionAttr(node)
+}
+
+// captionAttr returns the caption of an image or table: its caption attr,
+// or else its title attr.
+func captionAttr(node Node) string {
+	for _, key := range []string{"caption", "title"} {
+		if caption, _ := getStringAttr(node.Attrs, key); strings.TrimSpace(caption) != "" {
+			return strings.TrimSpace(caption)
+		}
+	}
+	return ""
+}
+
+// escapeLinkDestination keeps spaces and parentheses in src from ending
+// the link destination early.
+func escapeLinkDestination(src string) string {
+	replacer := strings.NewReplacer(
+		" ", "%20",
+		"(", "%28",
+		")", "%29",
+	)
+	return replacer.Replace(src)
+}
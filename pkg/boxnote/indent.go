@@ -0,0 +1,76 @@
+package boxnote
+
+import "strings"
+
+// Indent selects how the indentation of paragraphs is kept. Box lets
+// paragraphs be indented by levels, which Markdown has no syntax for: four
+// leading spaces would start a code block instead.
+type Indent string
+
+const (
+	// IndentNone drops the indentation (the default).
+	IndentNone Indent = "none"
+	// IndentQuote writes an indented paragraph as a blockquote, nested once
+	// per level.
+	IndentQuote Indent = "quote"
+	// IndentNBSP starts every line of the paragraph with four &nbsp; per
+	// level.
+	IndentNBSP Indent = "nbsp"
+	// IndentSpaces starts every line of the paragraph with two em spaces
+	// (U+2003) per level, which Markdown keeps as text, unlike ASCII spaces.
+	IndentSpaces Indent = "spaces"
+)
+
+// maxIndent bounds the indent levels that are kept.
+const maxIndent = 8
+
+const emSpace = "\u2003"
+
+// WithIndent selects how the indentation of paragraphs is kept.
+func WithIndent(mode Indent) ConvertOption {
+	return func(c *config) {
+		c.indent = mode
+	}
+}
+
+// paragraphIndent returns the indent level of a paragraph, from its indent
+// attr, or 0.
+func paragraphIndent(node Node, ctx renderContext) int {
+	for _, key := range []string{"indent", "indentLevel", "indentation"} {
+		if _, ok := node.Attrs[key]; !ok {
+			continue
+		}
+		level := getIntAttr(node.Attrs, key)
+		if level < 0 || level > maxIndent {
+			ctx.warn(WarningInvalidAttr, "indent level %v out of range", node.Attrs[key])
+		}
+		return clampInt(level, 0, maxIndent)
+	}
+	return 0
+}
+
+// indentBlock indents the rendered paragraph node for its indent level.
+func indentBlock(block string, node Node, ctx renderContext) string {
+	if ctx.cfg.indent != IndentQuote && ctx.cfg.indent != IndentNBSP && ctx.cfg.indent != IndentSpaces || block == "" {
+		return block
+	}
+	level := paragraphIndent(node, ctx)
+	if level == 0 {
+		return block
+	}
+	if ctx.cfg.indent == IndentQuote {
+		for i := 0; i < level; i++ {
+			block = quoteLines(block)
+		}
+		return block
+	}
+	prefix := strings.Repeat("&nbsp;", 4*level)
+	if ctx.cfg.indent == IndentSpaces {
+		prefix = strings.Repeat(emSpace, 2*level)
+	}
+	lines := strings.Split(block, "\n")
+	for i, line := range lines {
+		lines[i] = prefix + line
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,33 @@
+package boxnote
+
+import "strings"
+
+// WithLinkRewrite passes the href of every link mark through fn before it is
+// rendered, e.g. to point links at migrated pages. An empty result renders
+// the link text without the link.
+func WithLinkRewrite(fn func(href string) string) ConvertOption {
+	return func(c *config) {
+		c.linkRewrite = fn
+	}
+}
+
+// WithWikiLinks writes links as [[target|text]] wikilinks, as Obsidian and
+// other wikis use, when fn resolves their href (after WithLinkRewrite) to a
+// page. Links fn does not resolve, and links whose text cannot be put into a
+// wikilink, stay Markdown links.
+func WithWikiLinks(fn func(href string) (target string, ok bool)) ConvertOption {
+	return func(c *config) {
+		c.wikiLink = fn
+	}
+}
+
+// wikiLink writes the wikilink to target labeled with text.
+func wikiLink(target, text string) (string, bool) {
+	if strings.ContainsAny(text, "|\n") || strings.Contains(text, "[[") || strings.Contains(text, "]]") {
+		return "", false
+	}
+	if text == target {
+		return "[[" + target + "]]", true
+	}
+	return "[[" + target + "|" + text + "]]", true
+}
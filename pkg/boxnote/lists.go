@@ -0,0 +1,49 @@
+package boxnote
+
+// ListStyle selects whether lists are written tight or loose.
+type ListStyle string
+
+const (
+	// ListAuto writes a list loose when one of its items holds several
+	// blocks, such as two paragraphs, and tight otherwise (the default).
+	ListAuto ListStyle = "auto"
+	// ListTight writes every list without blank lines between its items.
+	// Later paragraphs of an item may then be read as part of its first.
+	ListTight ListStyle = "tight"
+	// ListLoose separates the items of every list, and the blocks within
+	// an item, with blank lines.
+	ListLoose ListStyle = "loose"
+)
+
+// WithListStyle selects between tight and loose lists.
+func WithListStyle(style ListStyle) ConvertOption {
+	return func(c *config) {
+		c.listStyle = style
+	}
+}
+
+// looseItems reports whether a list with the given content is written
+// loose. Sub-lists next to the items are lists of their own.
+func (c *config) looseItems(items []Node) bool {
+	switch c.listStyle {
+	case ListTight:
+		return false
+	case ListLoose:
+		return true
+	}
+	for _, item := range items {
+		if item.Type != "list_item" && item.Type != "check_list_item" {
+			continue
+		}
+		blocks := 0
+		for _, child := range item.Content {
+			if !containsType(listNodeTypes, child.Type) {
+				blocks++
+			}
+		}
+		if blocks > 1 {
+			return true
+		}
+	}
+	return false
+}
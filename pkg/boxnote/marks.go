@@ -0,0 +1,469 @@
+package boxnote
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+func applyMarks(text string, marks []Mark, ctx renderContext) string {
+	text = sanitizeText(text, ctx)
+	filtered := filterMarks(marks, ctx)
+	if !hasMarkType(filtered, "code") {
+		text = applyRawHTML(text, ctx.cfg.rawHTML)
+		if ctx.cfg.ideographicSpaceEntities {
+			text = strings.ReplaceAll(text, ideographicSpace, ideographicSpaceEntity)
+		}
+		if ctx.cfg.emoji == EmojiUnicode {
+			text = fromShortcodes(text)
+		}
+	}
+	autolink := ctx.cfg.flavor != FlavorGFM
+	// Shortcodes are written after escaping, which would break their
+	// underscores.
+	shortcodes := ctx.cfg.emoji == EmojiShortcode && !hasMarkType(filtered, "code")
+	if len(filtered) == 0 {
+		if ctx.cfg.escaping == EscapeAll {
+			text = mapBareURLs(text, escapePlainText, autolink)
+		} else {
+			text = mapBareURLs(text, func(s string) string { return s }, autolink)
+		}
+		if shortcodes {
+			text = toShortcodes(text)
+		}
+		return text
+	}
+
+	hasStrong := hasMarkType(filtered, "strong")
+	hasEm := hasMarkType(filtered, "em")
+	hasStrike := hasMarkType(filtered, "strikethrough")
+	hasCode := hasMarkType(filtered, "code")
+	hasLink := hasMarkType(filtered, "link")
+	emDelimiter := "*"
+	if hasStrong && hasEm {
+		emDelimiter = "_"
+	}
+	escape := ctx.cfg.escaping != EscapeNone
+	htmlStrike := ctx.cfg.flavor == FlavorCommonMark
+	escapeText := func(s string) string {
+		switch {
+		case !escape:
+			return s
+		case ctx.cfg.escaping == EscapeAll:
+			return escapePlainText(s)
+		default:
+			return escapeForMarkdown(s, emDelimiter, hasStrong, hasStrike && !htmlStrike)
+		}
+	}
+	if !hasCode && !hasLink {
+		text = mapBareURLs(text, escapeText, autolink)
+	} else if !hasCode {
+		text = escapeText(text)
+	}
+	if shortcodes {
+		text = toShortcodes(text)
+	}
+	// padBefore and padAfter put the zero-width space outside the marks, as
+	// &#8203;, and htmlTags writes them as HTML instead; see ZeroWidthSpace.
+	var padBefore, padAfter, htmlTags bool
+	if (hasStrong || hasEm || hasStrike || hasCode) && !hasLink {
+		switch ctx.cfg.zeroWidthSpace {
+		case ZeroWidthSpaceEntity, ZeroWidthSpaceHTML:
+			// Code spans are not delimited by flanking runs.
+			if hasStrong || hasEm || hasStrike && !htmlStrike {
+				padBefore, padAfter = needsZeroWidthSpace(text)
+			}
+			if ctx.cfg.zeroWidthSpace == ZeroWidthSpaceHTML {
+				htmlTags = padBefore || padAfter
+				padBefore, padAfter = false, false
+			}
+		default:
+			text = padWithZeroWidthSpace(text)
+		}
+	}
+
+	sort.SliceStable(filtered, func(i, j int) bool {
+		return ctx.cfg.markOrder(filtered[i].Type) < ctx.cfg.markOrder(filtered[j].Type)
+	})
+
+	for i := len(filtered) - 1; i >= 0; i-- {
+		mark := filtered[i]
+		switch mark.Type {
+		case "link":
+			href, ok := getStringAttr(mark.Attrs, "href")
+			if !ok || href == "" {
+				ctx.warn(WarningInvalidAttr, "link without href rendered as plain text")
+				continue
+			}
+			if ctx.cfg.linkRewrite != nil {
+				if href = ctx.cfg.linkRewrite(href); href == "" {
+					continue
+				}
+			}
+			if ctx.cfg.wikiLink != nil {
+				if target, ok := ctx.cfg.wikiLink(href); ok {
+					if link, ok := wikiLink(target, text); ok {
+						text = link
+						continue
+					}
+				}
+			}
+			if len(href) > 1 && href[0] == '#' && ctx.anchors != nil {
+				if anchor, ok := ctx.anchors.resolve(href[1:]); ok {
+					href = "#" + anchor
+				} else {
+					ctx.warn(WarningInvalidAttr, "link to unknown heading %q", href)
+				}
+			}
+			// EscapeAll has already escaped the brackets of plain text.
+			if escape && (ctx.cfg.escaping != EscapeAll || hasCode) {
+				text = escapeLinkText(text)
+			}
+			text = fmt.Sprintf("[%s](%s)", text, href)
+		case "strong":
+			if htmlTags {
+				text = "<strong>" + text + "</strong>"
+			} else {
+				text = "**" + text + "**"
+			}
+		case "em":
+			if htmlTags {
+				text = "<em>" + text + "</em>"
+			} else {
+				text = emDelimiter + text + emDelimiter
+			}
+		case "underline":
+			text = "<u>" + text + "</u>"
+		case "strikethrough":
+			if htmlStrike || htmlTags {
+				text = "<del>" + text + "</del>"
+			} else {
+				text = "~~" + text + "~~"
+			}
+		case "code":
+			text = wrapInlineCode(text)
+		default:
+			if style, ok := ctx.cfg.markStyle(mark.Type); ok {
+				text = style.wrap(text, mark)
+			}
+		}
+	}
+	if padBefore {
+		text = zeroWidthSpaceEntity + text
+	}
+	if padAfter {
+		text += zeroWidthSpaceEntity
+	}
+	return text
+}
+
+func filterMarks(marks []Mark, ctx renderContext) []Mark {
+	var filtered []Mark
+	for _, mark := range marks {
+		if _, ok := ctx.cfg.markStyle(mark.Type); ok {
+			filtered = append(filtered, mark)
+			continue
+		}
+		if isIgnoredMark(mark.Type) {
+			continue
+		}
+		switch mark.Type {
+		case "link", "strong", "em", "underline", "strikethrough", "code":
+			filtered = append(filtered, mark)
+		default:
+			ctx.warnMark(mark.Type, "unknown mark type %q dropped", mark.Type)
+			filtered = append(filtered, mark)
+		}
+	}
+	return filtered
+}
+
+// sameMarks reports whether a and b format text the same way, ignoring the
+// marks that are not rendered.
+func sameMarks(a, b []Mark) bool {
+	a, b = renderedMarks(a), renderedMarks(b)
+	if len(a) != len(b) {
+		return false
+	}
+	for _, mark := range a {
+		found := false
+		for _, other := range b {
+			if mark.Type == other.Type && reflect.DeepEqual(mark.Attrs, other.Attrs) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func renderedMarks(marks []Mark) []Mark {
+	var rendered []Mark
+	for _, mark := range marks {
+		if !isIgnoredMark(mark.Type) {
+			rendered = append(rendered, mark)
+		}
+	}
+	return rendered
+}
+
+func isIgnoredMark(markType string) bool {
+	switch markType {
+	case "author_id", "font_size", "font_color", "highlight":
+		return true
+	default:
+		return false
+	}
+}
+
+func markOrder(markType string) int {
+	switch markType {
+	case "link":
+		return 0
+	case "strong":
+		return 1
+	case "em":
+		return 2
+	case "underline":
+		return 3
+	case "strikethrough":
+		return 4
+	case "code":
+		return 5
+	default:
+		return 100
+	}
+}
+
+func wrapInlineCode(text string) string {
+	if !strings.Contains(text, "`") {
+		return "`" + text + "`"
+	}
+	max := maxConsecutiveBackticks(text)
+	fence := strings.Repeat("`", max+1)
+	return fence + text + fence
+}
+
+func hasMarkType(marks []Mark, markType string) bool {
+	for _, mark := range marks {
+		if mark.Type == markType {
+			return true
+		}
+	}
+	return false
+}
+
+func maxConsecutiveBackticks(text string) int {
+	max := 0
+	current := 0
+	for _, r := range text {
+		if r == '`' {
+			current++
+			if current > max {
+				max = current
+			}
+		} else {
+			current = 0
+		}
+	}
+	return max
+}
+
+// bareURLPattern matches URLs written as plain text; trailing punctuation is
+// trimmed by trimURL.
+var bareURLPattern = regexp.MustCompile(`https?://[^\s<>"\x{3000}-\x{303F}\x{FF01}-\x{FF0F}]+`)
+
+// mapBareURLs applies fn to the text around bare URLs, leaving the URLs
+// themselves unescaped so that they stay clickable. With brackets, URLs
+// are written as <URL> autolinks, which CommonMark requires.
+func mapBareURLs(text string, fn func(string) string, brackets bool) string {
+	spans := bareURLPattern.FindAllStringIndex(text, -1)
+	if len(spans) == 0 {
+		return fn(text)
+	}
+	var b strings.Builder
+	last := 0
+	for _, span := range spans {
+		url := trimURL(text[span[0]:span[1]])
+		if strings.HasSuffix(url, "://") {
+			continue
+		}
+		b.WriteString(fn(text[last:span[0]]))
+		if brackets {
+			b.WriteString("<" + url + ">")
+		} else {
+			b.WriteString(url)
+		}
+		last = span[0] + len(url)
+	}
+	b.WriteString(fn(text[last:]))
+	return b.String()
+}
+
+// trimURL drops trailing punctuation that usually ends the sentence rather
+// than the URL, keeping a closing parenthesis that has an opening one.
+func trimURL(url string) string {
+	for url != "" {
+		last := url[len(url)-1]
+		switch {
+		case strings.IndexByte(".,:;!?'*_~", last) >= 0:
+			url = url[:len(url)-1]
+		case last == ')' && strings.Count(url, "(") < strings.Count(url, ")"):
+			url = url[:len(url)-1]
+		default:
+			return url
+		}
+	}
+	return url
+}
+
+// escapeTableCell escapes the pipes of text that would end a table cell.
+// With already set, pipes after an odd run of backslashes are taken as
+// escaped already, as EscapeAll leaves those of plain text.
+func escapeTableCell(text string, already bool) string {
+	if !already {
+		return strings.ReplaceAll(text, "|", "\\|")
+	}
+	var b strings.Builder
+	backslashes := 0
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		if c == '|' && backslashes%2 == 0 {
+			b.WriteByte('\\')
+		}
+		if c == '\\' {
+			backslashes++
+		} else {
+			backslashes = 0
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+func escapeLinkText(text string) string {
+	replacer := strings.NewReplacer(
+		"\\", "\\\\",
+		"[", "\\[",
+		"]", "\\]",
+		"(", "\\(",
+		")", "\\)",
+	)
+	return replacer.Replace(text)
+}
+
+// escapePlainText escapes the characters that can start inline syntax
+// anywhere in text, and the pipes that could make a line a table row, for
+// EscapeAll. Block syntax at line starts is escaped by escapeLineStarts.
+func escapePlainText(text string) string {
+	replacer := strings.NewReplacer(
+		"\\", "\\\\",
+		"*", "\\*",
+		"_", "\\_",
+		"`", "\\`",
+		"~", "\\~",
+		"[", "\\[",
+		"]", "\\]",
+		"<", "\\<",
+		"|", "\\|",
+	)
+	return replacer.Replace(text)
+}
+
+// lineStartPattern matches what would start a heading, quote, list item, or
+// setext underline at the beginning of a line.
+var lineStartPattern = regexp.MustCompile(`^(#|>|[-+](?: |$)|[-=]+\s*$|\d+[.)](?: |$))`)
+
+// escapeLineStarts escapes block syntax at the start of each line of a
+// rendered paragraph, for EscapeAll.
+func escapeLineStarts(text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		match := lineStartPattern.FindStringIndex(line)
+		if match == nil {
+			continue
+		}
+		if c := line[0]; c >= '0' && c <= '9' {
+			// Escape the delimiter after the number: 1\. item
+			end := strings.IndexAny(line, ".)")
+			lines[i] = line[:end] + "\\" + line[end:]
+			continue
+		}
+		lines[i] = "\\" + line
+	}
+	return strings.Join(lines, "\n")
+}
+
+func escapeForMarkdown(text, emDelimiter string, hasStrong, hasStrike bool) string {
+	text = strings.ReplaceAll(text, "\\", "\\\\")
+	if emDelimiter == "*" || hasStrong {
+		text = strings.ReplaceAll(text, "*", "\\*")
+	}
+	if emDelimiter == "_" {
+		text = strings.ReplaceAll(text, "_", "\\_")
+	}
+	if hasStrike {
+		text = strings.ReplaceAll(text, "~", "\\~")
+	}
+	return text
+}
+
+func padWithZeroWidthSpace(text string) string {
+	before, after := needsZeroWidthSpace(text)
+	if before {
+		text = zeroWidthSpace + text
+	}
+	if after {
+		text = text + zeroWidthSpace
+	}
+	return text
+}
+
+// needsZeroWidthSpace reports whether marked text starts or ends with
+// Japanese punctuation, next to which the delimiters of the marks cannot open
+// or close without a zero-width space between.
+func needsZeroWidthSpace(text string) (before, after bool) {
+	if r, ok := firstRune(text); ok && !strings.HasPrefix(text, zeroWidthSpace) && !unicode.IsSpace(r) && isYakumono(r) {
+		before = true
+	}
+	if r, ok := lastRune(text); ok && !strings.HasSuffix(text, zeroWidthSpace) && !unicode.IsSpace(r) && isYakumono(r) {
+		after = true
+	}
+	return before, after
+}
+
+func isYakumono(r rune) bool {
+	switch r {
+	case '、', '。', '，', '．', '｡', '､', '･', '・',
+		'：', '；', '！', '？', '!', '?',
+		'「', '」', '『', '』', '（', '）', '［', '］', '【', '】',
+		'〈', '〉', '《', '》', '“', '”', '‘', '’',
+		'…', '‥', '〜', '～', 'ー', '—', '―', '‐', '‑', 'ｰ':
+		return true
+	default:
+		return false
+	}
+}
+
+func firstRune(text string) (rune, bool) {
+	for _, r := range text {
+		return r, true
+	}
+	return 0, false
+}
+
+func lastRune(text string) (rune, bool) {
+	var last rune
+	found := false
+	for _, r := range text {
+		last = r
+		found = true
+	}
+	return last, found
+}
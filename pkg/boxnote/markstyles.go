@@ -0,0 +1,130 @@
+package boxnote
+
+import (
+	"fmt"
+	"html"
+	"reflect"
+	"strings"
+)
+
+// MarkStyle declares how text with a nonstandard mark is written, for
+// WithMarkStyles: between Prefix and Suffix, or in an HTML element. Both
+// may hold {{attrs.name}} placeholders for the attrs of the mark, and
+// {{type}} for its type.
+type MarkStyle struct {
+	Prefix string `json:"prefix,omitempty"`
+	Suffix string `json:"suffix,omitempty"`
+	// HTML is the opening tag of the element without its angle brackets,
+	// such as "mark" or `span class="spoiler"`.
+	HTML string `json:"html,omitempty"`
+}
+
+// WithMarkStyles writes the text with each mark type in styles as its
+// MarkStyle says, instead of dropping the mark. Marks that are otherwise
+// ignored, such as highlight and font_color, can be styled too. Styled
+// marks nest inside links and emphasis and outside code spans, whose
+// content is literal.
+func WithMarkStyles(styles map[string]MarkStyle) ConvertOption {
+	return func(c *config) {
+		c.markStyles = styles
+	}
+}
+
+// ValidateMarkStyle reports why style cannot be used for markType: the
+// built-in marks keep their Markdown syntax, a style is either delimiters
+// or HTML, and only the attrs and type of the mark can be filled in.
+func ValidateMarkStyle(markType string, style MarkStyle) error {
+	switch markType {
+	case "link", "strong", "em", "underline", "strikethrough", "code":
+		return fmt.Errorf("%s is a built-in mark", markType)
+	}
+	if style.HTML != "" && strings.TrimSpace(style.HTML) == "" {
+		return fmt.Errorf("%s: html names no element", markType)
+	}
+	if style.HTML != "" && (style.Prefix != "" || style.Suffix != "") {
+		return fmt.Errorf("%s: give html or prefix and suffix, not both", markType)
+	}
+	if style.HTML == "" && style.Prefix == "" && style.Suffix == "" {
+		return fmt.Errorf("%s: no html, prefix, or suffix", markType)
+	}
+	for _, part := range []string{style.Prefix, style.Suffix, style.HTML} {
+		for _, m := range nodeTemplatePlaceholder.FindAllStringSubmatch(part, -1) {
+			if name := m[1]; name != "type" && (!strings.HasPrefix(name, "attrs.") || name == "attrs.") {
+				return fmt.Errorf("%s: unknown placeholder %s", markType, m[0])
+			}
+		}
+	}
+	return nil
+}
+
+// styledMarkOrder nests the styled marks with strikethrough, inside the
+// other built-in marks and outside code spans.
+const styledMarkOrder = 4
+
+// markStyle returns the style WithMarkStyles gives for markType.
+func (c *config) markStyle(markType string) (MarkStyle, bool) {
+	style, ok := c.markStyles[markType]
+	return style, ok
+}
+
+// markOrder is markOrder with the styled marks placed by styledMarkOrder.
+func (c *config) markOrder(markType string) int {
+	if _, ok := c.markStyle(markType); ok {
+		return styledMarkOrder
+	}
+	return markOrder(markType)
+}
+
+// sameMarks is sameMarks that also tells apart the ignored marks given a
+// style, by what the style writes for them, so that highlights of two
+// colors still join when the color is not written.
+func (c *config) sameMarks(a, b []Mark) bool {
+	if !sameMarks(a, b) {
+		return false
+	}
+	for markType, style := range c.markStyles {
+		if isIgnoredMark(markType) && !reflect.DeepEqual(style.wrappers(a, markType), style.wrappers(b, markType)) {
+			return false
+		}
+	}
+	return true
+}
+
+// wrappers returns what the style writes around text for each mark of
+// markType in marks.
+func (s MarkStyle) wrappers(marks []Mark, markType string) []string {
+	var wrappers []string
+	for _, mark := range marks {
+		if mark.Type == markType {
+			wrappers = append(wrappers, s.wrap("", mark))
+		}
+	}
+	return wrappers
+}
+
+// wrap writes text with mark as the style says. HTML naming no element is
+// taken as not given.
+func (s MarkStyle) wrap(text string, mark Mark) string {
+	fields := strings.Fields(s.HTML)
+	if len(fields) == 0 {
+		return fillMarkStyle(s.Prefix, mark, nil) + text + fillMarkStyle(s.Suffix, mark, nil)
+	}
+	tag := fields[0]
+	return "<" + fillMarkStyle(s.HTML, mark, html.EscapeString) + ">" + text + "</" + tag + ">"
+}
+
+// fillMarkStyle fills in the placeholders of part for mark, passing the
+// values through escape when it is not nil.
+func fillMarkStyle(part string, mark Mark, escape func(string) string) string {
+	return nodeTemplatePlaceholder.ReplaceAllStringFunc(part, func(placeholder string) string {
+		name := nodeTemplatePlaceholder.FindStringSubmatch(placeholder)[1]
+		value := mark.Type
+		if name != "type" {
+			value = attrText(mark.Attrs[strings.TrimPrefix(name, "attrs.")])
+		}
+		if escape != nil {
+			value = escape(value)
+		}
+		return value
+	})
+}
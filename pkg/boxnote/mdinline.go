@@ -0,0 +1,563 @@
+package boxnote
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	entityPattern   = regexp.MustCompile(`^&(?:#[0-9]{1,7}|#[xX][0-9a-fA-F]{1,6}|[a-zA-Z][a-zA-Z0-9]{1,31});`)
+	autolinkPattern = regexp.MustCompile(`^<([a-zA-Z][a-zA-Z0-9+.-]{1,31}:[^\s<>]*)>`)
+	emailPattern    = regexp.MustCompile(`^<([a-zA-Z0-9.!#$%&'*+/=?^_{|}~-]+@[a-zA-Z0-9-]+(?:\.[a-zA-Z0-9-]+)*)>`)
+	breakPattern    = regexp.MustCompile(`^<br\s*/?>`)
+	anchorPattern   = regexp.MustCompile(`^<a\s+(?:id|name)="[^"]*"\s*>\s*</a>`)
+	hrefPattern     = regexp.MustCompile(`^<a\s+href="([^"]*)"[^>]*>`)
+	htmlMarkPattern = regexp.MustCompile(`^<(u|ins|del|s|strike|strong|b|em|i|code)>`)
+)
+
+// htmlMarks maps the inline HTML elements read as marks.
+var htmlMarks = map[string]string{
+	"u": "underline", "ins": "underline",
+	"del": "strikethrough", "s": "strikethrough", "strike": "strikethrough",
+	"strong": "strong", "b": "strong",
+	"em": "em", "i": "em",
+	"code": "code",
+}
+
+// parseInline parses the inline content of a paragraph, heading, or table
+// cell into text, hard_break, and image nodes.
+func parseInline(text string) []Node {
+	var merged []Node
+	for _, node := range inlineNodes(text, false) {
+		if node.Type == "text" {
+			if node.Text == "" {
+				continue
+			}
+			if n := len(merged); n > 0 && merged[n-1].Type == "text" && sameMarks(merged[n-1].Marks, node.Marks) {
+				merged[n-1].Text += node.Text
+				continue
+			}
+		}
+		merged = append(merged, node)
+	}
+	return merged
+}
+
+func endsWithBreak(items []inline) bool {
+	if len(items) == 0 {
+		return false
+	}
+	nodes := items[len(items)-1].nodes
+	return len(nodes) > 0 && nodes[len(nodes)-1].Type == "hard_break"
+}
+
+func textNode(text string) Node {
+	return Node{Type: "text", Text: text}
+}
+
+// addMark applies mark to nodes, outside the marks they already have.
+func addMark(nodes []Node, mark Mark) []Node {
+	for i := range nodes {
+		if nodes[i].Type == "text" {
+			nodes[i].Marks = append([]Mark{mark}, nodes[i].Marks...)
+		}
+	}
+	return nodes
+}
+
+// inline is a parsed piece of inline content: either nodes, or a run of
+// emphasis delimiters that may still be matched.
+type inline struct {
+	nodes []Node
+	// delimiter is *, _, or ~ for a delimiter run, of which count
+	// characters are left from the length it was written with.
+	delimiter byte
+	count     int
+	length    int
+	canOpen   bool
+	canClose  bool
+}
+
+// inlineNodes parses inline Markdown. Code spans, links, images, and HTML
+// are parsed as they are met; emphasis is matched afterwards, as CommonMark
+// does. Inside a link label, no further links are parsed.
+func inlineNodes(s string, inLink bool) []Node {
+	var items []inline
+	var buf strings.Builder
+	emit := func(n ...Node) {
+		if buf.Len() > 0 {
+			items = append(items, inline{nodes: []Node{textNode(buf.String())}})
+			buf.Reset()
+		}
+		if len(n) > 0 {
+			items = append(items, inline{nodes: n})
+		}
+	}
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch c {
+		case '\\':
+			if i+1 < len(s) && s[i+1] == '\n' {
+				emit(Node{Type: "hard_break"})
+				i = skipSpaces(s, i+2)
+				continue
+			}
+			if i+1 < len(s) && isASCIIPunct(s[i+1]) {
+				buf.WriteByte(s[i+1])
+				i += 2
+				continue
+			}
+		case '\n':
+			if buf.Len() == 0 && endsWithBreak(items) {
+				// The line break after a <br>.
+				i = skipSpaces(s, i+1)
+				continue
+			}
+			line := buf.String()
+			trimmed := strings.TrimRight(line, " ")
+			buf.Reset()
+			buf.WriteString(trimmed)
+			i = skipSpaces(s, i+1)
+			if len(line)-len(trimmed) >= 2 {
+				emit(Node{Type: "hard_break"})
+			} else {
+				buf.WriteByte(' ')
+			}
+			continue
+		case '`':
+			if code, end, ok := codeSpan(s, i); ok {
+				emit(Node{Type: "text", Text: code, Marks: []Mark{{Type: "code"}}})
+				i = end
+				continue
+			}
+			n := runLength(s, i)
+			buf.WriteString(s[i : i+n])
+			i += n
+			continue
+		case '!':
+			if i+1 < len(s) && s[i+1] == '[' {
+				if label, dest, end, ok := parseLink(s, i+1); ok {
+					emit(Node{Type: "image", Attrs: map[string]interface{}{"src": dest, "alt": plainText(label)}})
+					i = end
+					continue
+				}
+			}
+		case '[':
+			if !inLink {
+				if label, dest, end, ok := parseLink(s, i); ok {
+					emit(addMark(inlineNodes(label, true), linkMark(dest))...)
+					i = end
+					continue
+				}
+			}
+		case '<':
+			if n, end, ok := inlineHTML(s, i, inLink); ok {
+				emit(n...)
+				i = end
+				continue
+			}
+		case '*', '_', '~':
+			emit()
+			n := runLength(s, i)
+			items = append(items, delimiterRun(s, i, n))
+			i += n
+			continue
+		case '&':
+			if entity := entityPattern.FindString(s[i:]); entity != "" {
+				buf.WriteString(html.UnescapeString(entity))
+				i += len(entity)
+				continue
+			}
+		case 'h':
+			// A bare URL is plain text, as Box keeps it, but the delimiters
+			// in it are not emphasis.
+			if end := bareURLAt(s, i); end > i {
+				buf.WriteString(s[i:end])
+				i = end
+				continue
+			}
+		}
+		buf.WriteByte(c)
+		i++
+	}
+	emit()
+	return matchEmphasis(items)
+}
+
+func linkMark(href string) Mark {
+	return Mark{Type: "link", Attrs: map[string]interface{}{"href": href}}
+}
+
+func isASCIILetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func skipSpaces(s string, i int) int {
+	for i < len(s) && s[i] == ' ' {
+		i++
+	}
+	return i
+}
+
+func isASCIIPunct(c byte) bool {
+	return strings.IndexByte("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", c) >= 0
+}
+
+// runLength returns the length of the run of the character at s[i].
+func runLength(s string, i int) int {
+	n := 1
+	for i+n < len(s) && s[i+n] == s[i] {
+		n++
+	}
+	return n
+}
+
+func bareURLAt(s string, i int) int {
+	if i > 0 {
+		if r, _ := utf8.DecodeLastRuneInString(s[:i]); unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return i
+		}
+	}
+	url := trimURL(bareURLPattern.FindString(s[i:]))
+	if !strings.HasPrefix(s[i:], url) || strings.HasSuffix(url, "://") {
+		return i
+	}
+	return i + len(url)
+}
+
+// codeSpan parses the code span starting at s[i], which ends at the next
+// backtick run of the same length.
+func codeSpan(s string, i int) (string, int, bool) {
+	n := runLength(s, i)
+	for j := i + n; j < len(s); {
+		if s[j] != '`' {
+			j++
+			continue
+		}
+		m := runLength(s, j)
+		if m == n {
+			code := strings.ReplaceAll(s[i+n:j], "\n", " ")
+			if len(code) >= 2 && code[0] == ' ' && code[len(code)-1] == ' ' && strings.Trim(code, " ") != "" {
+				code = code[1 : len(code)-1]
+			}
+			return code, j + m, true
+		}
+		j += m
+	}
+	return "", 0, false
+}
+
+// parseLink parses an inline link [label](destination "title") starting at
+// s[i]; the title is dropped.
+func parseLink(s string, i int) (label, dest string, end int, ok bool) {
+	depth := 0
+	j := i
+	for ; j < len(s); j++ {
+		switch s[j] {
+		case '\\':
+			j++
+			continue
+		case '`':
+			if _, codeEnd, ok := codeSpan(s, j); ok {
+				j = codeEnd - 1
+			}
+			continue
+		case '[':
+			depth++
+		case ']':
+			depth--
+		}
+		if depth == 0 {
+			break
+		}
+	}
+	if j+1 >= len(s) || s[j] != ']' || s[j+1] != '(' {
+		return "", "", 0, false
+	}
+	label = s[i+1 : j]
+	k := skipSpaces(s, j+2)
+	var b strings.Builder
+	if k < len(s) && s[k] == '<' {
+		end := strings.IndexByte(s[k:], '>')
+		if end < 0 {
+			return "", "", 0, false
+		}
+		b.WriteString(s[k+1 : k+end])
+		k += end + 1
+	} else {
+		parens := 0
+	dest:
+		for ; k < len(s); k++ {
+			switch c := s[k]; {
+			case c == '\\' && k+1 < len(s) && isASCIIPunct(s[k+1]):
+				k++
+				b.WriteByte(s[k])
+				continue
+			case c == ' ' || c == '\n':
+				break dest
+			case c == '(':
+				parens++
+			case c == ')':
+				if parens == 0 {
+					break dest
+				}
+				parens--
+			}
+			b.WriteByte(s[k])
+		}
+	}
+	k = skipSpaces(s, k)
+	if k < len(s) && (s[k] == '"' || s[k] == '\'' || s[k] == '(') {
+		closer := s[k]
+		if closer == '(' {
+			closer = ')'
+		}
+		if end := strings.IndexByte(s[k+1:], closer); end >= 0 {
+			k = skipSpaces(s, k+end+2)
+		}
+	}
+	if k >= len(s) || s[k] != ')' {
+		return looseLink(s, label, j+2)
+	}
+	return label, html.UnescapeString(b.String()), k + 1, true
+}
+
+// looseLink takes everything up to the closing parenthesis from s[start] as
+// the destination, for links to paths with spaces, which the converter
+// writes as they are.
+func looseLink(s, label string, start int) (string, string, int, bool) {
+	parens := 0
+	for k := start; k < len(s) && s[k] != '\n'; k++ {
+		switch s[k] {
+		case '\\':
+			k++
+		case '(':
+			parens++
+		case ')':
+			if parens == 0 {
+				dest := strings.TrimSpace(s[start:k])
+				if dest == "" {
+					return "", "", 0, false
+				}
+				return label, html.UnescapeString(unescapeBackslashes(dest)), k + 1, true
+			}
+			parens--
+		}
+	}
+	return "", "", 0, false
+}
+
+func unescapeBackslashes(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && isASCIIPunct(s[i+1]) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// plainText returns the text of inline Markdown without its marks, for alt
+// text.
+func plainText(s string) string {
+	var b strings.Builder
+	for _, node := range inlineNodes(s, false) {
+		if node.Type == "image" {
+			alt, _ := getStringAttr(node.Attrs, "alt")
+			b.WriteString(alt)
+			continue
+		}
+		b.WriteString(node.Text)
+	}
+	return b.String()
+}
+
+// inlineHTML reads the HTML the converter writes inline: autolinks, <br>,
+// heading anchors, links, and the elements of htmlMarks. Other HTML is not
+// read, and ends up as text.
+func inlineHTML(s string, i int, inLink bool) ([]Node, int, bool) {
+	rest := s[i:]
+	if m := autolinkPattern.FindStringSubmatch(rest); m != nil && !inLink {
+		return addMark([]Node{textNode(m[1])}, linkMark(m[1])), i + len(m[0]), true
+	}
+	if m := emailPattern.FindStringSubmatch(rest); m != nil && !inLink {
+		return addMark([]Node{textNode(m[1])}, linkMark("mailto:"+m[1])), i + len(m[0]), true
+	}
+	if m := breakPattern.FindString(rest); m != "" {
+		return []Node{{Type: "hard_break"}}, i + len(m), true
+	}
+	if m := anchorPattern.FindString(rest); m != "" {
+		return nil, i + len(m), true
+	}
+	if strings.HasPrefix(rest, "<!--") {
+		if end := strings.Index(rest, "-->"); end >= 0 {
+			return nil, i + end + len("-->"), true
+		}
+	}
+	if m := hrefPattern.FindStringSubmatch(rest); m != nil && !inLink {
+		if end := strings.Index(rest, "</a>"); end > len(m[0]) {
+			inner := rest[len(m[0]):end]
+			return addMark(inlineNodes(inner, true), linkMark(html.UnescapeString(m[1]))), i + end + len("</a>"), true
+		}
+	}
+	if m := htmlMarkPattern.FindStringSubmatch(rest); m != nil {
+		closing := "</" + m[1] + ">"
+		end := strings.Index(rest, closing)
+		if end < 0 {
+			return nil, 0, false
+		}
+		inner := rest[len(m[0]):end]
+		mark := Mark{Type: htmlMarks[m[1]]}
+		if mark.Type == "code" {
+			return addMark([]Node{textNode(html.UnescapeString(inner))}, mark), i + end + len(closing), true
+		}
+		return addMark(inlineNodes(inner, inLink), mark), i + end + len(closing), true
+	}
+	return nil, 0, false
+}
+
+// delimiterRun returns the run of n delimiters at s[i], with whether it can
+// open or close emphasis by the flanking rules of CommonMark.
+func delimiterRun(s string, i, n int) inline {
+	prev, next := ' ', ' '
+	if i > 0 {
+		prev, _ = utf8.DecodeLastRuneInString(s[:i])
+	}
+	if i+n < len(s) {
+		next, _ = utf8.DecodeRuneInString(s[i+n:])
+	}
+	left := !unicode.IsSpace(next) && (!isPunctuation(next) || unicode.IsSpace(prev) || isPunctuation(prev))
+	right := !unicode.IsSpace(prev) && (!isPunctuation(prev) || unicode.IsSpace(next) || isPunctuation(next))
+	run := inline{delimiter: s[i], count: n, length: n, canOpen: left, canClose: right}
+	if s[i] == '_' {
+		// An underscore does not emphasize inside a word.
+		run.canOpen = left && (!right || isPunctuation(prev))
+		run.canClose = right && (!left || isPunctuation(next))
+	}
+	return run
+}
+
+func isPunctuation(r rune) bool {
+	return unicode.IsPunct(r) || unicode.IsSymbol(r)
+}
+
+// matchEmphasis pairs the delimiter runs of items into em, strong, and
+// strikethrough marks, from the first closer on, as CommonMark's "process
+// emphasis" does. Unmatched delimiters are kept as text.
+func matchEmphasis(items []inline) []Node {
+	for c := 0; c < len(items); c++ {
+		closer := &items[c]
+		if closer.delimiter == 0 || !closer.canClose || closer.count == 0 {
+			continue
+		}
+		o := c - 1
+		for ; o >= 0; o-- {
+			if opener := items[o]; opener.delimiter == closer.delimiter && opener.canOpen && opener.count > 0 && matches(opener, *closer) {
+				break
+			}
+		}
+		if o < 0 {
+			continue
+		}
+		opener := &items[o]
+		used, mark := 1, Mark{Type: "em"}
+		switch {
+		case closer.delimiter == '~':
+			used, mark = closer.count, Mark{Type: "strikethrough"}
+		case opener.count >= 2 && closer.count >= 2:
+			used, mark = 2, Mark{Type: "strong"}
+		}
+		var inner []Node
+		for _, item := range items[o+1 : c] {
+			inner = append(inner, itemNodes(item)...)
+		}
+		trimZeroWidthSpace(inner)
+		opener.count -= used
+		closer.count -= used
+		group := inline{nodes: addMark(inner, mark)}
+
+		var rest []inline
+		rest = append(rest, items[:o+1]...)
+		rest = append(rest, group)
+		rest = append(rest, items[c:]...)
+		items = rest
+		// The closer now follows the group; look at it again if it has
+		// delimiters left.
+		c = o + 1
+		if items[o].count == 0 {
+			items = append(items[:o], items[o+1:]...)
+			c--
+		}
+	}
+	var nodes []Node
+	for _, item := range items {
+		nodes = append(nodes, itemNodes(item)...)
+	}
+	trimZeroWidthSpaceEntities(nodes)
+	return nodes
+}
+
+// matches reports whether opener and closer can pair up. Strikethrough
+// needs runs of the same length; for emphasis, a run that can both open and
+// close does not pair with another whose lengths add up to a multiple of 3,
+// unless both are.
+func matches(opener, closer inline) bool {
+	if closer.delimiter == '~' {
+		return opener.count == closer.count && closer.count <= 2
+	}
+	if (opener.canClose || closer.canOpen) && (opener.length+closer.length)%3 == 0 {
+		return opener.length%3 == 0 && closer.length%3 == 0
+	}
+	return true
+}
+
+func itemNodes(item inline) []Node {
+	if item.delimiter == 0 {
+		return item.nodes
+	}
+	if item.count == 0 {
+		return nil
+	}
+	return []Node{textNode(strings.Repeat(string(item.delimiter), item.count))}
+}
+
+// trimZeroWidthSpaceEntities drops the zero-width spaces that
+// ZeroWidthSpaceEntity writes outside the delimiters of marked text, where
+// the emphasis of two text nodes differs.
+func trimZeroWidthSpaceEntities(nodes []Node) {
+	for i := 1; i < len(nodes); i++ {
+		a, b := &nodes[i-1], &nodes[i]
+		if a.Type != "text" || b.Type != "text" || sameEmphasis(a.Marks, b.Marks) {
+			continue
+		}
+		a.Text = strings.TrimSuffix(a.Text, zeroWidthSpace)
+		b.Text = strings.TrimPrefix(b.Text, zeroWidthSpace)
+	}
+}
+
+func sameEmphasis(a, b []Mark) bool {
+	for _, markType := range []string{"strong", "em", "strikethrough"} {
+		if hasMarkType(a, markType) != hasMarkType(b, markType) {
+			return false
+		}
+	}
+	return true
+}
+
+// trimZeroWidthSpace drops the zero-width spaces the converter pads marked
+// text with next to Japanese punctuation.
+func trimZeroWidthSpace(nodes []Node) {
+	if len(nodes) == 0 {
+		return
+	}
+	if first := &nodes[0]; first.Type == "text" {
+		first.Text = strings.TrimPrefix(first.Text, zeroWidthSpace)
+	}
+	if last := &nodes[len(nodes)-1]; last.Type == "text" {
+		last.Text = strings.TrimSuffix(last.Text, zeroWidthSpace)
+	}
+}
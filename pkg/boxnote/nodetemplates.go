@@ -0,0 +1,152 @@
+package boxnote
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// WithNodeTemplates renders the nodes of each type in templates by filling
+// in its template, ahead of the handlers registered for the type and of the
+// built-in rendering, so that org-specific node types can be converted
+// without code. A template is Markdown with these placeholders:
+//
+//	{{inline}}      the content of the node as inline text
+//	{{blocks}}      the content of the node as blocks
+//	{{text}}        the plain text of the node, as is
+//	{{type}}        the node type
+//	{{attrs.name}}  the value of the attr name, as is
+//
+// A value of several lines continues each line with the blockquote markers
+// and indentation that start the template line of its placeholder, so that
+// "> {{blocks}}" quotes every line. A block whose template fills in to
+// nothing is dropped.
+func WithNodeTemplates(templates map[string]string) ConvertOption {
+	return func(c *config) {
+		c.nodeTemplates = templates
+	}
+}
+
+var nodeTemplatePlaceholder = regexp.MustCompile(`\{\{\s*([^{}]*?)\s*\}\}`)
+
+// ValidateNodeTemplate reports the first placeholder of template that
+// WithNodeTemplates does not know.
+func ValidateNodeTemplate(template string) error {
+	for _, m := range nodeTemplatePlaceholder.FindAllStringSubmatch(template, -1) {
+		switch name := m[1]; {
+		case name == "inline", name == "blocks", name == "text", name == "type":
+		case strings.HasPrefix(name, "attrs.") && len(name) > len("attrs."):
+		default:
+			return fmt.Errorf("unknown placeholder %s", m[0])
+		}
+	}
+	return nil
+}
+
+// nodeTemplate returns the template WithNodeTemplates gives for node.
+func (c *config) nodeTemplate(node Node) (string, bool) {
+	template, ok := c.nodeTemplates[node.Type]
+	return template, ok
+}
+
+// fillNodeTemplate fills in template for node.
+func fillNodeTemplate(template string, node Node, ctx renderContext) string {
+	var b strings.Builder
+	last := 0
+	for _, loc := range nodeTemplatePlaceholder.FindAllStringSubmatchIndex(template, -1) {
+		b.WriteString(template[last:loc[0]])
+		lineStart := strings.LastIndexByte(template[:loc[0]], '\n') + 1
+		value := nodeTemplateValue(template[loc[2]:loc[3]], node, ctx)
+		if lead := templateLinePrefix(template[lineStart:loc[0]]); lead != "" {
+			value = continueLines(value, lead)
+		}
+		b.WriteString(value)
+		last = loc[1]
+	}
+	b.WriteString(template[last:])
+	return b.String()
+}
+
+func nodeTemplateValue(name string, node Node, ctx renderContext) string {
+	switch name {
+	case "inline":
+		return templateInline(node, ctx)
+	case "blocks":
+		return renderBlocks(node.Content, ctx)
+	case "text":
+		return PlainText(node)
+	case "type":
+		return node.Type
+	}
+	if key := strings.TrimPrefix(name, "attrs."); key != name {
+		return attrText(node.Attrs[key])
+	}
+	return "{{" + name + "}}"
+}
+
+// templateInline renders the content of node inline. Block children, such
+// as paragraphs, are rendered by their inline content, separated by spaces.
+func templateInline(node Node, ctx renderContext) string {
+	blocks := false
+	for _, child := range node.Content {
+		if child.Type == "paragraph" || child.Type == "heading" {
+			blocks = true
+		}
+	}
+	if !blocks {
+		return renderInline(node.Content, ctx)
+	}
+	var parts []string
+	for i, child := range node.Content {
+		if text := renderInline(child.Content, ctx.child(i)); text != "" {
+			parts = append(parts, text)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// templateLinePrefix returns the blockquote markers and indentation that
+// start line.
+func templateLinePrefix(line string) string {
+	end := 0
+	for end < len(line) && (line[end] == ' ' || line[end] == '\t' || line[end] == '>') {
+		end++
+	}
+	return line[:end]
+}
+
+// continueLines prefixes the lines of value after the first with lead;
+// empty lines get lead without its trailing spaces.
+func continueLines(value, lead string) string {
+	lines := strings.Split(value, "\n")
+	for i := 1; i < len(lines); i++ {
+		if lines[i] == "" {
+			lines[i] = strings.TrimRight(lead, " \t")
+		} else {
+			lines[i] = lead + lines[i]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// attrText formats an attr value for a template: strings as they are,
+// numbers without exponents, and other values as JSON.
+func attrText(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
@@ -0,0 +1,226 @@
+package boxnote
+
+import "time"
+
+// ConvertOption configures a single conversion.
+type ConvertOption func(*config)
+
+// Flavor selects the Markdown dialect of the output.
+type Flavor string
+
+const (
+	// FlavorGFM renders GitHub Flavored Markdown (the default).
+	FlavorGFM Flavor = "gfm"
+	// FlavorCommonMark avoids GFM-only inline syntax: strikethrough is
+	// rendered as <del> HTML.
+	FlavorCommonMark Flavor = "commonmark"
+	// FlavorPandoc renders Pandoc's Markdown: GFM syntax, except that bare
+	// URLs are written as autolinks and table captions as Table: lines.
+	FlavorPandoc Flavor = "pandoc"
+)
+
+// Escaping selects how Markdown syntax characters in note text are escaped.
+type Escaping string
+
+const (
+	// EscapeMarked escapes the characters that would interfere with the
+	// emphasis and link syntax wrapped around formatted text (the default).
+	EscapeMarked Escaping = "marked"
+	// EscapeAll also escapes unformatted text: every character that could
+	// start inline syntax, and block syntax such as #, >, or 1. at the start
+	// of a line.
+	EscapeAll Escaping = "all"
+	// EscapeNone emits note text verbatim.
+	EscapeNone Escaping = "none"
+)
+
+// HardBreak selects how hard_break nodes are written.
+type HardBreak string
+
+const (
+	// HardBreakBackslash ends the line with a backslash (the default).
+	HardBreakBackslash HardBreak = "backslash"
+	// HardBreakSpaces ends the line with two spaces.
+	HardBreakSpaces HardBreak = "spaces"
+	// HardBreakHTML ends the line with <br>.
+	HardBreakHTML HardBreak = "html"
+)
+
+// HeadingIDs selects whether and how headings are given explicit IDs.
+type HeadingIDs string
+
+const (
+	// HeadingIDsNone writes no heading IDs (the default).
+	HeadingIDsNone HeadingIDs = "none"
+	// HeadingIDsAttr appends a Pandoc/Kramdown-style {#id} attribute.
+	HeadingIDsAttr HeadingIDs = "attr"
+	// HeadingIDsHTML puts an <a id="id"></a> anchor before the heading text.
+	HeadingIDsHTML HeadingIDs = "html"
+)
+
+type config struct {
+	flavor           Flavor
+	bullet           string
+	escaping         Escaping
+	hardBreak        HardBreak
+	title            string
+	headingIDs       HeadingIDs
+	unknownNodes     UnknownNodes
+	tableMode        TableMode
+	headerlessTables HeaderlessTable
+	rawHTML          RawHTML
+	listStyle        ListStyle
+	callouts         Callouts
+	alignment        Alignment
+	indent           Indent
+	tasks            Tasks
+	zeroWidthSpace   ZeroWidthSpace
+	emoji            Emoji
+	dateLayout       string
+	tocDepth         int
+	// headingShift moves headings; see WithShiftHeadings and
+	// WithShiftHeadingsAuto.
+	headingShift     int
+	headingShiftAuto bool
+	// keepEmptyParagraphs keeps spacing paragraphs; see WithEmptyParagraphs.
+	keepEmptyParagraphs bool
+	// htmlBlocks allows HTML blocks; see WithHTMLBlocks.
+	htmlBlocks bool
+	// joinCJKLines joins soft-broken lines; see WithJoinCJKLines.
+	joinCJKLines bool
+	// ideographicSpaceEntities escapes U+3000; see
+	// WithIdeographicSpaceEntities.
+	ideographicSpaceEntities bool
+	// doneDates appends done dates to checked items; see WithDoneDates.
+	doneDates    bool
+	doneFallback time.Time
+	// imageSource rewrites image sources; see WithImageSource.
+	imageSource func(src string, node Node) string
+	// linkRewrite rewrites link hrefs; see WithLinkRewrite.
+	linkRewrite func(href string) string
+	// markStyles writes nonstandard marks declaratively; see
+	// WithMarkStyles.
+	markStyles map[string]MarkStyle
+	// nodeTemplates renders node types declaratively; see
+	// WithNodeTemplates.
+	nodeTemplates map[string]string
+	// wikiLink resolves wikilink targets; see WithWikiLinks.
+	wikiLink func(href string) (string, bool)
+}
+
+func newConfig(opts []ConvertOption) *config {
+	cfg := &config{
+		flavor:           FlavorGFM,
+		bullet:           "-",
+		escaping:         EscapeMarked,
+		hardBreak:        HardBreakBackslash,
+		headingIDs:       HeadingIDsNone,
+		unknownNodes:     UnknownNodesSkip,
+		tableMode:        TableModePipe,
+		headerlessTables: HeaderlessTableEmpty,
+		rawHTML:          RawHTMLAllow,
+		listStyle:        ListAuto,
+		callouts:         CalloutsQuote,
+		alignment:        AlignmentNone,
+		indent:           IndentNone,
+		tasks:            TasksCheckbox,
+		zeroWidthSpace:   ZeroWidthSpaceChar,
+		emoji:            EmojiKeep,
+		dateLayout:       "2006-01-02",
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// WithFlavor selects the Markdown dialect.
+func WithFlavor(flavor Flavor) ConvertOption {
+	return func(c *config) {
+		c.flavor = flavor
+	}
+}
+
+// WithBullet sets the marker of bullet and check list items. Markers other
+// than '-', '*', and '+' are ignored.
+func WithBullet(marker rune) ConvertOption {
+	return func(c *config) {
+		switch marker {
+		case '-', '*', '+':
+			c.bullet = string(marker)
+		}
+	}
+}
+
+// WithEscaping selects how note text is escaped.
+func WithEscaping(escaping Escaping) ConvertOption {
+	return func(c *config) {
+		c.escaping = escaping
+	}
+}
+
+// WithHardBreak selects how hard line breaks are written.
+func WithHardBreak(style HardBreak) ConvertOption {
+	return func(c *config) {
+		c.hardBreak = style
+	}
+}
+
+// WithTitle prepends an H1 heading with title to the output. An empty title
+// adds no heading.
+func WithTitle(title string) ConvertOption {
+	return func(c *config) {
+		c.title = title
+	}
+}
+
+// WithHeadingIDs gives every heading an explicit ID in the given style. The
+// ID is the one the heading carries in the note (its id or guid attr), or
+// else its generated anchor slug.
+func WithHeadingIDs(style HeadingIDs) ConvertOption {
+	return func(c *config) {
+		c.headingIDs = style
+	}
+}
+
+// WithEmptyParagraphs keeps the empty paragraphs that notes use as vertical
+// spacing: each one between other blocks is written as an &nbsp; line,
+// which Markdown renderers do not collapse.
+func WithEmptyParagraphs(keep bool) ConvertOption {
+	return func(c *config) {
+		c.keepEmptyParagraphs = keep
+	}
+}
+
+// WithDateLayout sets the time layout of the dates the converter writes
+// from timestamps, such as the due dates of checklist items given in
+// milliseconds, for readers of another locale. The default is 2006-01-02.
+// The dates of the Obsidian Tasks syntax are always written as 2006-01-02.
+func WithDateLayout(layout string) ConvertOption {
+	return func(c *config) {
+		c.dateLayout = layout
+	}
+}
+
+// WithHTMLBlocks allows HTML blocks for content that Markdown has no syntax
+// for: images with a caption are written as <figure> elements.
+func WithHTMLBlocks(allowed bool) ConvertOption {
+	return func(c *config) {
+		c.htmlBlocks = allowed
+	}
+}
+
+func (c *config) bulletPrefix() string {
+	return c.bullet + " "
+}
+
+func (c *config) hardBreakText() string {
+	switch c.hardBreak {
+	case HardBreakSpaces:
+		return "  \n"
+	case HardBreakHTML:
+		return "<br>\n"
+	default:
+		return "\\\n"
+	}
+}
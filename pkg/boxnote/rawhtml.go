@@ -0,0 +1,46 @@
+package boxnote
+
+import (
+	"regexp"
+	"strings"
+)
+
+// RawHTML selects what happens to HTML written literally in note text,
+// such as a pasted <script> tag.
+type RawHTML string
+
+const (
+	// RawHTMLAllow passes it through, so Markdown renderers interpret it
+	// (the default).
+	RawHTMLAllow RawHTML = "allow"
+	// RawHTMLEscape writes the tags as &lt;tag>, so they show as text.
+	RawHTMLEscape RawHTML = "escape"
+	// RawHTMLStrip removes the tags and comments, keeping the text between
+	// them.
+	RawHTMLStrip RawHTML = "strip"
+)
+
+// WithRawHTML selects how raw HTML in text nodes is handled. Text in code
+// spans is never changed, since Markdown does not interpret HTML there.
+func WithRawHTML(policy RawHTML) ConvertOption {
+	return func(c *config) {
+		c.rawHTML = policy
+	}
+}
+
+// rawHTMLPattern matches what CommonMark recognizes as raw inline HTML: an
+// open or closing tag, a comment, a processing instruction, a declaration,
+// or a CDATA section.
+var rawHTMLPattern = regexp.MustCompile(`</?[A-Za-z][A-Za-z0-9-]*(?:\s[^<>]*)?/?>|<!--[\s\S]*?-->|<\?[\s\S]*?\?>|<![A-Za-z][^>]*>|<!\[CDATA\[[\s\S]*?\]\]>`)
+
+func applyRawHTML(text string, policy RawHTML) string {
+	switch policy {
+	case RawHTMLEscape:
+		return rawHTMLPattern.ReplaceAllStringFunc(text, func(tag string) string {
+			return "&lt;" + strings.TrimPrefix(tag, "<")
+		})
+	case RawHTMLStrip:
+		return rawHTMLPattern.ReplaceAllString(text, "")
+	}
+	return text
+}
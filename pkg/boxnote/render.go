@@ -0,0 +1,711 @@
+package boxnote
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+type renderContext struct {
+	indent int
+	// path holds the content indexes leading from doc to the current node.
+	path []int
+	diag *diagnostics
+	cfg  *config
+	// parent is checked for cancellation between blocks.
+	parent context.Context
+	// anchors resolves links to headings of the document.
+	anchors *headingAnchors
+}
+
+func (ctx renderContext) nested() renderContext {
+	ctx.indent += 2
+	return ctx
+}
+
+// child returns the context for the index-th child of the current node.
+func (ctx renderContext) child(index int) renderContext {
+	path := make([]int, len(ctx.path), len(ctx.path)+1)
+	copy(path, ctx.path)
+	ctx.path = append(path, index)
+	return ctx
+}
+
+// warnMark reports an unknown mark of markType on the current node.
+func (ctx renderContext) warnMark(markType, format string, args ...interface{}) {
+	ctx.warn(WarningUnknownMark, format, args...)
+	if ctx.diag != nil {
+		ctx.diag.warnings[len(ctx.diag.warnings)-1].MarkType = markType
+	}
+}
+
+func (ctx renderContext) warn(kind, format string, args ...interface{}) {
+	if ctx.diag == nil {
+		return
+	}
+	node := ctx.diag.node(ctx.path)
+	ctx.diag.warnings = append(ctx.diag.warnings, Warning{
+		Kind:     kind,
+		Message:  fmt.Sprintf(format, args...),
+		Path:     formatNodePath(ctx.path),
+		NodeType: node.Type,
+		Excerpt:  nodeExcerpt(node),
+	})
+}
+
+func renderBlocks(nodes []Node, ctx renderContext) string {
+	var b strings.Builder
+	renderBlocksTo(&errWriter{w: &b}, nodes, ctx)
+	return b.String()
+}
+
+// renderBlocksTo writes the rendered blocks to out, separated by blank
+// lines, without joining them in memory first.
+func renderBlocksTo(out *errWriter, nodes []Node, ctx renderContext) {
+	bw := &blockWriter{out: out, ctx: ctx}
+	for i, node := range nodes {
+		if !bw.write(i, node) {
+			return
+		}
+	}
+	bw.finish()
+}
+
+// blockWriter writes sibling blocks one at a time, so that they can come
+// from a slice or straight from a decoder.
+type blockWriter struct {
+	out *errWriter
+	ctx renderContext
+	// wrote is set once a block has been written.
+	wrote bool
+	// seenContent is set after the first block other than an empty
+	// paragraph; later empty paragraphs are held in pendingEmpty until the
+	// next such block shows they are spacing between content.
+	seenContent  bool
+	pendingEmpty []int
+}
+
+// write renders node, the i-th sibling. It returns false once writing
+// has failed or the context is done.
+func (bw *blockWriter) write(i int, node Node) bool {
+	if bw.ctx.parent != nil && bw.out.err == nil {
+		bw.out.err = bw.ctx.parent.Err()
+	}
+	if bw.out.err != nil {
+		return false
+	}
+	if bw.ctx.cfg.keepEmptyParagraphs {
+		if isEmptyParagraph(node) {
+			if bw.seenContent {
+				bw.pendingEmpty = append(bw.pendingEmpty, i)
+				return true
+			}
+		} else {
+			// Empty paragraphs between content are spacing the author meant.
+			for _, index := range bw.pendingEmpty {
+				bw.out.path = bw.ctx.child(index).path
+				bw.writeBlock(emptyParagraphText)
+			}
+			bw.pendingEmpty = nil
+			bw.seenContent = true
+		}
+	}
+	bw.render(i, node)
+	return bw.out.err == nil
+}
+
+// finish renders the empty paragraphs that ended the siblings as usual.
+func (bw *blockWriter) finish() {
+	for _, index := range bw.pendingEmpty {
+		bw.render(index, Node{Type: "paragraph"})
+	}
+	bw.pendingEmpty = nil
+}
+
+func (bw *blockWriter) render(i int, node Node) {
+	childCtx := bw.ctx.child(i)
+	block, keep := renderBlock(node, childCtx)
+	if !keep {
+		return
+	}
+	bw.out.path = childCtx.path
+	bw.writeBlock(block)
+}
+
+func (bw *blockWriter) writeBlock(block string) {
+	if bw.wrote {
+		bw.out.writeString("\n\n")
+	}
+	bw.out.writeString(block)
+	bw.wrote = true
+}
+
+// emptyParagraphText is written for an empty paragraph kept by
+// WithEmptyParagraphs; a non-breaking space keeps the line from collapsing.
+const emptyParagraphText = "&nbsp;"
+
+func isEmptyParagraph(node Node) bool {
+	return node.Type == "paragraph" && len(node.Content) == 0
+}
+
+func renderBlock(node Node, ctx renderContext) (string, bool) {
+	if template, ok := ctx.cfg.nodeTemplate(node); ok {
+		block := fillNodeTemplate(template, node, ctx)
+		return block, block != ""
+	}
+	if fn, ok := blockHandler(node.Type); ok {
+		return fn(node, &Renderer{ctx: ctx})
+	}
+	switch node.Type {
+	case "heading":
+		rawLevel := getIntAttr(node.Attrs, "level")
+		level := clampInt(rawLevel, 1, 6)
+		if level != rawLevel {
+			ctx.warn(WarningInvalidAttr, "heading level %v out of range", node.Attrs["level"])
+		}
+		text := safeHeadingText(renderInline(node.Content, ctx), ctx.cfg)
+		level = ctx.cfg.headingLevel(level)
+		return alignBlock(fmt.Sprintf("%s %s", strings.Repeat("#", level), withHeadingID(text, ctx)), node, ctx), true
+	case "paragraph":
+		if len(node.Content) == 0 {
+			return "", true
+		}
+		text := renderInline(node.Content, ctx)
+		if ctx.cfg.escaping == EscapeAll {
+			text = escapeLineStarts(text)
+		}
+		return alignBlock(indentBlock(text, node, ctx), node, ctx), true
+	case "hard_break":
+		return ctx.cfg.hardBreakText(), true
+	case "bullet_list":
+		return renderList(node, ctx, ctx.cfg.bulletPrefix()), true
+	case "ordered_list":
+		return renderList(node, ctx, "1. "), true
+	case "list_item":
+		lines := renderListItem(node, ctx, ctx.cfg.bulletPrefix(), ctx.cfg.looseItems([]Node{node}))
+		return strings.Join(lines, "\n"), true
+	case "check_list":
+		return renderCheckList(node, ctx), true
+	case "check_list_item":
+		lines := renderListItem(node, ctx, taskPrefix(node, ctx), ctx.cfg.looseItems([]Node{node}))
+		lines = withTaskFields(lines, node, ctx)
+		return strings.Join(lines, "\n"), true
+	case "horizontal_rule":
+		return "---", true
+	case "blockquote":
+		return renderBlockquote(node.Content, ctx), true
+	case "call_out_box":
+		if ctx.cfg.callouts == CalloutsObsidian || ctx.cfg.callouts == CalloutsAlerts {
+			return renderCallout(node, ctx), true
+		}
+		return renderBlockquote(node.Content, ctx), true
+	case "table":
+		return renderTable(node, ctx), true
+	case "image":
+		return renderImageBlock(node, ctx)
+	default:
+		warnUnknownNodeType(node, ctx)
+		kept := keptUnknown(node, ctx, true)
+		if len(node.Content) == 0 {
+			return kept, kept != ""
+		}
+		children := renderBlocks(node.Content, ctx)
+		if kept != "" && children != "" {
+			return kept + "\n\n" + children, true
+		}
+		return kept + children, true
+	}
+}
+
+// closingSequencePattern matches a run of # at the end of heading text that
+// Markdown would take as the optional closing sequence and drop.
+var closingSequencePattern = regexp.MustCompile(`(^|[ \t])#+[ \t]*$`)
+
+// safeHeadingText keeps heading text on one line, since an ATX heading
+// cannot continue onto the next, and escapes a trailing run of #.
+func safeHeadingText(text string, cfg *config) string {
+	text = strings.ReplaceAll(text, cfg.hardBreakText(), " ")
+	text = trimMarkdownSpace(strings.ReplaceAll(text, "\n", " "))
+	if loc := closingSequencePattern.FindStringIndex(text); loc != nil {
+		i := strings.IndexByte(text[loc[0]:], '#') + loc[0]
+		text = text[:i] + "\\" + text[i:]
+	}
+	return text
+}
+
+func warnUnknownNodeType(node Node, ctx renderContext) {
+	if isKnownNodeType(node.Type) {
+		return
+	}
+	switch {
+	case keepsUnknownNodes(ctx.cfg) && len(node.Content) == 0:
+		ctx.warn(WarningUnknownNode, "unknown node type %q kept as JSON", node.Type)
+	case keepsUnknownNodes(ctx.cfg):
+		ctx.warn(WarningUnknownNode, "unknown node type %q kept as JSON and rendered as its children", node.Type)
+	case len(node.Content) == 0:
+		ctx.warn(WarningUnknownNode, "unknown node type %q dropped", node.Type)
+	default:
+		ctx.warn(WarningUnknownNode, "unknown node type %q rendered as its children", node.Type)
+	}
+}
+
+func isKnownNodeType(nodeType string) bool {
+	switch nodeType {
+	case "doc", "heading", "paragraph", "text", "hard_break",
+		"bullet_list", "ordered_list", "list_item",
+		"check_list", "check_list_item",
+		"horizontal_rule", "blockquote", "call_out_box", "image",
+		"table", "table_row", "table_header", "table_cell":
+		return true
+	default:
+		return false
+	}
+}
+
+func renderInline(nodes []Node, ctx renderContext) string {
+	var b strings.Builder
+	// last is the last character of the text before, for joinLines.
+	var last rune
+	for i := 0; i < len(nodes); i++ {
+		node := nodes[i]
+		childCtx := ctx.child(i)
+		if template, ok := ctx.cfg.nodeTemplate(node); ok {
+			b.WriteString(fillNodeTemplate(template, node, childCtx))
+			last = 0
+			continue
+		}
+		if fn, ok := inlineHandler(node.Type); ok {
+			b.WriteString(fn(node, &Renderer{ctx: childCtx}))
+			continue
+		}
+		switch node.Type {
+		case "text":
+			// Box splits formatted runs into one text node per edit; render
+			// each run as a unit so that its marks are not closed and
+			// reopened mid-phrase.
+			text := node.Text
+			for i+1 < len(nodes) && nodes[i+1].Type == "text" && ctx.cfg.sameMarks(node.Marks, nodes[i+1].Marks) {
+				i++
+				text += nodes[i].Text
+			}
+			if ctx.cfg.joinCJKLines {
+				var next rune
+				if i+1 < len(nodes) && nodes[i+1].Type == "text" {
+					next = firstLineRune(strings.Split(nodes[i+1].Text, "\n"), 0)
+				}
+				text = joinLines(text, last, next)
+				if text != "" {
+					last, _ = utf8.DecodeLastRuneInString(text)
+				}
+			}
+			b.WriteString(applyMarks(text, node.Marks, childCtx))
+			continue
+		case "hard_break":
+			b.WriteString(ctx.cfg.hardBreakText())
+		case "image":
+			image, _ := renderImage(node, childCtx)
+			b.WriteString(image)
+		default:
+			warnUnknownNodeType(node, childCtx)
+			b.WriteString(keptUnknown(node, childCtx, false))
+			if len(node.Content) > 0 {
+				b.WriteString(renderInline(node.Content, childCtx))
+			}
+		}
+		last = 0
+	}
+	return b.String()
+}
+
+func renderList(node Node, ctx renderContext, prefix string) string {
+	var lines []string
+	loose := ctx.cfg.looseItems(node.Content)
+	hasItem := false
+	for i, item := range node.Content {
+		itemCtx := ctx.child(i)
+		switch item.Type {
+		case "list_item":
+			if loose && hasItem {
+				lines = append(lines, "")
+			}
+			lines = append(lines, renderListItem(item, itemCtx, prefix, loose)...)
+			hasItem = true
+		case "bullet_list":
+			if !hasItem {
+				itemCtx.warn(WarningDroppedNode, "nested %s before the first list item dropped", item.Type)
+				continue
+			}
+			nested := renderList(item, itemCtx.nested(), ctx.cfg.bulletPrefix())
+			if nested != "" {
+				lines = append(lines, strings.Split(nested, "\n")...)
+			}
+		case "ordered_list":
+			if !hasItem {
+				itemCtx.warn(WarningDroppedNode, "nested %s before the first list item dropped", item.Type)
+				continue
+			}
+			nested := renderList(item, itemCtx.nested(), "1. ")
+			if nested != "" {
+				lines = append(lines, strings.Split(nested, "\n")...)
+			}
+		case "check_list":
+			if !hasItem {
+				itemCtx.warn(WarningDroppedNode, "nested %s before the first list item dropped", item.Type)
+				continue
+			}
+			nested := renderCheckList(item, itemCtx.nested())
+			if nested != "" {
+				lines = append(lines, strings.Split(nested, "\n")...)
+			}
+		default:
+			itemCtx.warn(WarningDroppedNode, "%s inside %s dropped", item.Type, node.Type)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func renderCheckList(node Node, ctx renderContext) string {
+	var lines []string
+	loose := ctx.cfg.looseItems(node.Content)
+	hasItem := false
+	for i, item := range node.Content {
+		itemCtx := ctx.child(i)
+		switch item.Type {
+		case "check_list_item":
+			if loose && hasItem {
+				lines = append(lines, "")
+			}
+			itemLines := renderListItem(item, itemCtx, taskPrefix(item, itemCtx), loose)
+			lines = append(lines, withTaskFields(itemLines, item, itemCtx)...)
+			hasItem = true
+		case "bullet_list":
+			if !hasItem {
+				itemCtx.warn(WarningDroppedNode, "nested %s before the first list item dropped", item.Type)
+				continue
+			}
+			nested := renderList(item, itemCtx.nested(), ctx.cfg.bulletPrefix())
+			if nested != "" {
+				lines = append(lines, strings.Split(nested, "\n")...)
+			}
+		case "ordered_list":
+			if !hasItem {
+				itemCtx.warn(WarningDroppedNode, "nested %s before the first list item dropped", item.Type)
+				continue
+			}
+			nested := renderList(item, itemCtx.nested(), "1. ")
+			if nested != "" {
+				lines = append(lines, strings.Split(nested, "\n")...)
+			}
+		case "check_list":
+			if !hasItem {
+				itemCtx.warn(WarningDroppedNode, "nested %s before the first list item dropped", item.Type)
+				continue
+			}
+			nested := renderCheckList(item, itemCtx.nested())
+			if nested != "" {
+				lines = append(lines, strings.Split(nested, "\n")...)
+			}
+		default:
+			itemCtx.warn(WarningDroppedNode, "%s inside %s dropped", item.Type, node.Type)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// renderListItem renders an item with the given marker prefix. In a loose
+// list, the blocks of the item are separated by blank lines.
+func renderListItem(node Node, ctx renderContext, prefix string, loose bool) []string {
+	indent := ctx.indent
+	prefixLine := strings.Repeat(" ", indent) + prefix
+	children := node.Content
+	if len(children) == 0 {
+		return []string{prefixLine}
+	}
+
+	var lines []string
+	start := 0
+	first := children[0]
+	if first.Type == "paragraph" {
+		text := renderInline(first.Content, ctx.child(0))
+		text = indentMultiline(text, len(prefixLine))
+		lines = append(lines, prefixLine+text)
+		start = 1
+	} else {
+		lines = append(lines, prefixLine)
+	}
+
+	// Later blocks are indented to the item's content column so that they
+	// stay in the item. A table is also set off by blank lines, since it
+	// cannot interrupt a paragraph and would take in the lines after it as
+	// rows.
+	afterTable := false
+	contentIndent := indent + markerWidth(prefix)
+	for i := start; i < len(children); i++ {
+		block, keep := renderBlock(children[i], ctx.child(i).nested())
+		if !keep {
+			continue
+		}
+		isTable := children[i].Type == "table"
+		// Only a block that opens the item follows the marker directly.
+		opensItem := start == 0 && len(lines) == 1
+		if afterTable || isTable && !opensItem || loose && !opensItem {
+			lines = append(lines, "")
+		}
+		afterTable = isTable
+		if block == "" {
+			lines = append(lines, strings.Repeat(" ", contentIndent))
+			continue
+		}
+		lines = append(lines, indentAllLines(block, contentIndent))
+	}
+
+	return lines
+}
+
+// markerWidth returns the width of the list marker that starts prefix: 2
+// for "- " and "- [ ] ", 3 for "1. ".
+func markerWidth(prefix string) int {
+	return strings.Index(prefix, " ") + 1
+}
+
+func renderBlockquote(nodes []Node, ctx renderContext) string {
+	content := renderBlocks(nodes, ctx)
+	if content == "" {
+		return ">"
+	}
+	return quoteLines(content)
+}
+
+func renderTable(node Node, ctx renderContext) string {
+	switch ctx.cfg.tableMode {
+	case TableModeHTML:
+		return renderHTMLTable(node, ctx)
+	case TableModeAuto:
+		if needsHTMLTable(node) {
+			return renderHTMLTable(node, ctx)
+		}
+	}
+	if !hasHeaderRow(node) {
+		switch ctx.cfg.headerlessTables {
+		case HeaderlessTableHTML:
+			return renderHTMLTable(node, ctx)
+		case HeaderlessTableEmpty:
+			return captionPipeTable(renderPipeTable(node, ctx, false), node, ctx)
+		}
+	}
+	return captionPipeTable(renderPipeTable(node, ctx, true), node, ctx)
+}
+
+// captionPipeTable adds the caption of a table to its pipe table: as an
+// italic line above it, or as a Table: line below it for Pandoc, which
+// makes it the caption of the table.
+func captionPipeTable(table string, node Node, ctx renderContext) string {
+	caption := captionAttr(node)
+	if caption == "" || table == "" {
+		return table
+	}
+	if ctx.cfg.flavor == FlavorPandoc {
+		return table + "\n\nTable: " + applyMarks(caption, nil, ctx)
+	}
+	return applyMarks(caption, []Mark{{Type: "em"}}, ctx) + "\n\n" + table
+}
+
+// hasHeaderRow reports whether the first row of a table consists of
+// table_header cells.
+func hasHeaderRow(table Node) bool {
+	for _, row := range table.Content {
+		if row.Type != "table_row" {
+			continue
+		}
+		if len(row.Content) == 0 {
+			return false
+		}
+		for _, cell := range row.Content {
+			if cell.Type != "table_header" {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// renderPipeTable renders a GFM pipe table. Without firstRowHeader, the
+// header row is left empty and the first row becomes a body row.
+func renderPipeTable(node Node, ctx renderContext, firstRowHeader bool) string {
+	var rows [][]string
+	for i, row := range node.Content {
+		if row.Type != "table_row" {
+			ctx.child(i).warn(WarningDroppedNode, "%s inside table dropped", row.Type)
+			continue
+		}
+		rows = append(rows, renderTableRow(row, ctx.child(i)))
+	}
+	if len(rows) == 0 {
+		return ""
+	}
+
+	colCount := 0
+	for _, row := range rows {
+		if len(row) > colCount {
+			colCount = len(row)
+		}
+	}
+	if colCount == 0 {
+		return ""
+	}
+
+	if !firstRowHeader {
+		rows = append([][]string{make([]string, colCount)}, rows...)
+	}
+	header := normalizeRow(rows[0], colCount)
+	lines := []string{formatTableRow(header), formatTableSeparator(colCount)}
+	for _, row := range rows[1:] {
+		lines = append(lines, formatTableRow(normalizeRow(row, colCount)))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func renderTableRow(row Node, ctx renderContext) []string {
+	var cells []string
+	for i, cell := range row.Content {
+		switch cell.Type {
+		case "table_header", "table_cell":
+			cells = append(cells, renderTableCell(cell, ctx.child(i)))
+		default:
+			ctx.child(i).warn(WarningDroppedNode, "%s inside table_row dropped", cell.Type)
+		}
+	}
+	return cells
+}
+
+func renderTableCell(cell Node, ctx renderContext) string {
+	text := renderCellContent(cell.Content, ctx)
+	if ctx.cfg.hardBreak == HardBreakHTML {
+		text = strings.ReplaceAll(text, "<br>\n", "\n")
+	}
+	text = strings.ReplaceAll(text, "\n", "<br>")
+	text = escapeTableCell(text, ctx.cfg.escaping == EscapeAll)
+	return text
+}
+
+func renderCellContent(nodes []Node, ctx renderContext) string {
+	var parts []string
+	for i, node := range nodes {
+		childCtx := ctx.child(i)
+		if template, ok := ctx.cfg.nodeTemplate(node); ok {
+			parts = append(parts, fillNodeTemplate(template, node, childCtx))
+			continue
+		}
+		if fn, ok := inlineHandler(node.Type); ok {
+			parts = append(parts, fn(node, &Renderer{ctx: childCtx}))
+			continue
+		}
+		switch node.Type {
+		case "paragraph":
+			if len(node.Content) > 0 {
+				parts = append(parts, renderInline(node.Content, childCtx))
+			}
+		case "text":
+			parts = append(parts, applyMarks(node.Text, node.Marks, childCtx))
+		case "image":
+			if image, ok := renderImage(node, childCtx); ok {
+				parts = append(parts, image)
+			}
+		default:
+			warnUnknownNodeType(node, childCtx)
+			if kept := keptUnknown(node, childCtx, false); kept != "" {
+				parts = append(parts, kept)
+			}
+			if len(node.Content) > 0 {
+				parts = append(parts, renderCellContent(node.Content, childCtx))
+			}
+		}
+	}
+	return strings.Join(parts, "<br>")
+}
+
+// trimMarkdownSpace trims the spaces and tabs that Markdown strips from
+// headings and table cells anyway. Ideographic spaces (U+3000), which indent
+// Japanese text, are kept.
+func trimMarkdownSpace(text string) string {
+	return strings.Trim(text, " \t\r\n")
+}
+
+func indentMultiline(text string, indent int) string {
+	lines := strings.Split(text, "\n")
+	if len(lines) == 0 {
+		return text
+	}
+	for i := 1; i < len(lines); i++ {
+		lines[i] = strings.Repeat(" ", indent) + lines[i]
+	}
+	return strings.Join(lines, "\n")
+}
+
+func indentAllLines(text string, indent int) string {
+	if text == "" {
+		return ""
+	}
+	lines := strings.Split(text, "\n")
+	prefix := strings.Repeat(" ", indent)
+	for i, line := range lines {
+		if line == "" {
+			lines[i] = prefix
+			continue
+		}
+		lines[i] = prefix + line
+	}
+	return strings.Join(lines, "\n")
+}
+
+// quoteLines prefixes every line of text with a quote marker. Lines of a
+// nested quote already start with one and get a marker of the next level
+// (>>, >>>, ...), so the depth stays visible at a glance.
+func quoteLines(text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		switch {
+		case line == "":
+			lines[i] = ">"
+		case strings.HasPrefix(line, ">"):
+			lines[i] = ">" + line
+		default:
+			lines[i] = "> " + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func normalizeRow(row []string, colCount int) []string {
+	if len(row) == colCount {
+		return row
+	}
+	if len(row) > colCount {
+		return row[:colCount]
+	}
+	normalized := make([]string, colCount)
+	copy(normalized, row)
+	return normalized
+}
+
+func formatTableRow(row []string) string {
+	for i, cell := range row {
+		row[i] = trimMarkdownSpace(cell)
+	}
+	return "| " + strings.Join(row, " | ") + " |"
+}
+
+func formatTableSeparator(colCount int) string {
+	if colCount <= 0 {
+		return ""
+	}
+	parts := make([]string, colCount)
+	for i := range parts {
+		parts[i] = "---"
+	}
+	return "| " + strings.Join(parts, " | ") + " |"
+}
@@ -0,0 +1,77 @@
+package boxnote
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxListedControls bounds how many distinct control characters a
+// sanitized_text warning names.
+const maxListedControls = 5
+
+// sanitizeText removes the control characters from text, other than tabs
+// and newlines, and replaces invalid UTF-8 with U+FFFD, reporting what was
+// cleaned. A \r\n pair is silently turned into a newline.
+func sanitizeText(text string, ctx renderContext) string {
+	if isCleanText(text) {
+		return text
+	}
+	var b strings.Builder
+	removed, invalid := 0, 0
+	var listed []string
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		switch {
+		case r == utf8.RuneError && size == 1:
+			invalid++
+			b.WriteRune(utf8.RuneError)
+		case r == '\r' && strings.HasPrefix(text[i+1:], "\n"):
+		case isControl(r):
+			removed++
+			if name := fmt.Sprintf("U+%04X", r); len(listed) < maxListedControls && !containsType(listed, name) {
+				listed = append(listed, name)
+			}
+		default:
+			b.WriteString(text[i : i+size])
+		}
+		i += size
+	}
+	if removed > 0 {
+		ctx.warn(WarningSanitized, "removed %d control character(s) (%s)", removed, strings.Join(listed, ", "))
+	}
+	if invalid > 0 {
+		ctx.warn(WarningSanitized, "replaced %d invalid UTF-8 byte(s) with U+FFFD", invalid)
+	}
+	return b.String()
+}
+
+func countInvalidUTF8(input []byte) int {
+	if utf8.Valid(input) {
+		return 0
+	}
+	count := 0
+	for i := 0; i < len(input); {
+		r, size := utf8.DecodeRune(input[i:])
+		if r == utf8.RuneError && size == 1 {
+			count++
+		}
+		i += size
+	}
+	return count
+}
+
+func isCleanText(text string) bool {
+	for _, r := range text {
+		if r == utf8.RuneError || isControl(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// isControl reports whether r is a C0 or C1 control character other than
+// a tab or newline, or DEL.
+func isControl(r rune) bool {
+	return r < 0x20 && r != '\t' && r != '\n' || r >= 0x7F && r <= 0x9F
+}
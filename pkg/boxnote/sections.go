@@ -0,0 +1,152 @@
+package boxnote
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SelectSection keeps only the section of the document headed by the
+// top-level heading whose text is title: the heading, and the blocks after
+// it up to the next heading of the same or a higher level. Headings are
+// matched without regard to case and to runs of whitespace. The document is
+// left alone when no heading matches.
+func (d *Document) SelectSection(title string) error {
+	start := d.findHeading(title, 0)
+	if start < 0 {
+		return fmt.Errorf("no heading %q", title)
+	}
+	blocks := d.Doc.Content
+	level := headingLevelOf(blocks[start])
+	end := start + 1
+	for end < len(blocks) && (blocks[end].Type != "heading" || headingLevelOf(blocks[end]) > level) {
+		end++
+	}
+	d.Doc.Content = blocks[start:end]
+	return nil
+}
+
+// SelectRange keeps the top-level blocks of the document from the heading
+// whose text is from up to, but not including, the first heading after it
+// whose text is to. An empty from starts at the first block, and an empty to
+// runs to the last. Headings are matched as with SelectSection, and the
+// document is left alone when one of them is not found.
+func (d *Document) SelectRange(from, to string) error {
+	start, end := 0, len(d.Doc.Content)
+	if from != "" {
+		if start = d.findHeading(from, 0); start < 0 {
+			return fmt.Errorf("no heading %q", from)
+		}
+	}
+	if to != "" {
+		if from == "" {
+			end = d.findHeading(to, 0)
+		} else {
+			// The heading from is not its own end.
+			end = d.findHeading(to, start+1)
+		}
+		if end < 0 {
+			return fmt.Errorf("no heading %q", to)
+		}
+	}
+	d.Doc.Content = d.Doc.Content[start:end]
+	return nil
+}
+
+// findHeading returns the index of the first top-level heading from index
+// start on whose text is title, or -1.
+func (d *Document) findHeading(title string, start int) int {
+	title = normalizeHeadingText(title)
+	for i := start; i < len(d.Doc.Content); i++ {
+		node := d.Doc.Content[i]
+		if node.Type == "heading" && strings.EqualFold(normalizeHeadingText(PlainText(node)), title) {
+			return i
+		}
+	}
+	return -1
+}
+
+func normalizeHeadingText(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+func headingLevelOf(node Node) int {
+	return clampInt(getIntAttr(node.Attrs, "level"), 1, 6)
+}
+
+// Section is a part of a document cut out by Split.
+type Section struct {
+	// Title is the plain text of the heading that starts the section, or ""
+	// for the blocks before the first heading.
+	Title string
+	// Level is the level of that heading, or 0.
+	Level int
+	// Document holds the heading and the blocks after it.
+	Document *Document
+}
+
+// Split cuts the document at every top-level heading of level 1 to level.
+// The first section holds the blocks before the first such heading, and
+// has no blocks when the document starts with one; each of the others
+// starts with its heading. Every section shares the nodes of d.
+func (d *Document) Split(level int) []Section {
+	blocks := d.Doc.Content
+	sections := []Section{{}}
+	start := 0
+	for i, node := range blocks {
+		if node.Type != "heading" || headingLevelOf(node) > level {
+			continue
+		}
+		sections[len(sections)-1].Document = d.part(blocks[start:i], len(sections) == 1)
+		sections = append(sections, Section{
+			Title: normalizeHeadingText(PlainText(node)),
+			Level: headingLevelOf(node),
+		})
+		start = i
+	}
+	sections[len(sections)-1].Document = d.part(blocks[start:], len(sections) == 1)
+	return sections
+}
+
+// part returns a document of blocks, with the attrs of d. Invalid input is
+// reported by the first part only.
+func (d *Document) part(blocks []Node, first bool) *Document {
+	part := &Document{Doc: d.Doc}
+	part.Doc.Content = blocks
+	if first {
+		part.invalidUTF8 = d.invalidUTF8
+	}
+	return part
+}
+
+// Merge joins the documents of sections into one, as the reverse of Split:
+// a section with a Title starts with a heading of its Level holding the
+// title, and the top-level headings of its document are moved down by
+// Level below it.
+func Merge(sections []Section) *Document {
+	merged := &Document{Doc: Node{Type: "doc"}}
+	for _, section := range sections {
+		if section.Title != "" {
+			merged.Doc.Content = append(merged.Doc.Content, Node{
+				Type:    "heading",
+				Attrs:   map[string]interface{}{"level": float64(clampInt(section.Level, 1, 6))},
+				Content: []Node{{Type: "text", Text: section.Title}},
+			})
+		}
+		if section.Document == nil {
+			continue
+		}
+		for _, node := range section.Document.Doc.Content {
+			if node.Type == "heading" && section.Title != "" {
+				attrs := make(map[string]interface{}, len(node.Attrs)+1)
+				for k, v := range node.Attrs {
+					attrs[k] = v
+				}
+				attrs["level"] = float64(clampInt(headingLevelOf(node)+section.Level, 1, 6))
+				node.Attrs = attrs
+			}
+			merged.Doc.Content = append(merged.Doc.Content, node)
+		}
+		merged.invalidUTF8 += section.Document.invalidUTF8
+	}
+	return merged
+}
@@ -0,0 +1,237 @@
+package boxnote
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// RenderStream reads a Box Note from r and writes it to w as Markdown. Each
+// top-level block is rendered as soon as it has been decoded and then
+// dropped, so neither the input nor the document tree is held in memory
+// whole; memory is bounded by the largest block.
+//
+// The output matches Render's, except that a link to a heading later in
+// the note is pointed at the heading's plain slug, since the heading is
+// not known yet when the link is rendered, and links to missing headings
+// are not reported. Input that is empty or only
+// whitespace writes nothing. Malformed input is reported as a *ParseError
+// or *SchemaError once it is reached; the blocks before it have already
+// been written.
+func RenderStream(ctx context.Context, w io.Writer, r io.Reader, opts ...ConvertOption) ([]Warning, error) {
+	r, err := decodeStreamInput(r)
+	if err != nil {
+		return nil, &ParseError{Err: err}
+	}
+	s := &streamRenderer{dec: json.NewDecoder(r), cfg: newConfig(opts), parent: ctx}
+	return s.run(w)
+}
+
+// decodeStreamInput skips a UTF-8 byte order mark. UTF-16 input has to be
+// transcoded as a whole, so it is read into memory.
+func decodeStreamInput(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(len(utf8BOM))
+	switch {
+	case bytes.HasPrefix(head, utf8BOM):
+		_, err := br.Discard(len(utf8BOM))
+		return br, err
+	case isUTF16(head):
+		input, err := io.ReadAll(br)
+		if err != nil {
+			return nil, err
+		}
+		input, err = decodeInput(input)
+		if err != nil {
+			return nil, err
+		}
+		return bytes.NewReader(input), nil
+	}
+	return br, nil
+}
+
+// streamRenderer walks the token stream of a Box Note down to doc.content
+// and renders its elements one by one.
+type streamRenderer struct {
+	dec    *json.Decoder
+	cfg    *config
+	parent context.Context
+	diag   diagnostics
+	// path is the location being decoded, for a ParseError.
+	path string
+}
+
+func (s *streamRenderer) run(w io.Writer) ([]Warning, error) {
+	tok, err := s.dec.Token()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, s.parseError(err)
+	}
+	if tok != json.Delim('{') {
+		return nil, s.parseError(fmt.Errorf("cannot use JSON %v as boxnote.Document", tok))
+	}
+	out := &errWriter{w: w}
+	if s.cfg.title != "" {
+		out.writeString("# " + safeHeadingText(s.cfg.title, s.cfg) + "\n\n")
+	}
+	found := false
+	for s.dec.More() {
+		key, err := s.key()
+		if err != nil {
+			return s.diag.warnings, err
+		}
+		if key != "doc" {
+			if err := s.skip(key); err != nil {
+				return s.diag.warnings, err
+			}
+			continue
+		}
+		found = true
+		if err := s.doc(out); err != nil {
+			return s.diag.warnings, err
+		}
+	}
+	if err := s.expect(json.Delim('}')); err != nil {
+		return s.diag.warnings, err
+	}
+	if !found {
+		return s.diag.warnings, &SchemaError{Message: "missing doc node"}
+	}
+	return s.diag.warnings, nil
+}
+
+// doc renders the doc node, whose opening brace is next in the stream.
+func (s *streamRenderer) doc(out *errWriter) error {
+	s.path = "doc"
+	if err := s.expect(json.Delim('{')); err != nil {
+		return err
+	}
+	docType := ""
+	for s.dec.More() {
+		key, err := s.key()
+		if err != nil {
+			return err
+		}
+		switch key {
+		case "type":
+			s.path = "doc.type"
+			if err := s.dec.Decode(&docType); err != nil {
+				return s.parseError(err)
+			}
+		case "content":
+			if err := s.content(out); err != nil {
+				return err
+			}
+		default:
+			if err := s.skip("doc." + key); err != nil {
+				return err
+			}
+		}
+	}
+	if err := s.expect(json.Delim('}')); err != nil {
+		return err
+	}
+	if docType == "" {
+		return &SchemaError{Message: "missing doc node"}
+	}
+	return nil
+}
+
+// content renders the elements of doc.content as they are decoded.
+func (s *streamRenderer) content(out *errWriter) error {
+	s.path = "doc.content"
+	if err := s.expect(json.Delim('[')); err != nil {
+		return err
+	}
+	anchors := newHeadingAnchors(nil, s.cfg)
+	anchors.partial = true
+	ctx := renderContext{
+		diag:    &s.diag,
+		cfg:     s.cfg,
+		parent:  s.parent,
+		anchors: anchors,
+	}
+	bw := &blockWriter{out: out, ctx: ctx}
+	for i := 0; s.dec.More(); i++ {
+		s.path = formatNodePath([]int{i})
+		var node Node
+		if err := s.dec.Decode(&node); err != nil {
+			return s.parseError(err)
+		}
+		if _, ok := exceedsDepth(&node, MaxDepth-1); ok {
+			return depthError(s.path)
+		}
+		anchors.collect(&node, []int{i}, s.cfg)
+		s.diag.root = Node{Type: "doc", Content: []Node{node}}
+		s.diag.first = i
+		if !bw.write(i, node) {
+			return out.err
+		}
+	}
+	bw.finish()
+	if out.err == nil {
+		// Nested blocks stop early on cancellation without reporting it.
+		out.err = s.parent.Err()
+	}
+	if out.err != nil {
+		return out.err
+	}
+	s.path = "doc.content"
+	return s.expect(json.Delim(']'))
+}
+
+// key reads the next object key.
+func (s *streamRenderer) key() (string, error) {
+	tok, err := s.dec.Token()
+	if err != nil {
+		return "", s.parseError(err)
+	}
+	key, ok := tok.(string)
+	if !ok {
+		return "", s.parseError(fmt.Errorf("unexpected %v", tok))
+	}
+	return key, nil
+}
+
+// skip discards the value of path, which is not rendered.
+func (s *streamRenderer) skip(path string) error {
+	s.path = path
+	var value json.RawMessage
+	if err := s.dec.Decode(&value); err != nil {
+		return s.parseError(err)
+	}
+	return nil
+}
+
+func (s *streamRenderer) expect(delim json.Delim) error {
+	tok, err := s.dec.Token()
+	if err != nil {
+		return s.parseError(err)
+	}
+	if tok != delim {
+		return s.parseError(fmt.Errorf("expected %v, found %v", delim, tok))
+	}
+	return nil
+}
+
+func (s *streamRenderer) parseError(err error) *ParseError {
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	offset := s.dec.InputOffset()
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		offset = syntaxErr.Offset
+	case errors.As(err, &typeErr):
+		err = fmt.Errorf("cannot use JSON %s as %s", typeErr.Value, typeErr.Type)
+	}
+	return &ParseError{Path: s.path, Offset: offset, Err: err}
+}
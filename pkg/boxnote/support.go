@@ -0,0 +1,77 @@
+package boxnote
+
+// Support describes how much of a node type, mark type, or attr the
+// converter carries into the Markdown output.
+type Support string
+
+const (
+	// SupportFull is rendered with its meaning intact.
+	SupportFull Support = "full"
+	// SupportPartial is rendered, but loses some of its structure or
+	// styling.
+	SupportPartial Support = "partial"
+	// SupportDropped is left out of the output. The children of a dropped
+	// node type are still rendered.
+	SupportDropped Support = "dropped"
+)
+
+// nodeAttrs lists the attrs the converter reads, by node type.
+var nodeAttrs = map[string][]string{
+	"heading":         {"level", "id", "guid"},
+	"check_list_item": {"checked", "assignee", "assigneeId", "assignee_id", "dueDate", "due_date", "due"},
+	"image":           {"src", "alt", "caption", "title"},
+	"paragraph":       {"indent", "indentLevel", "indentation"},
+	"table":           {"caption", "title"},
+	"table_header":    {"colspan", "rowspan"},
+	"table_cell":      {"colspan", "rowspan"},
+}
+
+// NodeSupport reports how nodes of nodeType are converted. A call_out_box
+// is written as a blockquote or callout, without its colors.
+func NodeSupport(nodeType string) Support {
+	switch {
+	case nodeType == "call_out_box":
+		return SupportPartial
+	case isKnownNodeType(nodeType):
+		return SupportFull
+	}
+	return SupportDropped
+}
+
+// AttrSupport reports whether the attr of nodes of nodeType is converted.
+// An attr the converter does not read is dropped.
+func AttrSupport(nodeType, attr string) Support {
+	if containsType(nodeAttrs[nodeType], attr) {
+		return SupportFull
+	}
+	return SupportDropped
+}
+
+// MarkSupport reports how marks of markType on text nodes are converted.
+// Marks on other nodes are dropped.
+func MarkSupport(markType string) Support {
+	switch markType {
+	case "link", "strong", "em", "underline", "strikethrough", "code":
+		return SupportFull
+	}
+	return SupportDropped
+}
+
+// BlockMarkSupport reports how marks of markType on nodes of nodeType other
+// than text are converted. The alignment of paragraphs and headings is kept
+// only with WithAlignment; the other marks are dropped.
+func BlockMarkSupport(nodeType, markType string) Support {
+	if markType == "alignment" && (nodeType == "paragraph" || nodeType == "heading") {
+		return SupportPartial
+	}
+	return SupportDropped
+}
+
+// MarkAttrSupport reports whether the attr of marks of markType is
+// converted.
+func MarkAttrSupport(markType, attr string) Support {
+	if markType == "link" && attr == "href" {
+		return SupportFull
+	}
+	return SupportDropped
+}
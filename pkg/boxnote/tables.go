@@ -0,0 +1,121 @@
+package boxnote
+
+import (
+	"html"
+	"strconv"
+	"strings"
+)
+
+// TableMode selects between pipe tables and HTML tables.
+type TableMode string
+
+const (
+	// TableModePipe renders GFM pipe tables (the default).
+	TableModePipe TableMode = "pipe"
+	// TableModeHTML renders every table as an HTML <table>.
+	TableModeHTML TableMode = "html"
+	// TableModeAuto renders a table as HTML only when a pipe table cannot
+	// represent it: cells with several blocks or lists, merged cells, or no
+	// header row.
+	TableModeAuto TableMode = "auto"
+)
+
+// WithTableMode selects how tables are rendered.
+func WithTableMode(mode TableMode) ConvertOption {
+	return func(c *config) {
+		c.tableMode = mode
+	}
+}
+
+// needsHTMLTable reports whether a pipe table would lose structure of
+// table: anything but a single paragraph in a cell, or a merged cell.
+func needsHTMLTable(table Node) bool {
+	if !hasHeaderRow(table) {
+		return true
+	}
+	for _, row := range table.Content {
+		for _, cell := range row.Content {
+			if cellSpanAttrs(cell) != "" || len(cell.Content) > 1 {
+				return true
+			}
+			for _, child := range cell.Content {
+				if child.Type != "paragraph" {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// HeaderlessTable selects how a table whose first row is not made of
+// table_header cells is rendered. A pipe table always has a header row.
+type HeaderlessTable string
+
+const (
+	// HeaderlessTableEmpty adds an empty header row (the default).
+	HeaderlessTableEmpty HeaderlessTable = "empty"
+	// HeaderlessTableFirstRow uses the first row as the header anyway.
+	HeaderlessTableFirstRow HeaderlessTable = "first-row"
+	// HeaderlessTableHTML renders the table as an HTML <table>.
+	HeaderlessTableHTML HeaderlessTable = "html"
+)
+
+// WithHeaderlessTables selects how tables without a header row are
+// rendered.
+func WithHeaderlessTables(mode HeaderlessTable) ConvertOption {
+	return func(c *config) {
+		c.headerlessTables = mode
+	}
+}
+
+// renderHTMLTable renders a table as HTML. Cell content is rendered as
+// Markdown blocks between blank lines, which GFM renders inside HTML
+// blocks, so that cells can hold several paragraphs or lists.
+func renderHTMLTable(node Node, ctx renderContext) string {
+	lines := []string{"<table>"}
+	if caption := captionAttr(node); caption != "" {
+		lines = append(lines, "<caption>"+html.EscapeString(caption)+"</caption>")
+	}
+	for i, row := range node.Content {
+		rowCtx := ctx.child(i)
+		if row.Type != "table_row" {
+			rowCtx.warn(WarningDroppedNode, "%s inside table dropped", row.Type)
+			continue
+		}
+		lines = append(lines, "<tr>")
+		for j, cell := range row.Content {
+			cellCtx := rowCtx.child(j)
+			tag := "td"
+			switch cell.Type {
+			case "table_header":
+				tag = "th"
+			case "table_cell":
+			default:
+				cellCtx.warn(WarningDroppedNode, "%s inside table_row dropped", cell.Type)
+				continue
+			}
+			open := "<" + tag + cellSpanAttrs(cell) + ">"
+			content := trimMarkdownSpace(renderBlocks(cell.Content, cellCtx))
+			if content == "" {
+				lines = append(lines, open+"</"+tag+">")
+				continue
+			}
+			lines = append(lines, open, "", content, "", "</"+tag+">")
+		}
+		lines = append(lines, "</tr>")
+	}
+	lines = append(lines, "</table>")
+	return strings.Join(lines, "\n")
+}
+
+// cellSpanAttrs returns the colspan and rowspan attributes of a merged cell.
+func cellSpanAttrs(cell Node) string {
+	var attrs string
+	for _, key := range []string{"colspan", "rowspan"} {
+		if span := getIntAttr(cell.Attrs, key); span > 1 {
+			attrs += " " + key + `="` + strconv.Itoa(span) + `"`
+		}
+	}
+	return attrs
+}
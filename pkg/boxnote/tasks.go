@@ -0,0 +1,216 @@
+package boxnote
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Tasks selects how check_list_item nodes are marked.
+type Tasks string
+
+const (
+	// TasksCheckbox writes the [ ] and [x] task list items of GFM, by the
+	// checked attr alone (the default).
+	TasksCheckbox Tasks = "checkbox"
+	// TasksObsidian also writes the status markers of the Obsidian Tasks
+	// plugin for items whose state is cancelled, [-], or in progress, [/].
+	TasksObsidian Tasks = "obsidian"
+)
+
+// WithTasks selects how checklist items are marked.
+func WithTasks(style Tasks) ConvertOption {
+	return func(c *config) {
+		c.tasks = style
+	}
+}
+
+// WithDoneDates appends the done date of the Obsidian Tasks plugin,
+// ✅ 2006-01-02, to checked items: the date the item records its completion
+// at, or else fallback, such as the last modification of the note. A zero
+// fallback leaves the items that record no date without one.
+func WithDoneDates(fallback time.Time) ConvertOption {
+	return func(c *config) {
+		c.doneDates = true
+		c.doneFallback = fallback
+	}
+}
+
+// taskStates maps the values of the state attr of a checklist item to the
+// Obsidian Tasks status characters. Done and to-do states follow checked.
+var taskStates = map[string]byte{
+	"cancelled":   '-',
+	"canceled":    '-',
+	"in_progress": '/',
+	"in-progress": '/',
+	"inprogress":  '/',
+	"started":     '/',
+	"done":        'x',
+	"checked":     'x',
+	"completed":   'x',
+	"todo":        ' ',
+	"open":        ' ',
+	"unchecked":   ' ',
+}
+
+// taskPrefix returns the list marker and checkbox of a checklist item.
+func taskPrefix(item Node, ctx renderContext) string {
+	status := byte(' ')
+	if getBoolAttr(item.Attrs, "checked") {
+		status = 'x'
+	}
+	if ctx.cfg.tasks == TasksObsidian {
+		if state, ok := taskState(item); ok {
+			if s, known := taskStates[strings.ToLower(state)]; known {
+				if s == '-' || s == '/' {
+					status = s
+				}
+			} else {
+				ctx.warn(WarningInvalidAttr, "unknown checklist item state %q", state)
+			}
+		}
+	}
+	return ctx.cfg.bullet + " [" + string(status) + "] "
+}
+
+// taskState returns the state attr of a checklist item, or its status attr.
+func taskState(item Node) (string, bool) {
+	if state, ok := getStringAttr(item.Attrs, "state"); ok && state != "" {
+		return state, true
+	}
+	if state, ok := getStringAttr(item.Attrs, "status"); ok && state != "" {
+		return state, true
+	}
+	return "", false
+}
+
+// Attrs that tools writing Box Notes have used for the assignee and due date
+// of a task, in order of preference.
+var (
+	assigneeAttrs = []string{"assignee", "assigneeId", "assignee_id"}
+	dueAttrs      = []string{"dueDate", "due_date", "due"}
+)
+
+// TaskAssignee returns the assignee of a checklist item, a name or user ID,
+// or "" when it has none.
+func TaskAssignee(item Node) string {
+	for _, key := range assigneeAttrs {
+		switch value := item.Attrs[key].(type) {
+		case string:
+			if value != "" {
+				return value
+			}
+		case float64:
+			return strconv.FormatFloat(value, 'f', -1, 64)
+		}
+	}
+	return ""
+}
+
+// TaskDue returns the due date of a checklist item, as it is written or,
+// when it is given in milliseconds since the epoch, as 2006-01-02. It is ""
+// when the item has none.
+func TaskDue(item Node) string {
+	return taskDue(item, isoDate)
+}
+
+// isoDate is the layout of the dates the Obsidian Tasks plugin reads.
+const isoDate = "2006-01-02"
+
+func taskDue(item Node, layout string) string {
+	for _, key := range dueAttrs {
+		switch value := item.Attrs[key].(type) {
+		case string:
+			if value != "" {
+				return value
+			}
+		case float64:
+			return time.UnixMilli(int64(value)).Local().Format(layout)
+		}
+	}
+	return ""
+}
+
+// withTaskFields appends the assignee, due date, and done date of item to
+// the first line of its rendered lines. With TasksObsidian the dates are
+// the 📅 and ✅ fields the Obsidian Tasks plugin reads there; otherwise the
+// assignee and due date are written as (@alice, due 2024-05-01).
+func withTaskFields(lines []string, item Node, ctx renderContext) []string {
+	if len(lines) == 0 {
+		return lines
+	}
+	layout := ctx.cfg.dateLayout
+	if ctx.cfg.tasks == TasksObsidian {
+		layout = isoDate
+	}
+	assignee, due := TaskAssignee(item), taskDue(item, layout)
+	if assignee != "" && ctx.cfg.escaping == EscapeAll {
+		assignee = escapePlainText(assignee)
+	}
+	var fields []string
+	if ctx.cfg.tasks == TasksObsidian {
+		if assignee != "" {
+			fields = append(fields, "@"+assignee)
+		}
+		if due != "" {
+			fields = append(fields, "📅 "+due)
+		}
+	} else {
+		var details []string
+		if assignee != "" {
+			details = append(details, "@"+assignee)
+		}
+		if due != "" {
+			details = append(details, "due "+due)
+		}
+		if len(details) > 0 {
+			fields = append(fields, "("+strings.Join(details, ", ")+")")
+		}
+	}
+	if done, ok := doneDate(item, ctx); ok {
+		fields = append(fields, "✅ "+done.Format(isoDate))
+	}
+	if len(fields) == 0 {
+		return lines
+	}
+	suffix := " " + strings.Join(fields, " ")
+	first := lines[0]
+	if i := strings.IndexByte(first, '\n'); i >= 0 {
+		first = first[:i] + suffix + first[i:]
+	} else {
+		first += suffix
+	}
+	return append([]string{first}, lines[1:]...)
+}
+
+// doneDate returns the done date of a checked item, for WithDoneDates.
+func doneDate(item Node, ctx renderContext) (time.Time, bool) {
+	if !ctx.cfg.doneDates || !getBoolAttr(item.Attrs, "checked") {
+		return time.Time{}, false
+	}
+	if done, ok := taskDoneTime(item); ok {
+		return done, true
+	}
+	return ctx.cfg.doneFallback, !ctx.cfg.doneFallback.IsZero()
+}
+
+// taskDoneTime returns when a checklist item was checked, from an attr in
+// milliseconds since the epoch or as an RFC 3339 time or date.
+func taskDoneTime(item Node) (time.Time, bool) {
+	for _, key := range []string{"checkedAt", "completedAt", "doneAt"} {
+		switch value := item.Attrs[key].(type) {
+		case float64:
+			if value > 0 {
+				return time.UnixMilli(int64(value)).Local(), true
+			}
+		case string:
+			if t, err := time.Parse(time.RFC3339, value); err == nil {
+				return t.Local(), true
+			}
+			if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
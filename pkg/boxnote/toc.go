@@ -0,0 +1,58 @@
+package boxnote
+
+import "strings"
+
+// WithTableOfContents writes a table of contents after the title: a nested
+// list linking to the top-level headings written at levels 1 to depth, at the
+// anchors the converter gives them. It is built from the converted
+// headings, whether or not the note turns its own table of contents on.
+// The streaming Render leaves it out, since the headings are not known
+// before the body is written.
+func WithTableOfContents(depth int) ConvertOption {
+	return func(c *config) {
+		c.tocDepth = clampInt(depth, 0, 6)
+	}
+}
+
+// renderTableOfContents returns the table of contents of doc, or "" when
+// no heading is deep enough.
+func renderTableOfContents(doc *Document, anchors *headingAnchors, cfg *config) string {
+	type entry struct {
+		level int
+		text  string
+		href  string
+	}
+	var entries []entry
+	top := 6
+	for i, node := range doc.Doc.Content {
+		if node.Type != "heading" {
+			continue
+		}
+		level := cfg.headingLevel(headingLevelOf(node))
+		text := normalizeHeadingText(PlainText(node))
+		if level > cfg.tocDepth || text == "" {
+			continue
+		}
+		entries = append(entries, entry{level, text, anchors.byPath[formatNodePath([]int{i})]})
+		if level < top {
+			top = level
+		}
+	}
+	var lines []string
+	prev := -1
+	for _, e := range entries {
+		// A heading that skips a level is nested only one deeper than the
+		// one before it, since a list cannot skip a level either.
+		depth := e.level - top
+		if depth > prev+1 {
+			depth = prev + 1
+		}
+		prev = depth
+		link := escapePlainText(e.text)
+		if e.href != "" {
+			link = "[" + link + "](#" + e.href + ")"
+		}
+		lines = append(lines, strings.Repeat(" ", depth*len(cfg.bulletPrefix()))+cfg.bulletPrefix()+link)
+	}
+	return strings.Join(lines, "\n")
+}
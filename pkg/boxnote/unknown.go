@@ -0,0 +1,77 @@
+package boxnote
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// UnknownNodes selects what is written for node types the converter does
+// not recognize. Their children are rendered in every mode.
+type UnknownNodes string
+
+const (
+	// UnknownNodesSkip writes nothing for the node itself (the default).
+	UnknownNodesSkip UnknownNodes = "skip"
+	// UnknownNodesComment writes the node as JSON in an HTML comment.
+	UnknownNodesComment UnknownNodes = "comment"
+	// UnknownNodesFence writes the node as a ```json fenced code block.
+	// Inline nodes and nodes in table cells fall back to a comment.
+	UnknownNodesFence UnknownNodes = "fence"
+)
+
+// WithUnknownNodes selects how unrecognized nodes are preserved. The JSON
+// holds the node's type, attrs, marks, and text; its content is rendered as
+// usual after it.
+func WithUnknownNodes(mode UnknownNodes) ConvertOption {
+	return func(c *config) {
+		c.unknownNodes = mode
+	}
+}
+
+func keepsUnknownNodes(cfg *config) bool {
+	return cfg.unknownNodes == UnknownNodesComment || cfg.unknownNodes == UnknownNodesFence
+}
+
+// keptNode is the JSON written for an unknown node.
+type keptNode struct {
+	Type  string                 `json:"type"`
+	Attrs map[string]interface{} `json:"attrs,omitempty"`
+	Marks []Mark                 `json:"marks,omitempty"`
+	Text  string                 `json:"text,omitempty"`
+}
+
+// keptUnknown returns the preserved form of an unknown node, or "" when
+// unknown nodes are skipped. block tells whether a fenced block may be used.
+func keptUnknown(node Node, ctx renderContext, block bool) string {
+	if isKnownNodeType(node.Type) || !keepsUnknownNodes(ctx.cfg) {
+		return ""
+	}
+	kept := keptNode{Type: node.Type, Attrs: node.Attrs, Marks: node.Marks, Text: node.Text}
+	if ctx.cfg.unknownNodes == UnknownNodesFence && block {
+		data := marshalKept(kept, "  ")
+		fence := strings.Repeat("`", maxInt(maxConsecutiveBackticks(data)+1, 3))
+		return fence + "json\n" + data + "\n" + fence
+	}
+	// "--" cannot appear inside a comment. It can only occur in JSON
+	// strings, where the escape keeps the value intact.
+	data := strings.ReplaceAll(marshalKept(kept, ""), "--", `-\u002d`)
+	return "<!-- boxnote: " + data + " -->"
+}
+
+func marshalKept(node keptNode, indent string) string {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", indent)
+	// Values decoded from JSON always encode.
+	_ = encoder.Encode(node)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
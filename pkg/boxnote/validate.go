@@ -0,0 +1,111 @@
+package boxnote
+
+import "fmt"
+
+// Content categories of the Box Notes schema.
+var (
+	blockNodeTypes = []string{
+		"heading", "paragraph", "bullet_list", "ordered_list", "check_list",
+		"horizontal_rule", "blockquote", "call_out_box", "table", "image",
+	}
+	inlineNodeTypes = []string{"text", "hard_break", "image"}
+	listNodeTypes   = []string{"bullet_list", "ordered_list", "check_list"}
+)
+
+// allowedChildren lists the child types each known node type may contain.
+// Box nests sub-lists directly in lists, next to their items. A nil entry
+// means the node has no content.
+var allowedChildren = map[string][]string{
+	"doc":             blockNodeTypes,
+	"heading":         inlineNodeTypes,
+	"paragraph":       inlineNodeTypes,
+	"text":            nil,
+	"hard_break":      nil,
+	"horizontal_rule": nil,
+	"image":           nil,
+	"bullet_list":     append([]string{"list_item"}, listNodeTypes...),
+	"ordered_list":    append([]string{"list_item"}, listNodeTypes...),
+	"check_list":      append([]string{"check_list_item"}, listNodeTypes...),
+	"list_item":       blockNodeTypes,
+	"check_list_item": blockNodeTypes,
+	"blockquote":      blockNodeTypes,
+	"call_out_box":    blockNodeTypes,
+	"table":           {"table_row"},
+	"table_row":       {"table_header", "table_cell"},
+	"table_header":    blockNodeTypes,
+	"table_cell":      blockNodeTypes,
+}
+
+// Validate checks the document against the Box Notes schema: the children
+// each node type allows, the attrs it requires, and the attrs of its marks.
+// It returns every violation in document order, or nil. Node types the
+// schema does not know are not violations; their children are still
+// checked.
+func (d *Document) Validate() []*SchemaError {
+	var errs []*SchemaError
+	var check func(node Node, path []int)
+	check = func(node Node, path []int) {
+		at := formatNodePath(path)
+		fail := func(suffix, format string, args ...interface{}) {
+			errs = append(errs, &SchemaError{Path: at + suffix, Message: fmt.Sprintf(format, args...)})
+		}
+		allowed, known := allowedChildren[node.Type]
+		switch {
+		case node.Type == "":
+			fail("", "node without type")
+		case known && allowed == nil && len(node.Content) > 0:
+			fail("", "%s must not have content", node.Type)
+		}
+		switch node.Type {
+		case "text":
+			if node.Text == "" {
+				fail("", "empty text node")
+			}
+		case "heading":
+			if level, ok := node.Attrs["level"].(float64); !ok || level < 1 || level > 6 || level != float64(int(level)) {
+				fail(".attrs.level", "heading level must be an integer from 1 to 6")
+			}
+		case "image":
+			if src, _ := getStringAttr(node.Attrs, "src"); src == "" {
+				fail(".attrs.src", "image without src")
+			}
+		case "check_list_item":
+			if checked, ok := node.Attrs["checked"]; ok {
+				if _, isBool := checked.(bool); !isBool {
+					fail(".attrs.checked", "checked must be a boolean")
+				}
+			}
+		}
+		for i, mark := range node.Marks {
+			if mark.Type == "link" {
+				if href, _ := getStringAttr(mark.Attrs, "href"); href == "" {
+					fail(fmt.Sprintf(".marks[%d].attrs.href", i), "link without href")
+				}
+			}
+		}
+		for i, child := range node.Content {
+			childPath := append(append([]int(nil), path...), i)
+			if known && allowed != nil && isKnownNodeType(child.Type) && !containsType(allowed, child.Type) {
+				errs = append(errs, &SchemaError{
+					Path:    formatNodePath(childPath),
+					Message: fmt.Sprintf("%s is not allowed in %s", child.Type, node.Type),
+				})
+			}
+			check(child, childPath)
+		}
+	}
+	if d.Doc.Type != "doc" {
+		errs = append(errs, &SchemaError{Path: "doc", Message: fmt.Sprintf("root node has type %q, not doc", d.Doc.Type)})
+	}
+	check(d.Doc, nil)
+	return errs
+}
+
+func containsType(types []string, nodeType string) bool {
+	for _, t := range types {
+		if t == nodeType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package boxnote
+
+// Action tells Walk how to proceed after a Visitor's Enter hook.
+type Action int
+
+const (
+	// Continue visits the node's children.
+	Continue Action = iota
+	// SkipChildren leaves the node's children unvisited.
+	SkipChildren
+	// Remove deletes the node from its parent's content. Removing the
+	// root node is not possible and is treated as SkipChildren.
+	Remove
+)
+
+// Visitor holds the hooks Walk calls for each node. Either hook may be nil.
+//
+// Hooks receive a pointer into the document, so they may rewrite the node's
+// attrs, marks, text, or content in place. path holds the content indexes
+// leading from the root to the node, as in Warning.Path; it is only valid
+// for the duration of the call.
+type Visitor struct {
+	// Enter is called before the node's children are visited.
+	Enter func(node *Node, path []int) Action
+	// Leave is called after the node's children have been visited. It is
+	// not called for removed nodes.
+	Leave func(node *Node, path []int)
+}
+
+// Walk traverses doc depth-first in document order.
+func Walk(doc *Document, v Visitor) {
+	walkNode(&doc.Doc, nil, v)
+}
+
+func walkNode(node *Node, path []int, v Visitor) Action {
+	action := Continue
+	if v.Enter != nil {
+		action = v.Enter(node, path)
+	}
+	if action == Remove && len(path) > 0 {
+		return Remove
+	}
+	if action == Continue {
+		kept := node.Content[:0]
+		for i := range node.Content {
+			child := node.Content[i]
+			if walkNode(&child, append(path, len(kept)), v) != Remove {
+				kept = append(kept, child)
+			}
+		}
+		node.Content = kept
+	}
+	if v.Leave != nil {
+		v.Leave(node, path)
+	}
+	return Continue
+}
+
+// FormatPath formats a node path as reported in Warning.Path, e.g.
+// doc.content[1].content[0].
+func FormatPath(path []int) string {
+	return formatNodePath(path)
+}
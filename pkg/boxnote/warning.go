@@ -0,0 +1,131 @@
+package boxnote
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Warning describes content that could not be converted faithfully. Path
+// locates the node in the document, e.g. doc.content[12].content[0].
+type Warning struct {
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+	Path    string `json:"path"`
+	// NodeType is the type of the node at Path.
+	NodeType string `json:"node_type,omitempty"`
+	// MarkType is the type of the mark an unknown_mark warning is about.
+	MarkType string `json:"mark_type,omitempty"`
+	Excerpt  string `json:"excerpt,omitempty"`
+}
+
+// UnknownType counts the occurrences of one node or mark type that the
+// converter did not recognize.
+type UnknownType struct {
+	// Kind is WarningUnknownNode or WarningUnknownMark.
+	Kind  string `json:"kind"`
+	Type  string `json:"type"`
+	Count int    `json:"count"`
+	// FirstPath locates the first occurrence.
+	FirstPath string `json:"first_path"`
+}
+
+// SummarizeUnknown groups the unknown_node and unknown_mark warnings by
+// type, in order of first occurrence.
+func SummarizeUnknown(warnings []Warning) []UnknownType {
+	var summary []UnknownType
+	index := map[[2]string]int{}
+	for _, warning := range warnings {
+		var typ string
+		switch warning.Kind {
+		case WarningUnknownNode:
+			typ = warning.NodeType
+		case WarningUnknownMark:
+			typ = warning.MarkType
+		default:
+			continue
+		}
+		key := [2]string{warning.Kind, typ}
+		if i, ok := index[key]; ok {
+			summary[i].Count++
+			continue
+		}
+		index[key] = len(summary)
+		summary = append(summary, UnknownType{Kind: warning.Kind, Type: typ, Count: 1, FirstPath: warning.Path})
+	}
+	return summary
+}
+
+// diagnostics collects warnings for one document during rendering.
+type diagnostics struct {
+	root Node
+	// first is the index of root's first child in the document. It is only
+	// non-zero while streaming, when root holds just the current block.
+	first    int
+	warnings []Warning
+}
+
+// node returns the node at path, for the details of a warning.
+func (d *diagnostics) node(path []int) Node {
+	if len(path) == 0 {
+		return d.root
+	}
+	shifted := append([]int{path[0] - d.first}, path[1:]...)
+	return nodeAtPath(d.root, shifted)
+}
+
+// Warning kinds.
+const (
+	WarningUnknownNode = "unknown_node"
+	WarningDroppedNode = "dropped_node"
+	WarningUnknownMark = "unknown_mark"
+	WarningInvalidAttr = "invalid_attr"
+	// WarningSanitized reports control characters or invalid UTF-8 removed
+	// from text.
+	WarningSanitized = "sanitized_text"
+)
+
+func formatNodePath(path []int) string {
+	var b strings.Builder
+	b.WriteString("doc")
+	for _, index := range path {
+		fmt.Fprintf(&b, ".content[%d]", index)
+	}
+	return b.String()
+}
+
+func nodeAtPath(root Node, path []int) Node {
+	node := root
+	for _, index := range path {
+		if index < 0 || index >= len(node.Content) {
+			return Node{}
+		}
+		node = node.Content[index]
+	}
+	return node
+}
+
+const excerptLength = 40
+
+// nodeExcerpt returns the leading text below node, whitespace collapsed and
+// truncated for display.
+func nodeExcerpt(node Node) string {
+	var b strings.Builder
+	var collect func(Node)
+	collect = func(n Node) {
+		if b.Len() > excerptLength*4 {
+			return
+		}
+		b.WriteString(n.Text)
+		for _, child := range n.Content {
+			b.WriteString(" ")
+			collect(child)
+		}
+	}
+	collect(node)
+	text := strings.Join(strings.Fields(b.String()), " ")
+	runes := []rune(text)
+	if len(runes) > excerptLength {
+		return string(runes[:excerptLength]) + "…"
+	}
+	return text
+}
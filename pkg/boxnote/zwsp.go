@@ -0,0 +1,32 @@
+package boxnote
+
+// ZeroWidthSpace selects how marked text that starts or ends with Japanese
+// punctuation such as 「 or 。 is kept formatted. CommonMark does not let
+// the ** of **「ボールド」** open after a letter or close before one, so
+// the text needs something in between.
+type ZeroWidthSpace string
+
+const (
+	// ZeroWidthSpaceChar pads the text inside the delimiters with U+200B
+	// (the default).
+	ZeroWidthSpaceChar ZeroWidthSpace = "char"
+	// ZeroWidthSpaceEntity puts the entity &#8203; outside the delimiters
+	// instead, so that the output holds no invisible characters.
+	ZeroWidthSpaceEntity ZeroWidthSpace = "entity"
+	// ZeroWidthSpaceHTML writes the marks of such text as <strong>, <em>,
+	// and <del> tags, which need no padding.
+	ZeroWidthSpaceHTML ZeroWidthSpace = "html"
+)
+
+const (
+	zeroWidthSpace       = "\u200B"
+	zeroWidthSpaceEntity = "&#8203;"
+)
+
+// WithZeroWidthSpace selects how marked text next to Japanese punctuation is
+// kept formatted.
+func WithZeroWidthSpace(mode ZeroWidthSpace) ConvertOption {
+	return func(c *config) {
+		c.zeroWidthSpace = mode
+	}
+}
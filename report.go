@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/dayflower/boxnote2md/pkg/boxnote"
+)
+
+const stdinName = "<stdin>"
+
+// conversionReport is the JSON document written by --report.
+type conversionReport struct {
+	Files []reportEntry `json:"files"`
+}
+
+type reportEntry struct {
+	Input    string            `json:"input"`
+	Output   string            `json:"output,omitempty"`
+	Status   string            `json:"status"`
+	Error    string            `json:"error,omitempty"`
+	Warnings []boxnote.Warning `json:"warnings"`
+	// Unknown summarizes the unknown node and mark types among Warnings.
+	Unknown     []boxnote.UnknownType `json:"unknown_types"`
+	InputBytes  int                   `json:"input_bytes"`
+	OutputBytes int                   `json:"output_bytes"`
+	DurationMS  float64               `json:"duration_ms"`
+}
+
+const (
+	reportStatusOK      = "ok"
+	reportStatusWarning = "warning"
+	reportStatusSkipped = "skipped"
+	reportStatusError   = "error"
+)
+
+func (r *conversionReport) add(input string, result fileResult, err error, elapsed time.Duration) {
+	if r == nil {
+		return
+	}
+	entry := reportEntry{
+		Input:       input,
+		Output:      result.OutputPath,
+		Status:      reportStatusOK,
+		Warnings:    result.Warnings,
+		InputBytes:  result.InputBytes,
+		OutputBytes: result.OutputBytes,
+		DurationMS:  float64(elapsed.Microseconds()) / 1000,
+	}
+	if entry.Warnings == nil {
+		entry.Warnings = []boxnote.Warning{}
+	}
+	entry.Unknown = boxnote.SummarizeUnknown(entry.Warnings)
+	if entry.Unknown == nil {
+		entry.Unknown = []boxnote.UnknownType{}
+	}
+	switch {
+	case err != nil:
+		entry.Status = reportStatusError
+		entry.Error = err.Error()
+	case result.Skipped:
+		entry.Status = reportStatusSkipped
+	case len(result.Warnings) > 0:
+		entry.Status = reportStatusWarning
+	}
+	r.Files = append(r.Files, entry)
+}
+
+func writeReport(path string, report *conversionReport) {
+	if report == nil {
+		return
+	}
+	data, err := marshalJSON(report)
+	if err != nil {
+		fatal(exitFailure, "failed to encode report", err)
+	}
+	if err := writeFileAtomic(path, data, 0644, false); err != nil {
+		fatal(exitIO, fmt.Sprintf("failed to write report %s", path), err)
+	}
+}
+
+// marshalJSON encodes v indented, leaving characters such as < unescaped.
+func marshalJSON(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
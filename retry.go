@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Backoff between retries: the delay doubles from retryBaseDelay up to
+// retryMaxDelay, and a random part of it is waited, so that the workers of
+// a batch do not retry in step.
+const (
+	retryBaseDelay = 500 * time.Millisecond
+	retryMaxDelay  = 30 * time.Second
+	// maxRetryAfter bounds the wait a Retry-After header can ask for.
+	maxRetryAfter = 10 * time.Minute
+)
+
+// requestPacer spaces the requests sent through it to at most rate a
+// second, for --rate.
+type requestPacer struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func newRequestPacer(rate float64) *requestPacer {
+	if rate <= 0 {
+		return nil
+	}
+	return &requestPacer{interval: time.Duration(float64(time.Second) / rate)}
+}
+
+// wait blocks until the next request may be sent.
+func (p *requestPacer) wait(ctx context.Context) error {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	now := time.Now()
+	at := p.next
+	if at.Before(now) {
+		at = now
+	}
+	p.next = at.Add(p.interval)
+	p.mu.Unlock()
+	return sleepContext(ctx, time.Until(at))
+}
+
+// pause holds back every request for d, after the server asked for it.
+func (p *requestPacer) pause(d time.Duration) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	if until := time.Now().Add(d); p.next.Before(until) {
+		p.next = until
+	}
+	p.mu.Unlock()
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// retryableStatus reports whether a response with status is worth sending
+// the request again for.
+func retryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status == http.StatusRequestTimeout || status >= 500
+}
+
+// retryDelay returns how long to wait before retry number attempt (from 0).
+// Retry-After, in seconds or as a date, is obeyed when the response has it.
+func retryDelay(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if after, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+			return after
+		}
+	}
+	delay := retryBaseDelay << uint(attempt)
+	if delay <= 0 || delay > retryMaxDelay {
+		delay = retryMaxDelay
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	var after time.Duration
+	if seconds, err := strconv.Atoi(value); err == nil {
+		after = time.Duration(seconds) * time.Second
+	} else if at, err := http.ParseTime(value); err == nil {
+		after = at.Sub(now)
+	} else {
+		return 0, false
+	}
+	if after < 0 {
+		after = 0
+	}
+	if after > maxRetryAfter {
+		after = maxRetryAfter
+	}
+	return after, true
+}
+
+// sendWithRetry sends the request newRequest makes with client, and reads
+// the body of the response, up to limit bytes when limit > 0. Failures to
+// connect or read, 429 Too Many Requests, and server errors are retried up
+// to retries times with backoff; other responses are returned as they are,
+// with their body closed.
+func sendWithRetry(ctx context.Context, client *http.Client, pacer *requestPacer, retries int, limit int64, newRequest func() (*http.Request, error)) (*http.Response, []byte, error) {
+	for attempt := 0; ; attempt++ {
+		if err := pacer.wait(ctx); err != nil {
+			return nil, nil, err
+		}
+		req, err := newRequest()
+		if err != nil {
+			return nil, nil, err
+		}
+		resp, err := client.Do(req)
+		var body []byte
+		if err == nil {
+			var reader io.Reader = resp.Body
+			if limit > 0 {
+				reader = io.LimitReader(resp.Body, limit)
+			}
+			body, err = io.ReadAll(reader)
+			resp.Body.Close()
+		}
+		switch {
+		case err != nil:
+			if ctx.Err() != nil || attempt >= retries {
+				return nil, nil, err
+			}
+			resp = nil
+		case !retryableStatus(resp.StatusCode) || attempt >= retries:
+			return resp, body, nil
+		}
+		delay := retryDelay(attempt, resp)
+		if resp != nil && resp.StatusCode == http.StatusTooManyRequests {
+			// The limit is shared by every request of the run.
+			pacer.pause(delay)
+		}
+		if err := sleepContext(ctx, delay); err != nil {
+			return nil, nil, fmt.Errorf("gave up retrying %s: %w", req.URL.Redacted(), err)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dayflower/boxnote2md/pkg/boxnote"
+)
+
+// reverseConflict returns the first flag given that only applies to
+// Markdown outputs.
+func reverseConflict(opts options) string {
+	switch {
+	case opts.stream:
+		return "--stream"
+	case opts.interactive:
+		return "--interactive"
+	case opts.skipUnchanged:
+		return "--skip-unchanged"
+	case opts.marker:
+		return "--marker"
+	case opts.sidecar:
+		return "--sidecar"
+	}
+	return ""
+}
+
+// runReverse turns Markdown back into Box Notes. Each file argument is
+// written next to it, or into --out-dir, with its extension replaced by
+// .boxnote; Markdown on stdin is written to stdout.
+func runReverse(opts *options, args []string) int {
+	if flag := reverseConflict(*opts); flag != "" {
+		fmt.Fprintf(os.Stderr, "--reverse cannot be combined with %s\n", flag)
+		return exitUsage
+	}
+	if len(args) == 0 {
+		input, err := io.ReadAll(stdinReader)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to read stdin: %v\n", err)
+			return exitIO
+		}
+		output, err := boxnote.FromMarkdown(input).Encode()
+		if err != nil {
+			reportError(stdinName, err)
+			return exitFailure
+		}
+		if _, err := os.Stdout.Write(output); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write stdout: %v\n", err)
+			return exitIO
+		}
+		return exitOK
+	}
+
+	opts.commit = newMigrationCommit(*opts)
+	exitCode := exitOK
+	for _, input := range collectFiles(args, opts.recursive, ".md") {
+		if err := reverseFile(input, *opts); err != nil {
+			reportError(input.Path, err)
+			if exitCode == exitOK {
+				exitCode = exitCodeFor(err)
+			}
+			continue
+		}
+		reportOK(input.Path)
+	}
+	return commitOutputs(opts, exitCode)
+}
+
+func reverseFile(input inputFile, opts options) error {
+	markdown, err := os.ReadFile(input.Path)
+	if err != nil {
+		return &exitError{code: exitIO, err: err}
+	}
+	output, err := boxnote.FromMarkdown(markdown).Encode()
+	if err != nil {
+		return err
+	}
+	outputPath := placeInput(input, opts.outDir)
+	outputPath = strings.TrimSuffix(outputPath, filepath.Ext(outputPath)) + ".boxnote"
+	if err := prepareOverwrite(outputPath, opts); err != nil {
+		return err
+	}
+	if err := writeOutput(outputPath, string(output), "", opts); err != nil {
+		return err
+	}
+	opts.commit.addOutput(outputPath, input.Path, "")
+	return nil
+}
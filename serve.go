@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dayflower/boxnote2md/pkg/boxnote"
+)
+
+// serveOptions lists the flags a convert request may set in its options.
+// They shape the Markdown of one note; the flags that name files are only
+// taken from the command line, as are --embed-images, which would let a
+// client make the server fetch any URL, --timeout, which bounds the work a
+// client can ask for, and --footer-template, whose template could run
+// without that bound.
+var serveOptions = []string{
+	"strict", "validate", "locale",
+	"eol", "flavor", "bullet", "escape", "hard-break", "heading-ids", "keep-unknown",
+	"table-mode", "headerless-tables", "lists", "callouts", "alignment", "indent", "tasks", "task-done-dates", "toc",
+	"shift-headings", "zwsp", "emoji", "html", "html-blocks", "keep-empty-paragraphs", "join-cjk-lines", "ideographic-space-entities",
+	"title-from", "title-mode", "title", "front-matter", "front-matter-fields", "date", "contributors",
+	"footer", "section", "from", "to", "strip-hashtags",
+}
+
+// JSON-RPC 2.0 error codes used by the server.
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	// rpcConversionFailed is returned for notes that cannot be converted.
+	rpcConversionFailed = -32000
+)
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// convertParams are the params of a convert request. Document is the Box
+// Note, as a JSON object or as a string holding it.
+type convertParams struct {
+	Document json.RawMessage        `json:"document"`
+	Options  map[string]interface{} `json:"options"`
+}
+
+type convertResult struct {
+	Markdown string            `json:"markdown"`
+	Warnings []boxnote.Warning `json:"warnings"`
+}
+
+// runServe answers conversion requests on stdin until it ends, or over
+// HTTP until interrupted, keeping one process warm for editors and other
+// tools.
+func runServe(ctx context.Context, opts *options, args []string) int {
+	if len(args) != 0 || opts.serveStdio == (opts.serveHTTP != "") {
+		fmt.Fprintf(os.Stderr, "usage: %s serve (--stdio|--http <addr>) [flags]\n", programName)
+		return exitUsage
+	}
+	if opts.serveMaxBody <= 0 {
+		fmt.Fprintln(os.Stderr, "--max-body must be positive")
+		return exitUsage
+	}
+	// The authors are loaded whether or not --contributors is given, since
+	// a request may ask for them.
+	authors, err := loadAuthorDirectory(opts.authorsMap, nil)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitIO
+	}
+	opts.authors = authors
+	if opts.serveStdio {
+		err = serveStdio(ctx, stdinReader, os.Stdout, *opts)
+	} else {
+		err = serveHTTP(ctx, opts.serveHTTP, *opts)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitIO
+	}
+	return exitOK
+}
+
+// serveStdio reads one JSON-RPC request per line from r and writes one
+// response per line to w, in order. Notifications, which have no id, get no
+// response.
+func serveStdio(ctx context.Context, r *bufio.Reader, w io.Writer, opts options) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			response, ok := handleRequest(ctx, line, opts)
+			if ok {
+				if err := encoder.Encode(response); err != nil {
+					return fmt.Errorf("failed to write response: %w", err)
+				}
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read request: %w", err)
+		}
+	}
+}
+
+// handleRequest answers one request line. It reports false for a
+// notification.
+func handleRequest(ctx context.Context, line []byte, opts options) (rpcResponse, bool) {
+	response := rpcResponse{JSONRPC: "2.0", ID: json.RawMessage("null")}
+	var req rpcRequest
+	if err := json.Unmarshal(line, &req); err != nil {
+		response.Error = &rpcError{Code: rpcParseError, Message: err.Error()}
+		return response, true
+	}
+	if len(req.ID) > 0 {
+		response.ID = req.ID
+	}
+	switch {
+	case req.Method == "":
+		response.Error = &rpcError{Code: rpcInvalidRequest, Message: "missing method"}
+	case req.Method == "convert":
+		response.Result, response.Error = serveConvert(ctx, req.Params, opts)
+	default:
+		response.Error = &rpcError{Code: rpcMethodNotFound, Message: fmt.Sprintf("unknown method %q", req.Method)}
+	}
+	return response, len(req.ID) > 0
+}
+
+func serveConvert(ctx context.Context, raw json.RawMessage, opts options) (interface{}, *rpcError) {
+	var params convertParams
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &params); err != nil {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: err.Error()}
+		}
+	}
+	input := []byte(params.Document)
+	var text string
+	if json.Unmarshal(params.Document, &text) == nil {
+		input = []byte(text)
+	}
+	if len(bytes.TrimSpace(input)) == 0 {
+		return nil, &rpcError{Code: rpcInvalidParams, Message: "missing document"}
+	}
+	if err := applyRequestOptions(&opts, params.Options); err != nil {
+		return nil, &rpcError{Code: rpcInvalidParams, Message: err.Error()}
+	}
+	markdown, warnings, err := convertDocument(ctx, input, opts)
+	if warnings == nil {
+		warnings = []boxnote.Warning{}
+	}
+	if err != nil {
+		return nil, &rpcError{Code: rpcConversionFailed, Message: err.Error(), Data: map[string]interface{}{
+			"exit_code": exitCodeFor(err),
+			"warnings":  warnings,
+		}}
+	}
+	return convertResult{Markdown: markdown, Warnings: warnings}, nil
+}
+
+// convertDocument renders a note received whole as processStdin does, with
+// its failures as errors rather than diagnostics.
+func convertDocument(ctx context.Context, input []byte, opts options) (string, []boxnote.Warning, error) {
+	ctx, cancel := withTimeout(ctx, opts.timeout)
+	defer cancel()
+	meta := noteMeta{title: opts.title}
+	output, warnings, err := renderNote(ctx, input, &meta, opts)
+	if err != nil {
+		return "", warnings, renderFailure(err)
+	}
+	if opts.strict && len(warnings) > 0 {
+		return "", warnings, &exitError{code: exitWarnings, err: fmt.Errorf("%d conversion warning(s)", len(warnings))}
+	}
+	return finishOutput(prependFrontMatter(output, meta, opts), opts.eol), warnings, nil
+}
+
+// applyRequestOptions sets the serveOptions named in options as if they
+// were given as flags. Values may be strings, numbers, booleans, or, for
+// lists, arrays of strings.
+func applyRequestOptions(opts *options, options map[string]interface{}) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	defineGlobalFlags(fs, opts)
+	defineOutputFlags(fs, opts)
+	names := make([]string, 0, len(options))
+	for name := range options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !containsString(serveOptions, name) {
+			return fmt.Errorf("unsupported option %q", name)
+		}
+		value, err := optionString(options[name])
+		if err != nil {
+			return fmt.Errorf("option %q: %v", name, err)
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("option %q: %v", name, err)
+		}
+	}
+	return nil
+}
+
+func optionString(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return "", fmt.Errorf("want an array of strings")
+			}
+			items[i] = s
+		}
+		return strings.Join(items, ","), nil
+	}
+	return "", fmt.Errorf("want a string, number, boolean, or array of strings")
+}
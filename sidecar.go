@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/dayflower/boxnote2md/pkg/boxnote"
+)
+
+const sidecarSuffix = ".meta.json"
+
+// sidecar is the note.md.meta.json written with --sidecar. It keeps what
+// the Markdown cannot carry.
+type sidecar struct {
+	Source       string                 `json:"source"`
+	SourceSHA256 string                 `json:"source_sha256"`
+	Attrs        map[string]interface{} `json:"attrs"`
+	NodeAttrs    []sidecarNode          `json:"node_attrs"`
+	AuthorIDs    []string               `json:"author_ids"`
+	DroppedTypes []string               `json:"dropped_node_types"`
+}
+
+type sidecarNode struct {
+	Path  string                 `json:"path"`
+	Type  string                 `json:"type"`
+	Attrs map[string]interface{} `json:"attrs"`
+}
+
+// newSidecar records the attrs and authors of doc as parsed, before any
+// changes made for rendering.
+func newSidecar(doc *boxnote.Document) *sidecar {
+	s := &sidecar{
+		Attrs:        doc.Doc.Attrs,
+		NodeAttrs:    []sidecarNode{},
+		AuthorIDs:    doc.AuthorIDs(),
+		DroppedTypes: []string{},
+	}
+	if s.Attrs == nil {
+		s.Attrs = map[string]interface{}{}
+	}
+	if s.AuthorIDs == nil {
+		s.AuthorIDs = []string{}
+	}
+	boxnote.Walk(doc, boxnote.Visitor{
+		Enter: func(node *boxnote.Node, path []int) boxnote.Action {
+			if len(path) > 0 && len(node.Attrs) > 0 {
+				s.NodeAttrs = append(s.NodeAttrs, sidecarNode{
+					Path:  boxnote.FormatPath(path),
+					Type:  node.Type,
+					Attrs: node.Attrs,
+				})
+			}
+			return boxnote.Continue
+		},
+	})
+	return s
+}
+
+// addDropped records the node types that warnings report as not converted.
+func (s *sidecar) addDropped(warnings []boxnote.Warning) {
+	for _, warning := range warnings {
+		if warning.Kind != boxnote.WarningUnknownNode && warning.Kind != boxnote.WarningDroppedNode {
+			continue
+		}
+		if warning.NodeType == "" || containsString(s.DroppedTypes, warning.NodeType) {
+			continue
+		}
+		s.DroppedTypes = append(s.DroppedTypes, warning.NodeType)
+	}
+}
+
+func writeSidecar(outputPath string, s *sidecar, opts options) error {
+	data, err := marshalJSON(s)
+	if err != nil {
+		return err
+	}
+	if opts.store != nil {
+		return writeStored(outputPath+sidecarSuffix, data, opts)
+	}
+	if err := writeFileAtomic(outputPath+sidecarSuffix, data, 0644, opts.fsync); err != nil {
+		return &exitError{code: exitIO, err: fmt.Errorf("failed to write sidecar: %w", err)}
+	}
+	opts.commit.add(outputPath + sidecarSuffix)
+	return nil
+}
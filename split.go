@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/dayflower/boxnote2md/pkg/boxnote"
+)
+
+const (
+	splitNone = "none"
+	splitH1   = "h1"
+	splitH2   = "h2"
+	splitH3   = "h3"
+)
+
+var splitChoices = []string{splitNone, splitH1, splitH2, splitH3}
+
+// splitPart is the output of a section cut out by --split-by, written
+// along with the index.
+type splitPart struct {
+	path   string
+	output string
+}
+
+// renderSplit converts the note in input for --split-by: every section
+// under a top-level heading of the chosen level or above is rendered as a
+// note of its own, in a folder named after the output at meta.outputPath,
+// and the returned index holds the blocks before the first of them and a
+// list linking to them.
+func renderSplit(ctx context.Context, input []byte, meta *noteMeta, opts options) (string, []splitPart, []boxnote.Warning, error) {
+	doc, err := parseNote(input, opts)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	level, _ := strconv.Atoi(strings.TrimPrefix(opts.splitBy, "h"))
+	sections := doc.Split(level)
+	dir := strings.TrimSuffix(meta.outputPath, filepath.Ext(meta.outputPath))
+
+	var warnings []boxnote.Warning
+	var parts []splitPart
+	var links []boxnote.Node
+	used := map[string]bool{}
+	for i, section := range sections[1:] {
+		base := slugify(section.Title, opts.slug)
+		if base == "" {
+			base = "section"
+		}
+		name := base
+		for n := 2; used[name]; n++ {
+			name = base + "-" + strconv.Itoa(n)
+		}
+		used[name] = true
+		partMeta := *meta
+		partMeta.title = section.Title
+		partMeta.outputPath = filepath.Join(dir, name+".md")
+		partMeta.sidecar = nil
+		partOpts := opts
+		// The heading of the section stands in for the title, as an H1.
+		partOpts.titleFrom = titleFromFirstHeading
+		partOpts.markdown.shift = headingShift{levels: 1 - section.Level}
+		partOpts.sidecar = false
+		output, partWarnings, err := renderDocument(ctx, section.Document, &partMeta, partOpts)
+		warnings = append(warnings, partWarnings...)
+		if err != nil {
+			return "", nil, warnings, fmt.Errorf("section %d (%s): %w", i+1, section.Title, err)
+		}
+		parts = append(parts, splitPart{path: partMeta.outputPath, output: prependFrontMatter(output, partMeta, partOpts)})
+		links = append(links, linkItem(section.Title, relativeLink(meta.outputPath, partMeta.outputPath)))
+	}
+
+	index := sections[0].Document
+	if len(links) > 0 {
+		index.Doc.Content = append(index.Doc.Content[:len(index.Doc.Content):len(index.Doc.Content)],
+			boxnote.Node{Type: "bullet_list", Content: links})
+	}
+	indexOpts := opts
+	indexOpts.sidecar = false
+	output, indexWarnings, err := renderDocument(ctx, index, meta, indexOpts)
+	warnings = append(indexWarnings, warnings...)
+	if err != nil {
+		return "", nil, warnings, err
+	}
+	if opts.sidecar {
+		meta.sidecar = newSidecar(doc)
+		meta.sidecar.addDropped(warnings)
+	}
+	return output, parts, warnings, nil
+}
+
+// writeSplitParts writes the sections of a note converted from sourcePath
+// with --split-by.
+func writeSplitParts(parts []splitPart, sourcePath, digest string, opts options) error {
+	for _, part := range parts {
+		if err := prepareOverwrite(part.path, opts); err != nil {
+			return err
+		}
+		if err := writeOutput(part.path, finishOutput(part.output, opts.eol), digest, opts); err != nil {
+			return err
+		}
+		opts.commit.addOutput(part.path, sourcePath, digest)
+	}
+	return nil
+}
+
+// linkItem returns a list item linking text to href.
+func linkItem(text, href string) boxnote.Node {
+	link := boxnote.Node{Type: "text", Text: text, Marks: []boxnote.Mark{{Type: "link", Attrs: map[string]interface{}{"href": href}}}}
+	return boxnote.Node{Type: "list_item", Content: []boxnote.Node{{Type: "paragraph", Content: []boxnote.Node{link}}}}
+}
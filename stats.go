@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/dayflower/boxnote2md/pkg/boxnote"
+)
+
+// noteStats aggregates the content of a set of notes, for estimating a
+// migration. It is printed by the stats command, or encoded with --json.
+type noteStats struct {
+	Notes  int `json:"notes"`
+	Failed int `json:"failed"`
+	Words  int `json:"words"`
+	// MaxDepth is the deepest node nesting, the doc node being depth 0.
+	MaxDepth int            `json:"max_depth"`
+	Nodes    map[string]int `json:"node_types"`
+	Marks    map[string]int `json:"mark_types"`
+	Tables   tableStats     `json:"tables"`
+	// Unsupported counts the node and mark types the converter does not
+	// recognize, keyed "node:type" or "mark:type".
+	Unsupported map[string]int `json:"unsupported"`
+}
+
+type tableStats struct {
+	Count      int `json:"count"`
+	MaxRows    int `json:"max_rows"`
+	MaxColumns int `json:"max_columns"`
+	// Sizes counts the tables by "rows x columns".
+	Sizes map[string]int `json:"sizes"`
+}
+
+func newNoteStats() *noteStats {
+	return &noteStats{
+		Nodes:       map[string]int{},
+		Marks:       map[string]int{},
+		Tables:      tableStats{Sizes: map[string]int{}},
+		Unsupported: map[string]int{},
+	}
+}
+
+// addInput counts the note read from source. An empty input is an empty
+// note.
+func (s *noteStats) addInput(ctx context.Context, source string, input []byte) int {
+	if len(strings.TrimSpace(string(input))) == 0 {
+		s.Notes++
+		return exitOK
+	}
+	doc, err := boxnote.Parse(input)
+	if err == nil {
+		err = s.add(ctx, doc)
+	}
+	if err != nil {
+		reportError(source, err)
+		s.Failed++
+		return exitParse
+	}
+	return exitOK
+}
+
+// add counts the content of doc.
+func (s *noteStats) add(ctx context.Context, doc *boxnote.Document) error {
+	boxnote.Walk(doc, boxnote.Visitor{
+		Enter: func(node *boxnote.Node, path []int) boxnote.Action {
+			s.Nodes[node.Type]++
+			for _, mark := range node.Marks {
+				s.Marks[mark.Type]++
+			}
+			if len(path) > s.MaxDepth {
+				s.MaxDepth = len(path)
+			}
+			if node.Type == "table" {
+				s.addTable(*node)
+			}
+			return boxnote.Continue
+		},
+	})
+	// Rendering tells which types the converter would drop or pass over.
+	s.Words += countText(doc).Words
+	_, warnings, err := doc.MarkdownContext(ctx)
+	if err != nil {
+		return err
+	}
+	s.Notes++
+	for _, unknown := range boxnote.SummarizeUnknown(warnings) {
+		kind := "node"
+		if unknown.Kind == boxnote.WarningUnknownMark {
+			kind = "mark"
+		}
+		s.Unsupported[kind+":"+unknown.Type] += unknown.Count
+	}
+	return nil
+}
+
+func (s *noteStats) addTable(table boxnote.Node) {
+	rows, columns := len(table.Content), 0
+	for _, row := range table.Content {
+		if len(row.Content) > columns {
+			columns = len(row.Content)
+		}
+	}
+	s.Tables.Count++
+	s.Tables.Sizes[fmt.Sprintf("%dx%d", rows, columns)]++
+	if rows > s.Tables.MaxRows {
+		s.Tables.MaxRows = rows
+	}
+	if columns > s.Tables.MaxColumns {
+		s.Tables.MaxColumns = columns
+	}
+}
+
+// hasTextChild reports whether node directly holds text, so that its words
+// are counted once, across the text runs it is split into.
+func hasTextChild(node boxnote.Node) bool {
+	for _, child := range node.Content {
+		if child.Type == "text" {
+			return true
+		}
+	}
+	return false
+}
+
+func runStats(ctx context.Context, opts *options, args []string) int {
+	stats := newNoteStats()
+	exitCode := exitOK
+	if len(args) == 0 {
+		input, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to read stdin: %v\n", err)
+			return exitIO
+		}
+		exitCode = stats.addInput(ctx, stdinName, input)
+	}
+	for _, input := range collectInputs(args, opts.recursive) {
+		code := exitOK
+		data, err := os.ReadFile(input.Path)
+		if err != nil {
+			reportError(input.Path, fmt.Errorf("failed to read: %w", err))
+			stats.Failed++
+			code = exitIO
+		} else {
+			code = stats.addInput(ctx, input.Path, data)
+		}
+		if exitCode == exitOK {
+			exitCode = code
+		}
+	}
+	if opts.statsJSON {
+		data, err := marshalJSON(stats)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to encode stats: %v\n", err)
+			return exitFailure
+		}
+		os.Stdout.Write(data)
+		return exitCode
+	}
+	writeStats(os.Stdout, stats, opts.locale)
+	return exitCode
+}
+
+func writeStats(w io.Writer, s *noteStats, loc locale) {
+	n := func(v int) string { return loc.formatNumber(int64(v)) }
+	fmt.Fprintf(w, "Notes:      %s", n(s.Notes))
+	if s.Failed > 0 {
+		fmt.Fprintf(w, " (%s failed)", n(s.Failed))
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "Words:      %s\n", n(s.Words))
+	fmt.Fprintf(w, "Max depth:  %s\n", n(s.MaxDepth))
+	fmt.Fprintf(w, "Tables:     %s", n(s.Tables.Count))
+	if s.Tables.Count > 0 {
+		fmt.Fprintf(w, " (up to %s rows, %s columns)", n(s.Tables.MaxRows), n(s.Tables.MaxColumns))
+	}
+	fmt.Fprintln(w)
+	writeCounts(w, "Table sizes", s.Tables.Sizes, loc)
+	writeCounts(w, "Node types", s.Nodes, loc)
+	writeCounts(w, "Mark types", s.Marks, loc)
+	writeCounts(w, "Unsupported", s.Unsupported, loc)
+}
+
+// writeCounts prints counts under title, most frequent first.
+func writeCounts(w io.Writer, title string, counts map[string]int, loc locale) {
+	if len(counts) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(counts))
+	width := 0
+	for key := range counts {
+		keys = append(keys, key)
+		if len(key) > width {
+			width = len(key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	fmt.Fprintf(w, "\n%s:\n", title)
+	for _, key := range keys {
+		fmt.Fprintf(w, "  %-*s  %s\n", width, key, loc.formatNumber(int64(counts[key])))
+	}
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/dayflower/boxnote2md/pkg/boxnote"
+)
+
+// storageRenderer writes a Box Note in Confluence storage format, the XHTML
+// that Confluence keeps pages in.
+type storageRenderer struct {
+	b strings.Builder
+	// rewrite maps link hrefs before they are written; may be nil.
+	rewrite func(href string) string
+	// pageTitle returns the title of the published page that a link, after
+	// rewrite, points at; may be nil.
+	pageTitle func(href string) (string, bool)
+	// attachments collects the images embedded as data URIs, which are
+	// uploaded to the page and referenced by file name.
+	attachments []storageAttachment
+}
+
+type storageAttachment struct {
+	name      string
+	mediaType string
+	data      []byte
+}
+
+// confluenceMacros maps callout types to the Confluence panel macro closest
+// in meaning. Other types give an info panel.
+var confluenceMacros = map[string]string{
+	"tip":       "tip",
+	"success":   "tip",
+	"important": "note",
+	"warning":   "note",
+	"danger":    "warning",
+	"failure":   "warning",
+	"bug":       "warning",
+}
+
+// storageFormat renders doc. Images embedded as data URIs that cannot be
+// decoded are an error.
+func (r *storageRenderer) storageFormat(doc *boxnote.Document) (string, error) {
+	if err := r.blocks(doc.Doc.Content); err != nil {
+		return "", err
+	}
+	return r.b.String(), nil
+}
+
+func (r *storageRenderer) blocks(nodes []boxnote.Node) error {
+	for _, node := range nodes {
+		if err := r.block(node); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *storageRenderer) block(node boxnote.Node) error {
+	switch node.Type {
+	case "paragraph":
+		r.b.WriteString("<p>")
+		if err := r.inline(node.Content); err != nil {
+			return err
+		}
+		r.b.WriteString("</p>")
+	case "heading":
+		level, _ := node.Attrs["level"].(float64)
+		if level < 1 || level > 6 {
+			level = 1
+		}
+		fmt.Fprintf(&r.b, "<h%d>", int(level))
+		if err := r.inline(node.Content); err != nil {
+			return err
+		}
+		fmt.Fprintf(&r.b, "</h%d>", int(level))
+	case "bullet_list", "ordered_list":
+		tag := "ul"
+		if node.Type == "ordered_list" {
+			tag = "ol"
+		}
+		r.b.WriteString("<" + tag + ">")
+		open := false
+		for _, item := range node.Content {
+			// Box Notes put a sub-list next to the item it belongs to.
+			if isList(item) {
+				if !open {
+					r.b.WriteString("<li>")
+					open = true
+				}
+				if err := r.block(item); err != nil {
+					return err
+				}
+				continue
+			}
+			if open {
+				r.b.WriteString("</li>")
+			}
+			r.b.WriteString("<li>")
+			open = true
+			if err := r.blocks(item.Content); err != nil {
+				return err
+			}
+		}
+		if open {
+			r.b.WriteString("</li>")
+		}
+		r.b.WriteString("</" + tag + ">")
+	case "check_list":
+		return r.taskList(node)
+	case "blockquote":
+		r.b.WriteString("<blockquote>")
+		if err := r.blocks(node.Content); err != nil {
+			return err
+		}
+		r.b.WriteString("</blockquote>")
+	case "call_out_box":
+		macro, ok := confluenceMacros[boxnote.CalloutType(node)]
+		if !ok {
+			macro = "info"
+		}
+		fmt.Fprintf(&r.b, `<ac:structured-macro ac:name="%s"><ac:rich-text-body>`, macro)
+		if err := r.blocks(node.Content); err != nil {
+			return err
+		}
+		r.b.WriteString("</ac:rich-text-body></ac:structured-macro>")
+	case "horizontal_rule":
+		r.b.WriteString("<hr />")
+	case "table":
+		return r.table(node)
+	case "image":
+		r.b.WriteString("<p>")
+		err := r.image(node)
+		r.b.WriteString("</p>")
+		return err
+	default:
+		// Unknown nodes are rendered as their children, as in Markdown.
+		return r.blocks(node.Content)
+	}
+	return nil
+}
+
+// taskList writes a check list as a Confluence task list. The paragraphs of
+// an item form its body; nested lists, and the sub-lists that follow the
+// item, come after them.
+func (r *storageRenderer) taskList(node boxnote.Node) error {
+	r.b.WriteString("<ac:task-list>")
+	open := false
+	for _, item := range node.Content {
+		if isList(item) {
+			if !open {
+				r.b.WriteString("<ac:task><ac:task-status>incomplete</ac:task-status><ac:task-body>")
+				open = true
+			}
+			if err := r.block(item); err != nil {
+				return err
+			}
+			continue
+		}
+		if open {
+			r.b.WriteString("</ac:task-body></ac:task>")
+		}
+		open = true
+		status := "incomplete"
+		if checked, _ := item.Attrs["checked"].(bool); checked {
+			status = "complete"
+		}
+		fmt.Fprintf(&r.b, "<ac:task><ac:task-status>%s</ac:task-status><ac:task-body>", status)
+		for i, child := range item.Content {
+			if child.Type != "paragraph" {
+				if err := r.block(child); err != nil {
+					return err
+				}
+				continue
+			}
+			if i > 0 {
+				r.b.WriteString("<br />")
+			}
+			if err := r.inline(child.Content); err != nil {
+				return err
+			}
+		}
+	}
+	if open {
+		r.b.WriteString("</ac:task-body></ac:task>")
+	}
+	r.b.WriteString("</ac:task-list>")
+	return nil
+}
+
+// isList reports whether node is a list, which may stand in a list as the
+// sub-list of the item before it.
+func isList(node boxnote.Node) bool {
+	switch node.Type {
+	case "bullet_list", "ordered_list", "check_list":
+		return true
+	}
+	return false
+}
+
+func (r *storageRenderer) table(node boxnote.Node) error {
+	r.b.WriteString("<table><tbody>")
+	for _, row := range node.Content {
+		r.b.WriteString("<tr>")
+		for _, cell := range row.Content {
+			tag := "td"
+			if cell.Type == "table_header" {
+				tag = "th"
+			}
+			r.b.WriteString("<" + tag)
+			for _, attr := range []string{"colspan", "rowspan"} {
+				if span, ok := cell.Attrs[attr].(float64); ok && span > 1 {
+					fmt.Fprintf(&r.b, ` %s="%d"`, attr, int(span))
+				}
+			}
+			r.b.WriteString(">")
+			if err := r.blocks(cell.Content); err != nil {
+				return err
+			}
+			r.b.WriteString("</" + tag + ">")
+		}
+		r.b.WriteString("</tr>")
+	}
+	r.b.WriteString("</tbody></table>")
+	return nil
+}
+
+func (r *storageRenderer) image(node boxnote.Node) error {
+	src, _ := node.Attrs["src"].(string)
+	alt, _ := node.Attrs["alt"].(string)
+	if src == "" {
+		return nil
+	}
+	// The data URI is decoded before anything is written, so that a bad one
+	// leaves no open tag behind.
+	resource := fmt.Sprintf(`<ri:url ri:value="%s" />`, html.EscapeString(src))
+	if strings.HasPrefix(src, "data:") {
+		data, mediaType, err := decodeDataURI(src)
+		if err != nil {
+			return err
+		}
+		name := inputDigest(data)[:16] + assetExtension(mediaType)
+		if !r.hasAttachment(name) {
+			r.attachments = append(r.attachments, storageAttachment{name: name, mediaType: mediaType, data: data})
+		}
+		resource = fmt.Sprintf(`<ri:attachment ri:filename="%s" />`, html.EscapeString(name))
+	}
+	r.b.WriteString("<ac:image")
+	if alt != "" {
+		fmt.Fprintf(&r.b, ` ac:alt="%s"`, html.EscapeString(alt))
+	}
+	r.b.WriteString(">" + resource + "</ac:image>")
+	return nil
+}
+
+func (r *storageRenderer) hasAttachment(name string) bool {
+	for _, attachment := range r.attachments {
+		if attachment.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *storageRenderer) inline(nodes []boxnote.Node) error {
+	for _, node := range nodes {
+		switch node.Type {
+		case "text":
+			r.text(node)
+		case "hard_break":
+			r.b.WriteString("<br />")
+		case "image":
+			if err := r.image(node); err != nil {
+				return err
+			}
+		default:
+			if err := r.inline(node.Content); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// text writes a text node with its formatting marks, inside its link.
+// Marks the converter does not support are dropped.
+func (r *storageRenderer) text(node boxnote.Node) {
+	text := html.EscapeString(node.Text)
+	href := ""
+	for _, mark := range node.Marks {
+		switch mark.Type {
+		case "strong":
+			text = "<strong>" + text + "</strong>"
+		case "em":
+			text = "<em>" + text + "</em>"
+		case "underline":
+			text = "<u>" + text + "</u>"
+		case "strikethrough":
+			text = `<span style="text-decoration: line-through;">` + text + "</span>"
+		case "code":
+			text = "<code>" + text + "</code>"
+		case "link":
+			href, _ = mark.Attrs["href"].(string)
+		}
+	}
+	if href != "" && r.rewrite != nil {
+		href = r.rewrite(href)
+	}
+	if href == "" {
+		r.b.WriteString(text)
+		return
+	}
+	if r.pageTitle != nil {
+		if title, ok := r.pageTitle(href); ok {
+			fmt.Fprintf(&r.b, `<ac:link><ri:page ri:content-title="%s" /><ac:link-body>%s</ac:link-body></ac:link>`, html.EscapeString(title), text)
+			return
+		}
+	}
+	fmt.Fprintf(&r.b, `<a href="%s">%s</a>`, html.EscapeString(href), text)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/dayflower/boxnote2md/pkg/boxnote"
+)
+
+func TestStorageFormatNestsSubLists(t *testing.T) {
+	data, err := os.ReadFile("examples/example.boxnote")
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := boxnote.Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := (&storageRenderer{}).storageFormat(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"<ul><li><p>Unordered list</p><ul><li><p>Level 2</p><ul><li><p>Level 3</p>",
+		"<li><p>Level 3</p><ul><li><p>Unordered Level 4</p><ol><li><p>Level 5</p></li></ol></li>",
+		"<ac:task-body>Checked<ac:task-list><ac:task><ac:task-status>incomplete</ac:task-status><ac:task-body>Nested<ul>",
+		"<ac:task-body>Item<ol><li><p>Ordered</p><ac:task-list>",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("storage format lacks %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestStorageFormatRejectsBadInlineImage(t *testing.T) {
+	doc, err := boxnote.Parse([]byte(`{"doc":{"type":"doc","content":[{"type":"paragraph","content":[
+		{"type":"text","text":"see "},
+		{"type":"image","attrs":{"src":"data:image/png;base64,@@@"}}]}]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, err := (&storageRenderer{}).storageFormat(doc); err == nil {
+		t.Errorf("storage format of a malformed data URI succeeded: %s", body)
+	}
+}
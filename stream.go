@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/dayflower/boxnote2md/pkg/boxnote"
+)
+
+// streamConflict returns the first flag given alongside --stream that
+// needs the whole note before its first block is written.
+func streamConflict(opts options) string {
+	switch {
+	case !opts.stream:
+		return ""
+	case opts.validate:
+		return "--validate"
+	case opts.sidecar:
+		return "--sidecar"
+	case opts.stripHashtags:
+		return "--strip-hashtags"
+	case opts.frontMatter != frontMatterNone:
+		return "--front-matter"
+	case opts.contributors != contributorsNone:
+		return "--contributors"
+	case opts.titleFrom == titleFromFirstHeading:
+		return "--title-from " + titleFromFirstHeading
+	case opts.marker:
+		return "--marker"
+	case opts.skipUnchanged:
+		return "--skip-unchanged"
+	case opts.markdown.toc > 0:
+		return "--toc"
+	case opts.section != "":
+		return "--section"
+	case opts.sectionFrom != "" || opts.sectionTo != "":
+		return "--from and --to"
+	case opts.splitBy != splitNone:
+		return "--split-by"
+	case opts.merge != "":
+		return "--merge"
+	}
+	return ""
+}
+
+// streamMeta settles the title mode of a streamed note, whose headings are
+// not known in advance.
+func streamMeta(meta noteMeta, opts options) *noteMeta {
+	meta.titleMode = opts.titleMode
+	if opts.titleFrom == titleFromFrontMatterOnly {
+		meta.titleMode = titleModeFrontMatter
+	}
+	return &meta
+}
+
+// streamNote renders the note read from r into w block by block.
+func streamNote(ctx context.Context, w io.Writer, r io.Reader, meta *noteMeta, opts options) ([]boxnote.Warning, error) {
+	convertOpts, images := noteOptions(ctx, meta, opts)
+	warnings, err := boxnote.RenderStream(ctx, w, r, convertOpts...)
+	if err != nil {
+		return warnings, err
+	}
+	if images.err != nil {
+		return warnings, images.err
+	}
+	footer, err := renderFooter(*meta, opts)
+	if err == nil && footer != "" {
+		_, err = io.WriteString(w, "\n\n"+footer)
+	}
+	return warnings, err
+}
+
+func streamStdin(ctx context.Context, opts options) (fileResult, error) {
+	var result fileResult
+	ctx, cancel := withTimeout(ctx, opts.timeout)
+	defer cancel()
+	input := &countingReader{r: os.Stdin}
+	stdout := bufio.NewWriter(os.Stdout)
+	output := &finishingWriter{w: stdout, eol: opts.eol}
+	warnings, err := streamNote(ctx, output, input, streamMeta(noteMeta{title: opts.title}, opts), opts)
+	result.Warnings = warnings
+	result.InputBytes = input.n
+	if err == nil {
+		err = output.Close()
+	}
+	if err == nil {
+		err = stdout.Flush()
+	}
+	result.OutputBytes = output.n
+	if err != nil {
+		return result, renderFailure(err)
+	}
+	if opts.strict && len(warnings) > 0 {
+		printWarnings(stdinName, warnings)
+		return result, &exitError{code: exitWarnings, err: fmt.Errorf("%d conversion warning(s)", len(warnings))}
+	}
+	printUnknown(stdinName, warnings)
+	printSanitized(stdinName, warnings)
+	return result, nil
+}
+
+// streamToFile is convertToFile for --stream: the note is read from
+// inputPath and rendered into the temporary output as it is decoded.
+func streamToFile(ctx context.Context, inputPath string, meta noteMeta, outputPath string, opts options) (fileResult, error) {
+	result := fileResult{OutputPath: outputPath}
+	if err := prepareOverwrite(outputPath, opts); err != nil {
+		return result, err
+	}
+	file, err := os.Open(inputPath)
+	if err != nil {
+		return result, &exitError{code: exitIO, err: fmt.Errorf("failed to read: %w", err)}
+	}
+	defer file.Close()
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return result, &exitError{code: exitIO, err: fmt.Errorf("failed to create output directory: %w", err)}
+	}
+
+	ctx, cancel := withTimeout(ctx, opts.timeout)
+	defer cancel()
+	input := &countingReader{r: file}
+	note := streamMeta(meta, opts)
+	note.outputPath = outputPath
+	var renderErr error
+	strictFailed := false
+	err = writeFileAtomicFunc(outputPath, 0644, opts.fsync, func(w io.Writer) error {
+		buffered := bufio.NewWriter(w)
+		output := &finishingWriter{w: buffered, eol: opts.eol}
+		defer func() { result.OutputBytes = output.n }()
+		result.Warnings, renderErr = streamNote(ctx, output, input, note, opts)
+		if renderErr != nil {
+			return renderErr
+		}
+		if opts.strict && len(result.Warnings) > 0 {
+			// Fail before the output is renamed into place.
+			strictFailed = true
+			return fmt.Errorf("%d conversion warning(s)", len(result.Warnings))
+		}
+		if err := output.Close(); err != nil {
+			return err
+		}
+		return buffered.Flush()
+	})
+	result.InputBytes = input.n
+	switch {
+	case strictFailed:
+		printWarnings(meta.source, result.Warnings)
+		return result, &exitError{code: exitWarnings, err: err}
+	case renderErr != nil:
+		return result, renderFailure(renderErr)
+	case err != nil:
+		return result, &exitError{code: exitIO, err: fmt.Errorf("failed to write: %w", err)}
+	}
+	printUnknown(meta.source, result.Warnings)
+	printSanitized(meta.source, result.Warnings)
+	opts.commit.addOutput(outputPath, inputPath, "")
+	opts.manifest.record(meta, "", outputPath, opts)
+	return result, nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
+
+// finishingWriter applies finishOutput to a stream: trailing newlines are
+// held back until more text follows, and Close ends the output with
+// exactly one.
+type finishingWriter struct {
+	w   io.Writer
+	eol string
+	// newlines counts the held-back newlines; cr is set after a \r that
+	// may start a \r\n.
+	newlines int
+	cr       bool
+	wrote    bool
+	// n counts the bytes written to w.
+	n int
+}
+
+func (f *finishingWriter) Write(p []byte) (int, error) {
+	buf := make([]byte, 0, len(p)+8)
+	for _, c := range p {
+		if f.cr {
+			f.cr = false
+			if c != '\n' {
+				buf = f.text(buf, '\r')
+			}
+		}
+		switch c {
+		case '\r':
+			f.cr = true
+		case '\n':
+			f.newlines++
+		default:
+			buf = f.text(buf, c)
+		}
+	}
+	if err := f.flush(buf); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// text appends c to buf after the newlines held back before it.
+func (f *finishingWriter) text(buf []byte, c byte) []byte {
+	for ; f.newlines > 0; f.newlines-- {
+		buf = append(buf, f.newline()...)
+	}
+	f.wrote = true
+	return append(buf, c)
+}
+
+func (f *finishingWriter) newline() string {
+	if f.eol == eolCRLF {
+		return "\r\n"
+	}
+	return "\n"
+}
+
+func (f *finishingWriter) flush(buf []byte) error {
+	n, err := f.w.Write(buf)
+	f.n += n
+	return err
+}
+
+// Close writes the final newline of a non-empty output.
+func (f *finishingWriter) Close() error {
+	var buf []byte
+	if f.cr {
+		f.cr = false
+		buf = f.text(buf, '\r')
+	}
+	if f.wrote {
+		buf = append(buf, f.newline()...)
+	}
+	return f.flush(buf)
+}
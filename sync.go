@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// syncStateName is the state file of sync inside --out-dir, unless --state
+// names another.
+const syncStateName = ".boxnotes2md-sync.json"
+
+// runSync mirrors the notes below a Box folder into --out-dir. The state
+// file is a --manifest: the notes whose modification time and output are
+// unchanged since the run that recorded them are not downloaded again.
+// With --interval, the folder is synced again until interrupted.
+func runSync(ctx context.Context, opts *options, args []string) int {
+	if opts.syncFolder == "" || len(args) > 0 {
+		fmt.Fprintf(os.Stderr, "usage: %s sync [flags] --folder <id> --out-dir <dir>\n", programName)
+		return exitUsage
+	}
+	if strings.Contains(opts.outDir, "://") {
+		fmt.Fprintln(os.Stderr, "sync needs a local --out-dir")
+		return exitUsage
+	}
+	if opts.manifestPath == "" {
+		opts.manifestPath = filepath.Join(opts.outDir, syncStateName)
+	}
+	client, err := newAuthenticatedBoxClient(*opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	if err := prepareAuthors(opts, client); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitIO
+	}
+	if opts.syncInterval <= 0 {
+		return syncFolder(ctx, client, *opts)
+	}
+	ticker := time.NewTicker(opts.syncInterval)
+	defer ticker.Stop()
+	for {
+		syncFolder(ctx, client, *opts)
+		select {
+		case <-ctx.Done():
+			return exitOK
+		case <-ticker.C:
+		}
+	}
+}
+
+// syncFolder runs one pass of sync. opts is a copy, since a pass sets up
+// its own collectors.
+func syncFolder(ctx context.Context, client *boxClient, opts options) int {
+	opts.forceOverwrite = true
+	opts.commit = newMigrationCommit(opts)
+	if opts.assetManifestPath != "" {
+		opts.assetManifest = newAssetManifest()
+	}
+	if opts.checkLinks {
+		opts.linkCheck = newLinkChecker(opts.checkExternal)
+	}
+	opts.noteLinks = newNoteLinks()
+	if err := prepareManifest(&opts); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to read sync state: %v\n", err)
+		return exitIO
+	}
+
+	// A listing that fails part way is not a sync: notes missing from it
+	// must not be taken for deleted ones.
+	listCtx, cancel := withTimeout(ctx, opts.timeout)
+	notes, err := walkBoxFolder(listCtx, client, opts.syncFolder, "")
+	cancel()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to list folder %s: %v\n", opts.syncFolder, err)
+		return exitIO
+	}
+
+	paths := make([]string, len(notes))
+	names := make([]string, len(notes))
+	for i, note := range notes {
+		target := filepath.Join(opts.outDir, note.dir, filepath.Base(note.file.Name))
+		outputPath, err := resolveOutputPath(target, newNameFields(target, note.file.ModifiedAt, i+1), opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", syncName(note), err)
+			return exitUsage
+		}
+		paths[i], names[i] = outputPath, syncName(note)
+	}
+	planned, collisions := planOutputs(paths, names, opts.onCollision)
+	for _, collision := range collisions {
+		reportError(collision.second, collision)
+	}
+	if len(collisions) > 0 {
+		fmt.Fprintf(os.Stderr, "%d output collision(s); use --on-collision %s\n", len(collisions), collisionNumber)
+		return exitFailure
+	}
+	listed := map[string]bool{}
+	// outputs holds the outputs of this pass, which --delete leaves alone
+	// even when a note removed or moved away wrote the same path before.
+	outputs := map[string]bool{}
+	for i, note := range notes {
+		listed[note.file.ID] = true
+		outputs[filepath.Clean(planned[i])] = true
+		opts.noteLinks.add(note.file, planned[i])
+	}
+
+	exitCode := exitOK
+	var updated, unchanged, removed, failed int
+	for i, note := range notes {
+		previous := opts.manifest.boxNote(note.file.ID)
+		if isSynced(previous, note.file, planned[i], opts.manifest) {
+			unchanged++
+			continue
+		}
+		previousOutput := ""
+		if previous != nil {
+			// The entry is updated in place by the conversion.
+			previousOutput = opts.manifest.path(previous.Output)
+		}
+		if _, err := fetchNote(ctx, client, note.file, planned[i], opts); err != nil {
+			reportError(syncName(note), err)
+			failed++
+			if exitCode == exitOK {
+				exitCode = exitFailure
+				if opts.strict {
+					exitCode = exitCodeFor(err)
+				}
+			}
+			continue
+		}
+		reportOK(syncName(note))
+		updated++
+		// A renamed or moved note leaves its previous output behind.
+		if opts.syncDelete && previousOutput != "" && !outputs[filepath.Clean(previousOutput)] {
+			removeSyncOutput(previousOutput, opts)
+		}
+	}
+	if opts.syncDelete {
+		for _, note := range append([]*manifestNote(nil), opts.manifest.Notes...) {
+			if note.BoxFileID == "" || listed[note.BoxFileID] {
+				continue
+			}
+			if path := opts.manifest.path(note.Output); !outputs[filepath.Clean(path)] {
+				removeSyncOutput(path, opts)
+			}
+			opts.manifest.remove(note)
+			removed++
+		}
+	}
+	fmt.Fprintf(os.Stderr, "synced folder %s: %d updated, %d unchanged, %d removed, %d failed\n", opts.syncFolder, updated, unchanged, removed, failed)
+
+	writeAssetManifest(opts.assetManifestPath, opts.assetManifest)
+	writeManifest(opts.manifestPath, opts.manifest)
+	return commitOutputs(&opts, checkLinks(ctx, &opts, exitCode))
+}
+
+// isSynced reports whether the output of file recorded by an earlier run is
+// still current: the note has not been modified since, and its output is
+// where it would be written now.
+func isSynced(previous *manifestNote, file boxFile, outputPath string, manifest *conversionManifest) bool {
+	if previous == nil || previous.Modified == "" {
+		return false
+	}
+	if previous.Modified != file.ModifiedAt.UTC().Format(time.RFC3339) {
+		return false
+	}
+	return filepath.Clean(manifest.path(previous.Output)) == filepath.Clean(outputPath) && exists(outputPath)
+}
+
+// removeSyncOutput deletes the output of a note removed from Box, or moved
+// away from path, for --delete, with the folders below --out-dir it leaves
+// empty.
+func removeSyncOutput(path string, opts options) {
+	if err := os.Remove(path); err != nil {
+		if !os.IsNotExist(err) {
+			reportError(path, err)
+		}
+		return
+	}
+	opts.commit.add(path)
+	reportRemoved(path)
+	root := filepath.Clean(opts.outDir)
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		rel, err := filepath.Rel(root, dir)
+		if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return
+		}
+		if os.Remove(dir) != nil {
+			return
+		}
+	}
+}
+
+func syncName(note folderNote) string {
+	return filepath.ToSlash(filepath.Join(note.dir, note.file.Name))
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/dayflower/boxnote2md/pkg/boxnote"
+)
+
+const (
+	todosMarkdown = "markdown"
+	todosCSV      = "csv"
+)
+
+var todosFormatChoices = []string{todosMarkdown, todosCSV}
+
+// noteTodo is a check list item found by the todos command.
+type noteTodo struct {
+	file     string
+	path     string
+	checked  bool
+	text     string
+	assignee string
+	due      string
+}
+
+func runTodos(ctx context.Context, opts *options, args []string) int {
+	var todos []noteTodo
+	exitCode := exitOK
+	if len(args) == 0 {
+		input, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to read stdin: %v\n", err)
+			return exitIO
+		}
+		todos, exitCode = appendNoteTodos(todos, stdinName, input)
+	}
+	for _, input := range collectInputs(args, opts.recursive) {
+		code := exitOK
+		data, err := os.ReadFile(input.Path)
+		if err != nil {
+			reportError(input.Path, fmt.Errorf("failed to read: %w", err))
+			code = exitIO
+		} else {
+			todos, code = appendNoteTodos(todos, input.Path, data)
+		}
+		if exitCode == exitOK {
+			exitCode = code
+		}
+	}
+	if opts.todosOpen {
+		open := todos[:0]
+		for _, todo := range todos {
+			if !todo.checked {
+				open = append(open, todo)
+			}
+		}
+		todos = open
+	}
+
+	var err error
+	if opts.todosFormat == todosCSV {
+		err = writeTodosCSV(os.Stdout, todos)
+	} else {
+		err = writeTodosMarkdown(os.Stdout, todos)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write: %v\n", err)
+		return exitIO
+	}
+	return exitCode
+}
+
+// appendNoteTodos appends the check list items of the note read from source.
+func appendNoteTodos(todos []noteTodo, source string, input []byte) ([]noteTodo, int) {
+	if len(strings.TrimSpace(string(input))) == 0 {
+		return todos, exitOK
+	}
+	doc, err := boxnote.Parse(input)
+	if err != nil {
+		reportError(source, err)
+		return todos, exitParse
+	}
+	boxnote.Walk(doc, boxnote.Visitor{
+		Enter: func(node *boxnote.Node, path []int) boxnote.Action {
+			if node.Type != "check_list_item" {
+				return boxnote.Continue
+			}
+			checked, _ := node.Attrs["checked"].(bool)
+			todos = append(todos, noteTodo{
+				file:     source,
+				path:     boxnote.FormatPath(path),
+				checked:  checked,
+				text:     todoText(*node),
+				assignee: boxnote.TaskAssignee(*node),
+				due:      boxnote.TaskDue(*node),
+			})
+			return boxnote.Continue
+		},
+	})
+	return todos, exitOK
+}
+
+// todoText is the text of an item's own blocks; its nested lists are items
+// of their own.
+func todoText(item boxnote.Node) string {
+	var parts []string
+	for _, child := range item.Content {
+		switch child.Type {
+		case "bullet_list", "ordered_list", "check_list":
+			continue
+		}
+		if text := strings.Join(strings.Fields(boxnote.PlainText(child)), " "); text != "" {
+			parts = append(parts, text)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// writeTodosMarkdown writes the items as one task list per note.
+func writeTodosMarkdown(w io.Writer, todos []noteTodo) error {
+	var b strings.Builder
+	for i, todo := range todos {
+		if i == 0 || todo.file != todos[i-1].file {
+			if i > 0 {
+				b.WriteString("\n")
+			}
+			fmt.Fprintf(&b, "## %s\n\n", todo.file)
+		}
+		box := "[ ]"
+		if todo.checked {
+			box = "[x]"
+		}
+		fmt.Fprintf(&b, "- %s %s", box, todo.text)
+		var details []string
+		if todo.assignee != "" {
+			details = append(details, "@"+todo.assignee)
+		}
+		if todo.due != "" {
+			details = append(details, "due "+todo.due)
+		}
+		if len(details) > 0 {
+			fmt.Fprintf(&b, " (%s)", strings.Join(details, ", "))
+		}
+		b.WriteString("\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeTodosCSV(w io.Writer, todos []noteTodo) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"file", "path", "checked", "text", "assignee", "due"})
+	for _, todo := range todos {
+		cw.Write([]string{todo.file, todo.path, strconv.FormatBool(todo.checked), todo.text, todo.assignee, todo.due})
+	}
+	cw.Flush()
+	return cw.Error()
+}
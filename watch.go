@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// runWatch polls the given files and directories and converts every
+// .boxnote whose contents changed. Outputs are always overwritten.
+func runWatch(ctx context.Context, opts *options, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, "usage: %s watch [flags] <file.boxnote|dir>...\n", programName)
+		return exitUsage
+	}
+	if opts.watchInterval <= 0 {
+		fmt.Fprintln(os.Stderr, "watch interval must be positive")
+		return exitUsage
+	}
+	if flag := streamConflict(*opts); flag != "" {
+		fmt.Fprintf(os.Stderr, "--stream cannot be combined with %s\n", flag)
+		return exitUsage
+	}
+
+	if err := prepareAuthors(opts, nil); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitIO
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	convertOpts := *opts
+	convertOpts.forceOverwrite = true
+	if opts.assetManifestPath != "" {
+		convertOpts.assetManifest = newAssetManifest()
+	}
+	if err := prepareManifest(&convertOpts); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to read manifest: %v\n", err)
+		return exitIO
+	}
+
+	stamps := map[string]fileStamp{}
+	first := true
+	ticker := time.NewTicker(opts.watchInterval)
+	defer ticker.Stop()
+	for {
+		for i, input := range collectInputs(args, true) {
+			if ctx.Err() != nil {
+				return exitOK
+			}
+			inputPath := input.Path
+			info, err := os.Stat(inputPath)
+			if err != nil {
+				continue
+			}
+			stamp := fileStamp{modTime: info.ModTime(), size: info.Size()}
+			previous, seen := stamps[inputPath]
+			stamps[inputPath] = stamp
+			if seen && previous == stamp {
+				continue
+			}
+			if first && isUpToDate(input, i+1, info, convertOpts) {
+				continue
+			}
+			if _, err := processFile(ctx, input, i+1, convertOpts); err != nil {
+				reportError(inputPath, err)
+				continue
+			}
+			reportOK(inputPath)
+		}
+		first = false
+		writeAssetManifest(opts.assetManifestPath, convertOpts.assetManifest)
+		writeManifest(opts.manifestPath, convertOpts.manifest)
+
+		select {
+		case <-ctx.Done():
+			return exitOK
+		case <-ticker.C:
+		}
+	}
+}
+
+// isUpToDate reports whether the output for file is newer than the input.
+func isUpToDate(file inputFile, index int, input os.FileInfo, opts options) bool {
+	outputPath, err := resolveOutputPath(placeInput(file, opts.outDir), newNameFields(file.Path, input.ModTime(), index), opts)
+	if err != nil {
+		return false
+	}
+	output, err := os.Stat(outputPath)
+	if err != nil {
+		return false
+	}
+	return !output.ModTime().Before(input.ModTime())
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/dayflower/boxnote2md/pkg/boxnote"
+)
+
+// Reading speeds for the estimated reading time: words of space-separated
+// scripts, and characters of Chinese, Japanese, and Korean, per minute.
+const (
+	wordsPerMinute = 200
+	cjkPerMinute   = 500
+)
+
+// textCount measures the text of a note.
+type textCount struct {
+	File string `json:"file,omitempty"`
+	// Words counts each CJK character as a word, as word processors do.
+	Words int `json:"words"`
+	// Characters counts the characters other than whitespace.
+	Characters int `json:"characters"`
+	Headings   int `json:"headings"`
+	// Minutes is the estimated reading time, rounded up.
+	Minutes int `json:"reading_minutes"`
+	// cjk counts the CJK characters among Words.
+	cjk int
+}
+
+// countText measures the text blocks of doc. Text split into several nodes
+// by formatting counts as the text of its block.
+func countText(doc *boxnote.Document) textCount {
+	var c textCount
+	boxnote.Walk(doc, boxnote.Visitor{
+		Enter: func(node *boxnote.Node, path []int) boxnote.Action {
+			if node.Type == "heading" {
+				c.Headings++
+			}
+			if hasTextChild(*node) {
+				c.add(boxnote.PlainText(*node))
+			}
+			return boxnote.Continue
+		},
+	})
+	c.Minutes = readingMinutes(c.Words-c.cjk, c.cjk)
+	return c
+}
+
+func (c *textCount) add(text string) {
+	inWord := false
+	for _, r := range text {
+		switch {
+		case unicode.IsSpace(r):
+			inWord = false
+			continue
+		case isCJK(r):
+			c.Words++
+			c.cjk++
+			inWord = false
+		case !inWord:
+			c.Words++
+			inWord = true
+		}
+		c.Characters++
+	}
+}
+
+// isCJK reports whether r is written without spaces between words.
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+func readingMinutes(words, cjk int) int {
+	minutes := float64(words)/wordsPerMinute + float64(cjk)/cjkPerMinute
+	return int(math.Ceil(minutes))
+}
+
+func (c *textCount) total(other textCount) {
+	c.Words += other.Words
+	c.Characters += other.Characters
+	c.Headings += other.Headings
+	c.cjk += other.cjk
+	c.Minutes = readingMinutes(c.Words-c.cjk, c.cjk)
+}
+
+func runWordCount(ctx context.Context, opts *options, args []string) int {
+	var counts []textCount
+	exitCode := exitOK
+	if len(args) == 0 {
+		input, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to read stdin: %v\n", err)
+			return exitIO
+		}
+		counts, exitCode = appendTextCount(counts, stdinName, input)
+	}
+	for _, input := range collectInputs(args, opts.recursive) {
+		code := exitOK
+		data, err := os.ReadFile(input.Path)
+		if err != nil {
+			reportError(input.Path, fmt.Errorf("failed to read: %w", err))
+			code = exitIO
+		} else {
+			counts, code = appendTextCount(counts, input.Path, data)
+		}
+		if exitCode == exitOK {
+			exitCode = code
+		}
+	}
+	if opts.wcJSON {
+		if counts == nil {
+			counts = []textCount{}
+		}
+		data, err := marshalJSON(counts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to encode counts: %v\n", err)
+			return exitFailure
+		}
+		os.Stdout.Write(data)
+		return exitCode
+	}
+	writeTextCounts(os.Stdout, counts, opts.locale)
+	return exitCode
+}
+
+func appendTextCount(counts []textCount, source string, input []byte) ([]textCount, int) {
+	count := textCount{File: source}
+	if len(strings.TrimSpace(string(input))) > 0 {
+		doc, err := boxnote.Parse(input)
+		if err != nil {
+			reportError(source, err)
+			return counts, exitParse
+		}
+		count = countText(doc)
+		count.File = source
+	}
+	return append(counts, count), exitOK
+}
+
+// writeTextCounts prints a line per note, in the manner of wc(1), and a
+// total line after several notes.
+func writeTextCounts(w io.Writer, counts []textCount, loc locale) {
+	rows := [][]string{{"words", "chars", "headings", "minutes", ""}}
+	var total textCount
+	for _, c := range counts {
+		rows = append(rows, textCountRow(c, c.File, loc))
+		total.total(c)
+	}
+	if len(counts) > 1 {
+		rows = append(rows, textCountRow(total, "total", loc))
+	}
+	widths := make([]int, 4)
+	for _, row := range rows {
+		for i := range widths {
+			if n := displayWidth(row[i]); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+	for _, row := range rows {
+		line := fmt.Sprintf("%*s  %*s  %*s  %*s  %s", widths[0], row[0], widths[1], row[1], widths[2], row[2], widths[3], row[3], row[4])
+		fmt.Fprintln(w, strings.TrimRight(line, " "))
+	}
+}
+
+func textCountRow(c textCount, name string, loc locale) []string {
+	n := func(v int) string { return loc.formatNumber(int64(v)) }
+	return []string{n(c.Words), n(c.Characters), n(c.Headings), n(c.Minutes), name}
+}